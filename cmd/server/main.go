@@ -9,12 +9,14 @@ import (
 	"github.com/hibiken/asynq"
 	"github.com/majingzhen/prism/internal/api"
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/service"
 	"github.com/majingzhen/prism/internal/worker"
 	"github.com/majingzhen/prism/pkg/cache"
 	"github.com/majingzhen/prism/pkg/config"
 	"github.com/majingzhen/prism/pkg/database"
 	"github.com/majingzhen/prism/pkg/logger"
 	"github.com/majingzhen/prism/pkg/queue"
+	"github.com/majingzhen/prism/pkg/secret"
 	"github.com/majingzhen/prism/pkg/storage"
 )
 
@@ -66,6 +68,11 @@ func main() {
 		log.Fatalf("failed to init logger: %v", err)
 	}
 
+	// 加载渠道账号密钥的主密钥
+	if err := secret.Init(); err != nil {
+		log.Fatalf("failed to init secrets: %v", err)
+	}
+
 	// 连接数据库
 	db, err := database.Connect()
 	if err != nil {
@@ -78,6 +85,26 @@ func main() {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
 
+	// 加密明文保存的渠道账号密钥，轮换主密钥后重新加密数据密钥
+	if err := service.ReencryptAccountSecrets(); err != nil {
+		log.Fatalf("failed to encrypt channel account secrets: %v", err)
+	}
+
+	// 明文保存的旧 API 密钥转为摘要
+	if err := service.NewTokenKeyService().MigrateKeys(); err != nil {
+		log.Fatalf("failed to migrate token keys: %v", err)
+	}
+
+	// 令牌余额并入用户钱包，剩余余额转为令牌预算
+	if err := service.NewBillingService().MigrateWallet(); err != nil {
+		log.Fatalf("failed to migrate token balances: %v", err)
+	}
+
+	// 首次启用账务流水时补记已有余额
+	if err := service.NewBillingService().OpenLedger(); err != nil {
+		log.Fatalf("failed to open billing ledger: %v", err)
+	}
+
 	// 初始化缓存
 	if err := cache.Init(); err != nil {
 		log.Fatalf("failed to init cache: %v", err)
@@ -143,6 +170,18 @@ func startScheduler() {
 		log.Fatalf("failed to register timeout check task: %v", err)
 	}
 
+	// 每小时清理一次过期的存储资源
+	_, err = scheduler.Register("0 * * * *", worker.NewAssetCleanupTask())
+	if err != nil {
+		log.Fatalf("failed to register asset cleanup task: %v", err)
+	}
+
+	// 每天核对一次余额与账务流水
+	_, err = scheduler.Register("30 3 * * *", worker.NewBillingReconcileTask())
+	if err != nil {
+		log.Fatalf("failed to register billing reconcile task: %v", err)
+	}
+
 	logger.Info("scheduler starting...")
 	if err := scheduler.Run(); err != nil {
 		log.Fatalf("failed to start scheduler: %v", err)
@@ -221,8 +221,8 @@ const AccountModal: React.FC<{
               value={form.api_key}
               onChange={e => setForm({ ...form, api_key: e.target.value })}
               className="w-full px-3 py-2 border border-gray-200 rounded-lg focus:outline-none focus:ring-2 focus:ring-indigo-500"
-                placeholder="输入 API Key"
-                required
+                placeholder={account ? '已脱敏显示，不修改请保持原样' : '输入 API Key'}
+                required={!account}
             />
           </div>
           <div>
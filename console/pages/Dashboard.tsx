@@ -3,7 +3,7 @@ import {
   XAxis, YAxis, CartesianGrid, Tooltip, ResponsiveContainer,
   PieChart, Pie, Cell, AreaChart, Area
 } from 'recharts';
-import { TrendingUp, Activity, AlertCircle, DollarSign, ArrowUpRight, ArrowDownRight, RefreshCw } from 'lucide-react';
+import { TrendingUp, Activity, AlertCircle, DollarSign, ArrowUpRight, ArrowDownRight, RefreshCw, Wallet } from 'lucide-react';
 import { fetchDashboardStats } from '../services/api';
 import { DashboardStats } from '../types';
 
@@ -50,7 +50,7 @@ const Dashboard: React.FC = () => {
     );
   }
 
-  const { today, weekly_trend, capability_dist } = stats;
+  const { today, wallet, weekly_trend, capability_dist } = stats;
     const formatShortDate = (date: Date) => {
         const month = String(date.getMonth() + 1).padStart(2, '0');
         const day = String(date.getDate()).padStart(2, '0');
@@ -139,6 +139,27 @@ const Dashboard: React.FC = () => {
         </div>
       </div>
 
+      {/* 钱包 */}
+      {wallet && (
+        <div className="bg-white p-6 rounded-2xl shadow-sm border border-gray-100 grid grid-cols-1 md:grid-cols-3 gap-6">
+          <div className="flex items-center gap-4">
+            <div className="p-3 bg-green-50 rounded-xl"><Wallet className="text-green-600" /></div>
+            <div>
+              <p className="text-sm text-gray-500 font-medium">钱包余额</p>
+              <h3 className="text-2xl font-bold text-gray-900 mt-1">¥{wallet.balance.toFixed(2)}</h3>
+            </div>
+          </div>
+          <div>
+            <p className="text-sm text-gray-500 font-medium">今日净消费</p>
+            <h3 className="text-2xl font-bold text-gray-900 mt-1">¥{wallet.today_spent.toFixed(2)}</h3>
+          </div>
+          <div>
+            <p className="text-sm text-gray-500 font-medium">本月净消费</p>
+            <h3 className="text-2xl font-bold text-gray-900 mt-1">¥{wallet.month_spent.toFixed(2)}</h3>
+          </div>
+        </div>
+      )}
+
       {/* Main Chart */}
       <div className="grid grid-cols-1 lg:grid-cols-3 gap-6">
         <div className="lg:col-span-2 bg-white p-8 rounded-2xl shadow-sm border border-gray-100">
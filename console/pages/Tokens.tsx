@@ -8,7 +8,6 @@ import {
     AlertCircle,
     X,
     Wallet,
-    PlusCircle,
     Edit2,
     ChevronUp,
     ChevronDown
@@ -17,7 +16,6 @@ import {
     fetchTokens,
     createToken,
     deleteToken,
-    rechargeToken,
     getToken,
     updateToken,
     fetchAllCapabilityChannels
@@ -25,22 +23,26 @@ import {
 import {ApiToken, ChannelPriorityItem, CapabilityWithChannels, ChannelOption} from '../types';
 import { STATUS_COLORS, STATUS_LABELS } from '../constants';
 
+// parseBudget 预算输入留空表示不限制
+const parseBudget = (value: string): number | null => {
+    return value.trim() === '' ? null : parseFloat(value);
+};
+
 const Tokens: React.FC = () => {
   const [tokens, setTokens] = useState<ApiToken[]>([]);
   const [isLoading, setIsLoading] = useState(true);
-  const [copiedId, setCopiedId] = useState<string | null>(null);
   const [showCreateModal, setShowCreateModal] = useState(false);
   const [newTokenName, setNewTokenName] = useState('');
-    const [newTokenBalance, setNewTokenBalance] = useState<string>('');
+    const [newTokenBudget, setNewTokenBudget] = useState<string>('');
   const [newTokenKey, setNewTokenKey] = useState('');
   const [isCreating, setIsCreating] = useState(false);
 
-    // 充值相关状态
-    const [showRechargeModal, setShowRechargeModal] = useState(false);
-    const [rechargeTokenId, setRechargeTokenId] = useState<string>('');
-    const [rechargeTokenName, setRechargeTokenName] = useState<string>('');
-    const [rechargeAmount, setRechargeAmount] = useState<string>('');
-    const [isRecharging, setIsRecharging] = useState(false);
+    // 预算相关状态
+    const [showBudgetModal, setShowBudgetModal] = useState(false);
+    const [budgetTokenId, setBudgetTokenId] = useState<string>('');
+    const [budgetTokenName, setBudgetTokenName] = useState<string>('');
+    const [budgetLimit, setBudgetLimit] = useState<string>('');
+    const [isSavingBudget, setIsSavingBudget] = useState(false);
 
     // 编辑相关状态
     const [showEditModal, setShowEditModal] = useState(false);
@@ -66,18 +68,12 @@ const Tokens: React.FC = () => {
     loadTokens();
   }, []);
 
-  const handleCopy = (id: string, key: string) => {
-    navigator.clipboard.writeText(key);
-    setCopiedId(id);
-    setTimeout(() => setCopiedId(null), 2000);
-  };
-
   const handleCreate = async () => {
     if (!newTokenName.trim()) return;
     setIsCreating(true);
     try {
-        const balance = parseFloat(newTokenBalance) || 0;
-        const result = await createToken(newTokenName, balance, createChannelPriorities.length > 0 ? createChannelPriorities : undefined);
+        const budget = parseBudget(newTokenBudget);
+        const result = await createToken(newTokenName, budget, createChannelPriorities.length > 0 ? createChannelPriorities : undefined);
       setNewTokenKey(result.key);
       loadTokens();
     } catch (err: any) {
@@ -97,28 +93,29 @@ const Tokens: React.FC = () => {
     }
   };
 
-    const openRechargeModal = (token: ApiToken) => {
-        setRechargeTokenId(token.id);
-        setRechargeTokenName(token.name);
-        setRechargeAmount('');
-        setShowRechargeModal(true);
+    const openBudgetModal = (token: ApiToken) => {
+        setBudgetTokenId(token.id);
+        setBudgetTokenName(token.name);
+        setBudgetLimit(token.budgetLimit !== null ? String(token.budgetLimit) : '');
+        setShowBudgetModal(true);
     };
 
-    const handleRecharge = async () => {
-        const amount = parseFloat(rechargeAmount);
-        if (!amount || amount <= 0) {
-            alert('请输入有效的充值金额');
+    // 预算留空时不限制，令牌可使用钱包全部余额；填 0 表示停止消费
+    const handleSaveBudget = async () => {
+        const limit = parseBudget(budgetLimit);
+        if (limit !== null && (isNaN(limit) || limit < 0)) {
+            alert('请输入有效的预算金额');
             return;
         }
-        setIsRecharging(true);
+        setIsSavingBudget(true);
         try {
-            await rechargeToken(rechargeTokenId, amount);
+            await updateToken(budgetTokenId, {budgetLimit: limit});
             loadTokens();
-            setShowRechargeModal(false);
+            setShowBudgetModal(false);
         } catch (err: any) {
-            alert(err.message || '充值失败');
+            alert(err.message || '保存失败');
         } finally {
-            setIsRecharging(false);
+            setIsSavingBudget(false);
         }
     };
 
@@ -244,7 +241,7 @@ const Tokens: React.FC = () => {
     const closeModal = () => {
         setShowCreateModal(false);
         setNewTokenName('');
-        setNewTokenBalance('');
+        setNewTokenBudget('');
         setNewTokenKey('');
         setCreateChannelPriorities([]);
         setShowChannelConfig(false);
@@ -416,13 +413,7 @@ const Tokens: React.FC = () => {
                   )}
               </div>
               <div className="flex items-center gap-2 text-sm text-gray-400 font-mono">
-                <code>{token.key}</code>
-                <button
-                  onClick={() => handleCopy(token.id, token.key)}
-                  className={`p-1 rounded hover:bg-gray-100 transition-colors ${copiedId === token.id ? 'text-green-500' : 'text-gray-400'}`}
-                >
-                  {copiedId === token.id ? <CheckCircle2 size={16} /> : <Copy size={16} />}
-                </button>
+                <code>{token.keyPrefix}…</code>
               </div>
             </div>
 
@@ -430,9 +421,11 @@ const Tokens: React.FC = () => {
                   <div className="text-center">
                       <div className="flex items-center gap-1 text-[10px] font-bold text-gray-400 uppercase mb-1">
                           <Wallet size={12}/>
-                          <span>可用余额</span>
+                          <span>预算剩余</span>
                       </div>
-                      <p className="text-lg font-bold text-green-600">¥{token.balance.toFixed(4)}</p>
+                      <p className="text-lg font-bold text-green-600">
+                          {token.budgetLimit !== null ? `¥${Math.max(token.budgetLimit - token.totalUsed, 0).toFixed(4)}` : '不限'}
+                      </p>
               </div>
                   <div className="text-center">
                       <div className="text-[10px] font-bold text-gray-400 uppercase mb-1">已使用</div>
@@ -449,11 +442,11 @@ const Tokens: React.FC = () => {
                     <Edit2 size={18}/>
                 </button>
                 <button
-                  onClick={() => openRechargeModal(token)}
+                  onClick={() => openBudgetModal(token)}
                   className="p-2 text-gray-400 hover:text-green-500 hover:bg-green-50 rounded-lg"
-                  title="充值"
+                  title="设置预算"
               >
-                  <PlusCircle size={18}/>
+                  <Wallet size={18}/>
               </button>
                 <button
                 onClick={() => handleDelete(token.id, token.name)}
@@ -491,7 +484,7 @@ const Tokens: React.FC = () => {
             {newTokenKey ? (
               <div className="space-y-4">
                 <div className="p-4 bg-green-50 border border-green-200 rounded-xl">
-                    <p className="text-sm text-green-700 mb-2">令牌创建成功!</p>
+                    <p className="text-sm text-green-700 mb-2">令牌创建成功! 密钥只显示这一次，请立即复制保存。</p>
                   <div className="flex items-center gap-2 bg-white p-3 rounded-lg border border-green-200">
                     <code className="flex-1 text-sm font-mono break-all">{newTokenKey}</code>
                     <button
@@ -525,14 +518,14 @@ const Tokens: React.FC = () => {
                   />
                 </div>
                   <div>
-                      <label className="block text-sm font-medium text-gray-700 mb-1">初始余额 (元)</label>
+                      <label className="block text-sm font-medium text-gray-700 mb-1">预算上限 (元)</label>
                       <input
                           type="number"
                           step="0.01"
                           min="0"
-                          value={newTokenBalance}
-                          onChange={e => setNewTokenBalance(e.target.value)}
-                          placeholder="0.00"
+                          value={newTokenBudget}
+                          onChange={e => setNewTokenBudget(e.target.value)}
+                          placeholder="留空不限制，消费从账户余额扣除"
                           className="w-full px-4 py-3 border border-gray-200 rounded-xl focus:outline-none focus:ring-2 focus:ring-indigo-500"
                   />
                 </div>
@@ -593,13 +586,13 @@ const Tokens: React.FC = () => {
         </div>
       )}
 
-        {/* 充值弹窗 */}
-        {showRechargeModal && (
+        {/* 预算弹窗 */}
+        {showBudgetModal && (
             <div className="fixed inset-0 bg-black/50 flex items-center justify-center z-50">
                 <div className="bg-white rounded-2xl p-6 w-full max-w-md shadow-xl">
                     <div className="flex items-center justify-between mb-4">
-                        <h3 className="text-lg font-bold text-gray-900">充值余额</h3>
-                        <button onClick={() => setShowRechargeModal(false)}
+                        <h3 className="text-lg font-bold text-gray-900">设置预算</h3>
+                        <button onClick={() => setShowBudgetModal(false)}
                                 className="p-1 hover:bg-gray-100 rounded-lg">
                             <X size={20} className="text-gray-400"/>
                         </button>
@@ -607,33 +600,34 @@ const Tokens: React.FC = () => {
 
                     <div className="space-y-4">
                         <div className="p-4 bg-gray-50 rounded-xl">
-                            <p className="text-sm text-gray-500">为令牌充值</p>
-                            <p className="text-lg font-bold text-gray-900 mt-1">{rechargeTokenName}</p>
+                            <p className="text-sm text-gray-500">令牌</p>
+                            <p className="text-lg font-bold text-gray-900 mt-1">{budgetTokenName}</p>
                         </div>
                         <div>
-                            <label className="block text-sm font-medium text-gray-700 mb-1">充值金额 (元)</label>
+                            <label className="block text-sm font-medium text-gray-700 mb-1">预算上限 (元)</label>
                             <input
                                 type="number"
                                 step="0.01"
-                                min="0.01"
-                                value={rechargeAmount}
-                                onChange={e => setRechargeAmount(e.target.value)}
-                                placeholder="请输入充值金额"
+                                min="0"
+                                value={budgetLimit}
+                                onChange={e => setBudgetLimit(e.target.value)}
+                                placeholder="留空不限制，0 表示停止消费"
                                 className="w-full px-4 py-3 border border-gray-200 rounded-xl focus:outline-none focus:ring-2 focus:ring-green-500"
                                 autoFocus
                             />
+                            <p className="text-xs text-gray-400 mt-1">令牌累计消费达到预算后停止调用，费用从账户余额扣除</p>
                         </div>
                         <button
-                            onClick={handleRecharge}
-                            disabled={isRecharging || !rechargeAmount || parseFloat(rechargeAmount) <= 0}
+                            onClick={handleSaveBudget}
+                            disabled={isSavingBudget}
                             className="w-full py-3 bg-green-600 text-white rounded-xl font-bold hover:bg-green-700 disabled:opacity-50 flex items-center justify-center gap-2"
                         >
-                            {isRecharging ? (
+                            {isSavingBudget ? (
                                 <div className="animate-spin rounded-full h-5 w-5 border-b-2 border-white"></div>
                             ) : (
                                 <>
-                                    <PlusCircle size={18}/>
-                                    确认充值
+                                    <Wallet size={18}/>
+                                    保存预算
                                 </>
                             )}
                         </button>
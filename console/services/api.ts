@@ -119,8 +119,8 @@ export const fetchTokens = async (): Promise<ApiToken[]> => {
   return data.map(t => ({
     id: String(t.id),
     name: t.name,
-    key: t.key,
-      balance: t.balance,
+    keyPrefix: t.key_prefix,
+      budgetLimit: t.budget_limit,
       totalUsed: t.total_used,
     status: t.status === 1 ? 'active' : 'expired',
       channelPriorities: (t.channel_priorities || []).map((p: any) => ({
@@ -136,8 +136,8 @@ export const getToken = async (id: string): Promise<ApiToken> => {
     return {
         id: String(t.id),
         name: t.name,
-        key: t.key,
-        balance: t.balance,
+        keyPrefix: t.key_prefix,
+        budgetLimit: t.budget_limit,
         totalUsed: t.total_used,
         status: t.status === 1 ? 'active' : 'expired',
         channelPriorities: (t.channel_priorities || []).map((p: any) => ({
@@ -150,10 +150,10 @@ export const getToken = async (id: string): Promise<ApiToken> => {
 
 export const createToken = async (
     name: string,
-    balance: number,
+    budgetLimit: number | null,
     channelPriorities?: ChannelPriorityItem[]
-): Promise<{ id: string; key: string; balance: number }> => {
-    const body: any = {name, balance};
+): Promise<{ id: string; key: string; budgetLimit: number | null }> => {
+    const body: any = {name, budget_limit: budgetLimit};
     if (channelPriorities && channelPriorities.length > 0) {
         body.channel_priorities = channelPriorities.map(p => ({
             capability_code: p.capabilityCode,
@@ -161,25 +161,28 @@ export const createToken = async (
             priority: p.priority,
         }));
     }
-    const data = await request<{ id: number; name: string; key: string; balance: number }>('/tokens', {
+    const data = await request<{ id: number; name: string; key: string; budget_limit: number | null }>('/tokens', {
     method: 'POST',
         body: JSON.stringify(body),
   });
   return {
     id: String(data.id),
     key: data.key,
-      balance: data.balance,
+      budgetLimit: data.budget_limit,
   };
 };
 
 export const updateToken = async (
     id: string,
-    data: { name?: string; channelPriorities?: ChannelPriorityItem[] }
+    data: { name?: string; budgetLimit?: number | null; channelPriorities?: ChannelPriorityItem[] }
 ): Promise<void> => {
     const body: any = {};
     if (data.name) {
         body.name = data.name;
     }
+    if (data.budgetLimit !== undefined) {
+        body.budget_limit = data.budgetLimit;
+    }
     if (data.channelPriorities !== undefined) {
         body.channel_priorities = data.channelPriorities.map(p => ({
             capability_code: p.capabilityCode,
@@ -197,17 +200,6 @@ export const deleteToken = async (id: string): Promise<void> => {
   await request(`/tokens/${id}`, { method: 'DELETE' });
 };
 
-export const rechargeToken = async (id: string, amount: number): Promise<{ id: string; balance: number }> => {
-  const data = await request<{ id: number; balance: number }>(`/tokens/${id}/recharge`, {
-    method: 'POST',
-    body: JSON.stringify({amount}),
-  });
-  return {
-    id: String(data.id),
-    balance: data.balance,
-  };
-};
-
 // 管理员 API - 用户管理
 export const fetchUsers = async (): Promise<User[]> => {
   const data = await request<any[]>('/admin/users');
@@ -90,8 +90,8 @@ export interface ChannelCapability {
 export interface ApiToken {
   id: string;
   name: string;
-  key: string;
-    balance: number;
+  keyPrefix: string;
+    budgetLimit: number | null; // null 表示不限制，消费从用户钱包扣除
     totalUsed: number;
   status: 'active' | 'expired';
   channelPriorities?: ChannelPriorityItem[];
@@ -146,6 +146,12 @@ export interface TaskDetail extends TaskLog {
 }
 
 export interface DashboardStats {
+  // 钱包余额及按账务流水统计的净消费
+  wallet?: {
+    balance: number;
+    today_spent: number;
+    month_spent: number;
+  };
   today: {
     total_requests: number;
     total_cost: number;
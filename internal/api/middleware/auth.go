@@ -1,11 +1,13 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/majingzhen/prism/internal/model"
-	"github.com/majingzhen/prism/pkg/errors"
+	"github.com/majingzhen/prism/internal/service"
+	perrors "github.com/majingzhen/prism/pkg/errors"
 )
 
 const (
@@ -13,29 +15,49 @@ const (
 	ContextKeyToken   = "token"
 )
 
+var (
+	tokenKeyService    = service.NewTokenKeyService()
+	tokenPolicyService = service.NewTokenPolicyService()
+)
+
+// Auth 按密钥摘要校验 API 令牌，并检查令牌的过期时间、来源 IP 白名单和只读限制（只读令牌仅允许 GET 查询）
+// 非查询请求同时检查令牌每分钟请求数
 func Auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenKey := c.GetHeader("Authorization")
 		if tokenKey == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    errors.ErrInvalidToken.Code,
+				"code":    perrors.ErrInvalidToken.Code,
 				"message": "missing authorization header",
 			})
 			c.Abort()
 			return
 		}
-		var token model.Token
-		if err := model.DB().Model(&model.Token{}).Where("`key` = ? AND status = 1", tokenKey).First(&token).Error; err != nil {
+		token, err := tokenKeyService.Authenticate(c.Request.Context(), tokenKey)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    errors.ErrInvalidToken.Code,
-				"message": errors.ErrInvalidToken.Message,
+				"code":    perrors.ErrInvalidToken.Code,
+				"message": perrors.ErrInvalidToken.Message,
 			})
 			c.Abort()
 			return
 		}
+		readOnly := c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead
+		if err := tokenPolicyService.CheckAccess(token, c.ClientIP(), readOnly); err != nil {
+			status, code := TokenPolicyError(err)
+			c.AbortWithStatusJSON(status, gin.H{
+				"code":    code.Code,
+				"message": err.Error(),
+			})
+			return
+		}
+		// 调用类请求按令牌限流，查询请求不计入
+		if !readOnly && !allowRequest(c, token) {
+			return
+		}
 
 		c.Set(ContextKeyTokenID, token.ID)
-		c.Set(ContextKeyToken, &token)
+		c.Set(ContextKeyToken, token)
 		c.Next()
 	}
 }
@@ -53,3 +75,22 @@ func GetToken(c *gin.Context) *model.Token {
 	}
 	return nil
 }
+
+// TokenPolicyError 令牌限制错误对应的 HTTP 状态码和错误码，非令牌限制错误返回 500
+func TokenPolicyError(err error) (int, *perrors.Error) {
+	switch {
+	case errors.Is(err, service.ErrTokenExpired):
+		return http.StatusUnauthorized, perrors.ErrTokenExpired
+	case errors.Is(err, service.ErrTokenReadOnly):
+		return http.StatusForbidden, perrors.ErrTokenReadOnly
+	case errors.Is(err, service.ErrIPNotAllowed):
+		return http.StatusForbidden, perrors.ErrIPNotAllowed
+	case errors.Is(err, service.ErrCapabilityNotAllowed):
+		return http.StatusForbidden, perrors.ErrCapabilityDenied
+	case errors.Is(err, service.ErrModelNotAllowed):
+		return http.StatusForbidden, perrors.ErrModelDenied
+	case errors.Is(err, service.ErrSpendLimitExceeded):
+		return http.StatusForbidden, perrors.ErrSpendLimit
+	}
+	return http.StatusInternalServerError, perrors.ErrInternalError
+}
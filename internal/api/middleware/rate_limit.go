@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/service"
+	perrors "github.com/majingzhen/prism/pkg/errors"
+)
+
+var rateLimitService = service.NewRateLimitService()
+
+// allowRequest 认证通过后检查令牌每分钟请求数，写入 x-ratelimit-*-requests 响应头，超限时返回 429
+// 每分钟 token 数和进行中任务数需要本次请求的预估用量和任务编号，在调用时检查
+func allowRequest(c *gin.Context, token *model.Token) bool {
+	if !rateLimitService.Enabled() {
+		return true
+	}
+	result := rateLimitService.AllowRequest(c.Request.Context(), token.ID, rateLimitService.Limits(token).RPM)
+	SetRateLimitHeaders(c, service.RateLimitRequests, result)
+	if !result.Allowed {
+		RejectRateLimited(c, &service.RateLimitError{Kind: service.RateLimitRequests, Result: result})
+		return false
+	}
+	return true
+}
+
+// SetRateLimitHeaders 写入 x-ratelimit-limit/remaining/reset-{kind} 响应头，不限制时不写入
+func SetRateLimitHeaders(c *gin.Context, kind string, result *service.RateLimitResult) {
+	if result == nil || result.Limit <= 0 {
+		return
+	}
+	c.Header("x-ratelimit-limit-"+kind, strconv.Itoa(result.Limit))
+	c.Header("x-ratelimit-remaining-"+kind, strconv.Itoa(result.Remaining))
+	c.Header("x-ratelimit-reset-"+kind, result.Reset.String())
+}
+
+// RejectRateLimited 返回 429，响应体同时带 OpenAI 格式的 error 对象
+// 无法确定何时恢复时（如进行中的任务数）Retry-After 为 1 秒
+func RejectRateLimited(c *gin.Context, err *service.RateLimitError) {
+	SetRateLimitHeaders(c, err.Kind, err.Result)
+	seconds := max(int(math.Ceil(err.Result.Reset.Seconds())), 1)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"code":    perrors.ErrRateLimited.Code,
+		"message": err.Error(),
+		"error": gin.H{
+			"message": err.Error(),
+			"type":    err.Kind,
+			"code":    "rate_limit_exceeded",
+		},
+	})
+}
+
+// RateLimitRejected 调用时超出限流额度（每分钟 token 数、进行中任务数）返回 429，返回是否已处理
+func RateLimitRejected(c *gin.Context, err error) bool {
+	var limitErr *service.RateLimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	RejectRateLimited(c, limitErr)
+	return true
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majingzhen/prism/internal/service"
+)
+
+func TestRateLimitRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		err        error
+		handled    bool
+		kind       string
+		retryAfter string
+		remaining  string
+	}{
+		{name: "other error", err: service.ErrSpendLimitExceeded},
+		{name: "tokens", err: &service.RateLimitError{Kind: service.RateLimitTokens, Result: &service.RateLimitResult{Limit: 100, Remaining: 10, Reset: 1500 * time.Millisecond}}, handled: true, kind: service.RateLimitTokens, retryAfter: "2", remaining: "10"},
+		{name: "wrapped concurrency", err: fmt.Errorf("invoke: %w", &service.RateLimitError{Kind: service.RateLimitConcurrency, Result: &service.RateLimitResult{Limit: 2}}), handled: true, kind: service.RateLimitConcurrency, retryAfter: "1", remaining: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if got := RateLimitRejected(c, tt.err); got != tt.handled {
+				t.Fatalf("handled = %v, want %v", got, tt.handled)
+			}
+			if !tt.handled {
+				return
+			}
+			if w.Code != http.StatusTooManyRequests || !c.IsAborted() {
+				t.Errorf("status = %d aborted = %v, want 429", w.Code, c.IsAborted())
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.retryAfter)
+			}
+			if got := w.Header().Get("x-ratelimit-remaining-" + tt.kind); got != tt.remaining {
+				t.Errorf("remaining header = %q, want %q", got, tt.remaining)
+			}
+		})
+	}
+}
+
+func TestSetRateLimitHeadersSkipsUnlimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, result := range []*service.RateLimitResult{nil, {Allowed: true}} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		SetRateLimitHeaders(c, service.RateLimitRequests, result)
+		if len(w.Header()) != 0 {
+			t.Errorf("headers for %+v = %v, want none", result, w.Header())
+		}
+	}
+}
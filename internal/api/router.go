@@ -48,8 +48,13 @@ func SetupRouter() *gin.Engine {
 		console.POST("/tokens", v1.CreateToken)
 		console.GET("/tokens/:id", v1.GetToken)
 		console.PUT("/tokens/:id", v1.UpdateToken)
-		console.POST("/tokens/:id/recharge", v1.RechargeToken)
 		console.DELETE("/tokens/:id", v1.DeleteToken)
+		console.POST("/tokens/:id/webhook-secret", v1.RotateWebhookSecret)
+		console.GET("/tokens/:id/webhooks", v1.ListTokenWebhooks)
+		console.POST("/tokens/:id/webhooks", v1.CreateTokenWebhook)
+		console.PUT("/tokens/:id/webhooks/:sub_id", v1.UpdateTokenWebhook)
+		console.DELETE("/tokens/:id/webhooks/:sub_id", v1.DeleteTokenWebhook)
+		console.GET("/billing/transactions", v1.ListMyTransactions)
 		console.GET("/capability-channels", v1.ListCapabilityChannels)
 		console.GET("/chat-model-channels", v1.ListChatModelChannelsForToken)
 
@@ -57,6 +62,8 @@ func SetupRouter() *gin.Engine {
 		console.GET("/dashboard/stats", v1.DashboardStats)
 		console.GET("/tasks", v1.ListTasks)
 		console.GET("/tasks/:task_no", v1.GetTaskDetail)
+		console.POST("/tasks/:task_no/pin", v1.PinTaskAsset)
+		console.DELETE("/tasks/:task_no/pin", v1.UnpinTaskAsset)
 
 		// 对话记录
 		console.GET("/conversations", v1.ListConversations)
@@ -72,8 +79,21 @@ func SetupRouter() *gin.Engine {
 		admin.GET("/users", v1.ListUsers)
 		admin.PUT("/users/:id/role", v1.UpdateUserRole)
 		admin.PUT("/users/:id/status", v1.UpdateUserStatus)
+		admin.PUT("/users/:id/tier", v1.UpdateUserTier)
 		admin.POST("/users/:id/recharge", v1.RechargeUser)
 
+		// 账务流水
+		admin.GET("/billing/transactions", v1.ListBillingTransactions)
+		admin.POST("/billing/adjustments", v1.AdjustBalance)
+		admin.POST("/billing/reconcile", v1.ReconcileBilling)
+
+		// 存储用量
+		admin.GET("/storage/usage", v1.GetStorageUsage)
+
+		// 回调投递
+		admin.GET("/webhook-deliveries", v1.ListWebhookDeliveries)
+		admin.POST("/webhooks/redeliver", v1.RedeliverFailedWebhooks)
+
 		// 渠道管理
 		admin.GET("/channels", v1.ListChannels)
 		admin.GET("/channels/:id", v1.GetChannel)
@@ -84,6 +104,7 @@ func SetupRouter() *gin.Engine {
 		// 渠道账号管理
 		admin.GET("/channel-accounts", v1.ListChannelAccounts)
 		admin.GET("/channel-accounts/:id", v1.GetChannelAccount)
+		admin.GET("/channel-accounts/:id/secret", v1.RevealChannelAccountSecret)
 		admin.POST("/channel-accounts", v1.CreateChannelAccount)
 		admin.PUT("/channel-accounts/:id", v1.UpdateChannelAccount)
 		admin.DELETE("/channel-accounts/:id", v1.DeleteChannelAccount)
@@ -133,9 +154,18 @@ func SetupRouter() *gin.Engine {
 		// 统一能力接口
 		apiV1.POST("/capabilities/:capability", v1.InvokeCapability)
 
+		// 文件管理
+		apiV1.POST("/files", v1.UploadFile)
+		apiV1.GET("/files", v1.ListFiles)
+		apiV1.GET("/files/:file_id", v1.GetFile)
+		apiV1.DELETE("/files/:file_id", v1.DeleteFile)
+
 		// 任务管理
 		apiV1.GET("/tasks/:task_no", v1.GetTaskByNo)
 		apiV1.POST("/tasks/:task_no/cancel", v1.CancelTask)
+		apiV1.POST("/tasks/:task_no/pin", v1.PinTask)
+		apiV1.DELETE("/tasks/:task_no/pin", v1.UnpinTask)
+		apiV1.POST("/tasks/:task_no/redeliver", v1.RedeliverTask)
 
 		// 兼容旧接口
 		apiV1.POST("/images/generations", v1.CreateImageGeneration)
@@ -150,8 +180,13 @@ func SetupRouter() *gin.Engine {
 	internal := r.Group("/internal")
 	{
 		internal.POST("/callback/:channel_type", v1.HandleCapabilityCallback)
+		internal.POST("/callback/:channel_type/:task_no", v1.HandleCapabilityCallback)
 	}
 
+	// 本地存储文件下载 (签名校验)
+	r.GET("/files/*filepath", v1.ServeLocalFile)
+	r.HEAD("/files/*filepath", v1.ServeLocalFile)
+
 	// 嵌入的前端静态文件
 	distFS, _ := fs.Sub(consolefs.DistFS, "dist")
 	fileServer := http.FileServer(http.FS(distFS))
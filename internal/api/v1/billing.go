@@ -0,0 +1,86 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/majingzhen/prism/internal/api/middleware"
+	"github.com/majingzhen/prism/internal/service"
+	"github.com/majingzhen/prism/pkg/errors"
+	"github.com/majingzhen/prism/pkg/money"
+)
+
+// ListMyTransactions 当前用户的账务流水（控制台）
+func ListMyTransactions(c *gin.Context) {
+	var q service.TransactionQuery
+	c.ShouldBindQuery(&q)
+	q.UserID = middleware.GetUserID(c)
+
+	listTransactions(c, &q)
+}
+
+// ListBillingTransactions 账务流水查询（管理员，可按用户、令牌、任务和类型过滤）
+func ListBillingTransactions(c *gin.Context) {
+	var q service.TransactionQuery
+	c.ShouldBindQuery(&q)
+
+	listTransactions(c, &q)
+}
+
+func listTransactions(c *gin.Context, q *service.TransactionQuery) {
+	items, total, err := billingService.ListTransactions(q)
+	if err != nil {
+		internalError(c, errors.ErrInternalError)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"items":     items,
+		"total":     total,
+		"page":      q.Page,
+		"page_size": q.PageSize,
+	})
+}
+
+type AdjustBalanceRequest struct {
+	UserID uint        `json:"user_id" binding:"required"`
+	Amount money.Money `json:"amount" binding:"required"`
+	Remark string      `json:"remark" binding:"required,max=255"`
+}
+
+// AdjustBalance 管理员调整用户钱包余额，金额为负时扣减
+func AdjustBalance(c *gin.Context) {
+	var req AdjustBalanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	ref := service.BillingRef{OperatorID: middleware.GetUserID(c), Remark: req.Remark}
+	err := billingService.Adjust(req.UserID, req.Amount, ref)
+	switch err {
+	case nil:
+		successResponse(c, gin.H{"adjusted": true})
+	case service.ErrBillingTargetNotFound:
+		notFound(c, errors.WithMessage(errors.ErrInvalidParams, err.Error()))
+	case service.ErrInsufficientUserBalance:
+		badRequest(c, errors.WithMessage(errors.ErrInsufficientQuota, err.Error()))
+	default:
+		internalError(c, errors.ErrInternalError)
+	}
+}
+
+// ReconcileBilling 立即核对余额与账务流水，返回不一致的账户
+func ReconcileBilling(c *gin.Context) {
+	mismatches, err := billingService.Reconcile()
+	if err != nil {
+		internalError(c, errors.ErrInternalError)
+		return
+	}
+	if mismatches == nil {
+		mismatches = []service.BillingMismatch{}
+	}
+
+	successResponse(c, gin.H{
+		"balanced":   len(mismatches) == 0,
+		"mismatches": mismatches,
+	})
+}
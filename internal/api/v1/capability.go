@@ -2,6 +2,7 @@ package v1
 
 import (
 	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -11,7 +12,10 @@ import (
 	perrors "github.com/majingzhen/prism/pkg/errors"
 )
 
-var capabilityService = service.NewCapabilityService()
+var (
+	capabilityService = service.NewCapabilityService()
+	assetService      = service.NewAssetService()
+)
 
 // ListAvailableChannels 列出所有可用渠道
 func ListAvailableChannels(c *gin.Context) {
@@ -152,14 +156,22 @@ func InvokeCapability(c *gin.Context) {
 
 	resp, err := capabilityService.Invoke(c.Request.Context(), req)
 	if err != nil {
-		if errors.Is(err, service.ErrInsufficientTokenBalance) || errors.Is(err, service.ErrInsufficientUserBalance) {
+		if tokenPolicyRejected(c, err) || middleware.RateLimitRejected(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInsufficientUserBalance) {
 			badRequest(c, perrors.WithMessage(perrors.ErrInsufficientQuota, err.Error()))
 			return
 		}
+		if errors.Is(err, service.ErrFileNotFound) || errors.Is(err, service.ErrInvalidPricingParam) {
+			badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, err.Error()))
+			return
+		}
 		errorResponse(c, http.StatusInternalServerError, 500, err.Error())
 		return
 	}
 
+	middleware.SetRateLimitHeaders(c, service.RateLimitConcurrency, resp.ConcurrencyLimit)
 	successResponse(c, resp)
 }
 
@@ -179,12 +191,13 @@ func GetTaskByNo(c *gin.Context) {
 	}
 
 	successResponse(c, gin.H{
-		"task_id":  task.TaskNo,
-		"status":   task.Status,
-		"progress": task.Progress,
-		"result":   task.Result,
-		"error":    task.ErrorMessage,
-		"cost":     task.Cost,
+		"task_id":      task.TaskNo,
+		"status":       task.Status,
+		"progress":     task.Progress,
+		"result":       assetService.ResolveResultJSON(c.Request.Context(), task.Result),
+		"error":        task.ErrorMessage,
+		"cost":         task.Cost,
+		"price_detail": task.PriceDetail,
 	})
 }
 
@@ -206,18 +219,50 @@ func CancelTask(c *gin.Context) {
 	successResponse(c, gin.H{"message": "task cancelled"})
 }
 
+// PinTask 固定任务资源，不受保留期限清理
+func PinTask(c *gin.Context) {
+	token := middleware.GetToken(c)
+	if token == nil {
+		errorResponse(c, http.StatusUnauthorized, 401, "unauthorized")
+		return
+	}
+	setTaskPinned(c, token.UserID, true)
+}
+
+// UnpinTask 取消固定任务资源
+func UnpinTask(c *gin.Context) {
+	token := middleware.GetToken(c)
+	if token == nil {
+		errorResponse(c, http.StatusUnauthorized, 401, "unauthorized")
+		return
+	}
+	setTaskPinned(c, token.UserID, false)
+}
+
 // HandleCapabilityCallback 处理供应商回调
 func HandleCapabilityCallback(c *gin.Context) {
-	channelType := c.Param("channel_type")
-
-	var body map[string]any
-	if err := c.ShouldBindJSON(&body); err != nil {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
 		errorResponse(c, http.StatusBadRequest, 400, "invalid request body")
 		return
 	}
 
-	err := capabilityService.HandleCallback(c.Request.Context(), channelType, body)
-	if err != nil {
+	req := &service.CallbackRequest{
+		ChannelType: c.Param("channel_type"),
+		TaskNo:      c.Param("task_no"),
+		Method:      c.Request.Method,
+		URL:         c.Request.URL.String(),
+		ClientIP:    c.ClientIP(),
+		Headers:     c.Request.Header,
+		Query:       c.Request.URL.Query(),
+		Body:        body,
+	}
+
+	if err := capabilityService.HandleCallback(c.Request.Context(), req); err != nil {
+		if errors.Is(err, service.ErrCallbackUnauthorized) {
+			errorResponse(c, http.StatusUnauthorized, 401, "unauthorized")
+			return
+		}
 		errorResponse(c, http.StatusBadRequest, 400, err.Error())
 		return
 	}
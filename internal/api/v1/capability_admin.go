@@ -4,9 +4,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/provider"
+	"github.com/majingzhen/prism/internal/service"
+	"github.com/majingzhen/prism/pkg/errors"
+	"github.com/majingzhen/prism/pkg/money"
 	"gorm.io/datatypes"
 )
 
@@ -49,6 +54,8 @@ func CreateCapability(c *gin.Context) {
 		Description      string         `json:"description"`
 		StandardParams   datatypes.JSON `json:"standard_params"`
 		StandardResponse datatypes.JSON `json:"standard_response"`
+		AssetVisibility  string         `json:"asset_visibility"`
+		RetentionDays    int            `json:"retention_days"`
 		Status           int8           `json:"status"`
 	}
 
@@ -56,6 +63,14 @@ func CreateCapability(c *gin.Context) {
 		errorResponse(c, http.StatusBadRequest, 400, err.Error())
 		return
 	}
+	if !validAssetVisibility(req.AssetVisibility) {
+		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, "invalid asset_visibility"))
+		return
+	}
+	if req.RetentionDays < model.RetentionForever {
+		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, "retention_days must be >= -1"))
+		return
+	}
 
 	capability := &model.Capability{
 		Code:             req.Code,
@@ -64,6 +79,8 @@ func CreateCapability(c *gin.Context) {
 		Description:      req.Description,
 		StandardParams:   req.StandardParams,
 		StandardResponse: req.StandardResponse,
+		AssetVisibility:  req.AssetVisibility,
+		RetentionDays:    req.RetentionDays,
 		Status:           req.Status,
 	}
 	if capability.Status == 0 {
@@ -97,6 +114,8 @@ func UpdateCapability(c *gin.Context) {
 		Description      string         `json:"description"`
 		StandardParams   datatypes.JSON `json:"standard_params"`
 		StandardResponse datatypes.JSON `json:"standard_response"`
+		AssetVisibility  *string        `json:"asset_visibility"`
+		RetentionDays    *int           `json:"retention_days"`
 		Status           *int8          `json:"status"`
 	}
 
@@ -121,6 +140,20 @@ func UpdateCapability(c *gin.Context) {
 	if len(req.StandardResponse) > 0 {
 		updates["standard_response"] = req.StandardResponse
 	}
+	if req.AssetVisibility != nil {
+		if !validAssetVisibility(*req.AssetVisibility) {
+			badRequest(c, errors.WithMessage(errors.ErrInvalidParams, "invalid asset_visibility"))
+			return
+		}
+		updates["asset_visibility"] = *req.AssetVisibility
+	}
+	if req.RetentionDays != nil {
+		if *req.RetentionDays < model.RetentionForever {
+			badRequest(c, errors.WithMessage(errors.ErrInvalidParams, "retention_days must be >= -1"))
+			return
+		}
+		updates["retention_days"] = *req.RetentionDays
+	}
 	if req.Status != nil {
 		updates["status"] = *req.Status
 	}
@@ -195,8 +228,9 @@ func CreateChannelCapability(c *gin.Context) {
 		CapabilityCode      string         `json:"capability_code" binding:"required"`
 		Model               string         `json:"model"`
 		Name                string         `json:"name"`
-		Price               float64        `json:"price"`
+		Price               money.Money    `json:"price"`
 		PriceUnit           string         `json:"price_unit"`
+		PricingRules        datatypes.JSON `json:"pricing_rules"`
 		ResultMode          string         `json:"result_mode"`
 		RequestPath         string         `json:"request_path"`
 		RequestMethod       string         `json:"request_method"`
@@ -208,8 +242,19 @@ func CreateChannelCapability(c *gin.Context) {
 		PollMethod          string         `json:"poll_method"`
 		PollInterval        int            `json:"poll_interval"`
 		PollMaxAttempts     int            `json:"poll_max_attempts"`
+		PollInitialDelay    int            `json:"poll_initial_delay"`
+		PollBackoff         string         `json:"poll_backoff"`
+		PollBackoffFactor   float64        `json:"poll_backoff_factor"`
+		PollSteps           datatypes.JSON `json:"poll_steps"`
+		PollJitter          float64        `json:"poll_jitter"`
+		PollMaxInterval     int            `json:"poll_max_interval"`
+		PollDeadline        int            `json:"poll_deadline"`
 		PollParamMapping    datatypes.JSON `json:"poll_param_mapping"`
 		PollResponseMapping datatypes.JSON `json:"poll_response_mapping"`
+		SubmitTemplate      datatypes.JSON `json:"submit_template"`
+		PollTemplate        datatypes.JSON `json:"poll_template"`
+		CancelTemplate      datatypes.JSON `json:"cancel_template"`
+		PreSubmitSteps      datatypes.JSON `json:"pre_submit_steps"`
 		ParamMapping        datatypes.JSON `json:"param_mapping"`
 		ResponseMapping     datatypes.JSON `json:"response_mapping"`
 		CallbackMapping     datatypes.JSON `json:"callback_mapping"`
@@ -221,6 +266,24 @@ func CreateChannelCapability(c *gin.Context) {
 		errorResponse(c, http.StatusBadRequest, 400, err.Error())
 		return
 	}
+	for field, tpl := range map[string]datatypes.JSON{
+		"submit_template": req.SubmitTemplate,
+		"poll_template":   req.PollTemplate,
+		"cancel_template": req.CancelTemplate,
+	} {
+		if _, err := provider.ParseRequestTemplate(tpl); err != nil {
+			errorResponse(c, http.StatusBadRequest, 400, "invalid "+field)
+			return
+		}
+	}
+	if _, err := service.ParsePreSubmitSteps(req.PreSubmitSteps); err != nil {
+		errorResponse(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+	if _, err := service.ParsePricingRules(req.PricingRules); err != nil {
+		errorResponse(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
 
 	cc := &model.ChannelCapability{
 		ChannelID:           req.ChannelID,
@@ -229,6 +292,7 @@ func CreateChannelCapability(c *gin.Context) {
 		Name:                req.Name,
 		Price:               req.Price,
 		PriceUnit:           req.PriceUnit,
+		PricingRules:        req.PricingRules,
 		ResultMode:          req.ResultMode,
 		RequestPath:         req.RequestPath,
 		RequestMethod:       req.RequestMethod,
@@ -240,8 +304,19 @@ func CreateChannelCapability(c *gin.Context) {
 		PollMethod:          req.PollMethod,
 		PollInterval:        req.PollInterval,
 		PollMaxAttempts:     req.PollMaxAttempts,
+		PollInitialDelay:    req.PollInitialDelay,
+		PollBackoff:         req.PollBackoff,
+		PollBackoffFactor:   req.PollBackoffFactor,
+		PollSteps:           req.PollSteps,
+		PollJitter:          req.PollJitter,
+		PollMaxInterval:     req.PollMaxInterval,
+		PollDeadline:        req.PollDeadline,
 		PollParamMapping:    req.PollParamMapping,
 		PollResponseMapping: req.PollResponseMapping,
+		SubmitTemplate:      req.SubmitTemplate,
+		PollTemplate:        req.PollTemplate,
+		CancelTemplate:      req.CancelTemplate,
+		PreSubmitSteps:      req.PreSubmitSteps,
 		ParamMapping:        req.ParamMapping,
 		ResponseMapping:     req.ResponseMapping,
 		CallbackMapping:     req.CallbackMapping,
@@ -280,6 +355,12 @@ func CreateChannelCapability(c *gin.Context) {
 	if cc.PollMaxAttempts == 0 {
 		cc.PollMaxAttempts = 60
 	}
+	if cc.PollBackoff == "" {
+		cc.PollBackoff = model.PollBackoffFixed
+	}
+	if cc.PollBackoffFactor == 0 {
+		cc.PollBackoffFactor = 2
+	}
 
 	if err := model.DB().Create(cc).Error; err != nil {
 		errorResponse(c, http.StatusInternalServerError, 500, err.Error())
@@ -310,12 +391,25 @@ func UpdateChannelCapability(c *gin.Context) {
 	delete(req, "created_at")
 	delete(req, "updated_at")
 
+	// 金额按十进制精确写入
+	if v, ok := req["price"]; ok {
+		price, err := money.FromAny(v)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, 400, "invalid price")
+			return
+		}
+		req["price"] = price
+	}
+
 	// JSON 字段需要序列化为 []byte，GORM 不能直接处理 map[string]any
-	jsonFields := []string{"param_mapping", "response_mapping", "callback_mapping", "extra_config", "poll_param_mapping", "poll_response_mapping"}
+	jsonFields := []string{"param_mapping", "response_mapping", "callback_mapping", "extra_config", "poll_param_mapping", "poll_response_mapping", "poll_steps",
+		"submit_template", "poll_template", "cancel_template", "pre_submit_steps", "pricing_rules"}
 	for _, field := range jsonFields {
 		if v, ok := req[field]; ok {
 			// 处理 nil 和空值，确保能清空字段
-			if v == nil {
+			if v == nil && (field == "poll_steps" || field == "pre_submit_steps" || field == "pricing_rules") {
+				req[field] = datatypes.JSON([]byte("[]"))
+			} else if v == nil {
 				req[field] = datatypes.JSON([]byte("{}"))
 			} else {
 				b, err := json.Marshal(v)
@@ -323,6 +417,24 @@ func UpdateChannelCapability(c *gin.Context) {
 					errorResponse(c, http.StatusBadRequest, 400, "invalid "+field)
 					return
 				}
+				if strings.HasSuffix(field, "_template") {
+					if _, err := provider.ParseRequestTemplate(b); err != nil {
+						errorResponse(c, http.StatusBadRequest, 400, "invalid "+field)
+						return
+					}
+				}
+				if field == "pre_submit_steps" {
+					if _, err := service.ParsePreSubmitSteps(b); err != nil {
+						errorResponse(c, http.StatusBadRequest, 400, err.Error())
+						return
+					}
+				}
+				if field == "pricing_rules" {
+					if _, err := service.ParsePricingRules(b); err != nil {
+						errorResponse(c, http.StatusBadRequest, 400, err.Error())
+						return
+					}
+				}
 				req[field] = datatypes.JSON(b)
 			}
 		}
@@ -354,3 +466,8 @@ func DeleteChannelCapability(c *gin.Context) {
 
 	successResponse(c, gin.H{"message": "deleted"})
 }
+
+// validAssetVisibility 结果存储可见性只能为空 (跟随全局配置)、public 或 private
+func validAssetVisibility(v string) bool {
+	return v == "" || v == model.AssetVisibilityPublic || v == model.AssetVisibilityPrivate
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 
 	"github.com/gin-gonic/gin"
+	"github.com/majingzhen/prism/internal/api/middleware"
 	"github.com/majingzhen/prism/internal/service"
 	pkgErrors "github.com/majingzhen/prism/pkg/errors"
+	"github.com/majingzhen/prism/pkg/logger"
+	"go.uber.org/zap"
 )
 
 var channelService = service.NewChannelService()
@@ -151,12 +154,13 @@ func ListChannelAccounts(c *gin.Context) {
 
 	result := make([]gin.H, len(accounts))
 	for i, acc := range accounts {
+		apiKey, config := service.MaskAccountSecrets(&acc)
 		result[i] = gin.H{
 			"id":            acc.ID,
 			"channel_id":    acc.ChannelID,
 			"name":          acc.Name,
-			"api_key":       acc.APIKey,
-			"config":        acc.Config,
+			"api_key":       apiKey,
+			"config":        config,
 			"weight":        acc.Weight,
 			"status":        acc.Status,
 			"current_tasks": acc.CurrentTasks,
@@ -184,12 +188,13 @@ func GetChannelAccount(c *gin.Context) {
 		return
 	}
 
+	apiKey, config := service.MaskAccountSecrets(account)
 	successResponse(c, gin.H{
 		"id":            account.ID,
 		"channel_id":    account.ChannelID,
 		"name":          account.Name,
-		"api_key":       account.APIKey,
-		"config":        account.Config,
+		"api_key":       apiKey,
+		"config":        config,
 		"weight":        account.Weight,
 		"status":        account.Status,
 		"current_tasks": account.CurrentTasks,
@@ -198,6 +203,37 @@ func GetChannelAccount(c *gin.Context) {
 	})
 }
 
+// RevealChannelAccountSecret 查看渠道账号密钥明文，仅限配置在 secrets.reveal_users 中的管理员
+func RevealChannelAccountSecret(c *gin.Context) {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	if !service.CanRevealSecrets(userID) {
+		forbidden(c, pkgErrors.WithMessage(pkgErrors.ErrNoPermission, "no permission to reveal secrets"))
+		return
+	}
+
+	account, err := channelService.GetChannelAccountByID(id)
+	if err != nil {
+		if errors.Is(err, service.ErrChannelAccountNotFound) {
+			notFound(c, pkgErrors.ErrTaskNotFound)
+			return
+		}
+		internalError(c, pkgErrors.ErrInternalError)
+		return
+	}
+
+	logger.Info("channel account secret revealed", zap.Uint("user_id", userID), zap.Uint("account_id", account.ID))
+	successResponse(c, gin.H{
+		"id":      account.ID,
+		"api_key": account.APIKey,
+		"config":  account.Config,
+	})
+}
+
 func CreateChannelAccount(c *gin.Context) {
 	var req service.CreateChannelAccountRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
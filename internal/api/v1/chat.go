@@ -1,12 +1,14 @@
 package v1
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/majingzhen/prism/internal/api/middleware"
 	"github.com/majingzhen/prism/internal/provider/chat"
 	"github.com/majingzhen/prism/internal/service"
+	perrors "github.com/majingzhen/prism/pkg/errors"
 )
 
 // ChatCompletions POST /v1/chat/completions
@@ -40,10 +42,18 @@ func ChatCompletions(c *gin.Context) {
 	chatService := service.NewChatService()
 	resp, err := chatService.Complete(c.Request.Context(), completionReq)
 	if err != nil {
+		if tokenPolicyRejected(c, err) || middleware.RateLimitRejected(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInsufficientUserBalance) {
+			badRequest(c, perrors.WithMessage(perrors.ErrInsufficientQuota, err.Error()))
+			return
+		}
 		errorResponse(c, http.StatusInternalServerError, 500, err.Error())
 		return
 	}
 
+	middleware.SetRateLimitHeaders(c, service.RateLimitTokens, resp.TokenLimit)
 	c.JSON(http.StatusOK, resp)
 }
 
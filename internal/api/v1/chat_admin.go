@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/money"
 )
 
 // ========== ChatModel CRUD ==========
@@ -34,6 +35,7 @@ func CreateChatModel(c *gin.Context) {
 		Name        string `json:"name" binding:"required,max=100"`
 		Provider    string `json:"provider" binding:"required,max=30"`
 		Description string `json:"description"`
+		MaxTokens   int    `json:"max_tokens"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -46,6 +48,7 @@ func CreateChatModel(c *gin.Context) {
 		Name:        req.Name,
 		Provider:    req.Provider,
 		Description: req.Description,
+		MaxTokens:   req.MaxTokens,
 		Status:      1,
 	}
 
@@ -65,6 +68,7 @@ func UpdateChatModel(c *gin.Context) {
 		Name        string `json:"name"`
 		Provider    string `json:"provider"`
 		Description string `json:"description"`
+		MaxTokens   *int   `json:"max_tokens"`
 		Status      *int8  `json:"status"`
 	}
 
@@ -83,6 +87,9 @@ func UpdateChatModel(c *gin.Context) {
 	if req.Description != "" {
 		updates["description"] = req.Description
 	}
+	if req.MaxTokens != nil {
+		updates["max_tokens"] = *req.MaxTokens
+	}
 	if req.Status != nil {
 		updates["status"] = *req.Status
 	}
@@ -141,15 +148,15 @@ func GetChatModelChannel(c *gin.Context) {
 // CreateChatModelChannel POST /api/admin/chat-model-channels
 func CreateChatModelChannel(c *gin.Context) {
 	var req struct {
-		ModelCode   string  `json:"model_code" binding:"required"`
-		ChannelID   uint    `json:"channel_id" binding:"required"`
-		VendorModel string  `json:"vendor_model" binding:"required"`
-		Priority    int     `json:"priority"`
-		PriceMode   string  `json:"price_mode"`
-		InputPrice  float64 `json:"input_price"`
-		OutputPrice float64 `json:"output_price"`
-		RequestPath string  `json:"request_path"`
-		Timeout     int     `json:"timeout"`
+		ModelCode   string      `json:"model_code" binding:"required"`
+		ChannelID   uint        `json:"channel_id" binding:"required"`
+		VendorModel string      `json:"vendor_model" binding:"required"`
+		Priority    int         `json:"priority"`
+		PriceMode   string      `json:"price_mode"`
+		InputPrice  money.Money `json:"input_price"`
+		OutputPrice money.Money `json:"output_price"`
+		RequestPath string      `json:"request_path"`
+		Timeout     int         `json:"timeout"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -193,14 +200,14 @@ func UpdateChatModelChannel(c *gin.Context) {
 	id := c.Param("id")
 
 	var req struct {
-		VendorModel string   `json:"vendor_model"`
-		Priority    *int     `json:"priority"`
-		PriceMode   string   `json:"price_mode"`
-		InputPrice  *float64 `json:"input_price"`
-		OutputPrice *float64 `json:"output_price"`
-		RequestPath string   `json:"request_path"`
-		Timeout     *int     `json:"timeout"`
-		Status      *int8    `json:"status"`
+		VendorModel string       `json:"vendor_model"`
+		Priority    *int         `json:"priority"`
+		PriceMode   string       `json:"price_mode"`
+		InputPrice  *money.Money `json:"input_price"`
+		OutputPrice *money.Money `json:"output_price"`
+		RequestPath string       `json:"request_path"`
+		Timeout     *int         `json:"timeout"`
+		Status      *int8        `json:"status"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
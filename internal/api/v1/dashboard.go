@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/majingzhen/prism/internal/api/middleware"
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/money"
 	"gorm.io/gorm"
 )
 
@@ -33,10 +34,10 @@ func DashboardStats(c *gin.Context) {
 	yesterdayStart := todayStart.AddDate(0, 0, -1)
 
 	var todayStats struct {
-		TotalRequests int64   `json:"total_requests"`
-		TotalCost     float64 `json:"total_cost"`
-		SuccessCount  int64   `json:"success_count"`
-		FailedCount   int64   `json:"failed_count"`
+		TotalRequests int64       `json:"total_requests"`
+		TotalCost     money.Money `json:"total_cost"`
+		SuccessCount  int64       `json:"success_count"`
+		FailedCount   int64       `json:"failed_count"`
 	}
 
 	// 今日请求数和费用
@@ -55,8 +56,8 @@ func DashboardStats(c *gin.Context) {
 
 	// 昨日统计（用于对比）
 	var yesterdayStats struct {
-		TotalRequests int64   `json:"total_requests"`
-		TotalCost     float64 `json:"total_cost"`
+		TotalRequests int64       `json:"total_requests"`
+		TotalCost     money.Money `json:"total_cost"`
 	}
 	baseQuery().
 		Where("created_at >= ? AND created_at < ?", yesterdayStart, todayStart).
@@ -76,15 +77,15 @@ func DashboardStats(c *gin.Context) {
 	}
 	costTrend := float64(0)
 	if yesterdayStats.TotalCost > 0 {
-		costTrend = (todayStats.TotalCost - yesterdayStats.TotalCost) / yesterdayStats.TotalCost * 100
+		costTrend = (todayStats.TotalCost - yesterdayStats.TotalCost).Float64() / yesterdayStats.TotalCost.Float64() * 100
 	}
 
 	// 过去7天的趋势数据
 	type DailyStats struct {
-		Date     string  `json:"date"`
-		Requests int64   `json:"requests" gorm:"column:requests"`
-		Cost     float64 `json:"cost" gorm:"column:cost"`
-		Errors   int64   `json:"errors"`
+		Date     string      `json:"date"`
+		Requests int64       `json:"requests" gorm:"column:requests"`
+		Cost     money.Money `json:"cost" gorm:"column:cost"`
+		Errors   int64       `json:"errors"`
 	}
 	var weeklyStats []DailyStats
 
@@ -93,8 +94,8 @@ func DashboardStats(c *gin.Context) {
 		dayEnd := dayStart.AddDate(0, 0, 1)
 
 		var dayAgg struct {
-			Requests int64   `gorm:"column:requests"`
-			Cost     float64 `gorm:"column:cost"`
+			Requests int64       `gorm:"column:requests"`
+			Cost     money.Money `gorm:"column:cost"`
 		}
 
 		// 使用 Table 替代 Model 以确保 Scan 正确映射列名
@@ -139,7 +140,31 @@ func DashboardStats(c *gin.Context) {
 		Limit(5).
 		Scan(&capabilityStats)
 
+	// 钱包：余额和按账务流水统计的净消费（扣费减退款），管理员为全部用户汇总
+	userQuery := db.Model(&model.User{})
+	if !isAdmin {
+		userQuery = userQuery.Where("id = ?", userID)
+	}
+	ledgerQuery := func(since time.Time) *gorm.DB {
+		q := db.Model(&model.BillingTransaction{}).
+			Where("type IN ? AND created_at >= ?", []string{model.BillingTypeDeduct, model.BillingTypeRefund}, since)
+		if !isAdmin {
+			q = q.Where("user_id = ?", userID)
+		}
+		return q
+	}
+	var wallet struct {
+		Balance    money.Money `json:"balance"`
+		TodaySpent money.Money `json:"today_spent"`
+		MonthSpent money.Money `json:"month_spent"`
+	}
+	userQuery.Select("COALESCE(SUM(balance), 0)").Scan(&wallet.Balance)
+	ledgerQuery(todayStart).Select("COALESCE(-SUM(user_amount), 0)").Scan(&wallet.TodaySpent)
+	ledgerQuery(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())).
+		Select("COALESCE(-SUM(user_amount), 0)").Scan(&wallet.MonthSpent)
+
 	successResponse(c, gin.H{
+		"wallet": wallet,
 		"today": gin.H{
 			"total_requests": todayStats.TotalRequests,
 			"total_cost":     todayStats.TotalCost,
@@ -221,18 +246,18 @@ func ListTasks(c *gin.Context) {
 
 	// 转换响应
 	type TaskItem struct {
-		ID             string  `json:"id"`
-		TaskNo         string  `json:"task_no"`
-		Capability     string  `json:"capability"`
-		CapabilityName string  `json:"capability_name"`
-		Channel        string  `json:"channel"`
-		Status         string  `json:"status"`
-		Progress       int     `json:"progress"`
-		Cost           float64 `json:"cost"`
-		Refunded       bool    `json:"refunded"`
-		Error          string  `json:"error,omitempty"`
-		CreatedAt      string  `json:"created_at"`
-		CompletedAt    string  `json:"completed_at,omitempty"`
+		ID             string      `json:"id"`
+		TaskNo         string      `json:"task_no"`
+		Capability     string      `json:"capability"`
+		CapabilityName string      `json:"capability_name"`
+		Channel        string      `json:"channel"`
+		Status         string      `json:"status"`
+		Progress       int         `json:"progress"`
+		Cost           money.Money `json:"cost"`
+		Refunded       bool        `json:"refunded"`
+		Error          string      `json:"error,omitempty"`
+		CreatedAt      string      `json:"created_at"`
+		CompletedAt    string      `json:"completed_at,omitempty"`
 	}
 
 	items := make([]TaskItem, 0, len(tasks))
@@ -291,10 +316,7 @@ func GetTaskDetail(c *gin.Context) {
 	}
 
 	// 解析结果
-	var result map[string]any
-	if len(task.Result) > 0 {
-		json.Unmarshal(task.Result, &result)
-	}
+	result := assetService.ResolveResultJSON(c.Request.Context(), task.Result)
 
 	// 解析原始请求参数
 	var rawParams map[string]any
@@ -319,6 +341,9 @@ func GetTaskDetail(c *gin.Context) {
 		"result":         result,
 		"raw_params":     rawParams,
 		"vendor_task_id": task.VendorTaskID,
+		"asset_size":     task.AssetSize,
+		"asset_pinned":   task.AssetPinned,
+		"asset_expired":  task.AssetExpired,
 		"created_at":     task.CreatedAt.Format("2006-01-02 15:04:05"),
 	}
 
@@ -339,6 +364,9 @@ func GetTaskDetail(c *gin.Context) {
 	if task.CompletedAt != nil {
 		resp["completed_at"] = task.CompletedAt.Format("2006-01-02 15:04:05")
 	}
+	if task.AssetExpiresAt != nil {
+		resp["asset_expires_at"] = task.AssetExpiresAt.Format("2006-01-02 15:04:05")
+	}
 
 	successResponse(c, resp)
 }
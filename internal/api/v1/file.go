@@ -0,0 +1,163 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majingzhen/prism/internal/api/middleware"
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/service"
+	perrors "github.com/majingzhen/prism/pkg/errors"
+)
+
+var fileService = service.NewFileService()
+
+// ImportFileRequest 通过链接导入文件
+type ImportFileRequest struct {
+	URL string `json:"url" form:"url" binding:"required"`
+	TTL int    `json:"ttl" form:"ttl"` // 有效期(秒)，为空使用默认值
+}
+
+// UploadFile 上传文件（multipart 的 file 字段，或 JSON/表单中的 url 字段导入）
+func UploadFile(c *gin.Context) {
+	token := middleware.GetToken(c)
+	if token == nil {
+		errorResponse(c, http.StatusUnauthorized, 401, "unauthorized")
+		return
+	}
+
+	var (
+		file *model.File
+		err  error
+	)
+	if fileHeader, formErr := c.FormFile("file"); formErr == nil {
+		ttl, _ := strconv.Atoi(c.PostForm("ttl"))
+		reader, openErr := fileHeader.Open()
+		if openErr != nil {
+			badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, "invalid file"))
+			return
+		}
+		defer reader.Close()
+
+		file, err = fileService.Upload(c.Request.Context(), token, &service.UploadFileRequest{
+			Filename:    fileHeader.Filename,
+			ContentType: fileHeader.Header.Get("Content-Type"),
+			Reader:      reader,
+			TTL:         time.Duration(ttl) * time.Second,
+		})
+	} else {
+		var req ImportFileRequest
+		if err := c.ShouldBind(&req); err != nil {
+			badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, "file or url is required"))
+			return
+		}
+		file, err = fileService.Import(c.Request.Context(), token, req.URL, time.Duration(req.TTL)*time.Second)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrFileQuotaExceeded), errors.Is(err, service.ErrFileCountLimitReached):
+			errorResponse(c, http.StatusForbidden, 403, err.Error())
+		case errors.Is(err, service.ErrFileTooLarge):
+			errorResponse(c, http.StatusRequestEntityTooLarge, 413, err.Error())
+		case errors.Is(err, service.ErrStorageNotConfigured):
+			errorResponse(c, http.StatusServiceUnavailable, 503, err.Error())
+		default:
+			errorResponse(c, http.StatusBadRequest, 400, err.Error())
+		}
+		return
+	}
+
+	successResponse(c, fileResponse(c, file))
+}
+
+// ListFiles 列出当前令牌上传的文件
+func ListFiles(c *gin.Context) {
+	token := middleware.GetToken(c)
+	if token == nil {
+		errorResponse(c, http.StatusUnauthorized, 401, "unauthorized")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	files, total, err := fileService.List(token.ID, page, pageSize)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, 500, "failed to list files")
+		return
+	}
+
+	list := make([]gin.H, 0, len(files))
+	for i := range files {
+		list = append(list, fileResponse(c, &files[i]))
+	}
+
+	successResponse(c, gin.H{
+		"items":     list,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetFile 查询文件信息和访问地址
+func GetFile(c *gin.Context) {
+	token := middleware.GetToken(c)
+	if token == nil {
+		errorResponse(c, http.StatusUnauthorized, 401, "unauthorized")
+		return
+	}
+
+	file, err := fileService.Get(c.Param("file_id"), token.UserID)
+	if err != nil {
+		errorResponse(c, http.StatusNotFound, 404, "file not found")
+		return
+	}
+
+	successResponse(c, fileResponse(c, file))
+}
+
+// DeleteFile 删除文件
+func DeleteFile(c *gin.Context) {
+	token := middleware.GetToken(c)
+	if token == nil {
+		errorResponse(c, http.StatusUnauthorized, 401, "unauthorized")
+		return
+	}
+
+	if err := fileService.Delete(c.Request.Context(), c.Param("file_id"), token.UserID); err != nil {
+		if errors.Is(err, service.ErrFileNotFound) {
+			errorResponse(c, http.StatusNotFound, 404, "file not found")
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, 500, err.Error())
+		return
+	}
+
+	successResponse(c, gin.H{"file_id": c.Param("file_id"), "deleted": true})
+}
+
+// fileResponse 文件信息，私有存储时返回签名链接
+func fileResponse(c *gin.Context, file *model.File) gin.H {
+	url, _ := fileService.URL(c.Request.Context(), file)
+	return gin.H{
+		"file_id":      file.FileID,
+		"filename":     file.Filename,
+		"content_type": file.ContentType,
+		"size":         file.Size,
+		"source":       file.Source,
+		"url":          url,
+		"created_at":   file.CreatedAt,
+		"expires_at":   file.ExpiresAt,
+	}
+}
@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,7 +10,7 @@ import (
 	"github.com/majingzhen/prism/internal/provider"
 	"github.com/majingzhen/prism/internal/service"
 	"github.com/majingzhen/prism/internal/worker"
-	"github.com/majingzhen/prism/pkg/errors"
+	perrors "github.com/majingzhen/prism/pkg/errors"
 )
 
 type GenerationRequest struct {
@@ -26,9 +27,11 @@ type GenerationResponse struct {
 }
 
 var (
-	strategyService = service.NewStrategyService()
-	taskService     = service.NewTaskService()
-	billingService  = service.NewBillingService()
+	strategyService  = service.NewStrategyService()
+	taskService      = service.NewTaskService()
+	billingService   = service.NewBillingService()
+	policyService    = service.NewTokenPolicyService()
+	rateLimitService = service.NewRateLimitService()
 )
 
 func CreateImageGeneration(c *gin.Context) {
@@ -42,7 +45,7 @@ func CreateVideoGeneration(c *gin.Context) {
 func createGeneration(c *gin.Context, capabilityCode string) {
 	var req GenerationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, err.Error()))
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, err.Error()))
 		return
 	}
 
@@ -53,18 +56,22 @@ func createGeneration(c *gin.Context, capabilityCode string) {
 	}
 	tokenID := token.ID
 	userID := token.UserID
+	if err := policyService.CheckCapability(token, capabilityCode); err != nil {
+		tokenPolicyRejected(c, err)
+		return
+	}
 
 	// 1. 选择渠道能力配置
 	ccResult, err := strategyService.SelectChannelCapability(req.Model)
 	if err != nil {
-		badRequest(c, errors.ErrNoAvailableChannel)
+		badRequest(c, perrors.ErrNoAvailableChannel)
 		return
 	}
 
 	// 2. 选择账号
 	accountResult, err := strategyService.SelectAccount(ccResult.Channel.ID)
 	if err != nil {
-		badRequest(c, errors.WithMessage(errors.ErrNoAvailableChannel, "no available account"))
+		badRequest(c, perrors.WithMessage(perrors.ErrNoAvailableChannel, "no available account"))
 		return
 	}
 
@@ -79,23 +86,38 @@ func createGeneration(c *gin.Context, capabilityCode string) {
 		params[k] = v
 	}
 
-	mappedParams, err := converter.Convert(params, paramTemplate)
+	resolvedParams, err := fileService.ResolveParams(c.Request.Context(), userID, params)
 	if err != nil {
-		internalError(c, errors.WithMessage(errors.ErrProviderError, "param convert error"))
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, err.Error()))
 		return
 	}
 
-	// 4. 预扣费
-	price := ccResult.ChannelCapability.Price
-	if price > 0 {
-		if err := billingService.Deduct(tokenID, userID, price); err != nil {
-			badRequest(c, errors.WithMessage(errors.ErrInsufficientQuota, err.Error()))
-			return
-		}
+	mappedParams, err := converter.Convert(resolvedParams, paramTemplate)
+	if err != nil {
+		internalError(c, perrors.WithMessage(perrors.ErrProviderError, "param convert error"))
+		return
+	}
+
+	// 4. 按计价规则计算价格，消费上限在预扣时检查
+	breakdown, err := service.CalculatePrice(ccResult.ChannelCapability, params)
+	if err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, err.Error()))
+		return
+	}
+	price := breakdown.Total
+
+	// 5. 占用进行中任务数的名额，任务结束时归还
+	taskNo := service.GenerateTaskNo()
+	concurrency := rateLimitService.AcquireTask(c.Request.Context(), tokenID, taskNo, rateLimitService.Limits(token).Concurrency)
+	if !concurrency.Allowed {
+		middleware.RejectRateLimited(c, &service.RateLimitError{Kind: service.RateLimitConcurrency, Result: concurrency})
+		return
 	}
+	middleware.SetRateLimitHeaders(c, service.RateLimitConcurrency, concurrency)
 
-	// 5. 创建任务
+	// 6. 创建任务并预扣费
 	task, err := taskService.CreateTask(&service.CreateTaskRequest{
+		TaskNo:              taskNo,
 		UserID:              userID,
 		TokenID:             tokenID,
 		CapabilityCode:      capabilityCode,
@@ -106,19 +128,25 @@ func createGeneration(c *gin.Context, capabilityCode string) {
 		MappedParams:        mappedParams,
 		CallbackURL:         req.CallbackURL,
 		Cost:                price,
+		PriceDetail:         breakdown,
 	})
 	if err != nil {
-		if price > 0 {
-			_ = billingService.Refund(tokenID, userID, price)
+		rateLimitService.ReleaseTask(c.Request.Context(), tokenID, taskNo)
+		if tokenPolicyRejected(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInsufficientUserBalance) || errors.Is(err, service.ErrBillingTargetNotFound) {
+			badRequest(c, perrors.WithMessage(perrors.ErrInsufficientQuota, err.Error()))
+			return
 		}
-		internalError(c, errors.WithMessage(errors.ErrInternalError, "create task error"))
+		internalError(c, perrors.WithMessage(perrors.ErrInternalError, "create task error"))
 		return
 	}
 
-	// 6. 入队异步任务
+	// 7. 入队异步任务
 	if err := worker.EnqueueTaskSubmit(task.ID); err != nil {
 		taskService.UpdateTaskFail(task.ID, "enqueue task error")
-		internalError(c, errors.WithMessage(errors.ErrInternalError, "enqueue task error"))
+		internalError(c, perrors.WithMessage(perrors.ErrInternalError, "enqueue task error"))
 		return
 	}
 
@@ -0,0 +1,40 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majingzhen/prism/pkg/storage"
+)
+
+// ServeLocalFile 提供本地存储文件下载（校验签名，支持 Range 请求）
+func ServeLocalFile(c *gin.Context) {
+	local, ok := storage.DefaultStorage.(*storage.LocalStorage)
+	if !ok {
+		errorResponse(c, http.StatusNotFound, 404, "file not found")
+		return
+	}
+
+	file, err := local.Open(c.Param("filepath"), c.Query("expires"), c.Query("sign"))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidSignature):
+			errorResponse(c, http.StatusForbidden, 403, "invalid signature")
+		case errors.Is(err, storage.ErrURLExpired):
+			errorResponse(c, http.StatusForbidden, 403, "url expired")
+		default:
+			errorResponse(c, http.StatusNotFound, 404, "file not found")
+		}
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		errorResponse(c, http.StatusNotFound, 404, "file not found")
+		return
+	}
+
+	http.ServeContent(c.Writer, c.Request, stat.Name(), stat.ModTime(), file)
+}
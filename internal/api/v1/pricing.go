@@ -5,6 +5,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/service"
+	"github.com/majingzhen/prism/pkg/money"
 )
 
 // PricingCapability 价格展示用的能力信息
@@ -17,11 +19,12 @@ type PricingCapability struct {
 
 // PricingChannelModel 价格展示用的渠道模型信息
 type PricingChannelModel struct {
-	ChannelCode string  `json:"channel_code"`
-	Model       string  `json:"model"`
-	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
-	PriceUnit   string  `json:"price_unit"`
+	ChannelCode  string                `json:"channel_code"`
+	Model        string                `json:"model"`
+	Name         string                `json:"name"`
+	Price        money.Money           `json:"price"`
+	PriceUnit    string                `json:"price_unit"`
+	PricingRules []service.PricingRule `json:"pricing_rules,omitempty"` // 按请求参数调整价格的规则
 }
 
 // GetPricing 获取公开的价格列表
@@ -49,12 +52,14 @@ func GetPricing(c *gin.Context) {
 		if cc.Channel == nil || cc.Channel.Status != 1 {
 			continue
 		}
+		rules, _ := service.ParsePricingRules(cc.PricingRules)
 		ccMap[cc.CapabilityCode] = append(ccMap[cc.CapabilityCode], PricingChannelModel{
-			ChannelCode: cc.Channel.Type,
-			Model:       cc.Model,
-			Name:        cc.Name,
-			Price:       cc.Price,
-			PriceUnit:   cc.PriceUnit,
+			ChannelCode:  cc.Channel.Type,
+			Model:        cc.Model,
+			Name:         cc.Name,
+			Price:        cc.Price,
+			PriceUnit:    cc.PriceUnit,
+			PricingRules: rules,
 		})
 	}
 
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/majingzhen/prism/internal/api/middleware"
 	"github.com/majingzhen/prism/pkg/errors"
 )
 
@@ -50,3 +51,13 @@ func forbidden(c *gin.Context, err *errors.Error) {
 func internalError(c *gin.Context, err *errors.Error) {
 	errorWithErr(c, http.StatusInternalServerError, err)
 }
+
+// tokenPolicyRejected 令牌限制（过期、范围、消费上限等）导致的错误写入对应的错误码，返回是否已处理
+func tokenPolicyRejected(c *gin.Context, err error) bool {
+	status, code := middleware.TokenPolicyError(err)
+	if code == errors.ErrInternalError {
+		return false
+	}
+	errorResponse(c, status, code.Code, err.Error())
+	return true
+}
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majingzhen/prism/internal/api/middleware"
+	"github.com/majingzhen/prism/internal/service"
+)
+
+// PinTaskAsset 固定任务资源（控制台）
+func PinTaskAsset(c *gin.Context) {
+	setTaskPinned(c, middleware.GetUserID(c), true)
+}
+
+// UnpinTaskAsset 取消固定任务资源（控制台）
+func UnpinTaskAsset(c *gin.Context) {
+	setTaskPinned(c, middleware.GetUserID(c), false)
+}
+
+// setTaskPinned 设置任务资源固定状态，固定后不受保留期限清理
+func setTaskPinned(c *gin.Context, userID uint, pinned bool) {
+	taskNo := c.Param("task_no")
+
+	if err := assetService.SetPinned(taskNo, userID, pinned); err != nil {
+		switch {
+		case errors.Is(err, service.ErrTaskNotFound):
+			errorResponse(c, http.StatusNotFound, 404, "task not found")
+		case errors.Is(err, service.ErrAssetExpired):
+			errorResponse(c, http.StatusBadRequest, 400, "task assets already expired")
+		default:
+			errorResponse(c, http.StatusInternalServerError, 500, err.Error())
+		}
+		return
+	}
+
+	successResponse(c, gin.H{"task_id": taskNo, "pinned": pinned})
+}
+
+// GetStorageUsage 存储用量报表（按用户和能力统计）
+func GetStorageUsage(c *gin.Context) {
+	byUser, byCapability, err := assetService.StorageUsage()
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, 500, err.Error())
+		return
+	}
+
+	var totalSize, totalTasks int64
+	for _, item := range byCapability {
+		totalSize += item.TotalSize
+		totalTasks += item.TaskCount
+	}
+
+	successResponse(c, gin.H{
+		"total_size":    totalSize,
+		"task_count":    totalTasks,
+		"by_user":       byUser,
+		"by_capability": byCapability,
+	})
+}
@@ -1,23 +1,24 @@
 package v1
 
 import (
-	"encoding/json"
-
 	"github.com/gin-gonic/gin"
 	"github.com/majingzhen/prism/internal/api/middleware"
 	"github.com/majingzhen/prism/internal/model"
 	"github.com/majingzhen/prism/pkg/errors"
+	"github.com/majingzhen/prism/pkg/money"
+	"gorm.io/datatypes"
 )
 
 type TaskResponse struct {
-	ID        string         `json:"id"`
-	Status    string         `json:"status"`
-	Progress  int            `json:"progress"`
-	Result    map[string]any `json:"result,omitempty"`
-	Error     string         `json:"error,omitempty"`
-	Cost      float64        `json:"cost,omitempty"`
-	CreatedAt string         `json:"created_at"`
-	UpdatedAt string         `json:"updated_at"`
+	ID          string         `json:"id"`
+	Status      string         `json:"status"`
+	Progress    int            `json:"progress"`
+	Result      map[string]any `json:"result,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Cost        money.Money    `json:"cost,omitempty"`
+	PriceDetail datatypes.JSON `json:"price_detail,omitempty"`
+	CreatedAt   string         `json:"created_at"`
+	UpdatedAt   string         `json:"updated_at"`
 }
 
 func GetTask(c *gin.Context) {
@@ -37,18 +38,17 @@ func GetTask(c *gin.Context) {
 	}
 
 	resp := TaskResponse{
-		ID:        task.TaskNo,
-		Status:    string(task.Status),
-		Progress:  task.Progress,
-		Cost:      task.Cost,
-		CreatedAt: task.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt: task.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		ID:          task.TaskNo,
+		Status:      string(task.Status),
+		Progress:    task.Progress,
+		Cost:        task.Cost,
+		PriceDetail: task.PriceDetail,
+		CreatedAt:   task.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:   task.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
 
 	if task.Status == model.TaskStatusSuccess && len(task.Result) > 0 {
-		var result map[string]any
-		json.Unmarshal(task.Result, &result)
-		resp.Result = result
+		resp.Result = assetService.ResolveResultJSON(c.Request.Context(), task.Result)
 	}
 
 	if task.Status == model.TaskStatusFailed {
@@ -1,21 +1,38 @@
 package v1
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/majingzhen/prism/internal/api/middleware"
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/service"
 	"github.com/majingzhen/prism/pkg/errors"
+	"github.com/majingzhen/prism/pkg/money"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
+var tokenKeyService = service.NewTokenKeyService()
+
 type CreateTokenRequest struct {
 	Name              string                 `json:"name" binding:"required,max=50"`
-	Balance           float64                `json:"balance"`
+	BudgetLimit       *money.Money           `json:"budget_limit" binding:"omitempty,min=0"` // 不传或 null 不限制预算
+	RateLimit         int                    `json:"rate_limit" binding:"min=0"`
+	TPMLimit          int                    `json:"tpm_limit" binding:"min=0"`
+	ConcurrencyLimit  int                    `json:"concurrency_limit" binding:"min=0"`
 	ChannelPriorities []ChannelPriorityInput `json:"channel_priorities"`
+
+	DailyLimit          money.Money `json:"daily_limit" binding:"min=0"`
+	MonthlyLimit        money.Money `json:"monthly_limit" binding:"min=0"`
+	ExpiresAt           *time.Time  `json:"expires_at"`
+	AllowedCapabilities []string    `json:"allowed_capabilities"`
+	AllowedModels       []string    `json:"allowed_models"`
+	AllowedIPs          []string    `json:"allowed_ips"`
+	ReadOnly            bool        `json:"read_only"`
 }
 
 type ChannelPriorityInput struct {
@@ -26,7 +43,50 @@ type ChannelPriorityInput struct {
 
 type UpdateTokenRequest struct {
 	Name              string                 `json:"name" binding:"max=50"`
+	RateLimit         *int                   `json:"rate_limit" binding:"omitempty,min=0"`
+	TPMLimit          *int                   `json:"tpm_limit" binding:"omitempty,min=0"`
+	ConcurrencyLimit  *int                   `json:"concurrency_limit" binding:"omitempty,min=0"`
 	ChannelPriorities []ChannelPriorityInput `json:"channel_priorities"`
+
+	// 令牌限制，未提供的字段不修改；列表传 [] 清空，expires_at 传 null 取消过期时间，budget_limit 传 null 不限制预算
+	BudgetLimit         optionalMoney `json:"budget_limit"`
+	DailyLimit          *money.Money  `json:"daily_limit" binding:"omitempty,min=0"`
+	MonthlyLimit        *money.Money  `json:"monthly_limit" binding:"omitempty,min=0"`
+	ExpiresAt           optionalTime  `json:"expires_at"`
+	AllowedCapabilities []string      `json:"allowed_capabilities"`
+	AllowedModels       []string      `json:"allowed_models"`
+	AllowedIPs          []string      `json:"allowed_ips"`
+	ReadOnly            *bool         `json:"read_only"`
+}
+
+// optionalTime 区分未提供和显式传 null 的时间字段
+type optionalTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (t *optionalTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		t.Value = nil
+		return nil
+	}
+	return json.Unmarshal(data, &t.Value)
+}
+
+// optionalMoney 区分未提供和显式传 null 的金额字段
+type optionalMoney struct {
+	Set   bool
+	Value *money.Money
+}
+
+func (m *optionalMoney) UnmarshalJSON(data []byte) error {
+	m.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		m.Value = nil
+		return nil
+	}
+	return json.Unmarshal(data, &m.Value)
 }
 
 func ListMyTokens(c *gin.Context) {
@@ -62,15 +122,26 @@ func ListMyTokens(c *gin.Context) {
 	result := make([]gin.H, len(tokens))
 	for i, t := range tokens {
 		result[i] = gin.H{
-			"id":                 t.ID,
-			"name":               t.Name,
-			"key":                t.Key,
-			"balance":            t.Balance,
-			"total_used":         t.TotalUsed,
-			"rate_limit":         t.RateLimit,
-			"status":             t.Status,
-			"created_at":         t.CreatedAt,
-			"channel_priorities": priorityMap[t.ID],
+			"id":                t.ID,
+			"name":              t.Name,
+			"key_prefix":        t.KeyPrefix,
+			"budget_limit":      budgetLimit(&t),
+			"total_used":        t.TotalUsed,
+			"budget_remaining":  budgetRemaining(&t),
+			"rate_limit":        t.RateLimit,
+			"tpm_limit":         t.TPMLimit,
+			"concurrency_limit": t.ConcurrencyLimit,
+			"status":            t.Status,
+
+			"daily_limit":          t.DailyLimit,
+			"monthly_limit":        t.MonthlyLimit,
+			"expires_at":           t.ExpiresAt,
+			"allowed_capabilities": service.ParseStringList(t.AllowedCapabilities),
+			"allowed_models":       service.ParseStringList(t.AllowedModels),
+			"allowed_ips":          service.ParseStringList(t.AllowedIPs),
+			"read_only":            t.ReadOnly,
+			"created_at":           t.CreatedAt,
+			"channel_priorities":   priorityMap[t.ID],
 		}
 	}
 
@@ -85,23 +156,43 @@ func CreateToken(c *gin.Context) {
 		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, err.Error()))
 		return
 	}
+	if err := service.ValidateIPAllowlist(req.AllowedIPs); err != nil {
+		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
 
-	key := generateAPIKey()
+	// 完整密钥只在创建响应中返回，数据库只保存摘要和可见前缀
+	key, keyHash, keyPrefix := tokenKeyService.Generate()
 
 	token := &model.Token{
-		UserID:    userID,
-		Name:      req.Name,
-		Key:       key,
-		Balance:   req.Balance,
-		RateLimit: 60,
-		Status:    1,
+		UserID:           userID,
+		Name:             req.Name,
+		KeyHash:          keyHash,
+		KeyPrefix:        keyPrefix,
+		RateLimit:        req.RateLimit,
+		TPMLimit:         req.TPMLimit,
+		ConcurrencyLimit: req.ConcurrencyLimit,
+		BudgetEnabled:    req.BudgetLimit != nil,
+		Status:           1,
+		WebhookSecret:    service.GenerateWebhookSecret(),
+
+		DailyLimit:          req.DailyLimit,
+		MonthlyLimit:        req.MonthlyLimit,
+		ExpiresAt:           req.ExpiresAt,
+		AllowedCapabilities: stringListJSON(req.AllowedCapabilities),
+		AllowedModels:       stringListJSON(req.AllowedModels),
+		AllowedIPs:          stringListJSON(req.AllowedIPs),
+		ReadOnly:            req.ReadOnly,
+	}
+
+	if req.BudgetLimit != nil {
+		token.BudgetLimit = *req.BudgetLimit
 	}
 
 	err := model.DB().Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(token).Error; err != nil {
 			return err
 		}
-
 		if len(req.ChannelPriorities) > 0 {
 			return saveChannelPriorities(tx, token.ID, req.ChannelPriorities)
 		}
@@ -114,10 +205,12 @@ func CreateToken(c *gin.Context) {
 	}
 
 	successResponse(c, gin.H{
-		"id":      token.ID,
-		"name":    token.Name,
-		"key":     key,
-		"balance": token.Balance,
+		"id":             token.ID,
+		"name":           token.Name,
+		"key":            key,
+		"key_prefix":     keyPrefix,
+		"budget_limit":   budgetLimit(token),
+		"webhook_secret": token.WebhookSecret,
 	})
 }
 
@@ -151,15 +244,27 @@ func GetToken(c *gin.Context) {
 	}
 
 	successResponse(c, gin.H{
-		"id":                 token.ID,
-		"name":               token.Name,
-		"key":                token.Key,
-		"balance":            token.Balance,
-		"total_used":         token.TotalUsed,
-		"rate_limit":         token.RateLimit,
-		"status":             token.Status,
-		"created_at":         token.CreatedAt,
-		"channel_priorities": priorityList,
+		"id":                token.ID,
+		"name":              token.Name,
+		"key_prefix":        token.KeyPrefix,
+		"budget_limit":      budgetLimit(&token),
+		"total_used":        token.TotalUsed,
+		"budget_remaining":  budgetRemaining(&token),
+		"rate_limit":        token.RateLimit,
+		"tpm_limit":         token.TPMLimit,
+		"concurrency_limit": token.ConcurrencyLimit,
+		"status":            token.Status,
+
+		"daily_limit":          token.DailyLimit,
+		"monthly_limit":        token.MonthlyLimit,
+		"expires_at":           token.ExpiresAt,
+		"allowed_capabilities": service.ParseStringList(token.AllowedCapabilities),
+		"allowed_models":       service.ParseStringList(token.AllowedModels),
+		"allowed_ips":          service.ParseStringList(token.AllowedIPs),
+		"read_only":            token.ReadOnly,
+		"webhook_secret":       token.WebhookSecret,
+		"created_at":           token.CreatedAt,
+		"channel_priorities":   priorityList,
 	})
 }
 
@@ -185,6 +290,14 @@ func UpdateToken(c *gin.Context) {
 		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, err.Error()))
 		return
 	}
+	if err := service.ValidateIPAllowlist(req.AllowedIPs); err != nil {
+		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+	if req.BudgetLimit.Value != nil && *req.BudgetLimit.Value < 0 {
+		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, "budget_limit must be >= 0"))
+		return
+	}
 
 	err := model.DB().Transaction(func(tx *gorm.DB) error {
 		// 更新名称（如果提供）
@@ -194,6 +307,54 @@ func UpdateToken(c *gin.Context) {
 			}
 		}
 
+		// 更新限流设置，0 表示使用用户等级的上限
+		limits := map[string]any{}
+		if req.RateLimit != nil {
+			limits["rate_limit"] = *req.RateLimit
+		}
+		if req.TPMLimit != nil {
+			limits["tpm_limit"] = *req.TPMLimit
+		}
+		if req.ConcurrencyLimit != nil {
+			limits["concurrency_limit"] = *req.ConcurrencyLimit
+		}
+
+		// 更新预算、消费上限、过期时间、调用范围和只读设置
+		// 关闭预算时同时清零预算上限
+		if req.BudgetLimit.Set {
+			limits["budget_enabled"] = req.BudgetLimit.Value != nil
+			limits["budget_limit"] = money.Money(0)
+			if req.BudgetLimit.Value != nil {
+				limits["budget_limit"] = *req.BudgetLimit.Value
+			}
+		}
+		if req.DailyLimit != nil {
+			limits["daily_limit"] = *req.DailyLimit
+		}
+		if req.MonthlyLimit != nil {
+			limits["monthly_limit"] = *req.MonthlyLimit
+		}
+		if req.ExpiresAt.Set {
+			limits["expires_at"] = req.ExpiresAt.Value
+		}
+		if req.AllowedCapabilities != nil {
+			limits["allowed_capabilities"] = stringListJSON(req.AllowedCapabilities)
+		}
+		if req.AllowedModels != nil {
+			limits["allowed_models"] = stringListJSON(req.AllowedModels)
+		}
+		if req.AllowedIPs != nil {
+			limits["allowed_ips"] = stringListJSON(req.AllowedIPs)
+		}
+		if req.ReadOnly != nil {
+			limits["read_only"] = *req.ReadOnly
+		}
+		if len(limits) > 0 {
+			if err := tx.Model(&token).Updates(limits).Error; err != nil {
+				return err
+			}
+		}
+
 		// 更新渠道优先级配置
 		if req.ChannelPriorities != nil {
 			// 删除旧配置
@@ -212,6 +373,7 @@ func UpdateToken(c *gin.Context) {
 		internalError(c, errors.ErrInternalError)
 		return
 	}
+	tokenKeyService.Invalidate(c.Request.Context(), token.KeyHash)
 
 	successResponse(c, gin.H{"updated": true})
 }
@@ -226,13 +388,13 @@ func DeleteToken(c *gin.Context) {
 		return
 	}
 
+	var token model.Token
 	err := model.DB().Transaction(func(tx *gorm.DB) error {
-		result := tx.Model(&model.Token{}).Where("id = ? AND user_id = ?", id, userID).Delete(&model.Token{})
-		if result.Error != nil {
-			return result.Error
+		if err := tx.Select("id", "key_hash").Where("id = ? AND user_id = ?", id, userID).First(&token).Error; err != nil {
+			return err
 		}
-		if result.RowsAffected == 0 {
-			return gorm.ErrRecordNotFound
+		if err := tx.Delete(&token).Error; err != nil {
+			return err
 		}
 		// 删除关联的渠道优先级配置
 		return tx.Where("token_id = ?", id).Delete(&model.TokenChannelPriority{}).Error
@@ -246,57 +408,35 @@ func DeleteToken(c *gin.Context) {
 		internalError(c, errors.ErrInternalError)
 		return
 	}
+	tokenKeyService.Invalidate(c.Request.Context(), token.KeyHash)
 
 	successResponse(c, gin.H{"deleted": true})
 }
 
-type RechargeTokenRequest struct {
-	Amount float64 `json:"amount" binding:"required,gt=0"`
-}
-
-func RechargeToken(c *gin.Context) {
-	userID := middleware.GetUserID(c)
-	tokenID := c.Param("id")
-
-	var id uint
-	if _, err := fmt.Sscanf(tokenID, "%d", &id); err != nil {
-		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, "invalid token id"))
-		return
-	}
-
-	var req RechargeTokenRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, err.Error()))
-		return
-	}
-
-	result := model.DB().Model(&model.Token{}).
-		Where("id = ? AND user_id = ?", id, userID).
-		UpdateColumn("balance", gorm.Expr("balance + ?", req.Amount))
-
-	if result.Error != nil {
-		internalError(c, errors.ErrInternalError)
-		return
+// budgetLimit 令牌预算上限，未启用预算时返回 nil
+func budgetLimit(token *model.Token) *money.Money {
+	if !token.BudgetEnabled {
+		return nil
 	}
+	return &token.BudgetLimit
+}
 
-	if result.RowsAffected == 0 {
-		notFound(c, errors.ErrTaskNotFound)
-		return
+// budgetRemaining 令牌预算剩余额度，未启用预算时返回 nil
+func budgetRemaining(token *model.Token) *money.Money {
+	if !token.BudgetEnabled {
+		return nil
 	}
-
-	var token model.Token
-	model.DB().First(&token, id)
-
-	successResponse(c, gin.H{
-		"id":      token.ID,
-		"balance": token.Balance,
-	})
+	remaining := max(token.BudgetLimit-token.TotalUsed, 0)
+	return &remaining
 }
 
-func generateAPIKey() string {
-	bytes := make([]byte, 24)
-	rand.Read(bytes)
-	return "sk-prism-" + hex.EncodeToString(bytes)
+// stringListJSON 字符串列表转为 JSON 数组，nil 时不保存
+func stringListJSON(list []string) datatypes.JSON {
+	if list == nil {
+		return nil
+	}
+	data, _ := json.Marshal(list)
+	return data
 }
 
 // saveChannelPriorities 保存渠道优先级配置
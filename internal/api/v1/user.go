@@ -4,8 +4,11 @@ import (
 	"fmt"
 
 	"github.com/gin-gonic/gin"
+	"github.com/majingzhen/prism/internal/api/middleware"
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/service"
 	"github.com/majingzhen/prism/pkg/errors"
+	"github.com/majingzhen/prism/pkg/money"
 )
 
 func ListUsers(c *gin.Context) {
@@ -21,6 +24,7 @@ func ListUsers(c *gin.Context) {
 			"id":         u.ID,
 			"username":   u.Username,
 			"role":       u.Role,
+			"tier":       u.Tier,
 			"balance":    u.Balance,
 			"status":     u.Status,
 			"created_at": u.CreatedAt,
@@ -57,6 +61,33 @@ func UpdateUserRole(c *gin.Context) {
 	successResponse(c, gin.H{"updated": true})
 }
 
+type UpdateTierRequest struct {
+	Tier string `json:"tier" binding:"required,max=20"`
+}
+
+func UpdateUserTier(c *gin.Context) {
+	userID := c.Param("id")
+
+	var req UpdateTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	var id uint
+	if _, err := fmt.Sscanf(userID, "%d", &id); err != nil {
+		badRequest(c, errors.WithMessage(errors.ErrInvalidParams, "invalid user id"))
+		return
+	}
+
+	if err := userService.UpdateUserTier(id, req.Tier); err != nil {
+		internalError(c, errors.ErrInternalError)
+		return
+	}
+
+	successResponse(c, gin.H{"updated": true})
+}
+
 type UpdateStatusRequest struct {
 	Status int8 `json:"status" binding:"oneof=0 1"`
 }
@@ -85,7 +116,8 @@ func UpdateUserStatus(c *gin.Context) {
 }
 
 type RechargeRequest struct {
-	Amount float64 `json:"amount" binding:"required,gt=0"`
+	Amount money.Money `json:"amount" binding:"required,gt=0"`
+	Remark string      `json:"remark" binding:"max=255"`
 }
 
 func RechargeUser(c *gin.Context) {
@@ -103,7 +135,11 @@ func RechargeUser(c *gin.Context) {
 		return
 	}
 
-	if err := userService.RechargeUser(id, req.Amount); err != nil {
+	if err := userService.RechargeUser(id, req.Amount, middleware.GetUserID(c), req.Remark); err != nil {
+		if err == service.ErrBillingTargetNotFound {
+			notFound(c, errors.WithMessage(errors.ErrInvalidParams, "user not found"))
+			return
+		}
 		internalError(c, errors.ErrInternalError)
 		return
 	}
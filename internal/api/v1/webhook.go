@@ -0,0 +1,229 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majingzhen/prism/internal/api/middleware"
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/service"
+	perrors "github.com/majingzhen/prism/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// defaultRedeliverLimit 批量重新投递默认数量上限
+const defaultRedeliverLimit = 500
+
+var webhookService = service.NewWebhookService()
+
+// RedeliverTask 重新投递任务回调
+func RedeliverTask(c *gin.Context) {
+	taskNo := c.Param("task_no")
+	token := middleware.GetToken(c)
+	if token == nil {
+		errorResponse(c, http.StatusUnauthorized, 401, "unauthorized")
+		return
+	}
+
+	if err := webhookService.Redeliver(taskNo, token.UserID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrTaskNotFound):
+			errorResponse(c, http.StatusNotFound, 404, "task not found")
+		case errors.Is(err, service.ErrWebhookNoCallback), errors.Is(err, service.ErrWebhookNotFinal):
+			errorResponse(c, http.StatusBadRequest, 400, err.Error())
+		default:
+			errorResponse(c, http.StatusInternalServerError, 500, err.Error())
+		}
+		return
+	}
+
+	successResponse(c, gin.H{"task_id": taskNo, "callback_status": "pending"})
+}
+
+type RedeliverFailedRequest struct {
+	Since string `json:"since"` // RFC3339，只投递该时间之后完成的任务
+	Limit int    `json:"limit"`
+}
+
+// RedeliverFailedWebhooks 批量重新投递失败的回调（管理员）
+func RedeliverFailedWebhooks(c *gin.Context) {
+	var req RedeliverFailedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	var since time.Time
+	if req.Since != "" {
+		t, err := time.Parse(time.RFC3339, req.Since)
+		if err != nil {
+			badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, "invalid since"))
+			return
+		}
+		since = t
+	}
+	if req.Limit <= 0 || req.Limit > defaultRedeliverLimit {
+		req.Limit = defaultRedeliverLimit
+	}
+
+	count, err := webhookService.RedeliverFailed(since, req.Limit)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, 500, err.Error())
+		return
+	}
+
+	successResponse(c, gin.H{"count": count})
+}
+
+// ListWebhookDeliveries 获取回调投递记录（管理员）
+func ListWebhookDeliveries(c *gin.Context) {
+	var req service.ListDeliveriesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	items, total, err := webhookService.ListDeliveries(&req)
+	if err != nil {
+		internalError(c, perrors.ErrInternalError)
+		return
+	}
+
+	successResponse(c, gin.H{
+		"items":     items,
+		"total":     total,
+		"page":      req.Page,
+		"page_size": req.PageSize,
+	})
+}
+
+// RotateWebhookSecret 重新生成令牌回调签名密钥
+func RotateWebhookSecret(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, "invalid token id"))
+		return
+	}
+
+	secret, err := webhookService.RotateSecret(id, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			notFound(c, perrors.ErrTaskNotFound)
+			return
+		}
+		internalError(c, perrors.ErrInternalError)
+		return
+	}
+
+	successResponse(c, gin.H{"id": id, "webhook_secret": secret})
+}
+
+// ListTokenWebhooks 获取令牌的事件订阅
+func ListTokenWebhooks(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var tokenID uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &tokenID); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, "invalid token id"))
+		return
+	}
+
+	subs, err := webhookService.ListSubscriptions(tokenID, userID)
+	if err != nil {
+		internalError(c, perrors.ErrInternalError)
+		return
+	}
+
+	successResponse(c, gin.H{"items": subs, "events": model.WebhookEvents})
+}
+
+// CreateTokenWebhook 创建令牌事件订阅
+func CreateTokenWebhook(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var tokenID uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &tokenID); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, "invalid token id"))
+		return
+	}
+
+	var req service.SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	sub, err := webhookService.CreateSubscription(tokenID, userID, &req)
+	if err != nil {
+		webhookSubscriptionError(c, err)
+		return
+	}
+
+	successResponse(c, sub)
+}
+
+// UpdateTokenWebhook 更新令牌事件订阅
+func UpdateTokenWebhook(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var tokenID, subID uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &tokenID); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, "invalid token id"))
+		return
+	}
+	if _, err := fmt.Sscanf(c.Param("sub_id"), "%d", &subID); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, "invalid subscription id"))
+		return
+	}
+
+	var req service.SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, err.Error()))
+		return
+	}
+
+	if err := webhookService.UpdateSubscription(subID, tokenID, userID, &req); err != nil {
+		webhookSubscriptionError(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{"updated": true})
+}
+
+// DeleteTokenWebhook 删除令牌事件订阅
+func DeleteTokenWebhook(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var tokenID, subID uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &tokenID); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, "invalid token id"))
+		return
+	}
+	if _, err := fmt.Sscanf(c.Param("sub_id"), "%d", &subID); err != nil {
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, "invalid subscription id"))
+		return
+	}
+
+	if err := webhookService.DeleteSubscription(subID, tokenID, userID); err != nil {
+		webhookSubscriptionError(c, err)
+		return
+	}
+
+	successResponse(c, gin.H{"deleted": true})
+}
+
+func webhookSubscriptionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrWebhookNotFound):
+		errorResponse(c, http.StatusNotFound, 404, err.Error())
+	case errors.Is(err, service.ErrWebhookInvalidURL), errors.Is(err, service.ErrWebhookEvents):
+		badRequest(c, perrors.WithMessage(perrors.ErrInvalidParams, err.Error()))
+	default:
+		internalError(c, perrors.ErrInternalError)
+	}
+}
@@ -38,6 +38,10 @@ func AutoMigrate() error {
 		&Task{},
 		&ChannelRequestLog{},
 		&TokenChannelPriority{},
+		&WebhookDelivery{},
+		&WebhookSubscription{},
+		&File{},
+		&BillingTransaction{},
 		// Chat 相关表
 		&ChatModel{},
 		&ChatModelChannel{},
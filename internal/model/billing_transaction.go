@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"github.com/majingzhen/prism/pkg/money"
+)
+
+// BillingTransaction 账务流水，记录每一次用户钱包余额的变动，只追加不修改
+// 金额为带符号的变动值，扣费为负、退款和充值为正；令牌金额为令牌预算的变动，与用户金额同号，不涉及令牌时为 0
+type BillingTransaction struct {
+	ID               uint        `gorm:"primarykey;comment:主键ID" json:"id"`
+	Type             string      `gorm:"type:varchar(20);not null;index;comment:类型(deduct/refund/recharge/adjustment)" json:"type"`
+	UserID           uint        `gorm:"default:0;index;comment:用户ID" json:"user_id"`
+	TokenID          uint        `gorm:"default:0;index;comment:令牌ID" json:"token_id"`
+	UserAmount       money.Money `gorm:"type:decimal(20,6);default:0;comment:用户余额变动" json:"user_amount"`
+	TokenAmount      money.Money `gorm:"type:decimal(20,6);default:0;comment:令牌预算变动" json:"token_amount"`
+	UserBalanceAfter money.Money `gorm:"type:decimal(20,6);default:0;comment:变动后用户余额" json:"user_balance_after"`
+	TokenUsedAfter   money.Money `gorm:"type:decimal(20,6);default:0;comment:变动后令牌累计消费" json:"token_used_after"`
+	TaskID           uint        `gorm:"default:0;index;comment:关联任务ID" json:"task_id,omitempty"`
+	TaskNo           string      `gorm:"type:varchar(32);comment:关联任务编号" json:"task_no,omitempty"`
+	ConversationID   uint        `gorm:"default:0;index;comment:关联对话ID" json:"conversation_id,omitempty"`
+	MessageID        uint        `gorm:"default:0;comment:关联消息ID" json:"message_id,omitempty"`
+	OperatorID       uint        `gorm:"default:0;comment:操作人ID" json:"operator_id,omitempty"`
+	Remark           string      `gorm:"type:varchar(255);comment:备注" json:"remark,omitempty"`
+	CreatedAt        time.Time   `gorm:"index;comment:创建时间" json:"created_at"`
+}
+
+func (BillingTransaction) TableName() string {
+	return "billing_transactions"
+}
+
+// 账务流水类型
+const (
+	BillingTypeDeduct     = "deduct"
+	BillingTypeRefund     = "refund"
+	BillingTypeRecharge   = "recharge"
+	BillingTypeAdjustment = "adjustment"
+)
@@ -14,6 +14,8 @@ type Capability struct {
 	Description      string         `gorm:"type:text;comment:能力描述" json:"description"`
 	StandardParams   datatypes.JSON `gorm:"type:json;comment:标准参数定义" json:"standard_params"`
 	StandardResponse datatypes.JSON `gorm:"type:json;comment:标准响应定义" json:"standard_response"`
+	AssetVisibility  string         `gorm:"type:varchar(10);default:'';comment:结果存储可见性(public/private,空则跟随全局配置)" json:"asset_visibility"`
+	RetentionDays    int            `gorm:"default:0;comment:结果保留天数(0则跟随用户等级/全局配置,-1永久保留)" json:"retention_days"`
 	Status           int8           `gorm:"default:1;comment:状态(1启用/0禁用)" json:"status"`
 	CreatedAt        time.Time      `gorm:"comment:创建时间" json:"created_at"`
 	UpdatedAt        time.Time      `gorm:"comment:更新时间" json:"updated_at"`
@@ -27,6 +29,15 @@ const (
 	CapabilityTypeOther = "other"
 )
 
+// 结果存储可见性常量
+const (
+	AssetVisibilityPublic  = "public"
+	AssetVisibilityPrivate = "private"
+)
+
+// RetentionForever 能力结果永久保留，不受用户等级和全局默认保留天数影响
+const RetentionForever = -1
+
 func (Capability) TableName() string {
 	return "capabilities"
 }
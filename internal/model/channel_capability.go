@@ -1,18 +1,22 @@
 package model
 
 import (
+	"github.com/majingzhen/prism/pkg/money"
 	"gorm.io/datatypes"
 )
 
 // ChannelCapability 渠道能力实现
 type ChannelCapability struct {
 	BaseModel
-	ChannelID      uint    `gorm:"not null;index;comment:渠道ID" json:"channel_id"`
-	CapabilityCode string  `gorm:"type:varchar(30);not null;index;comment:能力编码" json:"capability_code"`
-	Model          string  `gorm:"type:varchar(50);comment:模型标识" json:"model"`
-	Name           string  `gorm:"type:varchar(100);comment:配置名称" json:"name"`
-	Price          float64 `gorm:"type:decimal(10,4);default:0;comment:单次调用价格" json:"price"`
-	PriceUnit      string  `gorm:"type:varchar(20);default:'request';comment:计价单位" json:"price_unit"`
+	ChannelID      uint        `gorm:"not null;index;comment:渠道ID" json:"channel_id"`
+	CapabilityCode string      `gorm:"type:varchar(30);not null;index;comment:能力编码" json:"capability_code"`
+	Model          string      `gorm:"type:varchar(50);comment:模型标识" json:"model"`
+	Name           string      `gorm:"type:varchar(100);comment:配置名称" json:"name"`
+	Price          money.Money `gorm:"type:decimal(20,6);default:0;comment:单次调用价格" json:"price"`
+	PriceUnit      string      `gorm:"type:varchar(20);default:'request';comment:计价单位" json:"price_unit"`
+
+	// 计价规则（按时长、分辨率、数量等请求参数调整价格）
+	PricingRules datatypes.JSON `gorm:"type:json;comment:计价规则" json:"pricing_rules"`
 
 	// 请求配置
 	ResultMode    string `gorm:"type:varchar(10);default:'poll';comment:结果模式(sync/poll/callback)" json:"result_mode"`
@@ -30,9 +34,24 @@ type ChannelCapability struct {
 	PollMethod          string         `gorm:"type:varchar(10);default:'GET';comment:轮询方法" json:"poll_method"`
 	PollInterval        int            `gorm:"default:5;comment:轮询间隔(秒)" json:"poll_interval"`
 	PollMaxAttempts     int            `gorm:"default:60;comment:最大轮询次数" json:"poll_max_attempts"`
+	PollInitialDelay    int            `gorm:"default:0;comment:首次轮询延迟(秒,0为轮询间隔)" json:"poll_initial_delay"`
+	PollBackoff         string         `gorm:"type:varchar(20);default:'fixed';comment:轮询退避策略(fixed/exponential/stepped)" json:"poll_backoff"`
+	PollBackoffFactor   float64        `gorm:"type:decimal(5,2);default:2;comment:指数退避倍数" json:"poll_backoff_factor"`
+	PollSteps           datatypes.JSON `gorm:"type:json;comment:阶梯轮询间隔(秒数组,超出后使用最后一项)" json:"poll_steps"`
+	PollJitter          float64        `gorm:"type:decimal(3,2);default:0;comment:轮询间隔抖动比例(0-1)" json:"poll_jitter"`
+	PollMaxInterval     int            `gorm:"default:0;comment:最大轮询间隔(秒,0不限制)" json:"poll_max_interval"`
+	PollDeadline        int            `gorm:"default:0;comment:轮询总时限(秒,0不限制)" json:"poll_deadline"`
 	PollParamMapping    datatypes.JSON `gorm:"type:json;comment:轮询参数映射" json:"poll_param_mapping"`
 	PollResponseMapping datatypes.JSON `gorm:"type:json;comment:轮询响应映射" json:"poll_response_mapping"`
 
+	// 请求模板（方法、地址、query、请求头、请求体，支持变量和签名）
+	SubmitTemplate datatypes.JSON `gorm:"type:json;comment:提交请求模板" json:"submit_template"`
+	PollTemplate   datatypes.JSON `gorm:"type:json;comment:轮询请求模板" json:"poll_template"`
+	CancelTemplate datatypes.JSON `gorm:"type:json;comment:取消请求模板" json:"cancel_template"`
+
+	// 提交前置步骤（如先上传输入文件，输出参与参数映射）
+	PreSubmitSteps datatypes.JSON `gorm:"type:json;comment:提交前置步骤" json:"pre_submit_steps"`
+
 	// 映射配置
 	ParamMapping    datatypes.JSON `gorm:"type:json;comment:参数映射配置" json:"param_mapping"`
 	ResponseMapping datatypes.JSON `gorm:"type:json;comment:响应映射配置" json:"response_mapping"`
@@ -50,6 +69,13 @@ func (ChannelCapability) TableName() string {
 	return "channel_capabilities"
 }
 
+// 轮询退避策略
+const (
+	PollBackoffFixed       = "fixed"
+	PollBackoffExponential = "exponential"
+	PollBackoffStepped     = "stepped"
+)
+
 // 结果模式常量
 const (
 	ResultModeSync     = "sync"
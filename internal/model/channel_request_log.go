@@ -10,6 +10,11 @@ const (
 	RequestTypePoll     RequestType = "poll"     // 轮询任务状态
 	RequestTypeCallback RequestType = "callback" // 发送回调给调用方
 	RequestTypeChat     RequestType = "chat"     // Chat 对话请求
+	RequestTypeCancel   RequestType = "cancel"   // 取消第三方任务
+
+	RequestTypePreSubmit RequestType = "pre_submit" // 提交前置步骤（如上传输入文件）
+
+	RequestTypeVendorCallback RequestType = "vendor_callback" // 接收供应商回调
 )
 
 // ChannelRequestLog 渠道请求日志
@@ -22,7 +27,7 @@ type ChannelRequestLog struct {
 	AccountID      uint   `gorm:"comment:渠道账号ID" json:"account_id"`
 	CapabilityCode string `gorm:"type:varchar(50);index;comment:能力编码或模型编码" json:"capability_code"`
 
-	// 请求类型: submit(提交) / poll(轮询) / callback(回调通知) / chat(对话)
+	// 请求类型: submit(提交) / poll(轮询) / callback(回调通知) / chat(对话) / vendor_callback(供应商回调) / cancel(取消) / pre_submit(提交前置步骤)
 	RequestType RequestType `gorm:"type:varchar(20);index;comment:请求类型" json:"request_type"`
 
 	// 请求信息
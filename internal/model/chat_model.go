@@ -7,6 +7,7 @@ type ChatModel struct {
 	Name        string `gorm:"type:varchar(100);not null;comment:显示名称" json:"name"`
 	Provider    string `gorm:"type:varchar(30);not null;comment:提供商类型" json:"provider"`
 	Description string `gorm:"type:varchar(500);comment:模型描述" json:"description"`
+	MaxTokens   int    `gorm:"default:0;comment:默认最大输出token数(预授权估算)" json:"max_tokens"`
 	Status      int8   `gorm:"default:1;comment:状态(1启用/0禁用)" json:"status"`
 }
 
@@ -1,6 +1,10 @@
 package model
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/majingzhen/prism/pkg/money"
+)
 
 // ChatModelChannel 模型渠道映射
 type ChatModelChannel struct {
@@ -10,8 +14,8 @@ type ChatModelChannel struct {
 	VendorModel  string          `gorm:"type:varchar(50);not null;comment:供应商模型名" json:"vendor_model"`
 	Priority     int             `gorm:"default:0;comment:优先级" json:"priority"`
 	PriceMode    string          `gorm:"type:varchar(10);default:'token';comment:计价模式" json:"price_mode"`
-	InputPrice   float64         `gorm:"type:decimal(12,8);default:0;comment:输入价格($/1M tokens)" json:"input_price"`
-	OutputPrice  float64         `gorm:"type:decimal(12,8);default:0;comment:输出价格($/1M tokens)" json:"output_price"`
+	InputPrice   money.Money     `gorm:"type:decimal(20,6);default:0;comment:输入价格($/1M tokens)" json:"input_price"`
+	OutputPrice  money.Money     `gorm:"type:decimal(20,6);default:0;comment:输出价格($/1M tokens)" json:"output_price"`
 	RequestPath  string          `gorm:"type:varchar(255);default:'/v1/chat/completions';comment:请求路径" json:"request_path"`
 	Timeout      int             `gorm:"default:120;comment:超时时间" json:"timeout"`
 	ExtraHeaders json.RawMessage `gorm:"type:json;comment:额外请求头" json:"extra_headers"`
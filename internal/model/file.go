@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// File 用户通过 /v1/files 上传或导入的文件，能力参数中可通过文件ID引用
+type File struct {
+	BaseModel
+	FileID      string    `gorm:"type:varchar(40);uniqueIndex;not null;comment:文件ID" json:"file_id"`
+	UserID      uint      `gorm:"index;comment:用户ID" json:"user_id"`
+	TokenID     uint      `gorm:"index;comment:上传令牌ID" json:"token_id"`
+	Filename    string    `gorm:"type:varchar(255);comment:文件名" json:"filename"`
+	ContentType string    `gorm:"type:varchar(100);comment:内容类型" json:"content_type"`
+	Size        int64     `gorm:"default:0;comment:文件大小(字节)" json:"size"`
+	Source      string    `gorm:"type:varchar(10);default:'upload';comment:来源(upload/url)" json:"source"`
+	OriginURL   string    `gorm:"type:varchar(1000);comment:导入来源地址" json:"origin_url,omitempty"`
+	StorageKey  string    `gorm:"type:varchar(500);comment:存储对象路径" json:"-"`
+	URL         string    `gorm:"type:varchar(1000);comment:访问地址(私有存储或链接会过期时为空)" json:"-"`
+	ExpiresAt   time.Time `gorm:"index;comment:过期时间" json:"expires_at"`
+}
+
+func (File) TableName() string {
+	return "files"
+}
+
+// 文件来源
+const (
+	FileSourceUpload = "upload"
+	FileSourceURL    = "url"
+)
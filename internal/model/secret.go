@@ -0,0 +1,72 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/majingzhen/prism/pkg/secret"
+	"gorm.io/gorm/schema"
+)
+
+// SecretSerializer 字段加密保存，读取时解密，用于 gorm:"serializer:secret"
+// 通过 map 更新字段时不会经过序列化器，需要先调用 secret.Encrypt
+type SecretSerializer struct{}
+
+func init() {
+	schema.RegisterSerializer("secret", SecretSerializer{})
+}
+
+// Scan 解密数据库中的值，明文原样读取
+func (SecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		stored = string(v)
+	case string:
+		stored = v
+	default:
+		return fmt.Errorf("secret field %s: unsupported type %T", field.Name, dbValue)
+	}
+
+	plaintext, err := secret.Decrypt(stored)
+	if err != nil {
+		return fmt.Errorf("secret field %s: %w", field.Name, err)
+	}
+
+	fieldValue := reflect.New(field.FieldType).Elem()
+	switch fieldValue.Kind() {
+	case reflect.String:
+		fieldValue.SetString(plaintext)
+	case reflect.Slice:
+		if plaintext != "" {
+			fieldValue.SetBytes([]byte(plaintext))
+		}
+	default:
+		return fmt.Errorf("secret field %s: unsupported kind %s", field.Name, fieldValue.Kind())
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue)
+	return nil
+}
+
+// Value 加密字段值，空值保存为 NULL
+func (SecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue any) (any, error) {
+	var plaintext string
+	switch v := fieldValue.(type) {
+	case string:
+		plaintext = v
+	case []byte:
+		plaintext = string(v)
+	default:
+		rv := reflect.ValueOf(fieldValue)
+		if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, fmt.Errorf("secret field %s: unsupported type %T", field.Name, fieldValue)
+		}
+		plaintext = string(rv.Bytes())
+	}
+	if plaintext == "" {
+		return nil, nil
+	}
+	return secret.Encrypt(plaintext)
+}
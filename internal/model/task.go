@@ -3,6 +3,7 @@ package model
 import (
 	"time"
 
+	"github.com/majingzhen/prism/pkg/money"
 	"gorm.io/datatypes"
 )
 
@@ -34,6 +35,7 @@ type Task struct {
 	CallbackURL      string `gorm:"type:varchar(500);comment:回调地址" json:"callback_url"`
 	CallbackStatus   string `gorm:"type:varchar(20);comment:回调状态" json:"callback_status"`
 	CallbackAttempts int    `gorm:"default:0;comment:回调尝试次数" json:"callback_attempts"`
+	CallbackToken    string `gorm:"type:varchar(64);comment:供应商回调令牌" json:"-"`
 
 	RequestParams  datatypes.JSON `gorm:"type:json;comment:原始请求参数" json:"request_params"`
 	MappedParams   datatypes.JSON `gorm:"type:json;comment:映射后参数" json:"mapped_params"`
@@ -41,10 +43,21 @@ type Task struct {
 	Result         datatypes.JSON `gorm:"type:json;comment:统一结果" json:"result"`
 	ErrorMessage   string         `gorm:"type:text;comment:错误信息" json:"error_message"`
 
-	Cost        float64    `gorm:"type:decimal(10,4);comment:费用" json:"cost"`
-	Refunded    bool       `gorm:"default:false;comment:是否已退款" json:"refunded"`
-	StartedAt   *time.Time `gorm:"comment:开始时间" json:"started_at"`
-	CompletedAt *time.Time `gorm:"comment:完成时间" json:"completed_at"`
+	AssetSize      int64      `gorm:"default:0;comment:已存储资源大小(字节)" json:"asset_size"`
+	AssetExpiresAt *time.Time `gorm:"index;comment:存储资源过期时间" json:"asset_expires_at"`
+	AssetPinned    bool       `gorm:"default:false;comment:是否固定保留资源" json:"asset_pinned"`
+	AssetExpired   bool       `gorm:"default:false;comment:存储资源是否已清理" json:"asset_expired"`
+
+	// 资源删除失败后按退避时间重试，避免失败的任务一直占据清理批次
+	AssetCleanupAttempts int        `gorm:"default:0;comment:资源清理失败次数" json:"-"`
+	AssetNextCleanupAt   *time.Time `gorm:"index;comment:资源下次清理时间" json:"-"`
+
+	Cost        money.Money    `gorm:"type:decimal(20,6);comment:费用" json:"cost"`
+	PriceDetail datatypes.JSON `gorm:"type:json;comment:计价明细" json:"price_detail"`
+	SettledAt   *time.Time     `gorm:"comment:用量结算时间" json:"settled_at"`
+	Refunded    bool           `gorm:"default:false;comment:是否已退款" json:"refunded"`
+	StartedAt   *time.Time     `gorm:"comment:开始时间" json:"started_at"`
+	CompletedAt *time.Time     `gorm:"comment:完成时间" json:"completed_at"`
 
 	// 关联
 	Channel           *Channel           `gorm:"foreignKey:ChannelID" json:"channel,omitempty"`
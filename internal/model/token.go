@@ -1,14 +1,42 @@
 package model
 
+import (
+	"time"
+
+	"github.com/majingzhen/prism/pkg/money"
+	"gorm.io/datatypes"
+)
+
 type Token struct {
 	BaseModel
-	UserID    uint    `gorm:"default:0;index;comment:用户ID" json:"user_id"`
-	Key       string  `gorm:"type:varchar(64);uniqueIndex;not null;comment:API密钥" json:"key"`
-	Name      string  `gorm:"type:varchar(50);comment:令牌名称" json:"name"`
-	Balance   float64 `gorm:"type:decimal(10,4);default:0;comment:剩余额度" json:"balance"`
-	TotalUsed float64 `gorm:"type:decimal(10,4);default:0;comment:已使用额度" json:"total_used"`
-	RateLimit int     `gorm:"default:60;comment:速率限制(次/分钟)" json:"rate_limit"`
-	Status    int8    `gorm:"default:1;comment:状态(1启用/0禁用)" json:"status"`
+	UserID    uint   `gorm:"default:0;index;comment:用户ID" json:"user_id"`
+	KeyHash   string `gorm:"type:char(64);uniqueIndex;comment:API密钥SHA-256摘要" json:"-"`
+	KeyPrefix string `gorm:"type:varchar(20);comment:API密钥可见前缀" json:"key_prefix"`
+	Name      string `gorm:"type:varchar(50);comment:令牌名称" json:"name"`
+	RateLimit int    `gorm:"default:0;comment:速率限制(次/分钟,0使用等级上限)" json:"rate_limit"`
+	FileQuota int64  `gorm:"default:0;comment:文件存储配额(字节,0使用系统默认)" json:"file_quota"`
+
+	// 令牌不单独持有余额，消费从所属用户的钱包扣除；预算只限制令牌累计可用的额度
+	// 未启用预算时不限制，启用后预算为 0 表示不能再消费
+	BudgetEnabled bool        `gorm:"default:false;comment:是否限制预算" json:"budget_enabled"`
+	BudgetLimit   money.Money `gorm:"type:decimal(20,6);default:0;comment:预算上限(累计消费,启用预算时有效)" json:"budget_limit"`
+	TotalUsed     money.Money `gorm:"type:decimal(20,6);default:0;comment:累计消费" json:"total_used"`
+
+	TPMLimit         int `gorm:"default:0;comment:每分钟chat token数(0使用等级上限)" json:"tpm_limit"`
+	ConcurrencyLimit int `gorm:"default:0;comment:进行中任务数上限(0使用等级上限)" json:"concurrency_limit"`
+
+	DailyLimit   money.Money `gorm:"type:decimal(20,6);default:0;comment:每日消费上限(0不限制)" json:"daily_limit"`
+	MonthlyLimit money.Money `gorm:"type:decimal(20,6);default:0;comment:每月消费上限(0不限制)" json:"monthly_limit"`
+	ExpiresAt    *time.Time  `gorm:"comment:过期时间(空为永不过期)" json:"expires_at"`
+
+	AllowedCapabilities datatypes.JSON `gorm:"type:json;comment:允许调用的能力编码(空不限制)" json:"allowed_capabilities"`
+	AllowedModels       datatypes.JSON `gorm:"type:json;comment:允许调用的chat模型编码(空不限制)" json:"allowed_models"`
+	AllowedIPs          datatypes.JSON `gorm:"type:json;comment:来源IP白名单,支持CIDR(空不限制)" json:"allowed_ips"`
+	ReadOnly            bool           `gorm:"default:false;comment:只读(仅允许查询任务)" json:"read_only"`
+
+	WebhookSecret string `gorm:"type:varchar(64);comment:回调签名密钥" json:"-"`
+
+	Status int8 `gorm:"default:1;comment:状态(1启用/0禁用)" json:"status"`
 }
 
 func (Token) TableName() string {
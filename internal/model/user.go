@@ -1,5 +1,7 @@
 package model
 
+import "github.com/majingzhen/prism/pkg/money"
+
 type UserRole string
 
 const (
@@ -7,13 +9,17 @@ const (
 	UserRoleUser  UserRole = "user"
 )
 
+// UserTierDefault 默认用户等级
+const UserTierDefault = "default"
+
 type User struct {
 	BaseModel
-	Username string   `gorm:"type:varchar(50);uniqueIndex;not null;comment:用户名" json:"username"`
-	Password string   `gorm:"type:varchar(100);not null;comment:密码(加密)" json:"-"`
-	Role     UserRole `gorm:"type:varchar(10);default:'user';comment:角色(admin/user)" json:"role"`
-	Balance  float64  `gorm:"type:decimal(10,4);default:0;comment:账户余额" json:"balance"`
-	Status   int8     `gorm:"default:1;comment:状态(1启用/0禁用)" json:"status"`
+	Username string      `gorm:"type:varchar(50);uniqueIndex;not null;comment:用户名" json:"username"`
+	Password string      `gorm:"type:varchar(100);not null;comment:密码(加密)" json:"-"`
+	Role     UserRole    `gorm:"type:varchar(10);default:'user';comment:角色(admin/user)" json:"role"`
+	Tier     string      `gorm:"type:varchar(20);default:'default';comment:用户等级" json:"tier"`
+	Balance  money.Money `gorm:"type:decimal(20,6);default:0;comment:账户余额" json:"balance"`
+	Status   int8        `gorm:"default:1;comment:状态(1启用/0禁用)" json:"status"`
 }
 
 func (User) TableName() string {
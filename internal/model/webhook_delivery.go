@@ -0,0 +1,27 @@
+package model
+
+// WebhookDelivery 回调投递记录（每次尝试一条）
+type WebhookDelivery struct {
+	BaseModel
+	DeliveryID     string `gorm:"type:varchar(36);index;comment:投递ID(同一次投递的重试共用)" json:"delivery_id"`
+	EventID        string `gorm:"type:varchar(36);index;comment:事件ID" json:"event_id"`
+	SubscriptionID uint   `gorm:"index;comment:订阅ID(0为任务callback_url)" json:"subscription_id"`
+	TaskID         uint   `gorm:"index;comment:关联任务ID" json:"task_id"`
+	TaskNo         string `gorm:"type:varchar(32);index;comment:任务编号" json:"task_no"`
+	UserID         uint   `gorm:"index;comment:用户ID" json:"user_id"`
+	TokenID        uint   `gorm:"comment:令牌ID" json:"token_id"`
+	Event          string `gorm:"type:varchar(50);comment:事件类型" json:"event"`
+	URL            string `gorm:"type:varchar(500);comment:回调地址" json:"url"`
+	Attempt        int    `gorm:"comment:第几次尝试" json:"attempt"`
+
+	RequestBody  string `gorm:"type:text;comment:请求体" json:"request_body"`
+	StatusCode   int    `gorm:"comment:HTTP状态码" json:"status_code"`
+	ResponseBody string `gorm:"type:text;comment:响应体" json:"response_body"`
+	ErrorMessage string `gorm:"type:text;comment:错误信息" json:"error_message"`
+	DurationMs   int64  `gorm:"comment:耗时(毫秒)" json:"duration_ms"`
+	Success      bool   `gorm:"index;comment:是否成功" json:"success"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -0,0 +1,60 @@
+package model
+
+import "strings"
+
+// 回调事件类型
+const (
+	WebhookEventTaskStarted    = "task.started"
+	WebhookEventTaskProgress   = "task.progress"
+	WebhookEventTaskAssetReady = "task.asset_ready"
+	WebhookEventTaskSucceeded  = "task.succeeded"
+	WebhookEventTaskFailed     = "task.failed"
+
+	// WebhookEventAll 订阅全部事件
+	WebhookEventAll = "*"
+)
+
+// WebhookEvents 全部可订阅的事件类型
+var WebhookEvents = []string{
+	WebhookEventTaskStarted,
+	WebhookEventTaskProgress,
+	WebhookEventTaskAssetReady,
+	WebhookEventTaskSucceeded,
+	WebhookEventTaskFailed,
+}
+
+// WebhookSubscription 令牌的回调事件订阅
+type WebhookSubscription struct {
+	BaseModel
+	UserID  uint   `gorm:"index;comment:用户ID" json:"user_id"`
+	TokenID uint   `gorm:"index;comment:令牌ID" json:"token_id"`
+	URL     string `gorm:"type:varchar(500);not null;comment:回调地址" json:"url"`
+	Events  string `gorm:"type:varchar(255);comment:订阅事件(逗号分隔,*为全部)" json:"events"`
+	Status  int8   `gorm:"default:1;comment:状态(1启用/0禁用)" json:"status"`
+}
+
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// HasEvent 是否订阅了指定事件
+func (s *WebhookSubscription) HasEvent(event string) bool {
+	for _, e := range strings.Split(s.Events, ",") {
+		e = strings.TrimSpace(e)
+		if e == WebhookEventAll || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// TerminalWebhookEvent 任务终态对应的事件类型，非终态返回空
+func TerminalWebhookEvent(status TaskStatus) string {
+	switch status {
+	case TaskStatusSuccess:
+		return WebhookEventTaskSucceeded
+	case TaskStatusFailed:
+		return WebhookEventTaskFailed
+	}
+	return ""
+}
@@ -1,151 +1,111 @@
 package provider
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"mime/multipart"
-	"net/http"
-	"net/url"
 	"strings"
 	"time"
+
+	"github.com/majingzhen/prism/internal/provider/vendorauth"
+	"github.com/majingzhen/prism/pkg/httputil"
 )
 
 type BaseProvider struct {
 	Name            string
 	BaseURL         string
-	APIKey          string
-	AuthLocation    string // header/body/query
-	AuthKey         string
-	AuthValuePrefix string
+	Auth            vendorauth.Authenticator
 	ContentType     string // application/json / application/x-www-form-urlencoded
 	RequestMethod   string // POST / GET
 	SubmitPath      string
-	ProgressPath    string
+	ProgressPath    string // 包含 {变量} 时按模板渲染，否则在路径后追加供应商任务ID
+	ProgressMethod  string // GET / POST
+	SubmitTemplate  *RequestTemplate
+	FileFields      map[string]FileField // multipart 请求中以文件提交的字段
+	PollTemplate    *RequestTemplate
+	Vars            TemplateVars // 账号和渠道能力相关的模板变量
 	Converter       ParamConverter
 	Parser          ResponseParser
 	ResponseMapping *ResponseMapping
 	CallbackMapping *ResponseMapping
 }
 
-// buildRequestBody 根据 ContentType 构建请求体
-func (p *BaseProvider) buildRequestBody(params map[string]any) (io.Reader, string) {
-	ct := p.ContentType
-	if ct == "application/x-www-form-urlencoded" {
-		form := url.Values{}
-		for k, v := range params {
-			form.Set(k, fmt.Sprintf("%v", v))
-		}
-		return strings.NewReader(form.Encode()), ct
-	}
-	if ct == "multipart/form-data" {
-		var buf bytes.Buffer
-		writer := multipart.NewWriter(&buf)
-		for k, v := range params {
-			writer.WriteField(k, fmt.Sprintf("%v", v))
-		}
-		writer.Close()
-		return &buf, writer.FormDataContentType()
+// do 加入认证信息并发送请求
+func (p *BaseProvider) do(ctx context.Context, req *httputil.Request) (*httputil.RequestDetail, error) {
+	req.ContentType = p.ContentType
+	if err := p.Auth.Apply(ctx, req); err != nil {
+		return nil, fmt.Errorf("authorize: %w", err)
 	}
-	// 默认 JSON
-	bodyBytes, _ := json.Marshal(params)
-	return bytes.NewReader(bodyBytes), "application/json"
-}
 
-// setAuth 设置认证信息
-func (p *BaseProvider) setAuth(httpReq *http.Request) {
-	if p.AuthLocation == "" || p.AuthLocation == "header" {
-		httpReq.Header.Set(p.AuthKey, p.AuthValuePrefix+p.APIKey)
-	}
-}
-
-// appendQueryAuth 给 URL 追加 query 认证参数
-func (p *BaseProvider) appendQueryAuth(rawURL string) string {
-	if p.AuthLocation != "query" {
-		return rawURL
-	}
-	sep := "?"
-	if strings.Contains(rawURL, "?") {
-		sep = "&"
-	}
-	return rawURL + sep + url.QueryEscape(p.AuthKey) + "=" + url.QueryEscape(p.APIKey)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return httputil.Do(ctx, req), nil
 }
 
 func (p *BaseProvider) Submit(ctx context.Context, req SubmitRequest) (SubmitResult, error) {
-	reqURL := p.appendQueryAuth(p.BaseURL + p.SubmitPath)
-
-	// body 认证：将 token 注入到请求参数中
-	params := req.Params
-	if p.AuthLocation == "body" {
-		if params == nil {
-			params = make(map[string]any)
-		}
-		params[p.AuthKey] = p.AuthValuePrefix + p.APIKey
-	}
-
-	body, contentType := p.buildRequestBody(params)
-
 	method := p.RequestMethod
 	if method == "" {
 		method = "POST"
 	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, method, reqURL, body)
-	if err != nil {
-		return SubmitResult{}, fmt.Errorf("create request: %w", err)
+	vendorReq := &httputil.Request{
+		Method: method,
+		URL:    p.BaseURL + p.SubmitPath,
+		Params: req.Params,
 	}
 
-	httpReq.Header.Set("Content-Type", contentType)
-	p.setAuth(httpReq)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
+	vars := p.Vars.With("task_no", req.TaskNo, "callback_url", req.CallbackURL)
+	vars.SetParams(req.Params)
+	if err := p.SubmitTemplate.Apply(vendorReq, p.BaseURL, vars); err != nil {
+		return SubmitResult{}, err
+	}
+	params, err := ResolveFileFields(ctx, vendorReq.Params, p.FileFields, p.ContentType, req.Files)
 	if err != nil {
-		return SubmitResult{}, fmt.Errorf("do request: %w", err)
+		return SubmitResult{}, err
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
+	vendorReq.Params = params
+	detail, err := p.do(ctx, vendorReq)
 	if err != nil {
-		return SubmitResult{}, fmt.Errorf("read response: %w", err)
+		return SubmitResult{}, err
 	}
-
-	if resp.StatusCode >= 400 {
-		return SubmitResult{}, fmt.Errorf("api error: %s", string(respBody))
+	if detail.StatusCode >= 400 {
+		return SubmitResult{}, fmt.Errorf("api error: %s", string(detail.ResponseBody))
+	}
+	if detail.Error != nil {
+		return SubmitResult{}, detail.Error
 	}
 
-	return p.Parser.ParseSubmitResponse(respBody, p.ResponseMapping)
+	return p.Parser.ParseSubmitResponse(detail.ResponseBody, p.ResponseMapping)
 }
 
 func (p *BaseProvider) GetProgress(ctx context.Context, providerTaskID string) (ProgressResult, error) {
-	reqURL := p.appendQueryAuth(fmt.Sprintf("%s%s/%s", p.BaseURL, p.ProgressPath, providerTaskID))
+	vars := p.Vars.With("task_id", providerTaskID, "vendor_task_id", providerTaskID)
 
-	httpReq, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
-	if err != nil {
-		return ProgressResult{}, fmt.Errorf("create request: %w", err)
+	reqURL := fmt.Sprintf("%s%s/%s", p.BaseURL, p.ProgressPath, providerTaskID)
+	if strings.Contains(p.ProgressPath, "{") {
+		reqURL = p.BaseURL + vars.Render(p.ProgressPath)
 	}
-
-	p.setAuth(httpReq)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return ProgressResult{}, fmt.Errorf("do request: %w", err)
+	vendorReq := &httputil.Request{Method: "GET", URL: reqURL}
+	if p.ProgressMethod == "POST" {
+		vendorReq.Method = "POST"
+		vendorReq.Params = map[string]any{"task_id": providerTaskID}
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
+	if err := p.PollTemplate.Apply(vendorReq, p.BaseURL, vars); err != nil {
+		return ProgressResult{}, err
+	}
+	detail, err := p.do(ctx, vendorReq)
 	if err != nil {
-		return ProgressResult{}, fmt.Errorf("read response: %w", err)
+		return ProgressResult{}, err
 	}
-
-	if resp.StatusCode >= 400 {
-		return ProgressResult{Error: string(respBody)}, nil
+	retryAfter := httputil.ParseRetryAfter(detail.ResponseHeaders)
+	if detail.StatusCode >= 400 {
+		return ProgressResult{Error: string(detail.ResponseBody), RetryAfter: retryAfter}, nil
+	}
+	if detail.Error != nil {
+		return ProgressResult{}, detail.Error
 	}
 
-	return p.Parser.ParseProgressResponse(respBody, p.ResponseMapping)
+	result, err := p.Parser.ParseProgressResponse(detail.ResponseBody, p.ResponseMapping)
+	result.RetryAfter = retryAfter
+	return result, err
 }
 
 // ParseCallback 使用独立的 CallbackMapping 解析回调
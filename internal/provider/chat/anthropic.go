@@ -5,8 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
-
-	"github.com/majingzhen/prism/pkg/httputil"
 )
 
 // AnthropicProvider Claude API
@@ -31,9 +29,11 @@ func (p *AnthropicProvider) Complete(ctx context.Context, req *ChatRequest) (*Ch
 
 	// 构建请求头
 	headers := map[string]string{
-		"x-api-key":         p.config.APIKey,
 		"anthropic-version": "2023-06-01",
 	}
+	if p.config.Auth == nil {
+		headers["x-api-key"] = p.config.APIKey
+	}
 	for k, v := range p.config.ExtraHeaders {
 		headers[k] = v
 	}
@@ -43,7 +43,7 @@ func (p *AnthropicProvider) Complete(ctx context.Context, req *ChatRequest) (*Ch
 	defer cancel()
 
 	// 发送请求
-	resp, err := httputil.PostJSON(ctx, url, anthropicReq, headers)
+	resp, err := p.config.post(ctx, url, anthropicReq, headers)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
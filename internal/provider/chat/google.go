@@ -5,8 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
-
-	"github.com/majingzhen/prism/pkg/httputil"
 )
 
 // GoogleProvider Gemini API
@@ -26,15 +24,17 @@ func (p *GoogleProvider) Complete(ctx context.Context, req *ChatRequest) (*ChatR
 	geminiReq := p.convertRequest(req)
 
 	// API key 在 URL 参数中
-	url := fmt.Sprintf("%s/v1beta/models/%s:generateContent?key=%s",
-		p.config.BaseURL, p.config.VendorModel, p.config.APIKey)
+	url := fmt.Sprintf("%s/v1beta/models/%s:generateContent", p.config.BaseURL, p.config.VendorModel)
+	if p.config.Auth == nil {
+		url += "?key=" + p.config.APIKey
+	}
 
 	// 设置超时上下文
 	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
 	defer cancel()
 
 	// 发送请求
-	resp, err := httputil.PostJSON(ctx, url, geminiReq, p.config.ExtraHeaders)
+	resp, err := p.config.post(ctx, url, geminiReq, p.config.ExtraHeaders)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
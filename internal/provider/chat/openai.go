@@ -4,8 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-
-	"github.com/majingzhen/prism/pkg/httputil"
 )
 
 // OpenAIProvider OpenAI 及兼容 API
@@ -29,8 +27,9 @@ func (p *OpenAIProvider) Complete(ctx context.Context, req *ChatRequest) (*ChatR
 	url := p.config.BaseURL + p.config.RequestPath
 
 	// 构建请求头
-	headers := map[string]string{
-		"Authorization": "Bearer " + p.config.APIKey,
+	headers := map[string]string{}
+	if p.config.Auth == nil {
+		headers["Authorization"] = "Bearer " + p.config.APIKey
 	}
 	for k, v := range p.config.ExtraHeaders {
 		headers[k] = v
@@ -41,7 +40,7 @@ func (p *OpenAIProvider) Complete(ctx context.Context, req *ChatRequest) (*ChatR
 	defer cancel()
 
 	// 发送请求
-	resp, err := httputil.PostJSON(ctx, url, req, headers)
+	resp, err := p.config.post(ctx, url, req, headers)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
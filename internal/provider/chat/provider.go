@@ -2,7 +2,13 @@ package chat
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"time"
+
+	"github.com/majingzhen/prism/internal/provider/vendorauth"
+	"github.com/majingzhen/prism/pkg/httputil"
 )
 
 // ChatProvider LLM 请求适配接口
@@ -62,4 +68,29 @@ type ProviderConfig struct {
 	RequestPath  string
 	Timeout      time.Duration
 	ExtraHeaders map[string]string
+	// Auth 渠道配置的认证策略，为空时使用各 Provider 默认的 APIKey 认证
+	Auth vendorauth.Authenticator
+}
+
+// post 发送 JSON 请求，配置了认证策略时先加入认证信息
+func (c ProviderConfig) post(ctx context.Context, reqURL string, body any, headers map[string]string) ([]byte, error) {
+	if c.Auth == nil {
+		return httputil.PostJSON(ctx, reqURL, body, headers)
+	}
+
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal body: %w", err)
+	}
+	req := &httputil.Request{
+		Method:      http.MethodPost,
+		URL:         reqURL,
+		Headers:     headers,
+		Body:        bodyBytes,
+		ContentType: "application/json",
+	}
+	if err := c.Auth.Apply(ctx, req); err != nil {
+		return nil, fmt.Errorf("authorize: %w", err)
+	}
+	return httputil.PostJSON(ctx, req.URL, json.RawMessage(req.Body), req.Headers)
 }
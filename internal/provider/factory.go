@@ -2,6 +2,7 @@ package provider
 
 import (
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/provider/vendorauth"
 )
 
 func NewProvider(channel *model.Channel, account *model.ChannelAccount, cc *model.ChannelCapability) (Provider, error) {
@@ -17,34 +18,35 @@ func NewProvider(channel *model.Channel, account *model.ChannelAccount, cc *mode
 		return nil, err
 	}
 
-	apiKey := account.APIKey
-	baseURL := channel.BaseURL
-
-	// 认证配置默认值
-	authLocation := cc.AuthLocation
-	if authLocation == "" {
-		authLocation = "header"
+	// 解析请求模板
+	submitTemplate, err := ParseRequestTemplate(cc.SubmitTemplate)
+	if err != nil {
+		return nil, err
 	}
-	authKey := cc.AuthKey
-	if authKey == "" {
-		authKey = "Authorization"
+	pollTemplate, err := ParseRequestTemplate(cc.PollTemplate)
+	if err != nil {
+		return nil, err
 	}
-	authValuePrefix := cc.AuthValuePrefix
-	if authValuePrefix == "" && authLocation == "header" {
-		authValuePrefix = "Bearer "
+
+	// 认证策略：渠道配置优先，否则使用渠道能力的 APIKey 认证
+	auth, err := vendorauth.Resolve(channel, account, StaticAuthConfig(cc))
+	if err != nil {
+		return nil, err
 	}
 
 	base := &BaseProvider{
 		Name:            channel.Type,
-		BaseURL:         baseURL,
-		APIKey:          apiKey,
-		AuthLocation:    authLocation,
-		AuthKey:         authKey,
-		AuthValuePrefix: authValuePrefix,
+		BaseURL:         channel.BaseURL,
+		Auth:            auth,
 		ContentType:     cc.ContentType,
 		RequestMethod:   cc.RequestMethod,
 		SubmitPath:      cc.RequestPath,
 		ProgressPath:    cc.PollPath,
+		ProgressMethod:  cc.PollMethod,
+		SubmitTemplate:  submitTemplate,
+		FileFields:      ParseFileFields(cc.ParamMapping),
+		PollTemplate:    pollTemplate,
+		Vars:            NewTemplateVars(nil, cc, account),
 		Converter:       NewDefaultConverter(),
 		Parser:          NewDefaultParser(),
 		ResponseMapping: responseMapping,
@@ -53,3 +55,17 @@ func NewProvider(channel *model.Channel, account *model.ChannelAccount, cc *mode
 
 	return base, nil
 }
+
+// StaticAuthConfig 渠道能力上的 APIKey 认证配置，渠道未配置认证策略时使用
+func StaticAuthConfig(cc *model.ChannelCapability) vendorauth.Config {
+	switch cc.AuthLocation {
+	case "header", "body", "query":
+		authKey := cc.AuthKey
+		if authKey == "" {
+			authKey = "Authorization"
+		}
+		return vendorauth.Static(cc.AuthLocation, authKey, cc.AuthValuePrefix)
+	default:
+		return vendorauth.Static("header", "Authorization", "Bearer ")
+	}
+}
@@ -0,0 +1,209 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/majingzhen/prism/pkg/httputil"
+	"github.com/majingzhen/prism/pkg/storage"
+)
+
+// DefaultFileFieldMaxSize 文件字段默认大小上限
+const DefaultFileFieldMaxSize int64 = 20 << 20
+
+// FileField 以文件形式提交的参数 (ParamMapping.file_fields，键为映射后的供应商参数名)
+// 参数值可以是 http(s) 链接、data URI 或 base64 字符串，也可以是它们的数组
+type FileField struct {
+	Filename    string `json:"filename"`     // 为空时从链接或内容类型推断
+	ContentType string `json:"content_type"` // 为空时使用下载响应或 data URI 中的类型
+	MaxSize     int64  `json:"max_size"`     // 最大字节数，默认 20MB
+}
+
+// StoredFileLookup 查找链接对应的已上传文件，返回存储对象路径
+// 由文件服务按任务所属用户实现，链接不是该用户未过期的文件时返回 false
+type StoredFileLookup func(ctx context.Context, rawURL string) (key string, ok bool)
+
+// ParseFileFields 从参数映射配置中读取文件字段
+func ParseFileFields(mapping []byte) map[string]FileField {
+	if len(mapping) == 0 {
+		return nil
+	}
+	var cfg struct {
+		FileFields map[string]FileField `json:"file_fields"`
+	}
+	json.Unmarshal(mapping, &cfg)
+	return cfg.FileFields
+}
+
+// ResolveFileFields 读取文件字段引用的内容，返回替换为文件后的参数副本
+// 仅对 multipart/form-data 请求生效，其他内容类型原样返回
+// lookup 识别已解析的用户文件地址，从存储读取；其他链接只允许下载公网地址
+func ResolveFileFields(ctx context.Context, params map[string]any, fields map[string]FileField, contentType string, lookup StoredFileLookup) (map[string]any, error) {
+	if len(fields) == 0 || contentType != "multipart/form-data" {
+		return params, nil
+	}
+
+	resolved := make(map[string]any, len(params))
+	for k, v := range params {
+		resolved[k] = v
+	}
+	for name, field := range fields {
+		switch v := params[name].(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+			file, err := loadFormFile(ctx, v, field, lookup)
+			if err != nil {
+				return nil, fmt.Errorf("file field %s: %w", name, err)
+			}
+			resolved[name] = file
+		case []any:
+			files := make([]*httputil.FormFile, 0, len(v))
+			for _, item := range v {
+				ref, _ := item.(string)
+				if ref == "" {
+					continue
+				}
+				file, err := loadFormFile(ctx, ref, field, lookup)
+				if err != nil {
+					return nil, fmt.Errorf("file field %s: %w", name, err)
+				}
+				files = append(files, file)
+			}
+			resolved[name] = files
+		}
+	}
+	return resolved, nil
+}
+
+// loadFormFile 按引用类型读取文件内容
+func loadFormFile(ctx context.Context, ref string, field FileField, lookup StoredFileLookup) (*httputil.FormFile, error) {
+	maxSize := field.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultFileFieldMaxSize
+	}
+
+	var file *httputil.FormFile
+	var err error
+	switch {
+	case strings.HasPrefix(ref, "http://"), strings.HasPrefix(ref, "https://"):
+		if key, ok := lookupStoredFile(ctx, lookup, ref); ok {
+			file, err = loadStoredFile(ctx, key, maxSize)
+		} else {
+			file, err = downloadFormFile(ctx, httputil.DownloadPublic, ref, maxSize)
+		}
+	default:
+		file, err = decodeFormFile(ref, maxSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if field.ContentType != "" {
+		file.ContentType = field.ContentType
+	}
+	if field.Filename != "" {
+		file.Filename = field.Filename
+	}
+	if file.Filename == "" || file.Filename == "." || file.Filename == "/" {
+		file.Filename = "file"
+		if exts, _ := mime.ExtensionsByType(file.ContentType); len(exts) > 0 {
+			file.Filename += exts[0]
+		}
+	}
+	return file, nil
+}
+
+// lookupStoredFile 查找链接对应的用户文件
+func lookupStoredFile(ctx context.Context, lookup StoredFileLookup, rawURL string) (string, bool) {
+	if lookup == nil {
+		return "", false
+	}
+	return lookup(ctx, rawURL)
+}
+
+// loadStoredFile 通过服务端签名的地址读取存储对象，存储可能位于内网，不经过公网地址过滤
+func loadStoredFile(ctx context.Context, key string, maxSize int64) (*httputil.FormFile, error) {
+	if storage.DefaultStorage == nil {
+		return nil, fmt.Errorf("storage not configured")
+	}
+	signedURL, err := storage.GetSignedURL(ctx, key, 10*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("sign storage url: %w", err)
+	}
+	file, err := downloadFormFile(ctx, httputil.Download, signedURL, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	file.Filename = path.Base(key)
+	return file, nil
+}
+
+// downloadFormFile 下载链接内容，超过大小上限时返回错误
+func downloadFormFile(ctx context.Context, download func(context.Context, string) (*httputil.DownloadResult, error), rawURL string, maxSize int64) (*httputil.FormFile, error) {
+	result, err := download(ctx, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("download: %w", err)
+	}
+	defer result.Body.Close()
+
+	if result.Size > maxSize {
+		return nil, fmt.Errorf("file too large: %d > %d bytes", result.Size, maxSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(result.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("file too large: exceeds %d bytes", maxSize)
+	}
+
+	contentType, _, _ := strings.Cut(result.ContentType, ";")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	filename := ""
+	if u, err := url.Parse(rawURL); err == nil {
+		filename = path.Base(u.Path)
+	}
+	return &httputil.FormFile{Filename: filename, ContentType: contentType, Data: data}, nil
+}
+
+// decodeFormFile 解析 data URI 或 base64 字符串
+func decodeFormFile(ref string, maxSize int64) (*httputil.FormFile, error) {
+	contentType := ""
+	encoded := ref
+	if strings.HasPrefix(ref, "data:") {
+		meta, data, ok := strings.Cut(strings.TrimPrefix(ref, "data:"), ",")
+		if !ok || !strings.HasSuffix(meta, ";base64") {
+			return nil, fmt.Errorf("unsupported data uri")
+		}
+		contentType = strings.TrimSuffix(meta, ";base64")
+		encoded = data
+	}
+
+	if int64(base64.StdEncoding.DecodedLen(len(encoded))) > maxSize+2 {
+		return nil, fmt.Errorf("file too large: exceeds %d bytes", maxSize)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file reference: not a url or base64 data")
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("file too large: %d > %d bytes", len(data), maxSize)
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return &httputil.FormFile{ContentType: contentType, Data: data}, nil
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/tidwall/gjson"
 )
@@ -12,7 +13,9 @@ type ResponseMapping struct {
 	Progress      string            `json:"progress"`
 	OutputURL     string            `json:"output_url"`
 	Error         string            `json:"error"`
+	ETA           string            `json:"eta"` // 预计剩余时间(秒)
 	StatusMapping map[string]string `json:"status_mapping"`
+	Usage         *UsageMapping     `json:"usage"` // 实际用量，用于完成后结算
 }
 
 type ResponseParser interface {
@@ -50,10 +53,7 @@ func (p *DefaultParser) ParseSubmitResponse(body []byte, mapping *ResponseMappin
 	}
 
 	if mapping.OutputURL != "" {
-		url := gjson.Get(jsonStr, mapping.OutputURL).String()
-		if url != "" {
-			result.URLs = []string{url}
-		}
+		result.URLs = extractURLs(jsonStr, mapping.OutputURL)
 	}
 
 	return result, nil
@@ -78,16 +78,19 @@ func (p *DefaultParser) ParseProgressResponse(body []byte, mapping *ResponseMapp
 	}
 
 	if mapping.OutputURL != "" {
-		url := gjson.Get(jsonStr, mapping.OutputURL).String()
-		if url != "" {
-			result.URLs = []string{url}
-		}
+		result.URLs = extractURLs(jsonStr, mapping.OutputURL)
 	}
 
 	if mapping.Error != "" {
 		result.Error = gjson.Get(jsonStr, mapping.Error).String()
 	}
 
+	if mapping.ETA != "" {
+		result.ETA = time.Duration(gjson.Get(jsonStr, mapping.ETA).Float() * float64(time.Second))
+	}
+
+	result.Usage = mapping.Usage.Quantity(jsonStr)
+
 	return result, nil
 }
 
@@ -120,10 +123,7 @@ func (p *DefaultParser) ParseCallbackResponse(body []byte, mapping *ResponseMapp
 
 	// 提取输出 URL
 	if mapping.OutputURL != "" {
-		url := gjson.Get(jsonStr, mapping.OutputURL).String()
-		if url != "" {
-			result.URLs = []string{url}
-		}
+		result.URLs = extractURLs(jsonStr, mapping.OutputURL)
 	}
 
 	// 提取错误信息
@@ -131,9 +131,30 @@ func (p *DefaultParser) ParseCallbackResponse(body []byte, mapping *ResponseMapp
 		result.Error = gjson.Get(jsonStr, mapping.Error).String()
 	}
 
+	// 提取实际用量
+	result.Usage = mapping.Usage.Quantity(jsonStr)
+
 	return result, providerTaskID, nil
 }
 
+// extractURLs 提取输出 URL，路径指向数组时（如 data.images.#.url）返回全部 URL
+func extractURLs(jsonStr string, path string) []string {
+	value := gjson.Get(jsonStr, path)
+	if value.IsArray() {
+		var urls []string
+		for _, item := range value.Array() {
+			if url := item.String(); url != "" {
+				urls = append(urls, url)
+			}
+		}
+		return urls
+	}
+	if url := value.String(); url != "" {
+		return []string{url}
+	}
+	return nil
+}
+
 func (p *DefaultParser) mapStatus(raw string, mapping map[string]string) TaskStatus {
 	if mapping == nil {
 		return TaskStatus(raw)
@@ -1,6 +1,9 @@
 package provider
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type ResultMode string
 
@@ -24,6 +27,7 @@ type SubmitRequest struct {
 	TaskNo      string
 	Params      map[string]any
 	CallbackURL string
+	Files       StoredFileLookup // 查找参数中的用户文件地址，见 ResolveFileFields
 }
 
 type SubmitResult struct {
@@ -38,6 +42,10 @@ type ProgressResult struct {
 	Progress int
 	URLs     []string
 	Error    string
+	Usage    string // 实际用量，未配置用量映射时为空
+	// ETA 供应商预计剩余时间，RetryAfter 为 Retry-After 响应头
+	ETA        time.Duration
+	RetryAfter time.Duration
 }
 
 type Provider interface {
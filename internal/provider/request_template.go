@@ -0,0 +1,266 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/httputil"
+)
+
+// RequestTemplate 请求模板，用于定制提交、轮询和取消请求
+// 所有字符串均支持 {变量} 占位符，变量见 TemplateVars
+type RequestTemplate struct {
+	Method    string             `json:"method"`    // 请求方法，为空时使用默认方法
+	URL       string             `json:"url"`       // 请求路径或完整地址，为空时使用默认地址
+	Query     map[string]string  `json:"query"`     // 追加的 query 参数
+	Headers   map[string]string  `json:"headers"`   // 追加的请求头
+	Body      map[string]any     `json:"body"`      // 合并到请求参数中，支持嵌套
+	Signature *SignatureTemplate `json:"signature"` // 签名配置，结果可通过 {signature} 引用
+}
+
+// SignatureTemplate 签名配置
+type SignatureTemplate struct {
+	Algorithm string `json:"algorithm"` // md5/sha1/sha256/hmac_sha1/hmac_sha256
+	Key       string `json:"key"`       // HMAC 密钥模板
+	Payload   string `json:"payload"`   // 待签名内容模板
+	Encoding  string `json:"encoding"`  // hex/base64，默认 hex
+	Uppercase bool   `json:"uppercase"` // hex 结果是否转大写
+}
+
+// TemplateVars 模板变量
+//
+//   - task_no / task_id / vendor_task_id / capability / model / user_id: 任务字段，task_id 为供应商任务ID
+//   - callback_url: 供应商回调地址
+//   - api_key / account.<key>: 账号密钥及账号配置 (ChannelAccount.Config)
+//   - params.<key>: 映射后的请求参数（提交前置步骤中为原始请求参数）
+//   - steps.<name>.<key>: 提交前置步骤的输出
+//   - timestamp / timestamp_ms / datetime / nonce: 每次渲染时生成
+//   - signature: 签名结果
+type TemplateVars map[string]string
+
+var templateVarPattern = regexp.MustCompile(`\{([\w.]+)\}`)
+
+// NewTemplateVars 根据任务、渠道能力和账号创建模板变量
+func NewTemplateVars(task *model.Task, cc *model.ChannelCapability, account *model.ChannelAccount) TemplateVars {
+	vars := TemplateVars{}
+	if cc != nil {
+		vars["model"] = cc.Model
+	}
+	if task != nil {
+		vars["task_no"] = task.TaskNo
+		vars["task_id"] = task.VendorTaskID
+		vars["vendor_task_id"] = task.VendorTaskID
+		vars["capability"] = task.CapabilityCode
+		vars["user_id"] = strconv.FormatUint(uint64(task.UserID), 10)
+	}
+	if account != nil {
+		vars.SetAccount(account)
+	}
+	return vars
+}
+
+// SetAccount 写入账号密钥和账号配置
+func (v TemplateVars) SetAccount(account *model.ChannelAccount) {
+	v["api_key"] = account.APIKey
+	var config map[string]any
+	if len(account.Config) > 0 && json.Unmarshal(account.Config, &config) == nil {
+		for k, val := range config {
+			v["account."+k] = templateString(val)
+		}
+	}
+}
+
+// SetParams 写入映射后的请求参数，仅保留标量值
+func (v TemplateVars) SetParams(params map[string]any) {
+	for k, val := range params {
+		switch val.(type) {
+		case map[string]any, []any:
+			continue
+		}
+		v["params."+k] = templateString(val)
+	}
+}
+
+// Set 写入变量，非字符串值转换为字符串
+func (v TemplateVars) Set(key string, val any) {
+	v[key] = templateString(val)
+}
+
+// With 复制变量并写入额外的值
+func (v TemplateVars) With(kv ...string) TemplateVars {
+	vars := make(TemplateVars, len(v)+len(kv)/2)
+	for k, val := range v {
+		vars[k] = val
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		vars[kv[i]] = kv[i+1]
+	}
+	return vars
+}
+
+// Render 渲染字符串模板，未定义的变量替换为空字符串
+func (v TemplateVars) Render(tpl string) string {
+	if !strings.Contains(tpl, "{") {
+		return tpl
+	}
+	return templateVarPattern.ReplaceAllStringFunc(tpl, func(match string) string {
+		return v[strings.Trim(match, "{}")]
+	})
+}
+
+// ParseRequestTemplate 解析请求模板，未配置时返回 nil
+func ParseRequestTemplate(data []byte) (*RequestTemplate, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var tpl RequestTemplate
+	if err := json.Unmarshal(data, &tpl); err != nil {
+		return nil, fmt.Errorf("parse request template: %w", err)
+	}
+	return &tpl, nil
+}
+
+// Apply 将模板应用到请求上，baseURL 用于拼接相对路径
+// 每次调用都会生成新的时间戳和随机数
+func (t *RequestTemplate) Apply(req *httputil.Request, baseURL string, vars TemplateVars) error {
+	if t == nil {
+		return nil
+	}
+
+	now := time.Now()
+	vars = vars.With(
+		"timestamp", strconv.FormatInt(now.Unix(), 10),
+		"timestamp_ms", strconv.FormatInt(now.UnixMilli(), 10),
+		"datetime", now.UTC().Format(time.RFC3339),
+		"nonce", templateNonce(),
+	)
+	if t.Signature != nil {
+		signature, err := t.Signature.sign(vars)
+		if err != nil {
+			return err
+		}
+		vars["signature"] = signature
+	}
+
+	if t.Method != "" {
+		req.Method = strings.ToUpper(vars.Render(t.Method))
+	}
+	if t.URL != "" {
+		reqURL := vars.Render(t.URL)
+		if !strings.HasPrefix(reqURL, "http://") && !strings.HasPrefix(reqURL, "https://") {
+			reqURL = baseURL + reqURL
+		}
+		req.URL = reqURL
+	}
+	if len(t.Query) > 0 {
+		query := url.Values{}
+		for k, v := range t.Query {
+			query.Set(k, vars.Render(v))
+		}
+		req.URL = httputil.AppendQuery(req.URL, query)
+	}
+	if len(t.Headers) > 0 {
+		if req.Headers == nil {
+			req.Headers = make(map[string]string, len(t.Headers))
+		}
+		for k, v := range t.Headers {
+			req.Headers[k] = vars.Render(v)
+		}
+	}
+	if len(t.Body) > 0 {
+		if req.Params == nil {
+			req.Params = make(map[string]any, len(t.Body))
+		}
+		for k, v := range t.Body {
+			req.Params[k] = renderTemplateValue(v, vars)
+		}
+	}
+	return nil
+}
+
+// sign 计算签名
+func (s *SignatureTemplate) sign(vars TemplateVars) (string, error) {
+	payload := []byte(vars.Render(s.Payload))
+	key := []byte(vars.Render(s.Key))
+
+	var h hash.Hash
+	switch strings.ToLower(s.Algorithm) {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "", "sha256":
+		h = sha256.New()
+	case "hmac_sha1":
+		h = hmac.New(sha1.New, key)
+	case "hmac_sha256":
+		h = hmac.New(sha256.New, key)
+	default:
+		return "", fmt.Errorf("unsupported signature algorithm: %s", s.Algorithm)
+	}
+	h.Write(payload)
+	sum := h.Sum(nil)
+
+	if s.Encoding == "base64" {
+		return base64.StdEncoding.EncodeToString(sum), nil
+	}
+	if s.Uppercase {
+		return strings.ToUpper(hex.EncodeToString(sum)), nil
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// renderTemplateValue 渲染请求体中的值，递归处理对象和数组
+func renderTemplateValue(v any, vars TemplateVars) any {
+	switch val := v.(type) {
+	case string:
+		return vars.Render(val)
+	case map[string]any:
+		rendered := make(map[string]any, len(val))
+		for k, item := range val {
+			rendered[k] = renderTemplateValue(item, vars)
+		}
+		return rendered
+	case []any:
+		rendered := make([]any, len(val))
+		for i, item := range val {
+			rendered[i] = renderTemplateValue(item, vars)
+		}
+		return rendered
+	default:
+		return v
+	}
+}
+
+func templateString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func templateNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,31 @@
+package provider
+
+import (
+	"strconv"
+
+	"github.com/majingzhen/prism/pkg/money"
+	"github.com/tidwall/gjson"
+)
+
+// UsageMapping 实际用量映射，任务完成时按实际用量结算预扣的费用
+type UsageMapping struct {
+	Path      string      `json:"path"`       // 用量在响应中的路径，值为数组时取数组长度
+	Param     string      `json:"param"`      // 用量对应的计价参数，替换该参数后按计价规则重新计算价格
+	UnitPrice money.Money `json:"unit_price"` // 每单位用量的价格，配置后不使用计价规则
+}
+
+// Quantity 从响应中提取实际用量，未找到时返回空字符串
+func (m *UsageMapping) Quantity(jsonStr string) string {
+	if m == nil || m.Path == "" {
+		return ""
+	}
+	value := gjson.Get(jsonStr, m.Path)
+	switch {
+	case !value.Exists():
+		return ""
+	case value.IsArray():
+		return strconv.Itoa(len(value.Array()))
+	default:
+		return value.String()
+	}
+}
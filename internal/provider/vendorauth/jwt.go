@@ -0,0 +1,66 @@
+package vendorauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/httputil"
+)
+
+// defaultJWTTTL JWT 默认有效期
+const defaultJWTTTL = 30 * time.Minute
+
+// jwtAuth 使用 access_key 作为 iss、secret_key 作为 HS256 密钥签发 JWT
+type jwtAuth struct {
+	header    string
+	prefix    string
+	ttl       time.Duration
+	accessKey string
+	secretKey string
+	cacheKey  string
+}
+
+func newJWT(cfg Config, account *model.ChannelAccount) (*jwtAuth, error) {
+	access, secret, err := credentials(cfg, account, "access_key", "secret_key")
+	if err != nil {
+		return nil, err
+	}
+	a := &jwtAuth{
+		header:    defaultString(cfg.Header, "Authorization"),
+		prefix:    defaultString(cfg.Prefix, "Bearer "),
+		ttl:       time.Duration(cfg.TTL) * time.Second,
+		accessKey: access,
+		secretKey: secret,
+		cacheKey:  cacheKey(TypeJWT, account, access, secret),
+	}
+	if a.ttl <= 0 {
+		a.ttl = defaultJWTTTL
+	}
+	return a, nil
+}
+
+func (a *jwtAuth) Apply(ctx context.Context, req *httputil.Request) error {
+	token, err := cachedToken(ctx, a.cacheKey, a.sign)
+	if err != nil {
+		return err
+	}
+	setHeader(req, a.header, a.prefix+token)
+	return nil
+}
+
+// sign 签发令牌，缓存时间比有效期短一分钟，避免使用即将过期的令牌
+func (a *jwtAuth) sign() (string, time.Duration, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": a.accessKey,
+		"exp": now.Add(a.ttl).Unix(),
+		"nbf": now.Add(-5 * time.Second).Unix(),
+	})
+	signed, err := token.SignedString([]byte(a.secretKey))
+	if err != nil {
+		return "", 0, err
+	}
+	return signed, a.ttl - time.Minute, nil
+}
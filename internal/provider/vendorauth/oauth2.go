@@ -0,0 +1,95 @@
+package vendorauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/httputil"
+)
+
+// defaultOAuth2TTL 令牌响应未返回 expires_in 时的缓存时间
+const defaultOAuth2TTL = 30 * time.Minute
+
+// oauth2Auth OAuth2 client credentials，令牌缓存到 Redis 直到过期前一分钟
+type oauth2Auth struct {
+	header       string
+	prefix       string
+	tokenURL     string
+	scope        string
+	clientAuth   string
+	clientID     string
+	clientSecret string
+	cacheKey     string
+}
+
+func newOAuth2(cfg Config, account *model.ChannelAccount) (*oauth2Auth, error) {
+	if cfg.TokenURL == "" {
+		return nil, fmt.Errorf("oauth2 token_url is required")
+	}
+	clientID, clientSecret, err := credentials(cfg, account, "client_id", "client_secret")
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2Auth{
+		header:       defaultString(cfg.Header, "Authorization"),
+		prefix:       defaultString(cfg.Prefix, "Bearer "),
+		tokenURL:     cfg.TokenURL,
+		scope:        cfg.Scope,
+		clientAuth:   cfg.ClientAuth,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		cacheKey:     cacheKey(TypeOAuth2, account, cfg.TokenURL, cfg.Scope, clientID, clientSecret),
+	}, nil
+}
+
+func (a *oauth2Auth) Apply(ctx context.Context, req *httputil.Request) error {
+	token, err := cachedToken(ctx, a.cacheKey, func() (string, time.Duration, error) {
+		return a.fetch(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	setHeader(req, a.header, a.prefix+token)
+	return nil
+}
+
+// fetch 向授权服务器申请令牌
+func (a *oauth2Auth) fetch(ctx context.Context) (string, time.Duration, error) {
+	params := map[string]any{"grant_type": "client_credentials"}
+	if a.scope != "" {
+		params["scope"] = a.scope
+	}
+	headers := map[string]string{"Accept": "application/json"}
+	if a.clientAuth == "basic" {
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(a.clientID+":"+a.clientSecret))
+	} else {
+		params["client_id"] = a.clientID
+		params["client_secret"] = a.clientSecret
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	detail := httputil.DoWithDetail(ctx, http.MethodPost, a.tokenURL, params, headers, "application/x-www-form-urlencoded")
+	if detail.Error != nil {
+		return "", 0, fmt.Errorf("oauth2 token request: %w", detail.Error)
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(detail.ResponseBody, &resp); err != nil || resp.AccessToken == "" {
+		return "", 0, fmt.Errorf("oauth2 token response invalid: %s", string(detail.ResponseBody))
+	}
+
+	ttl := defaultOAuth2TTL
+	if resp.ExpiresIn > 0 {
+		ttl = time.Duration(resp.ExpiresIn) * time.Second
+	}
+	return resp.AccessToken, ttl - time.Minute, nil
+}
@@ -0,0 +1,52 @@
+package vendorauth
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/httputil"
+)
+
+// staticAuth 静态 APIKey 认证，前缀仅用于请求头
+type staticAuth struct {
+	location string
+	key      string
+	prefix   string
+	apiKey   string
+}
+
+func newStatic(cfg Config, account *model.ChannelAccount) *staticAuth {
+	return &staticAuth{
+		location: defaultString(cfg.Location, "header"),
+		key:      defaultString(cfg.Header, "Authorization"),
+		prefix:   cfg.Prefix,
+		apiKey:   account.APIKey,
+	}
+}
+
+func (a *staticAuth) Apply(ctx context.Context, req *httputil.Request) error {
+	switch a.location {
+	case "query":
+		appendQuery(req, a.key, a.apiKey)
+	case "body":
+		if req.Params != nil || len(req.Body) == 0 {
+			if req.Params == nil {
+				req.Params = make(map[string]any)
+			}
+			req.Params[a.key] = a.apiKey
+			return nil
+		}
+		// 已编码的 JSON 请求体（如重试请求）
+		var body map[string]any
+		if json.Unmarshal(req.Body, &body) == nil {
+			body[a.key] = a.apiKey
+			if b, err := json.Marshal(body); err == nil {
+				req.Body = b
+			}
+		}
+	default:
+		setHeader(req, a.key, a.prefix+a.apiKey)
+	}
+	return nil
+}
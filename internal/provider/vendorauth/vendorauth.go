@@ -0,0 +1,186 @@
+// Package vendorauth 供应商认证策略
+//
+// 渠道配置 (Channel.Config) 的 auth 字段选择认证方式，密钥从账号配置 (ChannelAccount.Config) 读取：
+//
+//	{"auth": {"type": "jwt", "ttl": 1800}}
+//
+// 未配置时使用渠道能力的静态 APIKey 认证。
+package vendorauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/cache"
+	"github.com/majingzhen/prism/pkg/httputil"
+)
+
+// 认证方式
+const (
+	TypeStatic = "static" // 静态 APIKey，放在请求头、请求体或 query 中
+	TypeJWT    = "jwt"    // 使用 access_key/secret_key 签发 JWT (可灵)
+	TypeHMAC   = "hmac"   // AK/SK 请求签名 (火山引擎/阿里云风格)
+	TypeOAuth2 = "oauth2" // OAuth2 client credentials
+)
+
+// cacheKeyPrefix 令牌缓存键前缀
+const cacheKeyPrefix = "vendor:auth:"
+
+// Config 认证配置
+type Config struct {
+	Type string `json:"type"` // static / jwt / hmac / oauth2
+
+	// 认证信息位置：static 的 header/body/query，jwt/oauth2/hmac 写入的请求头
+	Location string `json:"location"`
+	Header   string `json:"header"` // 默认 Authorization
+	Prefix   string `json:"prefix"` // 认证值前缀，jwt/oauth2 默认 "Bearer "
+
+	// 账号配置中的密钥字段名
+	AccessKeyField string `json:"access_key_field"` // 默认 access_key，oauth2 为 client_id
+	SecretKeyField string `json:"secret_key_field"` // 默认 secret_key，oauth2 为 client_secret
+
+	// jwt
+	TTL int `json:"ttl"` // 令牌有效期(秒)，默认 1800
+
+	// hmac
+	Algorithm string `json:"algorithm"` // 写入签名头的算法名，默认 HMAC-SHA256
+	Encoding  string `json:"encoding"`  // 签名编码 hex(默认) / base64
+	Format    string `json:"format"`    // 签名头格式，支持 {algorithm} {access_key} {timestamp} {nonce} {signature}
+
+	// oauth2
+	TokenURL   string `json:"token_url"`
+	Scope      string `json:"scope"`
+	ClientAuth string `json:"client_auth"` // body(默认) / basic
+}
+
+// Authenticator 认证策略
+type Authenticator interface {
+	// Apply 在请求发送前加入认证信息
+	Apply(ctx context.Context, req *httputil.Request) error
+}
+
+// ParseChannelConfig 解析渠道配置中的认证配置，未配置时返回 nil
+func ParseChannelConfig(raw json.RawMessage) *Config {
+	var cfg struct {
+		Auth *Config `json:"auth"`
+	}
+	if len(raw) == 0 || json.Unmarshal(raw, &cfg) != nil || cfg.Auth == nil || cfg.Auth.Type == "" {
+		return nil
+	}
+	return cfg.Auth
+}
+
+// New 创建认证策略
+func New(cfg Config, account *model.ChannelAccount) (Authenticator, error) {
+	switch cfg.Type {
+	case "", TypeStatic:
+		return newStatic(cfg, account), nil
+	case TypeJWT:
+		return newJWT(cfg, account)
+	case TypeHMAC:
+		return newHMAC(cfg, account)
+	case TypeOAuth2:
+		return newOAuth2(cfg, account)
+	default:
+		return nil, fmt.Errorf("unsupported auth type: %s", cfg.Type)
+	}
+}
+
+// Resolve 按渠道配置创建认证策略，渠道未配置时使用 fallback
+func Resolve(channel *model.Channel, account *model.ChannelAccount, fallback Config) (Authenticator, error) {
+	if cfg := ParseChannelConfig(channel.Config); cfg != nil {
+		return New(*cfg, account)
+	}
+	return New(fallback, account)
+}
+
+// Static 渠道能力上的静态认证配置
+func Static(location, key, prefix string) Config {
+	return Config{Type: TypeStatic, Location: location, Header: key, Prefix: prefix}
+}
+
+// accountConfig 读取账号配置
+func accountConfig(account *model.ChannelAccount) map[string]any {
+	var config map[string]any
+	if len(account.Config) > 0 {
+		json.Unmarshal(account.Config, &config)
+	}
+	return config
+}
+
+// credentials 从账号配置读取密钥对，secret 未配置时使用账号 APIKey
+func credentials(cfg Config, account *model.ChannelAccount, accessDefault, secretDefault string) (string, string, error) {
+	accessField := cfg.AccessKeyField
+	if accessField == "" {
+		accessField = accessDefault
+	}
+	secretField := cfg.SecretKeyField
+	if secretField == "" {
+		secretField = secretDefault
+	}
+
+	config := accountConfig(account)
+	access, _ := config[accessField].(string)
+	secret, _ := config[secretField].(string)
+	if secret == "" {
+		secret = account.APIKey
+	}
+	if access == "" || secret == "" {
+		return "", "", fmt.Errorf("account %d missing %s/%s in config", account.ID, accessField, secretField)
+	}
+	return access, secret, nil
+}
+
+// cacheKey 令牌缓存键，包含密钥摘要，轮换密钥后自动失效
+func cacheKey(kind string, account *model.ChannelAccount, parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%s%s:%d:%s", cacheKeyPrefix, kind, account.ID, hex.EncodeToString(h.Sum(nil))[:16])
+}
+
+// cachedToken 优先从 Redis 读取令牌，不存在时获取并缓存
+func cachedToken(ctx context.Context, key string, fetch func() (string, time.Duration, error)) (string, error) {
+	if cache.Client != nil {
+		if token, err := cache.Client.Get(ctx, key).Result(); err == nil && token != "" {
+			return token, nil
+		}
+	}
+
+	token, ttl, err := fetch()
+	if err != nil {
+		return "", err
+	}
+	if cache.Client != nil && ttl > 0 {
+		cache.Client.Set(ctx, key, token, ttl)
+	}
+	return token, nil
+}
+
+// setHeader 写入请求头
+func setHeader(req *httputil.Request, key, value string) {
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	req.Headers[key] = value
+}
+
+// appendQuery 写入 query 参数
+func appendQuery(req *httputil.Request, key, value string) {
+	req.URL = httputil.AppendQuery(req.URL, url.Values{key: {value}})
+}
+
+func defaultString(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,324 @@
+package vendorauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/cache"
+	"github.com/majingzhen/prism/pkg/httputil"
+	"github.com/redis/go-redis/v9"
+)
+
+func newAccount(apiKey, config string) *model.ChannelAccount {
+	account := &model.ChannelAccount{APIKey: apiKey, Config: json.RawMessage(config)}
+	account.ID = 1
+	return account
+}
+
+func TestStatic(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		req        httputil.Request
+		wantHeader map[string]string
+		wantURL    string
+		wantParams map[string]any
+		wantBody   string
+	}{
+		{name: "default header", req: httputil.Request{URL: "https://vendor/v1"}, wantHeader: map[string]string{"Authorization": "sk-1"}, wantURL: "https://vendor/v1"},
+		{name: "header with prefix", cfg: Static("header", "X-Api-Key", "Key "), req: httputil.Request{URL: "https://vendor/v1"}, wantHeader: map[string]string{"X-Api-Key": "Key sk-1"}, wantURL: "https://vendor/v1"},
+		{name: "query", cfg: Static("query", "key", "Bearer "), req: httputil.Request{URL: "https://vendor/v1?a=1"}, wantURL: "https://vendor/v1?a=1&key=sk-1"},
+		{name: "body params", cfg: Static("body", "api_key", ""), req: httputil.Request{Params: map[string]any{"prompt": "hi"}}, wantParams: map[string]any{"prompt": "hi", "api_key": "sk-1"}},
+		{name: "empty body", cfg: Static("body", "api_key", ""), req: httputil.Request{}, wantParams: map[string]any{"api_key": "sk-1"}},
+		{name: "encoded body", cfg: Static("body", "api_key", ""), req: httputil.Request{Body: []byte(`{"prompt":"hi"}`)}, wantBody: `{"api_key":"sk-1","prompt":"hi"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := New(tt.cfg, newAccount("sk-1", ""))
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			req := tt.req
+			if err := auth.Apply(context.Background(), &req); err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			for k, v := range tt.wantHeader {
+				if req.Headers[k] != v {
+					t.Errorf("header %s = %q, want %q", k, req.Headers[k], v)
+				}
+			}
+			if tt.wantURL != "" && req.URL != tt.wantURL {
+				t.Errorf("url = %q, want %q", req.URL, tt.wantURL)
+			}
+			if tt.wantParams != nil {
+				got, _ := json.Marshal(req.Params)
+				want, _ := json.Marshal(tt.wantParams)
+				if string(got) != string(want) {
+					t.Errorf("params = %s, want %s", got, want)
+				}
+			}
+			if tt.wantBody != "" && string(req.Body) != tt.wantBody {
+				t.Errorf("body = %s, want %s", req.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestJWT(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		account    *model.ChannelAccount
+		wantHeader string
+		wantPrefix string
+		wantTTL    time.Duration
+	}{
+		{name: "defaults", cfg: Config{Type: TypeJWT}, account: newAccount("", `{"access_key":"ak-1","secret_key":"sk-1"}`), wantHeader: "Authorization", wantPrefix: "Bearer ", wantTTL: 30 * time.Minute},
+		{name: "custom header and ttl", cfg: Config{Type: TypeJWT, Header: "X-Token", Prefix: "JWT ", TTL: 600}, account: newAccount("", `{"access_key":"ak-1","secret_key":"sk-1"}`), wantHeader: "X-Token", wantPrefix: "JWT ", wantTTL: 10 * time.Minute},
+		{name: "secret from api key", cfg: Config{Type: TypeJWT}, account: newAccount("sk-1", `{"access_key":"ak-1"}`), wantHeader: "Authorization", wantPrefix: "Bearer ", wantTTL: 30 * time.Minute},
+		{name: "custom fields", cfg: Config{Type: TypeJWT, AccessKeyField: "ak", SecretKeyField: "sk"}, account: newAccount("", `{"ak":"ak-1","sk":"sk-1"}`), wantHeader: "Authorization", wantPrefix: "Bearer ", wantTTL: 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := New(tt.cfg, tt.account)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			var req httputil.Request
+			if err := auth.Apply(context.Background(), &req); err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			value, ok := strings.CutPrefix(req.Headers[tt.wantHeader], tt.wantPrefix)
+			if !ok {
+				t.Fatalf("header %s = %q, want prefix %q", tt.wantHeader, req.Headers[tt.wantHeader], tt.wantPrefix)
+			}
+
+			claims := jwt.MapClaims{}
+			token, err := jwt.ParseWithClaims(value, claims, func(*jwt.Token) (any, error) { return []byte("sk-1"), nil },
+				jwt.WithValidMethods([]string{"HS256"}), jwt.WithIssuer("ak-1"))
+			if err != nil || !token.Valid {
+				t.Fatalf("parse jwt: %v", err)
+			}
+			exp, _ := claims.GetExpirationTime()
+			if d := time.Until(exp.Time) - tt.wantTTL; d > 5*time.Second || d < -5*time.Second {
+				t.Errorf("exp = %v, want about now + %v", exp.Time, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	const account = `{"access_key":"ak-1","secret_key":"sk-1"}`
+	tests := []struct {
+		name      string
+		cfg       Config
+		req       httputil.Request
+		wantPath  string
+		wantQuery string
+		wantBody  string
+	}{
+		{
+			name:      "post json",
+			cfg:       Config{Type: TypeHMAC},
+			req:       httputil.Request{Method: "POST", URL: "https://vendor/v1/videos?b=2&a=1", Params: map[string]any{"prompt": "hi"}},
+			wantPath:  "/v1/videos",
+			wantQuery: "a=1&b=2",
+			wantBody:  `{"prompt":"hi"}`,
+		},
+		{
+			name:      "get params in query",
+			cfg:       Config{Type: TypeHMAC},
+			req:       httputil.Request{Method: "GET", URL: "https://vendor/v1/tasks", Params: map[string]any{"id": "t 1"}},
+			wantPath:  "/v1/tasks",
+			wantQuery: "id=t+1",
+		},
+		{
+			name:     "base64 custom format",
+			cfg:      Config{Type: TypeHMAC, Header: "X-Signature", Algorithm: "ACS3", Encoding: "base64", Format: "{algorithm}:{access_key}:{signature}"},
+			req:      httputil.Request{URL: "https://vendor", Body: []byte(`{"a":1}`)},
+			wantPath: "/",
+			wantBody: `{"a":1}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := New(tt.cfg, newAccount("", account))
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			req := tt.req
+			if err := auth.Apply(context.Background(), &req); err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+
+			u, _ := url.Parse(req.URL)
+			if u.Query().Encode() != tt.wantQuery {
+				t.Errorf("query = %q, want %q", u.Query().Encode(), tt.wantQuery)
+			}
+			body := req.Payload()
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+
+			// 按文档约定的待签名字符串重新计算签名
+			timestamp, nonce := req.Headers["X-Timestamp"], req.Headers["X-Nonce"]
+			bodyHash := sha256.Sum256(body)
+			stringToSign := strings.Join([]string{
+				strings.ToUpper(defaultString(tt.req.Method, "POST")),
+				tt.wantPath,
+				tt.wantQuery,
+				timestamp,
+				nonce,
+				hex.EncodeToString(bodyHash[:]),
+			}, "\n")
+			mac := hmac.New(sha256.New, []byte("sk-1"))
+			mac.Write([]byte(stringToSign))
+
+			var want string
+			if tt.cfg.Encoding == "base64" {
+				want = "ACS3:ak-1:" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+			} else {
+				want = "HMAC-SHA256 Credential=ak-1, Timestamp=" + timestamp + ", Nonce=" + nonce + ", Signature=" + hex.EncodeToString(mac.Sum(nil))
+			}
+			header := defaultString(tt.cfg.Header, "Authorization")
+			if timestamp == "" || len(nonce) != 32 || req.Headers[header] != want {
+				t.Errorf("header %s = %q, want %q", header, req.Headers[header], want)
+			}
+		})
+	}
+}
+
+func TestOAuth2(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientAuth string
+		response   string
+		wantToken  string
+		wantTTL    time.Duration
+		wantErr    bool
+	}{
+		{name: "body client auth", response: `{"access_token":"at-1","expires_in":3600}`, wantToken: "at-1", wantTTL: 59 * time.Minute},
+		{name: "basic client auth", clientAuth: "basic", response: `{"access_token":"at-1","expires_in":3600}`, wantToken: "at-1", wantTTL: 59 * time.Minute},
+		{name: "default expiry", response: `{"access_token":"at-1"}`, wantToken: "at-1", wantTTL: 29 * time.Minute},
+		{name: "missing token", response: `{"error":"invalid_client"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			cache.Client = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() {
+				cache.Client.Close()
+				cache.Client = nil
+			})
+
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				r.ParseForm()
+				id, secret, basic := r.BasicAuth()
+				if !basic {
+					id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+				}
+				if basic != (tt.clientAuth == "basic") || id != "cid" || !strings.HasPrefix(secret, "csecret") ||
+					r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("scope") != "video" {
+					t.Errorf("token request = %v, basic %v", r.PostForm, basic)
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			cfg := Config{Type: TypeOAuth2, TokenURL: srv.URL, Scope: "video", ClientAuth: tt.clientAuth}
+			auth, err := New(cfg, newAccount("", `{"client_id":"cid","client_secret":"csecret"}`))
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			for i := 0; i < 2; i++ {
+				var req httputil.Request
+				err := auth.Apply(context.Background(), &req)
+				if tt.wantErr {
+					if err == nil {
+						t.Fatal("Apply should fail")
+					}
+					return
+				}
+				if err != nil || req.Headers["Authorization"] != "Bearer "+tt.wantToken {
+					t.Fatalf("Apply = %q, %v", req.Headers["Authorization"], err)
+				}
+			}
+
+			// 令牌缓存到过期前一分钟
+			if requests.Load() != 1 {
+				t.Errorf("token requests = %d, want 1", requests.Load())
+			}
+			keys := mr.Keys()
+			if len(keys) != 1 || mr.TTL(keys[0]) != tt.wantTTL {
+				t.Errorf("cache keys = %v, ttl = %v, want %v", keys, mr.TTL(keys[0]), tt.wantTTL)
+			}
+
+			// 轮换密钥后不再使用旧令牌
+			rotated, _ := New(cfg, newAccount("", `{"client_id":"cid","client_secret":"csecret-2"}`))
+			rotated.Apply(context.Background(), &httputil.Request{})
+			if requests.Load() != 2 {
+				t.Errorf("token requests after rotation = %d, want 2", requests.Load())
+			}
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		account string
+	}{
+		{name: "unsupported type", cfg: Config{Type: "digest"}},
+		{name: "jwt missing access key", cfg: Config{Type: TypeJWT}, account: `{"secret_key":"sk-1"}`},
+		{name: "jwt missing secret", cfg: Config{Type: TypeJWT}, account: `{"access_key":"ak-1"}`},
+		{name: "hmac missing access key", cfg: Config{Type: TypeHMAC}, account: `{"secret_key":"sk-1"}`},
+		{name: "oauth2 missing token url", cfg: Config{Type: TypeOAuth2}, account: `{"client_id":"cid","client_secret":"csecret"}`},
+		{name: "oauth2 missing client id", cfg: Config{Type: TypeOAuth2, TokenURL: "https://auth"}, account: `{"client_secret":"csecret"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg, newAccount("", tt.account)); err == nil {
+				t.Error("New should fail")
+			}
+		})
+	}
+}
+
+func TestParseChannelConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		wantType string
+	}{
+		{name: "empty"},
+		{name: "no auth", raw: `{"base_url":"https://vendor"}`},
+		{name: "auth without type", raw: `{"auth":{"header":"X-Key"}}`},
+		{name: "invalid json", raw: `{`},
+		{name: "jwt", raw: `{"auth":{"type":"jwt","ttl":600}}`, wantType: TypeJWT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ParseChannelConfig(json.RawMessage(tt.raw))
+			if (cfg == nil) != (tt.wantType == "") || (cfg != nil && cfg.Type != tt.wantType) {
+				t.Errorf("ParseChannelConfig = %+v, want type %q", cfg, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/provider/vendorauth"
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/majingzhen/prism/pkg/secret"
+	"go.uber.org/zap"
+)
+
+// redacted 日志中替换密钥的文本
+const redacted = "[REDACTED]"
+
+// sensitiveConfigKeys 视为密钥的字段名，比较前转为小写并把 - 替换为 _
+var sensitiveConfigKeys = []string{
+	"ak", "sk", "apikey", "api_key", "access_key", "secret_key", "secret", "client_secret",
+	"password", "passwd", "token", "access_token", "refresh_token", "id_token",
+	"private_key", "credential", "credentials", "signature", "authorization", "cookie",
+}
+
+// sensitiveKeySuffixes 以这些后缀结尾的字段名也视为密钥，如 x_api_key、app_secret、session_token
+var sensitiveKeySuffixes = []string{"key", "_secret", "_password", "_token", "_credential", "_signature"}
+
+// sensitiveHeaders 日志中始终脱敏的请求头，其余请求头按字段名和渠道配置的认证头判断
+var sensitiveHeaders = []string{"authorization", "proxy-authorization", "cookie"}
+
+// minRedactLength 按值替换的最短长度，过短的值不替换以免误伤
+const minRedactLength = 8
+
+// MaskAccountSecrets 账号 APIKey 和配置中密钥字段的脱敏值，用于管理接口展示
+func MaskAccountSecrets(account *model.ChannelAccount) (string, json.RawMessage) {
+	config := accountConfigMap(account.Config)
+	if config == nil {
+		return secret.Mask(account.APIKey), account.Config
+	}
+	for k, v := range config {
+		if s, ok := v.(string); ok && isSensitiveConfigKey(k) {
+			config[k] = secret.Mask(s)
+		}
+	}
+	masked, _ := json.Marshal(config)
+	return secret.Mask(account.APIKey), masked
+}
+
+// CanRevealSecrets 用户是否允许查看渠道账号密钥明文
+func CanRevealSecrets(userID uint) bool {
+	var user model.User
+	if err := model.DB().Select("id", "username", "role").First(&user, userID).Error; err != nil {
+		return false
+	}
+	return user.Role == model.UserRoleAdmin && slices.Contains(config.C.Secrets.RevealUsers, user.Username)
+}
+
+// restoreMaskedSecrets 管理端提交的脱敏值还原为原值，避免回写脱敏文本覆盖密钥
+func restoreMaskedSecrets(existing *model.ChannelAccount, apiKey string, config map[string]any) string {
+	if apiKey != "" && apiKey == secret.Mask(existing.APIKey) {
+		apiKey = ""
+	}
+	old := accountConfigMap(existing.Config)
+	for k, v := range config {
+		s, ok := v.(string)
+		if !ok || !isSensitiveConfigKey(k) {
+			continue
+		}
+		if prev, ok := old[k].(string); ok && s == secret.Mask(prev) {
+			config[k] = prev
+		}
+	}
+	return apiKey
+}
+
+// ReencryptAccountSecrets 用当前主密钥加密明文保存的账号密钥，并重新加密使用旧主密钥的数据密钥
+// 直接读写原始列值，不经过序列化器
+func ReencryptAccountSecrets() error {
+	if !secret.Enabled() {
+		return nil
+	}
+
+	var rows []struct {
+		ID     uint
+		APIKey string
+		Config string
+	}
+	if err := model.DB().Unscoped().Table("channel_accounts").
+		Select("id", "COALESCE(api_key, '') AS api_key", "COALESCE(config, '') AS config").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, row := range rows {
+		updates := make(map[string]any)
+		for column, value := range map[string]string{"api_key": row.APIKey, "config": row.Config} {
+			if !secret.NeedsRewrap(value) {
+				continue
+			}
+			rewrapped, err := secret.Rewrap(value)
+			if err != nil {
+				return err
+			}
+			updates[column] = rewrapped
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := model.DB().Table("channel_accounts").Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		updated++
+	}
+
+	if updated > 0 {
+		logger.Info("channel account secrets re-encrypted", zap.Int("accounts", updated))
+	}
+	return nil
+}
+
+// redactRequestLog 去掉请求日志中的账号密钥和派生凭证
+// 敏感请求头、渠道配置的认证头和 query 中的敏感参数整体替换，其值（如 OAuth2 访问令牌、签发的 JWT、请求签名）
+// 连同账号密钥原文在其余字段中出现时也替换
+func redactRequestLog(log *model.ChannelRequestLog) {
+	authHeader := channelAuthHeader(log.ChannelID)
+
+	var values []string
+	if log.RequestHeaders != "" {
+		var headers map[string]string
+		if json.Unmarshal([]byte(log.RequestHeaders), &headers) == nil {
+			for k, v := range headers {
+				if !isSensitiveHeader(k, authHeader) || v == redacted {
+					continue
+				}
+				values = append(values, credentialValues(v)...)
+				headers[k] = redacted
+			}
+			data, _ := json.Marshal(headers)
+			log.RequestHeaders = string(data)
+		}
+	}
+	if u, err := url.Parse(log.URL); err == nil {
+		for k, vs := range u.Query() {
+			if !isSensitiveConfigKey(k) {
+				continue
+			}
+			for _, v := range vs {
+				values = append(values, credentialValues(v)...)
+			}
+		}
+	}
+
+	if log.AccountID > 0 {
+		var account model.ChannelAccount
+		if err := model.DB().Unscoped().Select("id", "api_key", "config").First(&account, log.AccountID).Error; err == nil {
+			values = append(values, accountSecretValues(&account)...)
+		}
+	}
+
+	var replacements []string
+	for _, s := range sortSecretValues(values) {
+		replacements = append(replacements, s, redacted)
+		if escaped := url.QueryEscape(s); escaped != s {
+			replacements = append(replacements, escaped, redacted)
+		}
+	}
+	if len(replacements) == 0 {
+		return
+	}
+	r := strings.NewReplacer(replacements...)
+	log.URL = r.Replace(log.URL)
+	log.RequestHeaders = r.Replace(log.RequestHeaders)
+	log.RequestBody = r.Replace(log.RequestBody)
+	log.ResponseBody = r.Replace(log.ResponseBody)
+	log.ErrorMessage = r.Replace(log.ErrorMessage)
+}
+
+// accountSecretValues 账号的 APIKey 和配置中的密钥字段值
+func accountSecretValues(account *model.ChannelAccount) []string {
+	var values []string
+	if len(account.APIKey) >= minRedactLength {
+		values = append(values, account.APIKey)
+	}
+	for k, v := range accountConfigMap(account.Config) {
+		if s, ok := v.(string); ok && len(s) >= minRedactLength && isSensitiveConfigKey(k) {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// credentialValues 认证值本身及去掉认证方案 (如 "Bearer ") 后的令牌，HMAC 签名头中 Signature=、Credential= 等敏感参数的值也单独替换
+func credentialValues(value string) []string {
+	var values []string
+	add := func(v string) {
+		v = strings.Trim(v, ` ,"`)
+		if len(v) >= minRedactLength {
+			values = append(values, v)
+		}
+	}
+	add(value)
+	if _, rest, ok := strings.Cut(value, " "); ok {
+		add(rest)
+		for _, part := range strings.Split(rest, ",") {
+			if k, v, ok := strings.Cut(part, "="); ok && isSensitiveConfigKey(strings.TrimSpace(k)) {
+				add(v)
+			}
+		}
+	}
+	return values
+}
+
+// sortSecretValues 去重并按长度从长到短排序，避免包含关系的密钥只替换一部分
+func sortSecretValues(values []string) []string {
+	slices.SortFunc(values, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(b) - len(a)
+		}
+		return strings.Compare(a, b)
+	})
+	return slices.Compact(values)
+}
+
+// channelAuthHeader 渠道认证配置写入的请求头，未配置时返回空
+func channelAuthHeader(channelID uint) string {
+	if channelID == 0 {
+		return ""
+	}
+	var channel model.Channel
+	if err := model.DB().Unscoped().Select("id", "config").First(&channel, channelID).Error; err != nil {
+		return ""
+	}
+	if cfg := vendorauth.ParseChannelConfig(channel.Config); cfg != nil && cfg.Header != "" && cfg.Location != "query" && cfg.Location != "body" {
+		return cfg.Header
+	}
+	return ""
+}
+
+func isSensitiveHeader(key, authHeader string) bool {
+	if authHeader != "" && strings.EqualFold(key, authHeader) {
+		return true
+	}
+	return slices.Contains(sensitiveHeaders, strings.ToLower(key)) || isSensitiveConfigKey(key)
+}
+
+func accountConfigMap(data json.RawMessage) map[string]any {
+	if len(data) == 0 {
+		return nil
+	}
+	var config map[string]any
+	json.Unmarshal(data, &config)
+	return config
+}
+
+func isSensitiveConfigKey(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	if slices.Contains(sensitiveConfigKeys, key) {
+		return true
+	}
+	for _, suffix := range sensitiveKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,562 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/majingzhen/prism/pkg/httputil"
+	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/majingzhen/prism/pkg/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultTransferConcurrency 默认转存并发数
+	DefaultTransferConcurrency = 4
+	// DefaultSignedURLTTL 默认私有资源签名链接有效期
+	DefaultSignedURLTTL = time.Hour
+	// cleanupRetryBase 资源删除失败后的首次重试间隔，之后每次翻倍，最长 cleanupRetryMax
+	cleanupRetryBase = time.Hour
+	cleanupRetryMax  = 24 * time.Hour
+)
+
+// AssetTransfer 单个资源的转存结果
+// 私有存储或访问链接会过期的存储 (本地存储、开启 presign_get 的 S3) URL 为空，只保存对象路径 Key，读取时再生成签名链接
+type AssetTransfer struct {
+	OriginURL string `json:"origin_url"`
+	URL       string `json:"url"`
+	Key       string `json:"key,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+var ErrAssetExpired = errors.New("asset expired")
+
+type AssetService struct{}
+
+func NewAssetService() *AssetService {
+	return &AssetService{}
+}
+
+// TransferResult 转存结果中的全部资源
+// 处理 url、urls 以及数组字段中每一项的 url，转存失败的资源保留原始地址，
+// 原始地址分别写入 origin_url / origin_urls / 数组项的 origin_url，明细写入 assets
+func (s *AssetService) TransferResult(ctx context.Context, capabilityCode string, result map[string]any) {
+	if storage.DefaultStorage == nil || result == nil {
+		return
+	}
+
+	urls := collectResultURLs(result)
+	if len(urls) == 0 {
+		return
+	}
+
+	transfers := s.TransferURLs(ctx, capabilityCode, urls)
+	stored := make(map[string]AssetTransfer, len(transfers))
+	for _, t := range transfers {
+		stored[t.OriginURL] = t
+	}
+	resolve := func(u string) AssetTransfer {
+		if t, ok := stored[u]; ok {
+			return t
+		}
+		return AssetTransfer{OriginURL: u, URL: u}
+	}
+
+	if originURL, ok := result["url"].(string); ok && originURL != "" {
+		t := resolve(originURL)
+		result["origin_url"] = originURL
+		result["url"] = t.URL
+		if t.Key != "" {
+			result["key"] = t.Key
+		}
+	}
+
+	if originURLs := toStringSlice(result["urls"]); len(originURLs) > 0 {
+		finalURLs := make([]string, 0, len(originURLs))
+		keys := make([]string, 0, len(originURLs))
+		hasKey := false
+		for _, u := range originURLs {
+			t := resolve(u)
+			finalURLs = append(finalURLs, t.URL)
+			keys = append(keys, t.Key)
+			hasKey = hasKey || t.Key != ""
+		}
+		result["origin_urls"] = originURLs
+		result["urls"] = finalURLs
+		if hasKey {
+			result["keys"] = keys
+		}
+	}
+
+	for _, value := range result {
+		for _, item := range toItemSlice(value) {
+			if originURL, ok := item["url"].(string); ok && originURL != "" {
+				t := resolve(originURL)
+				item["origin_url"] = originURL
+				item["url"] = t.URL
+				if t.Key != "" {
+					item["key"] = t.Key
+				}
+			}
+		}
+	}
+
+	result["assets"] = transfers
+}
+
+// ResolveResult 为存在 key 的资源生成签名访问链接：url 为空，或存储的链接会过期（旧数据中保存的过期链接也会重新签名）
+func (s *AssetService) ResolveResult(ctx context.Context, result map[string]any) map[string]any {
+	if storage.DefaultStorage == nil || result == nil {
+		return result
+	}
+	expiring := storage.URLExpires()
+	needsSign := func(u, key string) bool {
+		return key != "" && (u == "" || expiring)
+	}
+
+	ttl := time.Duration(config.C.Storage.SignedURLTTL) * time.Second
+	if ttl <= 0 {
+		ttl = DefaultSignedURLTTL
+	}
+	sign := func(key string) string {
+		u, err := storage.GetSignedURL(ctx, key, ttl)
+		if err != nil {
+			logger.Error("sign asset url failed", zap.String("key", key), zap.Error(err))
+			return ""
+		}
+		return u
+	}
+
+	if key, ok := result["key"].(string); ok {
+		if u, _ := result["url"].(string); needsSign(u, key) {
+			result["url"] = sign(key)
+		}
+	}
+
+	keys := toStringSlice(result["keys"])
+	urls := toStringSlice(result["urls"])
+	if len(keys) > 0 && len(keys) == len(urls) {
+		signedURLs := make([]string, len(urls))
+		for i, u := range urls {
+			if needsSign(u, keys[i]) {
+				u = sign(keys[i])
+			}
+			signedURLs[i] = u
+		}
+		result["urls"] = signedURLs
+	}
+
+	for _, value := range result {
+		for _, item := range toItemSlice(value) {
+			key, _ := item["key"].(string)
+			if u, _ := item["url"].(string); needsSign(u, key) {
+				item["url"] = sign(key)
+			}
+		}
+	}
+
+	return result
+}
+
+// ResolveResultJSON 解析任务结果并生成私有资源的签名链接
+func (s *AssetService) ResolveResultJSON(ctx context.Context, data []byte) map[string]any {
+	if len(data) == 0 {
+		return nil
+	}
+	var result map[string]any
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	return s.ResolveResult(ctx, result)
+}
+
+// TransferURLs 并发转存一组 URL，返回结果与入参顺序一致
+func (s *AssetService) TransferURLs(ctx context.Context, capabilityCode string, urls []string) []AssetTransfer {
+	transfers := make([]AssetTransfer, len(urls))
+	// 私有存储和访问链接会过期的存储只保存对象路径
+	keyOnly := s.IsPrivate(capabilityCode) || storage.URLExpires()
+	concurrency := config.C.Storage.TransferConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultTransferConcurrency
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, originURL := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, originURL string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			transfers[i] = AssetTransfer{OriginURL: originURL, URL: originURL}
+			finalURL, key, size, err := s.transfer(ctx, capabilityCode, originURL)
+			if err != nil {
+				logger.Error("transfer asset failed", zap.String("url", originURL), zap.Error(err))
+				transfers[i].Error = err.Error()
+				return
+			}
+			transfers[i].Key = key
+			transfers[i].Size = size
+			transfers[i].URL = finalURL
+			if keyOnly {
+				transfers[i].URL = ""
+			}
+		}(i, originURL)
+	}
+	wg.Wait()
+
+	return transfers
+}
+
+// transfer 下载单个资源并上传到存储，返回访问地址、对象路径和文件大小
+func (s *AssetService) transfer(ctx context.Context, capabilityCode string, originURL string) (string, string, int64, error) {
+	downloadResult, err := httputil.Download(ctx, originURL)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("download: %w", err)
+	}
+	defer downloadResult.Body.Close()
+
+	storagePath := GenerateStoragePath(capabilityCode, originURL)
+	body := &countingReader{reader: downloadResult.Body}
+	finalURL, err := storage.Upload(ctx, body, storagePath, downloadResult.ContentType)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("upload: %w", err)
+	}
+	return finalURL, storagePath, body.size, nil
+}
+
+// countingReader 统计读取字节数
+type countingReader struct {
+	reader io.Reader
+	size   int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// IsPrivate 判断能力的结果是否私有存储（能力未配置时跟随全局配置）
+func (s *AssetService) IsPrivate(capabilityCode string) bool {
+	var capability model.Capability
+	if err := model.DB().Select("asset_visibility").Where("code = ?", capabilityCode).First(&capability).Error; err == nil {
+		switch capability.AssetVisibility {
+		case model.AssetVisibilityPrivate:
+			return true
+		case model.AssetVisibilityPublic:
+			return false
+		}
+	}
+	return config.C.Storage.Private
+}
+
+// RetentionDays 获取资源保留天数：能力配置 > 用户等级 > 全局默认，0 表示永久保留
+// 能力配置为 model.RetentionForever 时永久保留，覆盖用户等级和全局默认
+func (s *AssetService) RetentionDays(capabilityCode string, userID uint) int {
+	var capability model.Capability
+	if err := model.DB().Select("retention_days").Where("code = ?", capabilityCode).First(&capability).Error; err == nil {
+		switch {
+		case capability.RetentionDays == model.RetentionForever:
+			return 0
+		case capability.RetentionDays > 0:
+			return capability.RetentionDays
+		}
+	}
+
+	cfg := config.C.Storage.Retention
+	var user model.User
+	if err := model.DB().Select("tier").First(&user, userID).Error; err == nil {
+		if days := cfg.Tiers[user.Tier]; days > 0 {
+			return days
+		}
+	}
+	return cfg.DefaultDays
+}
+
+// RetentionUpdates 根据转存结果计算任务的存储大小和过期时间字段
+func (s *AssetService) RetentionUpdates(capabilityCode string, userID uint, result map[string]any) map[string]any {
+	updates := map[string]any{}
+	transfers, _ := result["assets"].([]AssetTransfer)
+
+	var size int64
+	stored := false
+	for _, t := range transfers {
+		if t.Key != "" {
+			stored = true
+			size += t.Size
+		}
+	}
+	if !stored {
+		return updates
+	}
+
+	updates["asset_size"] = size
+	if days := s.RetentionDays(capabilityCode, userID); days > 0 {
+		updates["asset_expires_at"] = time.Now().AddDate(0, 0, days)
+	}
+	return updates
+}
+
+// CleanupExpired 删除已过期且未固定的存储资源，并将任务结果标记为已过期
+// 删除失败的任务记录失败次数并推迟到退避时间之后重试，不影响后续任务的清理
+func (s *AssetService) CleanupExpired(ctx context.Context, limit int) (int, error) {
+	if storage.DefaultStorage == nil {
+		return 0, nil
+	}
+
+	now := time.Now()
+	var tasks []model.Task
+	err := model.DB().
+		Where("asset_expires_at < ? AND asset_pinned = ? AND asset_expired = ?", now, false, false).
+		Where("asset_next_cleanup_at IS NULL OR asset_next_cleanup_at <= ?", now).
+		Order("asset_expires_at ASC").
+		Limit(limit).
+		Find(&tasks).Error
+	if err != nil {
+		return 0, err
+	}
+
+	cleaned := 0
+	for _, task := range tasks {
+		var result map[string]any
+		json.Unmarshal(task.Result, &result)
+
+		// 任一对象删除失败则保留任务状态，退避后重试
+		failed := false
+		for _, key := range collectResultKeys(result) {
+			if err := storage.Delete(ctx, key); err != nil {
+				logger.Error("delete expired asset failed",
+					zap.String("task_no", task.TaskNo),
+					zap.String("key", key),
+					zap.Int("attempts", task.AssetCleanupAttempts+1),
+					zap.Error(err))
+				failed = true
+			}
+		}
+		if failed {
+			model.DB().Model(&model.Task{}).Where("id = ?", task.ID).Updates(map[string]any{
+				"asset_cleanup_attempts": task.AssetCleanupAttempts + 1,
+				"asset_next_cleanup_at":  now.Add(cleanupBackoff(task.AssetCleanupAttempts + 1)),
+			})
+			continue
+		}
+
+		resultJSON, _ := json.Marshal(expireResult(result))
+		model.DB().Model(&model.Task{}).Where("id = ?", task.ID).Updates(map[string]any{
+			"result":        resultJSON,
+			"asset_expired": true,
+		})
+		cleaned++
+	}
+
+	return cleaned, nil
+}
+
+// cleanupBackoff 第 attempts 次删除失败后的重试间隔
+func cleanupBackoff(attempts int) time.Duration {
+	if attempts <= 0 {
+		return 0
+	}
+	if attempts > 5 {
+		return cleanupRetryMax
+	}
+	return min(cleanupRetryBase<<(attempts-1), cleanupRetryMax)
+}
+
+// SetPinned 固定或取消固定任务资源，固定后不会被清理
+func (s *AssetService) SetPinned(taskNo string, userID uint, pinned bool) error {
+	result := model.DB().Model(&model.Task{}).
+		Where("task_no = ? AND user_id = ? AND asset_expired = ?", taskNo, userID, false).
+		Update("asset_pinned", pinned)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		model.DB().Model(&model.Task{}).Where("task_no = ? AND user_id = ?", taskNo, userID).Count(&count)
+		if count == 0 {
+			return ErrTaskNotFound
+		}
+		return ErrAssetExpired
+	}
+	return nil
+}
+
+// StorageUsageItem 存储用量统计项
+type StorageUsageItem struct {
+	UserID         uint   `json:"user_id,omitempty"`
+	Username       string `json:"username,omitempty"`
+	CapabilityCode string `json:"capability_code,omitempty"`
+	TaskCount      int64  `json:"task_count"`
+	TotalSize      int64  `json:"total_size"`
+}
+
+// StorageUsage 统计当前存储用量（按用户和能力分组）
+func (s *AssetService) StorageUsage() (byUser []StorageUsageItem, byCapability []StorageUsageItem, err error) {
+	err = model.DB().Table("tasks").
+		Select("tasks.user_id, users.username, COUNT(*) AS task_count, COALESCE(SUM(tasks.asset_size), 0) AS total_size").
+		Joins("LEFT JOIN users ON users.id = tasks.user_id").
+		Where("tasks.asset_size > 0 AND tasks.asset_expired = ? AND tasks.deleted_at IS NULL", false).
+		Group("tasks.user_id, users.username").
+		Order("total_size DESC").
+		Scan(&byUser).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = model.DB().Table("tasks").
+		Select("capability_code, COUNT(*) AS task_count, COALESCE(SUM(asset_size), 0) AS total_size").
+		Where("asset_size > 0 AND asset_expired = ? AND deleted_at IS NULL", false).
+		Group("capability_code").
+		Order("total_size DESC").
+		Scan(&byCapability).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return byUser, byCapability, nil
+}
+
+// GenerateStoragePath 生成存储路径
+func GenerateStoragePath(capabilityCode string, originURL string) string {
+	now := time.Now()
+	ext := filepath.Ext(originURL)
+	// 去除ext中可能的查询参数
+	if idx := strings.Index(ext, "?"); idx > 0 {
+		ext = ext[:idx]
+	}
+	if ext == "" || len(ext) > 10 {
+		// 根据能力类型判断文件扩展名
+		if strings.Contains(capabilityCode, "video") {
+			ext = ".mp4"
+		} else {
+			ext = ".png"
+		}
+	}
+	return fmt.Sprintf("%s/%s/%s%s", capabilityCode, now.Format("2006/01/02"), uuid.New().String(), ext)
+}
+
+// collectResultURLs 收集结果中需要转存的 URL（去重，保持出现顺序）
+func collectResultURLs(result map[string]any) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	add := func(u string) {
+		if u == "" || seen[u] || !isRemoteURL(u) {
+			return
+		}
+		seen[u] = true
+		urls = append(urls, u)
+	}
+
+	if u, ok := result["url"].(string); ok {
+		add(u)
+	}
+	for _, u := range toStringSlice(result["urls"]) {
+		add(u)
+	}
+	for _, value := range result {
+		for _, item := range toItemSlice(value) {
+			if u, ok := item["url"].(string); ok {
+				add(u)
+			}
+		}
+	}
+	return urls
+}
+
+// collectResultKeys 收集结果中已存储对象的路径
+func collectResultKeys(result map[string]any) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(k string) {
+		if k == "" || seen[k] {
+			return
+		}
+		seen[k] = true
+		keys = append(keys, k)
+	}
+
+	if k, ok := result["key"].(string); ok {
+		add(k)
+	}
+	for _, k := range toStringSlice(result["keys"]) {
+		add(k)
+	}
+	for _, value := range result {
+		for _, item := range toItemSlice(value) {
+			if k, ok := item["key"].(string); ok {
+				add(k)
+			}
+		}
+	}
+	return keys
+}
+
+// expireResult 清除结果中已删除资源的地址和路径，保留原始地址
+func expireResult(result map[string]any) map[string]any {
+	if result == nil {
+		result = map[string]any{}
+	}
+	for _, field := range []string{"url", "urls", "key", "keys"} {
+		delete(result, field)
+	}
+	for _, value := range result {
+		for _, item := range toItemSlice(value) {
+			delete(item, "url")
+			delete(item, "key")
+		}
+	}
+	result["expired"] = true
+	return result
+}
+
+func isRemoteURL(u string) bool {
+	return strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")
+}
+
+// toStringSlice 将 []string / []any 统一转为 []string
+func toStringSlice(v any) []string {
+	switch val := v.(type) {
+	case []string:
+		return val
+	case []any:
+		result := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// toItemSlice 将数组处理的结果（[]map[string]any / []any）统一转为对象列表
+func toItemSlice(v any) []map[string]any {
+	switch val := v.(type) {
+	case []map[string]any:
+		return val
+	case []any:
+		result := make([]map[string]any, 0, len(val))
+		for _, item := range val {
+			if m, ok := item.(map[string]any); ok {
+				result = append(result, m)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/majingzhen/prism/pkg/storage"
+	"gorm.io/datatypes"
+)
+
+func TestResolveResultSignsKeys(t *testing.T) {
+	config.C = &config.Config{}
+	local, err := storage.NewLocalStorage(config.LocalStorageConfig{
+		Dir:        t.TempDir(),
+		BaseURL:    "https://prism.example.com",
+		SignSecret: "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	defer storage.SetDefault(storage.DefaultStorage)
+	storage.SetDefault(local)
+
+	// 升级前保存的结果中带有已过期的签名链接
+	stale := "https://prism.example.com/files/image/a.png?expires=1&sign=old"
+	result := map[string]any{
+		"url":        stale,
+		"key":        "image/a.png",
+		"origin_url": "https://vendor.example.com/a.png",
+		"urls":       []any{"", stale},
+		"keys":       []any{"image/b.png", "image/c.png"},
+		"images": []any{
+			map[string]any{"url": "", "key": "image/d.png"},
+			map[string]any{"url": "https://vendor.example.com/e.png"},
+		},
+	}
+
+	got := NewAssetService().ResolveResult(context.Background(), result)
+
+	signed := func(u any, key string) bool {
+		s, _ := u.(string)
+		return strings.HasPrefix(s, "https://prism.example.com/files/"+key+"?") && !strings.Contains(s, "expires=1&")
+	}
+	if !signed(got["url"], "image/a.png") {
+		t.Errorf("url = %v, want re-signed", got["url"])
+	}
+	urls := got["urls"].([]string)
+	if !signed(urls[0], "image/b.png") || !signed(urls[1], "image/c.png") {
+		t.Errorf("urls = %v, want signed", urls)
+	}
+	images := got["images"].([]any)
+	if !signed(images[0].(map[string]any)["url"], "image/d.png") {
+		t.Errorf("images[0].url = %v, want signed", images[0])
+	}
+	// 没有 key 的转存失败项保留原始地址
+	if images[1].(map[string]any)["url"] != "https://vendor.example.com/e.png" {
+		t.Errorf("images[1].url = %v, want origin url", images[1])
+	}
+	if got["origin_url"] != "https://vendor.example.com/a.png" {
+		t.Errorf("origin_url changed: %v", got["origin_url"])
+	}
+}
+
+// fakeStorage 内存存储，failKeys 中的对象删除失败
+type fakeStorage struct {
+	mu       sync.Mutex
+	deleted  []string
+	failKeys map[string]bool
+}
+
+func (f *fakeStorage) Upload(ctx context.Context, reader io.Reader, path string, contentType string) (string, error) {
+	return "https://cdn.example.com/" + path, nil
+}
+
+func (f *fakeStorage) Delete(ctx context.Context, path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failKeys[path] {
+		return errors.New("delete failed")
+	}
+	f.deleted = append(f.deleted, path)
+	return nil
+}
+
+func (f *fakeStorage) GetURL(path string) string {
+	return "https://cdn.example.com/" + path
+}
+
+func (f *fakeStorage) GetSignedURL(ctx context.Context, path string, ttl time.Duration) (string, error) {
+	return "https://cdn.example.com/" + path + "?signed", nil
+}
+
+func TestCleanupExpiredSkipsFailingTasks(t *testing.T) {
+	setupTestDB(t)
+	store := &fakeStorage{failKeys: map[string]bool{"bad-0": true, "bad-1": true}}
+	defer storage.SetDefault(storage.DefaultStorage)
+	storage.SetDefault(store)
+
+	// 两个删除失败的任务过期时间最早，批次大小为 2
+	expired := time.Now().Add(-time.Hour)
+	for i, key := range []string{"bad-0", "bad-1", "good-0", "good-1"} {
+		expiresAt := expired.Add(time.Duration(i) * time.Minute)
+		task := model.Task{
+			TaskNo:         key,
+			Result:         datatypes.JSON(`{"url":"","key":"` + key + `"}`),
+			AssetExpiresAt: &expiresAt,
+		}
+		if err := model.DB().Create(&task).Error; err != nil {
+			t.Fatalf("create task: %v", err)
+		}
+	}
+
+	svc := NewAssetService()
+	cleaned, err := svc.CleanupExpired(context.Background(), 2)
+	if err != nil || cleaned != 0 {
+		t.Fatalf("first run cleaned %d, err %v; want 0", cleaned, err)
+	}
+	// 失败的任务进入退避，下一批处理后面的任务
+	cleaned, err = svc.CleanupExpired(context.Background(), 2)
+	if err != nil || cleaned != 2 {
+		t.Fatalf("second run cleaned %d, err %v; want 2", cleaned, err)
+	}
+	if len(store.deleted) != 2 {
+		t.Fatalf("deleted %v, want good-0 and good-1", store.deleted)
+	}
+
+	var bad model.Task
+	model.DB().Where("task_no = ?", "bad-0").First(&bad)
+	if bad.AssetExpired || bad.AssetCleanupAttempts != 1 || bad.AssetNextCleanupAt == nil {
+		t.Fatalf("bad task = expired %v attempts %d next %v", bad.AssetExpired, bad.AssetCleanupAttempts, bad.AssetNextCleanupAt)
+	}
+	if d := time.Until(*bad.AssetNextCleanupAt); d < 50*time.Minute || d > time.Hour {
+		t.Errorf("next cleanup in %s, want about 1h", d)
+	}
+
+	var good model.Task
+	model.DB().Where("task_no = ?", "good-0").First(&good)
+	if !good.AssetExpired || !strings.Contains(string(good.Result), `"expired":true`) {
+		t.Errorf("good task not expired: %s", good.Result)
+	}
+
+	// 退避时间到达后重试，删除成功即标记为已清理
+	delete(store.failKeys, "bad-0")
+	model.DB().Model(&model.Task{}).Where("task_no = ?", "bad-0").Update("asset_next_cleanup_at", time.Now().Add(-time.Second))
+	cleaned, err = svc.CleanupExpired(context.Background(), 2)
+	if err != nil || cleaned != 1 {
+		t.Fatalf("retry cleaned %d, err %v; want 1", cleaned, err)
+	}
+}
+
+func TestCleanupBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Hour},
+		{2, 2 * time.Hour},
+		{5, 16 * time.Hour},
+		{6, 24 * time.Hour},
+		{100, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := cleanupBackoff(tt.attempts); got != tt.want {
+			t.Errorf("cleanupBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRetentionDays(t *testing.T) {
+	tests := []struct {
+		name       string
+		capability int
+		tier       string
+		want       int
+	}{
+		{name: "global default", capability: 0, tier: "default", want: 30},
+		{name: "tier", capability: 0, tier: "pro", want: 90},
+		{name: "capability overrides tier", capability: 7, tier: "pro", want: 7},
+		{name: "capability forever", capability: model.RetentionForever, tier: "pro", want: 0},
+		{name: "capability forever over default", capability: model.RetentionForever, tier: "default", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			config.C.Storage.Retention = config.RetentionConfig{DefaultDays: 30, Tiers: map[string]int{"pro": 90}}
+			model.DB().Create(&model.Capability{Code: "image", Name: "image", RetentionDays: tt.capability})
+			user := model.User{Username: "alice", Tier: tt.tier}
+			model.DB().Create(&user)
+
+			if got := NewAssetService().RetentionDays("image", user.ID); got != tt.want {
+				t.Errorf("RetentionDays = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
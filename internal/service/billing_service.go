@@ -1,77 +1,472 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/majingzhen/prism/pkg/money"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
-	ErrInsufficientTokenBalance = errors.New("insufficient token balance")
-	ErrInsufficientUserBalance  = errors.New("insufficient user balance")
+	ErrInsufficientUserBalance = errors.New("insufficient user balance")
+	ErrBillingTargetNotFound   = errors.New("user or token not found")
+	// ErrTokenBudgetExceeded 令牌累计消费达到预算上限，按令牌限制处理
+	ErrTokenBudgetExceeded = fmt.Errorf("%w: token budget exhausted", ErrSpendLimitExceeded)
 )
 
+// BillingRef 账务流水的关联对象
+type BillingRef struct {
+	TaskID         uint
+	TaskNo         string
+	ConversationID uint
+	MessageID      uint
+	OperatorID     uint
+	Remark         string
+}
+
+// TaskRef 关联任务的流水
+func TaskRef(task *model.Task) BillingRef {
+	return BillingRef{TaskID: task.ID, TaskNo: task.TaskNo}
+}
+
 type BillingService struct{}
 
 func NewBillingService() *BillingService {
 	return &BillingService{}
 }
 
-func (s *BillingService) Deduct(tokenID uint, userID uint, amount float64) error {
+// Deduct 从用户钱包扣费并计入令牌累计消费，钱包余额不足、超出令牌预算或当日/当月消费上限时返回错误
+func (s *BillingService) Deduct(tokenID uint, userID uint, amount money.Money, ref BillingRef) error {
+	return s.deductTx(tokenID, userID, amount, ref, true)
+}
+
+// DeductUsage 按实际用量补扣超出预扣的部分，检查钱包余额和令牌预算，不检查当日/当月消费上限
+// 预扣时已按上限检查过，补扣的是已经发生的用量
+func (s *BillingService) DeductUsage(tokenID uint, userID uint, amount money.Money, ref BillingRef) error {
+	return s.deductTx(tokenID, userID, amount, ref, false)
+}
+
+func (s *BillingService) deductTx(tokenID uint, userID uint, amount money.Money, ref BillingRef, limitSpend bool) error {
 	if amount <= 0 {
 		return nil
 	}
+	if userID == 0 {
+		return ErrBillingTargetNotFound
+	}
 
 	return model.DB().Transaction(func(tx *gorm.DB) error {
-		result := tx.Model(&model.Token{}).Where("id = ? AND balance >= ?", tokenID, amount).Updates(map[string]any{
-			"balance":    gorm.Expr("balance - ?", amount),
-			"total_used": gorm.Expr("total_used + ?", amount),
-		})
+		return s.deduct(tx, tokenID, userID, amount, ref, limitSpend)
+	})
+}
+
+// CreateChargedTask 创建任务并预扣任务费用，任务和扣费流水在同一个事务中写入，流水关联任务ID
+// 扣费失败时任务不会创建
+func (s *BillingService) CreateChargedTask(task *model.Task) error {
+	return model.DB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(task).Error; err != nil {
+			return fmt.Errorf("create task failed: %w", err)
+		}
+		if task.Cost <= 0 {
+			return nil
+		}
+		if task.UserID == 0 {
+			return ErrBillingTargetNotFound
+		}
+		if err := s.deduct(tx, task.TokenID, task.UserID, task.Cost, TaskRef(task), true); err != nil {
+			return fmt.Errorf("deduct %s failed: %w", task.Cost, err)
+		}
+		return nil
+	})
+}
+
+// DeductArrears 扣除已经发生、无法拒绝的费用，不检查钱包余额和令牌预算
+// 余额不足时钱包欠费（余额为负），欠费期间 Deduct 会拒绝新的扣费，充值后先抵扣欠款
+func (s *BillingService) DeductArrears(tokenID uint, userID uint, amount money.Money, ref BillingRef) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	return model.DB().Transaction(func(tx *gorm.DB) error {
+		entry := newBillingEntry(model.BillingTypeDeduct, userID, tokenID, ref)
+
+		result := tx.Model(&model.User{}).Where("id = ?", userID).
+			UpdateColumn("balance", gorm.Expr("balance - ?", amount))
 		if result.Error != nil {
 			return result.Error
 		}
 		if result.RowsAffected == 0 {
-			return ErrInsufficientTokenBalance
+			return ErrBillingTargetNotFound
 		}
+		entry.UserAmount = -amount
 
-		if userID > 0 {
-			userResult := tx.Model(&model.User{}).Where("id = ? AND balance >= ?", userID, amount).
-				UpdateColumn("balance", gorm.Expr("balance - ?", amount))
-			if userResult.Error != nil {
-				return userResult.Error
+		if tokenID > 0 {
+			tokenResult := tx.Model(&model.Token{}).Where("id = ?", tokenID).
+				UpdateColumn("total_used", gorm.Expr("total_used + ?", amount))
+			if tokenResult.Error != nil {
+				return tokenResult.Error
 			}
-			if userResult.RowsAffected == 0 {
-				return ErrInsufficientUserBalance
+			if tokenResult.RowsAffected > 0 {
+				entry.TokenAmount = -amount
 			}
 		}
 
-		return nil
+		return s.record(tx, entry)
 	})
 }
 
-func (s *BillingService) Refund(tokenID uint, userID uint, amount float64) error {
+// deduct 在事务中扣费并记录流水，limitSpend 时检查令牌当日/当月消费上限
+// 令牌行加锁后再汇总消费，同一令牌的并发扣费依次检查
+func (s *BillingService) deduct(tx *gorm.DB, tokenID uint, userID uint, amount money.Money, ref BillingRef, limitSpend bool) error {
+	entry := newBillingEntry(model.BillingTypeDeduct, userID, tokenID, ref)
+
+	if tokenID > 0 {
+		var token model.Token
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "daily_limit", "monthly_limit").
+			Where("id = ?", tokenID).First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrBillingTargetNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if limitSpend {
+			if err := checkSpend(tx, &token, amount); err != nil {
+				return err
+			}
+		}
+
+		result := tx.Model(&model.Token{}).
+			Where("id = ? AND (budget_enabled = ? OR total_used + ? <= budget_limit)", tokenID, false, amount).
+			UpdateColumn("total_used", gorm.Expr("total_used + ?", amount))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTokenBudgetExceeded
+		}
+		entry.TokenAmount = -amount
+	}
+
+	result := tx.Model(&model.User{}).Where("id = ? AND balance >= ?", userID, amount).
+		UpdateColumn("balance", gorm.Expr("balance - ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientUserBalance
+	}
+	entry.UserAmount = -amount
+
+	return s.record(tx, entry)
+}
+
+// Refund 退回用户钱包并扣回令牌累计消费，已删除的令牌跳过
+func (s *BillingService) Refund(tokenID uint, userID uint, amount money.Money, ref BillingRef) error {
 	if amount <= 0 {
 		return nil
 	}
 
 	return model.DB().Transaction(func(tx *gorm.DB) error {
-		result := tx.Model(&model.Token{}).Where("id = ?", tokenID).Updates(map[string]any{
-			"balance":    gorm.Expr("balance + ?", amount),
-			"total_used": gorm.Expr("total_used - ?", amount),
-		})
+		return s.refund(tx, tokenID, userID, amount, ref)
+	})
+}
+
+// refund 在事务中退回余额并记录流水
+func (s *BillingService) refund(tx *gorm.DB, tokenID uint, userID uint, amount money.Money, ref BillingRef) error {
+	entry := newBillingEntry(model.BillingTypeRefund, userID, tokenID, ref)
+
+	result := tx.Model(&model.User{}).Where("id = ?", userID).
+		UpdateColumn("balance", gorm.Expr("balance + ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBillingTargetNotFound
+	}
+	entry.UserAmount = amount
+
+	if tokenID > 0 {
+		tokenResult := tx.Model(&model.Token{}).Where("id = ?", tokenID).
+			UpdateColumn("total_used", gorm.Expr("total_used - ?", amount))
+		if tokenResult.Error != nil {
+			return tokenResult.Error
+		}
+		if tokenResult.RowsAffected > 0 {
+			entry.TokenAmount = amount
+		}
+	}
+
+	return s.record(tx, entry)
+}
+
+// RechargeUser 给用户钱包充值
+func (s *BillingService) RechargeUser(userID uint, amount money.Money, ref BillingRef) error {
+	return s.adjustUser(model.BillingTypeRecharge, userID, amount, ref)
+}
+
+// Adjust 管理员调整用户钱包余额，金额可为负，调整后余额不能小于 0
+func (s *BillingService) Adjust(userID uint, amount money.Money, ref BillingRef) error {
+	return s.adjustUser(model.BillingTypeAdjustment, userID, amount, ref)
+}
+
+// adjustUser 变动用户余额并记录流水
+func (s *BillingService) adjustUser(billingType string, userID uint, amount money.Money, ref BillingRef) error {
+	if amount == 0 {
+		return nil
+	}
+
+	return model.DB().Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&model.User{}).Where("id = ?", userID)
+		if amount < 0 {
+			query = query.Where("balance >= ?", -amount)
+		}
+		result := query.UpdateColumn("balance", gorm.Expr("balance + ?", amount))
 		if result.Error != nil {
 			return result.Error
 		}
+		if result.RowsAffected == 0 {
+			if amount < 0 {
+				return ErrInsufficientUserBalance
+			}
+			return ErrBillingTargetNotFound
+		}
+
+		entry := newBillingEntry(billingType, userID, 0, ref)
+		entry.UserAmount = amount
+		return s.record(tx, entry)
+	})
+}
+
+// record 写入流水，变动后余额和令牌累计消费在同一事务内读取
+func (s *BillingService) record(tx *gorm.DB, entry *model.BillingTransaction) error {
+	if entry.UserID > 0 {
+		var user model.User
+		if err := tx.Select("balance").First(&user, entry.UserID).Error; err == nil {
+			entry.UserBalanceAfter = user.Balance
+		}
+	}
+	if entry.TokenAmount != 0 {
+		var token model.Token
+		if err := tx.Select("total_used").First(&token, entry.TokenID).Error; err == nil {
+			entry.TokenUsedAfter = token.TotalUsed
+		}
+	}
+	return tx.Create(entry).Error
+}
+
+func newBillingEntry(billingType string, userID, tokenID uint, ref BillingRef) *model.BillingTransaction {
+	return &model.BillingTransaction{
+		Type:           billingType,
+		UserID:         userID,
+		TokenID:        tokenID,
+		TaskID:         ref.TaskID,
+		TaskNo:         ref.TaskNo,
+		ConversationID: ref.ConversationID,
+		MessageID:      ref.MessageID,
+		OperatorID:     ref.OperatorID,
+		Remark:         ref.Remark,
+	}
+}
+
+// TransactionQuery 流水查询条件
+type TransactionQuery struct {
+	UserID   uint   `form:"user_id"`
+	TokenID  uint   `form:"token_id"`
+	TaskNo   string `form:"task_no"`
+	Type     string `form:"type"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+}
+
+// ListTransactions 分页查询流水，按时间倒序
+func (s *BillingService) ListTransactions(q *TransactionQuery) ([]model.BillingTransaction, int64, error) {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 || q.PageSize > 100 {
+		q.PageSize = 20
+	}
+
+	db := model.DB().Model(&model.BillingTransaction{})
+	if q.UserID > 0 {
+		db = db.Where("user_id = ?", q.UserID)
+	}
+	if q.TokenID > 0 {
+		db = db.Where("token_id = ?", q.TokenID)
+	}
+	if q.TaskNo != "" {
+		db = db.Where("task_no = ?", q.TaskNo)
+	}
+	if q.Type != "" {
+		db = db.Where("type = ?", q.Type)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []model.BillingTransaction
+	err := db.Order("id DESC").
+		Offset((q.Page - 1) * q.PageSize).
+		Limit(q.PageSize).
+		Find(&items).Error
+	return items, total, err
+}
+
+// BillingMismatch 余额与流水汇总不一致的账户
+type BillingMismatch struct {
+	Kind          string      `json:"kind"`           // user / token
+	ID            uint        `json:"id"`             // 用户ID或令牌ID
+	Balance       money.Money `json:"balance"`        // 用户为钱包余额，令牌为累计消费
+	LedgerBalance money.Money `json:"ledger_balance"` // 按流水汇总的对应金额
+}
+
+// Reconcile 核对用户钱包余额是否等于流水变动之和，令牌累计消费是否等于流水中令牌扣费减退款之和
+func (s *BillingService) Reconcile() ([]BillingMismatch, error) {
+	var mismatches []BillingMismatch
+	err := model.DB().Table("users").
+		Select("'user' AS kind, users.id, users.balance, COALESCE(SUM(bt.user_amount), 0) AS ledger_balance").
+		Joins("LEFT JOIN billing_transactions bt ON bt.user_id = users.id").
+		Where("users.deleted_at IS NULL").
+		Group("users.id, users.balance").
+		Having("users.balance <> COALESCE(SUM(bt.user_amount), 0)").
+		Scan(&mismatches).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var tokenMismatches []BillingMismatch
+	err = model.DB().Table("tokens").
+		Select("'token' AS kind, tokens.id, tokens.total_used AS balance, COALESCE(-SUM(bt.token_amount), 0) AS ledger_balance").
+		Joins("LEFT JOIN billing_transactions bt ON bt.token_id = tokens.id").
+		Where("tokens.deleted_at IS NULL").
+		Group("tokens.id, tokens.total_used").
+		Having("tokens.total_used <> COALESCE(-SUM(bt.token_amount), 0)").
+		Scan(&tokenMismatches).Error
+	if err != nil {
+		return nil, err
+	}
+	mismatches = append(mismatches, tokenMismatches...)
 
-		if userID > 0 {
-			userResult := tx.Model(&model.User{}).Where("id = ?", userID).
-				UpdateColumn("balance", gorm.Expr("balance + ?", amount))
-			if userResult.Error != nil {
-				return userResult.Error
+	for _, m := range mismatches {
+		logger.Warn("billing ledger mismatch",
+			zap.String("kind", m.Kind),
+			zap.Uint("id", m.ID),
+			zap.Stringer("balance", m.Balance),
+			zap.Stringer("ledger_balance", m.LedgerBalance))
+	}
+	return mismatches, nil
+}
+
+// OpenLedger 首次启用流水时为已有余额的用户和已有消费的令牌补记期初调整，之后的余额变动均有流水可查
+func (s *BillingService) OpenLedger() error {
+	var count int64
+	if err := model.DB().Model(&model.BillingTransaction{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return model.DB().Transaction(func(tx *gorm.DB) error {
+		var users []model.User
+		if err := tx.Select("id", "balance").Where("balance <> 0").Find(&users).Error; err != nil {
+			return err
+		}
+		for _, u := range users {
+			entry := newBillingEntry(model.BillingTypeAdjustment, u.ID, 0, BillingRef{Remark: "opening balance"})
+			entry.UserAmount = u.Balance
+			entry.UserBalanceAfter = u.Balance
+			if err := tx.Create(entry).Error; err != nil {
+				return err
 			}
 		}
 
+		var tokens []model.Token
+		if err := tx.Select("id", "user_id", "total_used").Where("total_used <> 0").Find(&tokens).Error; err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			entry := newBillingEntry(model.BillingTypeAdjustment, t.UserID, t.ID, BillingRef{Remark: "opening token usage"})
+			entry.TokenAmount = -t.TotalUsed
+			if err := s.record(tx, entry); err != nil {
+				return err
+			}
+		}
+
+		if len(users) > 0 || len(tokens) > 0 {
+			logger.Info("billing ledger opened", zap.Int("users", len(users)), zap.Int("tokens", len(tokens)))
+		}
 		return nil
 	})
 }
+
+// MigrateWallet 令牌余额并入用户钱包模型：用户余额不变，令牌剩余余额转为预算上限
+// 迁移后令牌仍可再消费原剩余的额度，余额为 0 或欠费的令牌预算已用完，完成后删除令牌余额列
+// 已设置预算的令牌保留原预算
+func (s *BillingService) MigrateWallet() error {
+	// 增加预算开关前以 budget_limit > 0 表示启用预算；关闭预算时 budget_limit 同时清零，重复执行不影响
+	if err := model.DB().Unscoped().Model(&model.Token{}).
+		Where("budget_enabled = ? AND budget_limit > 0", false).
+		UpdateColumn("budget_enabled", true).Error; err != nil {
+		return err
+	}
+
+	migrator := model.DB().Migrator()
+	if !migrator.HasColumn(&model.Token{}, "balance") {
+		return nil
+	}
+
+	result := model.DB().Unscoped().Table("tokens").
+		Where("budget_enabled = ?", false).
+		Updates(map[string]any{
+			"budget_limit":   gorm.Expr("total_used + CASE WHEN balance > 0 THEN balance ELSE 0 END"),
+			"budget_enabled": true,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if err := migrator.DropColumn(&model.Token{}, "balance"); err != nil {
+		return err
+	}
+	logger.Info("token balances migrated to budgets", zap.Int64("tokens", result.RowsAffected))
+	return nil
+}
+
+// claimTaskFailure 把进行中的任务更新为失败并退回任务费用，任务已被其他路径结束时返回 false
+// 失败状态、退款流水和 refunded 标记在同一事务中写入，退款失败时整体回滚，不会留下已失败但未退款的任务
+func (s *BillingService) claimTaskFailure(task *model.Task, updates map[string]any) (bool, error) {
+	refund := task.Cost > 0 && !task.Refunded
+	if refund {
+		updates["refunded"] = true
+	}
+
+	claimed := false
+	err := model.DB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		if claimed, err = claimTaskStatus(tx, task, updates); err != nil || !claimed || !refund {
+			return err
+		}
+		if err := s.refund(tx, task.TokenID, task.UserID, task.Cost, TaskRef(task)); err != nil {
+			return fmt.Errorf("refund task %s: %w", task.TaskNo, err)
+		}
+		return nil
+	})
+	if err != nil || !claimed {
+		return false, err
+	}
+	if refund {
+		task.Refunded = true
+	}
+	NewRateLimitService().ReleaseTask(context.Background(), task.TokenID, task.TaskNo)
+	return true, nil
+}
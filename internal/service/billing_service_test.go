@@ -0,0 +1,374 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/money"
+)
+
+// newWallet 创建带余额的用户和预算为 budget 的令牌，budget 为 0 时不限制预算
+func newWallet(t *testing.T, balance, budget money.Money) (model.User, model.Token) {
+	t.Helper()
+	var count int64
+	model.DB().Model(&model.User{}).Count(&count)
+	user := model.User{Username: fmt.Sprintf("user-%d", count+1), Balance: balance}
+	if err := model.DB().Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if balance != 0 {
+		// 与线上一致，初始余额有对应的期初流水
+		entry := newBillingEntry(model.BillingTypeAdjustment, user.ID, 0, BillingRef{Remark: "opening balance"})
+		entry.UserAmount = balance
+		entry.UserBalanceAfter = balance
+		model.DB().Create(entry)
+	}
+	token := model.Token{UserID: user.ID, KeyHash: fmt.Sprintf("hash-%d", user.ID), BudgetEnabled: budget != 0, BudgetLimit: budget, Status: 1}
+	if err := model.DB().Create(&token).Error; err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	return user, token
+}
+
+func TestCreateChargedTask(t *testing.T) {
+	tests := []struct {
+		name        string
+		balance     money.Money
+		budget      money.Money
+		cost        money.Money
+		wantErr     error
+		wantBalance money.Money
+		wantEntries int64
+	}{
+		{name: "charged", balance: 10 * money.Unit, cost: 3 * money.Unit, wantBalance: 7 * money.Unit, wantEntries: 1},
+		{name: "free", balance: 10 * money.Unit, wantBalance: 10 * money.Unit},
+		{name: "insufficient wallet", balance: money.Unit, cost: 3 * money.Unit, wantErr: ErrInsufficientUserBalance, wantBalance: money.Unit},
+		{name: "budget exceeded", balance: 10 * money.Unit, budget: 2 * money.Unit, cost: 3 * money.Unit, wantErr: ErrTokenBudgetExceeded, wantBalance: 10 * money.Unit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user, token := newWallet(t, tt.balance, tt.budget)
+
+			task := &model.Task{TaskNo: "T1", UserID: user.ID, TokenID: token.ID, Cost: tt.cost}
+			err := NewBillingService().CreateChargedTask(task)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				// 扣费失败时任务和流水一起回滚
+				var tasks int64
+				model.DB().Model(&model.Task{}).Count(&tasks)
+				if tasks != 0 {
+					t.Errorf("tasks = %d, want 0 after failed charge", tasks)
+				}
+			} else if err != nil {
+				t.Fatalf("CreateChargedTask: %v", err)
+			}
+
+			var entries []model.BillingTransaction
+			model.DB().Where("type = ?", model.BillingTypeDeduct).Find(&entries)
+			if int64(len(entries)) != tt.wantEntries {
+				t.Fatalf("deduct entries = %d, want %d", len(entries), tt.wantEntries)
+			}
+			for _, e := range entries {
+				if e.TaskID == 0 || e.TaskID != task.ID || e.TaskNo != "T1" {
+					t.Errorf("entry task = %d/%s, want %d/T1", e.TaskID, e.TaskNo, task.ID)
+				}
+				if e.UserAmount != -tt.cost || e.TokenAmount != -tt.cost {
+					t.Errorf("entry amounts = %s/%s, want -%s", e.UserAmount, e.TokenAmount, tt.cost)
+				}
+				if e.UserBalanceAfter != tt.wantBalance || e.TokenUsedAfter != tt.cost {
+					t.Errorf("entry after = %s/%s", e.UserBalanceAfter, e.TokenUsedAfter)
+				}
+			}
+
+			var got model.User
+			model.DB().First(&got, user.ID)
+			if got.Balance != tt.wantBalance {
+				t.Errorf("balance = %s, want %s", got.Balance, tt.wantBalance)
+			}
+			mismatches, err := NewBillingService().Reconcile()
+			if err != nil || len(mismatches) != 0 {
+				t.Errorf("Reconcile = %v, %v", mismatches, err)
+			}
+		})
+	}
+}
+
+func TestRefundTaskLedger(t *testing.T) {
+	setupTestDB(t)
+	user, token := newWallet(t, 10*money.Unit, 0)
+	s := NewBillingService()
+
+	task := &model.Task{TaskNo: "T1", UserID: user.ID, TokenID: token.ID, Status: model.TaskStatusProcessing, Cost: 4 * money.Unit}
+	if err := s.CreateChargedTask(task); err != nil {
+		t.Fatalf("CreateChargedTask: %v", err)
+	}
+	for i, want := range []bool{true, false} {
+		claimed, err := s.claimTaskFailure(task, map[string]any{"status": model.TaskStatusFailed})
+		if err != nil || claimed != want {
+			t.Fatalf("claimTaskFailure #%d = %v, %v, want %v", i, claimed, err, want)
+		}
+	}
+	var stored model.Task
+	model.DB().First(&stored, task.ID)
+	if stored.Status != model.TaskStatusFailed || !stored.Refunded {
+		t.Errorf("task = %s refunded=%v, want failed and refunded", stored.Status, stored.Refunded)
+	}
+
+	var entries []model.BillingTransaction
+	model.DB().Where("task_id = ?", task.ID).Order("id").Find(&entries)
+	if len(entries) != 2 || entries[0].Type != model.BillingTypeDeduct || entries[1].Type != model.BillingTypeRefund {
+		t.Fatalf("task entries = %+v, want deduct and one refund", entries)
+	}
+	if entries[1].UserAmount != 4*money.Unit || entries[1].UserBalanceAfter != 10*money.Unit || entries[1].TokenUsedAfter != 0 {
+		t.Errorf("refund entry = %+v", entries[1])
+	}
+	if mismatches, err := s.Reconcile(); err != nil || len(mismatches) != 0 {
+		t.Errorf("Reconcile = %v, %v", mismatches, err)
+	}
+}
+
+func TestClaimTaskFailureRollsBack(t *testing.T) {
+	setupTestDB(t)
+	user, token := newWallet(t, 10*money.Unit, 0)
+	s := NewBillingService()
+
+	task := &model.Task{TaskNo: "T1", UserID: user.ID, TokenID: token.ID, Status: model.TaskStatusProcessing, Cost: 4 * money.Unit}
+	if err := s.CreateChargedTask(task); err != nil {
+		t.Fatalf("CreateChargedTask: %v", err)
+	}
+	// 用户已删除，退款失败
+	model.DB().Delete(&model.User{}, user.ID)
+
+	claimed, err := s.claimTaskFailure(task, map[string]any{"status": model.TaskStatusFailed})
+	if claimed || !errors.Is(err, ErrBillingTargetNotFound) {
+		t.Fatalf("claimTaskFailure = %v, %v, want ErrBillingTargetNotFound", claimed, err)
+	}
+	var stored model.Task
+	model.DB().First(&stored, task.ID)
+	if stored.Status != model.TaskStatusProcessing || stored.Refunded || task.Refunded {
+		t.Errorf("task = %s refunded=%v, want processing and not refunded", stored.Status, stored.Refunded)
+	}
+	var refunds int64
+	model.DB().Model(&model.BillingTransaction{}).Where("type = ?", model.BillingTypeRefund).Count(&refunds)
+	if refunds != 0 {
+		t.Errorf("refund entries = %d, want 0", refunds)
+	}
+}
+
+func TestDeductAndRefund(t *testing.T) {
+	tests := []struct {
+		name         string
+		balance      money.Money
+		budget       money.Money
+		budgetOn     bool
+		used         money.Money // 之前的消费
+		amount       money.Money
+		deleteToken  bool
+		refund       bool
+		wantErr      error
+		wantBalance  money.Money
+		wantUsed     money.Money
+		wantTokenAmt money.Money
+	}{
+		{name: "unlimited budget", balance: 10 * money.Unit, amount: 4 * money.Unit, wantBalance: 6 * money.Unit, wantUsed: 4 * money.Unit, wantTokenAmt: -4 * money.Unit},
+		{name: "within budget", balance: 10 * money.Unit, budget: 5 * money.Unit, budgetOn: true, used: money.Unit, amount: 4 * money.Unit, wantBalance: 5 * money.Unit, wantUsed: 5 * money.Unit, wantTokenAmt: -4 * money.Unit},
+		{name: "budget exhausted", balance: 10 * money.Unit, budget: 5 * money.Unit, budgetOn: true, used: 2 * money.Unit, amount: 4 * money.Unit, wantErr: ErrTokenBudgetExceeded, wantBalance: 8 * money.Unit, wantUsed: 2 * money.Unit},
+		{name: "zero budget", balance: 10 * money.Unit, budgetOn: true, amount: money.Unit / 100, wantErr: ErrTokenBudgetExceeded, wantBalance: 10 * money.Unit},
+		{name: "insufficient wallet", balance: 3 * money.Unit, amount: 4 * money.Unit, wantErr: ErrInsufficientUserBalance, wantBalance: 3 * money.Unit},
+		{name: "deleted token", balance: 10 * money.Unit, amount: money.Unit, deleteToken: true, wantErr: ErrBillingTargetNotFound, wantBalance: 10 * money.Unit},
+		{name: "refund", balance: 10 * money.Unit, used: 5 * money.Unit, amount: 2 * money.Unit, refund: true, wantBalance: 7 * money.Unit, wantUsed: 3 * money.Unit, wantTokenAmt: 2 * money.Unit},
+		{name: "refund on deleted token", balance: 10 * money.Unit, used: 5 * money.Unit, amount: 2 * money.Unit, refund: true, deleteToken: true, wantBalance: 7 * money.Unit, wantUsed: 5 * money.Unit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user, token := newWallet(t, tt.balance, 0)
+			s := NewBillingService()
+			if err := s.Deduct(token.ID, user.ID, tt.used, BillingRef{Remark: "earlier"}); err != nil {
+				t.Fatalf("earlier deduct: %v", err)
+			}
+			model.DB().Model(&token).Updates(map[string]any{"budget_enabled": tt.budgetOn, "budget_limit": tt.budget})
+			if tt.deleteToken {
+				model.DB().Delete(&token)
+			}
+
+			var err error
+			if tt.refund {
+				err = s.Refund(token.ID, user.ID, tt.amount, BillingRef{Remark: "test"})
+			} else {
+				err = s.Deduct(token.ID, user.ID, tt.amount, BillingRef{Remark: "test"})
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			var u model.User
+			model.DB().First(&u, user.ID)
+			var tk model.Token
+			model.DB().Unscoped().First(&tk, token.ID)
+			if u.Balance != tt.wantBalance || tk.TotalUsed != tt.wantUsed {
+				t.Errorf("balance = %s used = %s, want %s / %s", u.Balance, tk.TotalUsed, tt.wantBalance, tt.wantUsed)
+			}
+
+			var entries []model.BillingTransaction
+			model.DB().Where("remark = ?", "test").Find(&entries)
+			if tt.wantErr != nil {
+				if len(entries) != 0 {
+					t.Errorf("entries = %d, want none after failure", len(entries))
+				}
+			} else if len(entries) != 1 || entries[0].TokenAmount != tt.wantTokenAmt || entries[0].UserBalanceAfter != tt.wantBalance {
+				t.Errorf("entries = %+v, want token amount %s", entries, tt.wantTokenAmt)
+			}
+			if mismatches, err := s.Reconcile(); err != nil || len(mismatches) != 0 {
+				t.Errorf("Reconcile = %v, %v", mismatches, err)
+			}
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(user model.User, token model.Token)
+		want   []BillingMismatch
+	}{
+		{name: "consistent", tamper: func(model.User, model.Token) {}},
+		{
+			name: "user balance changed outside ledger",
+			tamper: func(user model.User, _ model.Token) {
+				model.DB().Model(&user).UpdateColumn("balance", 9*money.Unit)
+			},
+			want: []BillingMismatch{{Kind: "user", Balance: 9 * money.Unit, LedgerBalance: 8 * money.Unit}},
+		},
+		{
+			name: "token usage changed outside ledger",
+			tamper: func(_ model.User, token model.Token) {
+				model.DB().Model(&token).UpdateColumn("total_used", money.Unit)
+			},
+			want: []BillingMismatch{{Kind: "token", Balance: money.Unit, LedgerBalance: 2 * money.Unit}},
+		},
+		{
+			name: "deleted token skipped",
+			tamper: func(_ model.User, token model.Token) {
+				model.DB().Model(&token).UpdateColumn("total_used", money.Unit)
+				model.DB().Delete(&token)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user, token := newWallet(t, 10*money.Unit, 0)
+			if err := NewBillingService().Deduct(token.ID, user.ID, 2*money.Unit, BillingRef{}); err != nil {
+				t.Fatalf("Deduct: %v", err)
+			}
+			tt.tamper(user, token)
+
+			got, err := NewBillingService().Reconcile()
+			if err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("mismatches = %+v, want %+v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				if got[i].Kind != want.Kind || got[i].Balance != want.Balance || got[i].LedgerBalance != want.LedgerBalance {
+					t.Errorf("mismatch = %+v, want %+v", got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenLedgerTokenUsage(t *testing.T) {
+	setupTestDB(t)
+	user := model.User{Username: "legacy", Balance: 5 * money.Unit}
+	model.DB().Create(&user)
+	token := model.Token{UserID: user.ID, KeyHash: "legacy", TotalUsed: 3 * money.Unit, Status: 1}
+	model.DB().Create(&token)
+
+	s := NewBillingService()
+	if mismatches, _ := s.Reconcile(); len(mismatches) != 2 {
+		t.Fatalf("mismatches before opening = %+v, want user and token", mismatches)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.OpenLedger(); err != nil {
+			t.Fatalf("OpenLedger: %v", err)
+		}
+	}
+	var count int64
+	model.DB().Model(&model.BillingTransaction{}).Count(&count)
+	if count != 2 {
+		t.Errorf("opening entries = %d, want 2", count)
+	}
+	if mismatches, err := s.Reconcile(); err != nil || len(mismatches) != 0 {
+		t.Errorf("Reconcile = %v, %v", mismatches, err)
+	}
+}
+
+func TestMigrateWallet(t *testing.T) {
+	setupTestDB(t)
+	// 升级前的令牌余额列；SQLite 删除列时按带引号的列名重建表
+	if err := model.DB().Exec("ALTER TABLE tokens ADD COLUMN `balance` decimal(20,6) DEFAULT 0").Error; err != nil {
+		t.Fatalf("add legacy balance column: %v", err)
+	}
+	user := model.User{Username: "legacy", Balance: 100 * money.Unit}
+	model.DB().Create(&user)
+
+	tests := []struct {
+		name       string
+		balance    money.Money // 迁移前令牌余额
+		used       money.Money
+		enabled    bool
+		budget     money.Money
+		wantBudget money.Money
+		wantCharge bool // 迁移后能否再扣 1 元
+	}{
+		{name: "positive balance", balance: 5 * money.Unit, used: 2 * money.Unit, wantBudget: 7 * money.Unit, wantCharge: true},
+		{name: "zero balance", used: 2 * money.Unit, wantBudget: 2 * money.Unit},
+		{name: "zero balance never used", wantBudget: 0},
+		{name: "negative balance", balance: -3 * money.Unit, used: 4 * money.Unit, wantBudget: 4 * money.Unit},
+		{name: "budget already set", balance: 5 * money.Unit, used: 2 * money.Unit, enabled: true, budget: 20 * money.Unit, wantBudget: 20 * money.Unit, wantCharge: true},
+		{name: "budget set before flag", used: 2 * money.Unit, budget: 20 * money.Unit, wantBudget: 20 * money.Unit, wantCharge: true},
+	}
+	tokens := make([]model.Token, len(tests))
+	for i, tt := range tests {
+		tokens[i] = model.Token{UserID: user.ID, KeyHash: fmt.Sprintf("legacy-%d", i), TotalUsed: tt.used, BudgetEnabled: tt.enabled, BudgetLimit: tt.budget, Status: 1}
+		model.DB().Create(&tokens[i])
+		model.DB().Exec("UPDATE tokens SET balance = ? WHERE id = ?", tt.balance, tokens[i].ID)
+	}
+
+	s := NewBillingService()
+	if err := s.MigrateWallet(); err != nil {
+		t.Fatalf("MigrateWallet: %v", err)
+	}
+	if model.DB().Migrator().HasColumn(&model.Token{}, "balance") {
+		t.Fatal("token balance column should be dropped")
+	}
+	// 再次执行不修改数据
+	if err := s.MigrateWallet(); err != nil {
+		t.Fatalf("MigrateWallet again: %v", err)
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tk model.Token
+			model.DB().First(&tk, tokens[i].ID)
+			if !tk.BudgetEnabled || tk.BudgetLimit != tt.wantBudget {
+				t.Errorf("budget = %v/%s, want enabled/%s", tk.BudgetEnabled, tk.BudgetLimit, tt.wantBudget)
+			}
+			err := s.Deduct(tk.ID, user.ID, money.Unit, BillingRef{})
+			if tt.wantCharge && err != nil {
+				t.Errorf("Deduct err = %v, want charged", err)
+			}
+			if !tt.wantCharge && !errors.Is(err, ErrTokenBudgetExceeded) {
+				t.Errorf("Deduct err = %v, want ErrTokenBudgetExceeded", err)
+			}
+		})
+	}
+}
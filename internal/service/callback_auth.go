@@ -0,0 +1,224 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/config"
+)
+
+// 供应商回调验证方式
+const (
+	CallbackAuthNone      = "none"       // 不验证（需显式配置）
+	CallbackAuthHeader    = "header"     // 请求头携带共享密钥
+	CallbackAuthHMAC      = "hmac"       // 请求体 HMAC-SHA256 签名
+	CallbackAuthIP        = "ip"         // 仅校验来源 IP
+	CallbackAuthTaskToken = "task_token" // 回调地址中携带每个任务的随机令牌
+)
+
+// DefaultCallbackTokenParam 任务令牌默认的 query 参数名
+const DefaultCallbackTokenParam = "token"
+
+var ErrCallbackUnauthorized = errors.New("callback unauthorized")
+
+// ChannelConfig 渠道配置 (Channel.Config)
+type ChannelConfig struct {
+	CallbackAuth *CallbackAuthConfig `json:"callback_auth"`
+	// CallbackParam 提交任务时写入回调地址的供应商参数名，如 notify_url
+	CallbackParam string `json:"callback_param"`
+	// LegacyCallback 允许不带任务编号的旧回调地址，按供应商任务ID在渠道内查找任务
+	// Deprecated: 仅为尚未切换到按任务路由地址的渠道保留，默认关闭
+	LegacyCallback bool `json:"legacy_callback"`
+}
+
+// CallbackAuthConfig 供应商回调验证配置
+type CallbackAuthConfig struct {
+	Type       string   `json:"type"`        // none / header / hmac / ip / task_token
+	Header     string   `json:"header"`      // header: 密钥所在请求头; hmac: 签名所在请求头
+	Secret     string   `json:"secret"`      // 共享密钥
+	Prefix     string   `json:"prefix"`      // hmac 签名前缀，如 sha256=
+	Encoding   string   `json:"encoding"`    // hmac 签名编码 hex(默认) / base64
+	AllowIPs   []string `json:"allow_ips"`   // 来源 IP 白名单，支持 CIDR，任意验证方式下均生效
+	TokenParam string   `json:"token_param"` // 任务令牌的 query 参数名，默认 token
+}
+
+// CallbackRequest 供应商回调请求
+type CallbackRequest struct {
+	ChannelType string
+	TaskNo      string // 按任务路由的回调地址中的任务编号
+	Method      string
+	URL         string
+	ClientIP    string
+	Headers     http.Header
+	Query       url.Values
+	Body        []byte
+}
+
+// ParseChannelConfig 解析渠道配置
+func ParseChannelConfig(raw json.RawMessage) ChannelConfig {
+	var cfg ChannelConfig
+	if len(raw) > 0 {
+		json.Unmarshal(raw, &cfg)
+	}
+	return cfg
+}
+
+// GenerateCallbackToken 生成任务回调令牌
+func GenerateCallbackToken() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// VendorCallbackURL 生成交给供应商的回调地址，地址中包含任务编号和任务令牌
+func VendorCallbackURL(channel *model.Channel, task *model.Task) string {
+	return fmt.Sprintf("%s/internal/callback/%s/%s?%s",
+		strings.TrimRight(config.C.Server.PublicURL, "/"),
+		channel.Type,
+		task.TaskNo,
+		url.Values{callbackTokenParam(channel): {task.CallbackToken}}.Encode())
+}
+
+// InjectVendorCallback 回调模式下将回调地址写入供应商参数 (Channel.Config.callback_param)
+func InjectVendorCallback(channel *model.Channel, cc *model.ChannelCapability, task *model.Task, params map[string]any) {
+	if cc.ResultMode != model.ResultModeCallback || params == nil {
+		return
+	}
+	if param := ParseChannelConfig(channel.Config).CallbackParam; param != "" {
+		params[param] = VendorCallbackURL(channel, task)
+	}
+}
+
+// callbackTokenParam 任务令牌的 query 参数名
+func callbackTokenParam(channel *model.Channel) string {
+	auth := ParseChannelConfig(channel.Config).CallbackAuth
+	if auth != nil && auth.TokenParam != "" {
+		return auth.TokenParam
+	}
+	return DefaultCallbackTokenParam
+}
+
+// verifyCallbackRequest 校验回调来源（不依赖任务的验证方式）
+// 按任务路由的回调总会校验任务令牌，渠道未配置 callback_auth 时不做额外校验
+func verifyCallbackRequest(channel *model.Channel, req *CallbackRequest) error {
+	auth := ParseChannelConfig(channel.Config).CallbackAuth
+	if auth == nil || auth.Type == "" {
+		if req.TaskNo != "" {
+			return nil
+		}
+		return fmt.Errorf("%w: callback auth not configured for channel %s", ErrCallbackUnauthorized, channel.Type)
+	}
+
+	if len(auth.AllowIPs) > 0 && !ipAllowed(req.ClientIP, auth.AllowIPs) {
+		return fmt.Errorf("%w: ip %s not allowed", ErrCallbackUnauthorized, req.ClientIP)
+	}
+
+	switch auth.Type {
+	case CallbackAuthNone, CallbackAuthTaskToken:
+		return nil
+	case CallbackAuthIP:
+		if len(auth.AllowIPs) == 0 {
+			return fmt.Errorf("%w: allow_ips is empty", ErrCallbackUnauthorized)
+		}
+		return nil
+	case CallbackAuthHeader:
+		if auth.Header == "" || auth.Secret == "" {
+			return fmt.Errorf("%w: header auth misconfigured", ErrCallbackUnauthorized)
+		}
+		if !hmac.Equal([]byte(req.Headers.Get(auth.Header)), []byte(auth.Secret)) {
+			return fmt.Errorf("%w: invalid secret header", ErrCallbackUnauthorized)
+		}
+		return nil
+	case CallbackAuthHMAC:
+		if auth.Header == "" || auth.Secret == "" {
+			return fmt.Errorf("%w: hmac auth misconfigured", ErrCallbackUnauthorized)
+		}
+		signature := strings.TrimPrefix(req.Headers.Get(auth.Header), auth.Prefix)
+		if !hmac.Equal([]byte(signature), []byte(signCallbackBody(auth, req.Body))) {
+			return fmt.Errorf("%w: invalid signature", ErrCallbackUnauthorized)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown auth type %s", ErrCallbackUnauthorized, auth.Type)
+	}
+}
+
+// verifyCallbackTask 校验回调中携带的任务令牌（按任务路由或 task_token 模式）
+func verifyCallbackTask(channel *model.Channel, task *model.Task, req *CallbackRequest) error {
+	auth := ParseChannelConfig(channel.Config).CallbackAuth
+	if req.TaskNo == "" && (auth == nil || auth.Type != CallbackAuthTaskToken) {
+		return nil
+	}
+
+	token := req.Query.Get(callbackTokenParam(channel))
+	if task.CallbackToken == "" || !hmac.Equal([]byte(token), []byte(task.CallbackToken)) {
+		return fmt.Errorf("%w: invalid task token", ErrCallbackUnauthorized)
+	}
+	return nil
+}
+
+// signCallbackBody 计算请求体签名
+func signCallbackBody(auth *CallbackAuthConfig, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(auth.Secret))
+	mac.Write(body)
+	sum := mac.Sum(nil)
+	if auth.Encoding == "base64" {
+		return base64.StdEncoding.EncodeToString(sum)
+	}
+	return hex.EncodeToString(sum)
+}
+
+// ipAllowed 判断 IP 是否在白名单中
+func ipAllowed(ip string, allowList []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, item := range allowList {
+		if strings.Contains(item, "/") {
+			if _, network, err := net.ParseCIDR(item); err == nil && network.Contains(parsed) {
+				return true
+			}
+			continue
+		}
+		if allowed := net.ParseIP(item); allowed != nil && allowed.Equal(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// logRejectedCallback 记录被拒绝的供应商回调
+func logRejectedCallback(channel *model.Channel, task *model.Task, req *CallbackRequest, reason error) {
+	headersJSON, _ := json.Marshal(req.Headers)
+	log := &model.ChannelRequestLog{
+		ChannelID:      channel.ID,
+		RequestType:    model.RequestTypeVendorCallback,
+		Method:         req.Method,
+		URL:            req.URL,
+		RequestHeaders: string(headersJSON),
+		RequestBody:    string(req.Body),
+		StatusCode:     http.StatusUnauthorized,
+		ErrorMessage:   fmt.Sprintf("%s (ip: %s)", reason.Error(), req.ClientIP),
+		RequestAt:      time.Now(),
+	}
+	if task != nil {
+		log.TaskID = task.ID
+		log.TaskNo = task.TaskNo
+		log.AccountID = task.AccountID
+		log.CapabilityCode = task.CapabilityCode
+	}
+	NewRequestLogService().Log(log)
+}
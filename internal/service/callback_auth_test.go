@@ -0,0 +1,100 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/majingzhen/prism/internal/model"
+)
+
+func TestVerifyCallbackRequest(t *testing.T) {
+	body := []byte(`{"task_id":"v-1","status":"success"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	hexSign := hex.EncodeToString(mac.Sum(nil))
+	b64Sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name    string
+		config  string
+		taskNo  string
+		ip      string
+		headers map[string]string
+		wantErr bool
+	}{
+		{name: "no auth legacy", config: `{}`, wantErr: true},
+		{name: "no auth routed", config: `{}`, taskNo: "T1"},
+		{name: "none", config: `{"callback_auth":{"type":"none"}}`},
+		{name: "task token", config: `{"callback_auth":{"type":"task_token"}}`},
+		{name: "header ok", config: `{"callback_auth":{"type":"header","header":"X-Secret","secret":"s3cret"}}`, headers: map[string]string{"X-Secret": "s3cret"}},
+		{name: "header wrong", config: `{"callback_auth":{"type":"header","header":"X-Secret","secret":"s3cret"}}`, headers: map[string]string{"X-Secret": "nope"}, wantErr: true},
+		{name: "header missing", config: `{"callback_auth":{"type":"header","header":"X-Secret","secret":"s3cret"}}`, wantErr: true},
+		{name: "header misconfigured", config: `{"callback_auth":{"type":"header","header":"X-Secret"}}`, headers: map[string]string{"X-Secret": ""}, wantErr: true},
+		{name: "hmac hex", config: `{"callback_auth":{"type":"hmac","header":"X-Signature","secret":"s3cret","prefix":"sha256="}}`, headers: map[string]string{"X-Signature": "sha256=" + hexSign}},
+		{name: "hmac base64", config: `{"callback_auth":{"type":"hmac","header":"X-Signature","secret":"s3cret","encoding":"base64"}}`, headers: map[string]string{"X-Signature": b64Sign}},
+		{name: "hmac wrong encoding", config: `{"callback_auth":{"type":"hmac","header":"X-Signature","secret":"s3cret"}}`, headers: map[string]string{"X-Signature": b64Sign}, wantErr: true},
+		{name: "hmac tampered", config: `{"callback_auth":{"type":"hmac","header":"X-Signature","secret":"other"}}`, headers: map[string]string{"X-Signature": hexSign}, wantErr: true},
+		{name: "ip allowed cidr", config: `{"callback_auth":{"type":"ip","allow_ips":["203.0.113.0/24"]}}`, ip: "203.0.113.9"},
+		{name: "ip allowed exact", config: `{"callback_auth":{"type":"ip","allow_ips":["198.51.100.1"]}}`, ip: "198.51.100.1"},
+		{name: "ip denied", config: `{"callback_auth":{"type":"ip","allow_ips":["203.0.113.0/24"]}}`, ip: "198.51.100.1", wantErr: true},
+		{name: "ip empty list", config: `{"callback_auth":{"type":"ip"}}`, ip: "203.0.113.9", wantErr: true},
+		{name: "allow ips with header", config: `{"callback_auth":{"type":"header","header":"X-Secret","secret":"s3cret","allow_ips":["203.0.113.0/24"]}}`, ip: "198.51.100.1", headers: map[string]string{"X-Secret": "s3cret"}, wantErr: true},
+		{name: "unknown type", config: `{"callback_auth":{"type":"magic"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := &model.Channel{Type: "vendor", Config: []byte(tt.config)}
+			req := &CallbackRequest{TaskNo: tt.taskNo, ClientIP: tt.ip, Headers: http.Header{}, Body: body}
+			for k, v := range tt.headers {
+				req.Headers.Set(k, v)
+			}
+			err := verifyCallbackRequest(channel, req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrCallbackUnauthorized) {
+				t.Fatalf("err = %v, want ErrCallbackUnauthorized", err)
+			}
+		})
+	}
+}
+
+func TestVerifyCallbackTask(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		taskNo    string
+		taskToken string
+		query     url.Values
+		wantErr   bool
+	}{
+		{name: "routed ok", config: `{}`, taskNo: "T1", taskToken: "tok", query: url.Values{"token": {"tok"}}},
+		{name: "routed wrong token", config: `{}`, taskNo: "T1", taskToken: "tok", query: url.Values{"token": {"bad"}}, wantErr: true},
+		{name: "routed missing token", config: `{}`, taskNo: "T1", taskToken: "tok", wantErr: true},
+		{name: "routed task without token", config: `{}`, taskNo: "T1", query: url.Values{"token": {""}}, wantErr: true},
+		{name: "custom token param", config: `{"callback_auth":{"type":"hmac","token_param":"sig"}}`, taskNo: "T1", taskToken: "tok", query: url.Values{"sig": {"tok"}}},
+		{name: "legacy without task token", config: `{"callback_auth":{"type":"header"}}`},
+		{name: "legacy task token ok", config: `{"callback_auth":{"type":"task_token"}}`, taskToken: "tok", query: url.Values{"token": {"tok"}}},
+		{name: "legacy task token wrong", config: `{"callback_auth":{"type":"task_token"}}`, taskToken: "tok", query: url.Values{"token": {"bad"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := &model.Channel{Type: "vendor", Config: []byte(tt.config)}
+			task := &model.Task{TaskNo: "T1", CallbackToken: tt.taskToken}
+			req := &CallbackRequest{TaskNo: tt.taskNo, Query: tt.query}
+			err := verifyCallbackTask(channel, task, req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrCallbackUnauthorized) {
+				t.Fatalf("err = %v, want ErrCallbackUnauthorized", err)
+			}
+		})
+	}
+}
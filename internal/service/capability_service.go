@@ -4,12 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"path/filepath"
-	"strings"
+	"net/http"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/provider"
+	"github.com/majingzhen/prism/internal/provider/vendorauth"
 	"github.com/majingzhen/prism/pkg/httputil"
 	"github.com/majingzhen/prism/pkg/logger"
 	"github.com/majingzhen/prism/pkg/storage"
@@ -44,10 +44,23 @@ type InvokeRequest struct {
 type InvokeResponse struct {
 	TaskID string `json:"task_id"`
 	Status string `json:"status"`
+
+	// ConcurrencyLimit 进行中任务数的限流结果，用于写入响应头
+	ConcurrencyLimit *RateLimitResult `json:"-"`
 }
 
 // Invoke 调用能力接口
 func (s *CapabilityService) Invoke(ctx context.Context, req *InvokeRequest) (*InvokeResponse, error) {
+	// 检查令牌的能力范围
+	policyService := NewTokenPolicyService()
+	token, err := policyService.Load(req.TokenID)
+	if err != nil {
+		return nil, err
+	}
+	if err := policyService.CheckCapability(token, req.Capability); err != nil {
+		return nil, err
+	}
+
 	// 1. 查找渠道
 	var channel model.Channel
 	var cc model.ChannelCapability
@@ -78,50 +91,38 @@ func (s *CapabilityService) Invoke(ctx context.Context, req *InvokeRequest) (*In
 		}
 	}
 
-	// 3. 如果配置了单价，检查余额并扣费
-	logger.Info("capability price check",
-		zap.String("capability", req.Capability),
-		zap.Float64("price", cc.Price))
+	// 2. 将参数中引用的文件ID解析为访问地址
+	resolvedParams, err := NewFileService().ResolveParams(ctx, req.UserID, req.Params)
+	if err != nil {
+		return nil, err
+	}
 
-	billingService := NewBillingService()
-	charged := false
-	if cc.Price > 0 {
-		if err := billingService.Deduct(req.TokenID, req.UserID, cc.Price); err != nil {
-			return nil, fmt.Errorf("insufficient balance: %w", err)
-		}
-		charged = true
+	// 3. 按计价规则计算价格，消费上限在预扣时检查
+	breakdown, err := CalculatePrice(&cc, req.Params)
+	if err != nil {
+		return nil, err
 	}
+	price := breakdown.Total
+	logger.Info("capability price check",
+		zap.String("capability", req.Capability),
+		zap.Stringer("price", price))
 
 	// 4. 选择账号
 	var account model.ChannelAccount
-	err := model.DB().Where("channel_id = ? AND status = 1", channel.ID).
+	err = model.DB().Where("channel_id = ? AND status = 1", channel.ID).
 		Order("current_tasks ASC, weight DESC").
 		First(&account).Error
 	if err != nil {
-		// 扣费失败需要退回
-		if charged {
-			_ = billingService.Refund(req.TokenID, req.UserID, cc.Price)
-		}
 		return nil, fmt.Errorf("no available account")
 	}
 
-	// 增加账号任务数
-	model.DB().Model(&account).UpdateColumn("current_tasks", gorm.Expr("current_tasks + 1"))
-
 	// 5. 参数映射
-	mappedParams, err := s.paramMapper.Map(req.Params, cc.ParamMapping)
+	mappedParams, err := s.paramMapper.Map(resolvedParams, cc.ParamMapping)
 	if err != nil {
-		// 扣费失败需要退回
-		if charged {
-			_ = billingService.Refund(req.TokenID, req.UserID, cc.Price)
-		}
 		return nil, fmt.Errorf("param mapping failed: %w", err)
 	}
 
-	// 6. 创建任务
-	requestParamsJSON, _ := json.Marshal(req.Params)
-	mappedParamsJSON, _ := json.Marshal(mappedParams)
-
+	// 6. 创建任务并预扣费，扣费流水关联任务
 	task := &model.Task{
 		TaskNo:              GenerateTaskNo(),
 		UserID:              req.UserID,
@@ -132,30 +133,44 @@ func (s *CapabilityService) Invoke(ctx context.Context, req *InvokeRequest) (*In
 		AccountID:           account.ID,
 		Status:              model.TaskStatusPending,
 		CallbackURL:         req.CallbackURL,
-		RequestParams:       requestParamsJSON,
-		MappedParams:        mappedParamsJSON,
-		Cost:                cc.Price,
-	}
-	if err := model.DB().Create(task).Error; err != nil {
-		// 创建任务失败需要退回
-		if charged {
-			_ = billingService.Refund(req.TokenID, req.UserID, cc.Price)
-		}
-		return nil, fmt.Errorf("create task failed: %w", err)
+		CallbackToken:       GenerateCallbackToken(),
+		Cost:                price,
 	}
 
+	// 回调模式下将回调地址写入供应商参数
+	InjectVendorCallback(&channel, &cc, task, mappedParams)
+
+	task.RequestParams, _ = json.Marshal(req.Params)
+	task.MappedParams, _ = json.Marshal(mappedParams)
+	task.PriceDetail, _ = json.Marshal(breakdown)
+
+	// 占用进行中任务数的名额，任务结束时归还
+	rateLimitService := NewRateLimitService()
+	concurrency := rateLimitService.AcquireTask(ctx, req.TokenID, task.TaskNo, rateLimitService.Limits(token).Concurrency)
+	if !concurrency.Allowed {
+		return nil, &RateLimitError{Kind: RateLimitConcurrency, Result: concurrency}
+	}
+	if err := NewBillingService().CreateChargedTask(task); err != nil {
+		rateLimitService.ReleaseTask(ctx, req.TokenID, task.TaskNo)
+		return nil, err
+	}
+
+	// 增加账号任务数
+	model.DB().Model(&account).UpdateColumn("current_tasks", gorm.Expr("current_tasks + 1"))
+
 	logger.Info("capability task created",
 		zap.String("task_no", task.TaskNo),
 		zap.String("capability", req.Capability),
 		zap.String("channel", req.Channel),
-		zap.Float64("cost", cc.Price))
+		zap.Stringer("cost", price))
 
 	// 7. 异步执行任务
 	go s.executeTask(task, &channel, &cc, &account, mappedParams)
 
 	return &InvokeResponse{
-		TaskID: task.TaskNo,
-		Status: string(task.Status),
+		TaskID:           task.TaskNo,
+		Status:           string(task.Status),
+		ConcurrencyLimit: concurrency,
 	}, nil
 }
 
@@ -176,36 +191,46 @@ func (s *CapabilityService) executeTask(
 		"status":     model.TaskStatusProcessing,
 		"started_at": now,
 	})
+	webhookService.Emit(task, model.WebhookEventTaskStarted, nil)
 
-	// 构建请求URL
-	url := channel.BaseURL + cc.RequestPath
-
-	// 处理认证
-	headers := make(map[string]string)
-	authKey := cc.AuthKey
-	if authKey == "" {
-		authKey = "Authorization"
-	}
-	authValue := cc.AuthValuePrefix + account.APIKey
-
-	switch cc.AuthLocation {
-	case "header":
-		headers[authKey] = authValue
-	case "body":
-		params[authKey] = account.APIKey
-	case "query":
-		if strings.Contains(url, "?") {
-			url += "&" + authKey + "=" + account.APIKey
-		} else {
-			url += "?" + authKey + "=" + account.APIKey
+	// 执行提交前置步骤，输出合并到请求参数后重新映射
+	if len(cc.PreSubmitSteps) > 0 {
+		mapped, err := s.runPreSubmitSteps(ctx, task, channel, cc, account)
+		if err != nil {
+			s.failTask(task, err.Error())
+			return
 		}
-	default:
-		headers["Authorization"] = "Bearer " + account.APIKey
+		params = mapped
+	}
+
+	// 构建请求（请求模板可覆盖方法、地址、请求头和请求体）
+	req := &httputil.Request{
+		Method:      http.MethodPost,
+		URL:         channel.BaseURL + cc.RequestPath,
+		Headers:     make(map[string]string),
+		Params:      params,
+		ContentType: cc.ContentType,
+	}
+	if err := applyRequestTemplate(cc.SubmitTemplate, req, channel.BaseURL, templateVars(task, channel, cc, account, params)); err != nil {
+		s.failTask(task, err.Error())
+		return
+	}
+
+	// multipart 请求的文件字段读取为文件部分
+	fileParams, err := provider.ResolveFileFields(ctx, req.Params, provider.ParseFileFields(cc.ParamMapping), req.ContentType, NewFileService().Lookup(task.UserID))
+	if err != nil {
+		s.failTask(task, err.Error())
+		return
+	}
+	req.Params = fileParams
+	if err := s.applyAuth(ctx, channel, cc, account, req); err != nil {
+		s.failTask(task, err.Error())
+		return
 	}
 
 	// 发送请求（根据 ContentType 选择请求格式）
-	detail := httputil.PostWithDetail(ctx, url, params, headers, cc.ContentType)
-	s.logRequest(task, model.RequestTypeSubmit, detail)
+	detail := httputil.Do(ctx, req)
+	logTaskRequest(task, model.RequestTypeSubmit, detail)
 	if detail.Error != nil {
 		s.failTask(task, detail.Error.Error())
 		return
@@ -230,6 +255,40 @@ func (s *CapabilityService) executeTask(
 	}
 }
 
+// runPreSubmitSteps 执行提交前置步骤并重新映射参数
+func (s *CapabilityService) runPreSubmitSteps(
+	ctx context.Context,
+	task *model.Task,
+	channel *model.Channel,
+	cc *model.ChannelCapability,
+	account *model.ChannelAccount,
+) (map[string]any, error) {
+	var requestParams map[string]any
+	json.Unmarshal(task.RequestParams, &requestParams)
+	requestParams, err := NewFileService().ResolveParams(ctx, task.UserID, requestParams)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := RunPreSubmitSteps(ctx, task, channel, cc, account, requestParams)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range outputs {
+		requestParams[k] = v
+	}
+
+	mappedParams, err := s.paramMapper.Map(requestParams, cc.ParamMapping)
+	if err != nil {
+		return nil, fmt.Errorf("param mapping failed: %w", err)
+	}
+	InjectVendorCallback(channel, cc, task, mappedParams)
+
+	task.MappedParams, _ = json.Marshal(mappedParams)
+	model.DB().Model(task).Update("mapped_params", task.MappedParams)
+	return mappedParams, nil
+}
+
 // handleSyncResult 处理同步结果
 func (s *CapabilityService) handleSyncResult(task *model.Task, cc *model.ChannelCapability, resp map[string]any) {
 	// 先检查成功条件（基于原始响应）
@@ -283,6 +342,7 @@ func (s *CapabilityService) handlePollResult(
 	// 从提交响应中获取供应商任务ID
 	submitResult, _ := s.responseMapper.Map(submitResp, cc.ResponseMapping)
 	vendorTaskID := extractString(submitResult["task_id"])
+	task.VendorTaskID = vendorTaskID
 	model.DB().Model(task).Update("vendor_task_id", vendorTaskID)
 
 	logger.Info("start polling",
@@ -302,51 +362,58 @@ func (s *CapabilityService) handlePollResult(
 	}
 
 	// 构建轮询URL（支持路径中的变量替换）
-	pollPath := cc.PollPath
-	pollPath = strings.ReplaceAll(pollPath, "{task_id}", vendorTaskID)
-	pollURL := channel.BaseURL + pollPath
-
-	// 构建认证头
-	authHeaders := s.buildAuthHeaders(cc, account)
+	vars := templateVars(task, channel, cc, account, nil)
+	pollURL := channel.BaseURL + vars.Render(cc.PollPath)
+	pollTemplate, err := provider.ParseRequestTemplate(cc.PollTemplate)
+	if err != nil {
+		s.failTask(task, err.Error())
+		return
+	}
 
-	for i := 0; i < cc.PollMaxAttempts; i++ {
-		time.Sleep(time.Duration(cc.PollInterval) * time.Second)
+	// 按轮询计划等待，优先遵循供应商返回的 Retry-After 和预计剩余时间
+	schedule := NewPollSchedule(cc)
+	startedAt := time.Now()
+	delay := schedule.Delay(0)
 
-		var resp []byte
-		var pollErr error
+	for attempt := 0; !schedule.Exhausted(attempt, startedAt); attempt++ {
+		time.Sleep(schedule.Clamp(delay, startedAt))
 
+		req := &httputil.Request{
+			Method:      pollMethod,
+			URL:         pollURL,
+			Headers:     make(map[string]string),
+			ContentType: cc.ContentType,
+		}
 		if pollMethod == "POST" {
 			// 构建轮询参数
-			pollParams := map[string]any{"task_id": vendorTaskID}
+			req.Params = map[string]any{"task_id": vendorTaskID}
 			if len(cc.PollParamMapping) > 0 {
-				pollParams, _ = s.paramMapper.Map(pollParams, cc.PollParamMapping)
-			}
-			// 轮询认证如果是 body，需要加入参数
-			if cc.AuthLocation == "body" {
-				authKey := cc.AuthKey
-				if authKey == "" {
-					authKey = "Authorization"
-				}
-				pollParams[authKey] = account.APIKey
+				req.Params, _ = s.paramMapper.Map(req.Params, cc.PollParamMapping)
 			}
-			detail := httputil.PostWithDetail(ctx, pollURL, pollParams, authHeaders, cc.ContentType)
-			s.logRequest(task, model.RequestTypePoll, detail)
-			resp = detail.ResponseBody
-			pollErr = detail.Error
-		} else {
-			detail := httputil.GetJSONWithDetail(ctx, pollURL, authHeaders)
-			s.logRequest(task, model.RequestTypePoll, detail)
-			resp = detail.ResponseBody
-			pollErr = detail.Error
+		}
+		if err := pollTemplate.Apply(req, channel.BaseURL, vars); err != nil {
+			s.failTask(task, err.Error())
+			return
+		}
+		// 认证失败（如令牌服务暂时不可用）时按计划继续轮询
+		if err := s.applyAuth(ctx, channel, cc, account, req); err != nil {
+			logger.Error("poll auth error", zap.String("task_no", task.TaskNo), zap.Error(err))
+			delay = schedule.NextDelay(attempt+1, 0, 0)
+			continue
 		}
 
-		if pollErr != nil {
-			logger.Error("poll error", zap.Error(pollErr))
+		detail := httputil.Do(ctx, req)
+		logTaskRequest(task, model.RequestTypePoll, detail)
+		retryAfter := httputil.ParseRetryAfter(detail.ResponseHeaders)
+
+		if detail.Error != nil {
+			logger.Error("poll error", zap.Error(detail.Error))
+			delay = schedule.NextDelay(attempt+1, retryAfter, 0)
 			continue
 		}
 
 		var respMap map[string]any
-		json.Unmarshal(resp, &respMap)
+		json.Unmarshal(detail.ResponseBody, &respMap)
 
 		// 先检查成功条件（基于原始响应）
 		isSuccess, isFailed := s.responseMapper.CheckSuccess(respMap, pollRespMapping)
@@ -354,8 +421,9 @@ func (s *CapabilityService) handlePollResult(
 		result, _ := s.responseMapper.Map(respMap, pollRespMapping)
 
 		// 更新进度
-		if progress, ok := result["progress"].(float64); ok {
+		if progress, ok := result["progress"].(float64); ok && int(progress) != task.Progress {
 			model.DB().Model(task).Update("progress", int(progress))
+			webhookService.Emit(task, model.WebhookEventTaskProgress, map[string]any{"progress": int(progress)})
 		}
 
 		// 如果配置了成功条件，优先使用
@@ -382,22 +450,43 @@ func (s *CapabilityService) handlePollResult(
 			s.failTask(task, errMsg)
 			return
 		}
+
+		delay = schedule.NextDelay(attempt+1, retryAfter, ETAFromResult(result))
 	}
 
 	s.failTask(task, "poll timeout")
 }
 
-// buildAuthHeaders 构建认证头
-func (s *CapabilityService) buildAuthHeaders(cc *model.ChannelCapability, account *model.ChannelAccount) map[string]string {
-	if cc.AuthLocation != "header" {
-		return nil
+// applyAuth 按渠道的认证策略加入认证信息，渠道未配置时使用渠道能力的 APIKey 认证
+func (s *CapabilityService) applyAuth(
+	ctx context.Context,
+	channel *model.Channel,
+	cc *model.ChannelCapability,
+	account *model.ChannelAccount,
+	req *httputil.Request,
+) error {
+	auth, err := vendorauth.Resolve(channel, account, provider.StaticAuthConfig(cc))
+	if err != nil {
+		return fmt.Errorf("vendor auth: %w", err)
 	}
-	authKey := cc.AuthKey
-	if authKey == "" {
-		authKey = "Authorization"
+	return auth.Apply(ctx, req)
+}
+
+// templateVars 构建请求模板变量
+func templateVars(task *model.Task, channel *model.Channel, cc *model.ChannelCapability, account *model.ChannelAccount, params map[string]any) provider.TemplateVars {
+	vars := provider.NewTemplateVars(task, cc, account)
+	vars["callback_url"] = VendorCallbackURL(channel, task)
+	vars.SetParams(params)
+	return vars
+}
+
+// applyRequestTemplate 解析并应用请求模板，未配置模板时不做修改
+func applyRequestTemplate(data []byte, req *httputil.Request, baseURL string, vars provider.TemplateVars) error {
+	tpl, err := provider.ParseRequestTemplate(data)
+	if err != nil {
+		return err
 	}
-	authValue := cc.AuthValuePrefix + account.APIKey
-	return map[string]string{authKey: authValue}
+	return tpl.Apply(req, baseURL, vars)
 }
 
 // handleCallbackResult 处理回调结果（提交后等待回调）
@@ -408,47 +497,72 @@ func (s *CapabilityService) handleCallbackResult(task *model.Task, cc *model.Cha
 	// 等待回调，状态保持 processing
 }
 
+// activeTaskStatuses 未结束的任务状态，只有处于这些状态的任务才能进入终态
+var activeTaskStatuses = []model.TaskStatus{model.TaskStatusPending, model.TaskStatusProcessing}
+
+// claimTaskFinish 以条件更新把任务推进到终态，任务已被其他路径结束时返回 false
+// 回调、轮询和超时可能同时结束同一任务，只有占用成功的一方执行结算、退款和通知，并归还并发名额
+func claimTaskFinish(task *model.Task, updates map[string]any) (bool, error) {
+	claimed, err := claimTaskStatus(model.DB(), task, updates)
+	if claimed {
+		NewRateLimitService().ReleaseTask(context.Background(), task.TokenID, task.TaskNo)
+	}
+	return claimed, err
+}
+
+// claimTaskStatus 仅在任务仍处于进行中时更新为终态
+func claimTaskStatus(tx *gorm.DB, task *model.Task, updates map[string]any) (bool, error) {
+	result := tx.Model(&model.Task{}).
+		Where("id = ? AND status IN ?", task.ID, activeTaskStatuses).
+		Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	return true, nil
+}
+
 // completeTask 完成任务（包含文件转存）
 func (s *CapabilityService) completeTask(task *model.Task, cc *model.ChannelCapability, result map[string]any) {
 	ctx := context.Background()
 
-	// 尝试转存文件到COS
-	if storage.DefaultStorage != nil {
-		// 获取结果URL（统一使用 url 字段）
-		originURL, _ := result["url"].(string)
-
-		if originURL != "" {
-			// 下载原始文件
-			downloadResult, err := httputil.Download(ctx, originURL)
-			if err != nil {
-				logger.Error("download file for transfer failed", zap.String("task_no", task.TaskNo), zap.Error(err))
-			} else {
-				defer downloadResult.Body.Close()
-
-				// 生成存储路径
-				storagePath := s.generateStoragePath(task.CapabilityCode, originURL)
-
-				// 上传到COS
-				finalURL, err := storage.Upload(ctx, downloadResult.Body, storagePath, downloadResult.ContentType)
-				if err != nil {
-					logger.Error("upload to storage failed", zap.String("task_no", task.TaskNo), zap.Error(err))
-				} else {
-					result["url"] = finalURL
-					logger.Info("file transferred to storage", zap.String("task_no", task.TaskNo), zap.String("url", finalURL))
-				}
-			}
-		}
-	}
+	// 转存结果中的全部资源到存储
+	assetService := NewAssetService()
+	assetService.TransferResult(ctx, task.CapabilityCode, result)
 
 	resultJSON, _ := json.Marshal(result)
 	now := time.Now()
-	model.DB().Model(task).Updates(map[string]any{
+	updates := map[string]any{
 		"status":       model.TaskStatusSuccess,
 		"progress":     100,
 		"result":       resultJSON,
-		"cost":         cc.Price,
 		"completed_at": now,
-	})
+	}
+	for k, v := range assetService.RetentionUpdates(task.CapabilityCode, task.UserID, result) {
+		updates[k] = v
+	}
+	claimed, err := claimTaskFinish(task, updates)
+	if err != nil {
+		logger.Error("complete task failed", zap.String("task_no", task.TaskNo), zap.Error(err))
+		return
+	}
+	if !claimed {
+		// 任务已被其他路径结束，删除本次转存的资源
+		logger.Warn("task already finished, skip completion", zap.String("task_no", task.TaskNo))
+		for _, key := range collectResultKeys(result) {
+			storage.Delete(ctx, key)
+		}
+		return
+	}
+	task.Status = model.TaskStatusSuccess
+	task.Result = resultJSON
+	task.CompletedAt = &now
+
+	webhookService.EmitAssets(task, result)
+
+	// 按实际用量结算预扣的费用
+	if usage, ok := result["usage"]; ok && usage != nil {
+		NewBillingService().SettleTaskUsage(task, cc, paramString(usage))
+	}
 
 	logger.Info("capability task completed", zap.String("task_no", task.TaskNo))
 
@@ -456,103 +570,33 @@ func (s *CapabilityService) completeTask(task *model.Task, cc *model.ChannelCapa
 	strategyService := NewStrategyService()
 	strategyService.DecrementAccountTasks(task.AccountID)
 
-	// 发送回调
-	if task.CallbackURL != "" {
-		go s.sendCallback(task)
-	}
-}
-
-// generateStoragePath 生成存储路径
-func (s *CapabilityService) generateStoragePath(capabilityCode string, originURL string) string {
-	now := time.Now()
-	ext := filepath.Ext(originURL)
-	if ext == "" || len(ext) > 10 {
-		if strings.Contains(capabilityCode, "video") {
-			ext = ".mp4"
-		} else {
-			ext = ".png"
-		}
-	}
-	// 去除ext中可能的查询参数
-	if idx := strings.Index(ext, "?"); idx > 0 {
-		ext = ext[:idx]
-	}
-	return fmt.Sprintf("%s/%s/%s%s", capabilityCode, now.Format("2006/01/02"), uuid.New().String(), ext)
+	webhookService.Emit(task, model.WebhookEventTaskSucceeded, nil)
 }
 
-// failTask 任务失败
+// failTask 任务失败，占用终态成功后才退回预扣费用
 func (s *CapabilityService) failTask(task *model.Task, errMsg string) {
 	now := time.Now()
-	updates := map[string]any{
+	// 失败状态和退款在同一事务中写入，退款失败时任务保持进行中，由超时检查再次结束
+	claimed, err := NewBillingService().claimTaskFailure(task, map[string]any{
 		"status":        model.TaskStatusFailed,
 		"error_message": errMsg,
 		"completed_at":  now,
+	})
+	if err != nil {
+		logger.Error("fail task failed", zap.String("task_no", task.TaskNo), zap.Error(err))
+		return
 	}
-
-	// 如果有扣费，退回余额
-	if task.Cost > 0 {
-		result := model.DB().Model(&model.Token{}).Where("id = ?", task.TokenID).Updates(map[string]any{
-			"balance":    gorm.Expr("balance + ?", task.Cost),
-			"total_used": gorm.Expr("total_used - ?", task.Cost),
-		})
-		if result.RowsAffected > 0 {
-			// 退还用户余额
-			model.DB().Model(&model.User{}).Where("id = ?", task.UserID).
-				UpdateColumn("balance", gorm.Expr("balance + ?", task.Cost))
-			updates["refunded"] = true
-			logger.Info("refunded cost for failed task",
-				zap.String("task_no", task.TaskNo),
-				zap.Float64("cost", task.Cost))
-		}
+	if !claimed {
+		logger.Warn("task already finished, skip failure", zap.String("task_no", task.TaskNo), zap.String("error", errMsg))
+		return
 	}
-
-	model.DB().Model(task).Updates(updates)
+	task.Status = model.TaskStatusFailed
+	task.ErrorMessage = errMsg
+	task.CompletedAt = &now
 
 	logger.Warn("capability task failed", zap.String("task_no", task.TaskNo), zap.String("error", errMsg))
 
-	if task.CallbackURL != "" {
-		go s.sendCallback(task)
-	}
-}
-
-// sendCallback 发送回调给调用方
-func (s *CapabilityService) sendCallback(task *model.Task) {
-	// 重新查询任务获取最新数据
-	model.DB().First(task, task.ID)
-
-	ctx := context.Background()
-	payload := map[string]any{
-		"task_id": task.TaskNo,
-		"status":  task.Status,
-	}
-
-	if task.Status == model.TaskStatusSuccess {
-		var result map[string]any
-		json.Unmarshal(task.Result, &result)
-		payload["result"] = result
-	}
-	if task.ErrorMessage != "" {
-		payload["error"] = task.ErrorMessage
-	}
-
-	maxAttempts := 3
-	for i := 0; i < maxAttempts; i++ {
-		detail := httputil.PostJSONWithDetail(ctx, task.CallbackURL, payload, nil)
-		s.logRequest(task, model.RequestTypeCallback, detail)
-		if detail.Error == nil {
-			model.DB().Model(task).Updates(map[string]any{
-				"callback_status":   model.CallbackStatusSuccess,
-				"callback_attempts": i + 1,
-			})
-			return
-		}
-		time.Sleep(time.Duration(i+1) * 5 * time.Second)
-	}
-
-	model.DB().Model(task).Updates(map[string]any{
-		"callback_status":   model.CallbackStatusFailed,
-		"callback_attempts": maxAttempts,
-	})
+	webhookService.Emit(task, model.WebhookEventTaskFailed, nil)
 }
 
 // releaseAccount 释放账号
@@ -578,81 +622,211 @@ func (s *CapabilityService) GetTaskByVendorID(ctx context.Context, vendorTaskID
 
 // CancelTask 取消任务
 func (s *CapabilityService) CancelTask(ctx context.Context, taskNo string, userID uint) error {
+	var task model.Task
+	if err := model.DB().Where("task_no = ? AND user_id = ? AND status IN ?", taskNo, userID, activeTaskStatuses).
+		First(&task).Error; err != nil {
+		return fmt.Errorf("task not found or cannot be cancelled")
+	}
+
 	result := model.DB().Model(&model.Task{}).
-		Where("task_no = ? AND user_id = ? AND status IN ?", taskNo, userID,
-			[]model.TaskStatus{model.TaskStatusPending, model.TaskStatusProcessing}).
+		Where("id = ? AND status IN ?", task.ID, activeTaskStatuses).
 		Update("status", model.TaskStatusCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
 	if result.RowsAffected == 0 {
 		return fmt.Errorf("task not found or cannot be cancelled")
 	}
-	return result.Error
+	NewRateLimitService().ReleaseTask(ctx, task.TokenID, task.TaskNo)
+
+	s.cancelVendorTask(ctx, &task)
+	return nil
 }
 
-// HandleCallback 处理供应商回调
-func (s *CapabilityService) HandleCallback(ctx context.Context, channelType string, body map[string]any) error {
+// cancelVendorTask 配置了取消模板时通知供应商取消任务，失败只记录日志
+func (s *CapabilityService) cancelVendorTask(ctx context.Context, task *model.Task) {
+	if task.VendorTaskID == "" {
+		return
+	}
+
+	var cc model.ChannelCapability
+	if err := model.DB().First(&cc, task.ChannelCapabilityID).Error; err != nil || len(cc.CancelTemplate) == 0 {
+		return
+	}
+	var channel model.Channel
+	if err := model.DB().First(&channel, task.ChannelID).Error; err != nil {
+		return
+	}
+	var account model.ChannelAccount
+	if err := model.DB().First(&account, task.AccountID).Error; err != nil {
+		return
+	}
+
+	req := &httputil.Request{
+		Method:      http.MethodPost,
+		URL:         channel.BaseURL,
+		Headers:     make(map[string]string),
+		ContentType: cc.ContentType,
+	}
+	if err := applyRequestTemplate(cc.CancelTemplate, req, channel.BaseURL, templateVars(task, &channel, &cc, &account, nil)); err != nil {
+		logger.Warn("build cancel request failed", zap.String("task_no", task.TaskNo), zap.Error(err))
+		return
+	}
+	if err := s.applyAuth(ctx, &channel, &cc, &account, req); err != nil {
+		logger.Warn("build cancel request failed", zap.String("task_no", task.TaskNo), zap.Error(err))
+		return
+	}
+
+	detail := httputil.Do(ctx, req)
+	logTaskRequest(task, model.RequestTypeCancel, detail)
+	if detail.Error != nil {
+		logger.Warn("cancel vendor task failed",
+			zap.String("task_no", task.TaskNo),
+			zap.String("vendor_task_id", task.VendorTaskID),
+			zap.Error(detail.Error))
+	}
+}
+
+// HandleCallback 处理供应商回调，未通过验证的回调会被拒绝并记录到请求日志
+// 回调地址包含任务编号时直接定位任务；不带任务编号的旧地址只有渠道开启 legacy_callback 时才按供应商任务ID查找
+func (s *CapabilityService) HandleCallback(ctx context.Context, req *CallbackRequest) error {
 	// 查找渠道
 	var channel model.Channel
-	if err := model.DB().Where("type = ?", channelType).First(&channel).Error; err != nil {
-		return fmt.Errorf("channel not found: %s", channelType)
+	if err := model.DB().Where("type = ?", req.ChannelType).First(&channel).Error; err != nil {
+		return fmt.Errorf("channel not found: %s", req.ChannelType)
+	}
+
+	if req.TaskNo == "" && !ParseChannelConfig(channel.Config).LegacyCallback {
+		err := fmt.Errorf("%w: legacy callback disabled for channel %s", ErrCallbackUnauthorized, channel.Type)
+		logRejectedCallback(&channel, nil, req, err)
+		return err
+	}
+
+	if err := verifyCallbackRequest(&channel, req); err != nil {
+		logRejectedCallback(&channel, nil, req, err)
+		return err
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		return fmt.Errorf("invalid request body")
 	}
 
-	// 查找该渠道下的能力配置
+	if req.TaskNo != "" {
+		return s.handleTaskCallback(&channel, req, body)
+	}
+
+	logger.Warn("deprecated legacy callback used", zap.String("channel_type", channel.Type))
+
+	// 查找该渠道下回调模式的能力配置
 	var ccs []model.ChannelCapability
-	model.DB().Where("channel_id = ?", channel.ID).Find(&ccs)
+	model.DB().Where("channel_id = ? AND result_mode = ?", channel.ID, model.ResultModeCallback).Find(&ccs)
 
 	// 尝试解析回调
 	for _, cc := range ccs {
-		mappingData := cc.CallbackMapping
-		if len(mappingData) == 0 {
-			mappingData = cc.ResponseMapping
-		}
+		mappingData := callbackMapping(&cc)
 		if len(mappingData) == 0 {
 			continue
 		}
 
 		result, _ := s.responseMapper.Map(body, mappingData)
-		vendorTaskID, _ := result["task_id"].(string)
+		vendorTaskID := extractString(result["task_id"])
 		if vendorTaskID == "" {
 			continue
 		}
 
-		// 查找任务
-		task, err := s.GetTaskByVendorID(ctx, vendorTaskID)
-		if err != nil {
+		// 查找任务（限定在当前能力配置内，避免不同渠道的供应商任务ID冲突）
+		var task model.Task
+		if err := model.DB().Where("vendor_task_id = ? AND channel_capability_id = ?", vendorTaskID, cc.ID).
+			First(&task).Error; err != nil {
 			continue
 		}
 
-		// 先检查成功条件（基于原始响应）
-		isSuccess, isFailed := s.responseMapper.CheckSuccess(body, mappingData)
-
-		// 如果配置了成功条件，优先使用
-		if isSuccess {
-			s.completeTask(task, &cc, result)
-			return nil
-		}
-		if isFailed {
-			errMsg, _ := result["error"].(string)
-			if errMsg == "" {
-				errMsg = "callback failed by success condition"
-			}
-			s.failTask(task, errMsg)
-			return nil
+		if err := verifyCallbackTask(&channel, &task, req); err != nil {
+			logRejectedCallback(&channel, &task, req, err)
+			return err
 		}
 
-		// 如果没有配置成功条件，使用原有的 status 字段判断逻辑
-		status, _ := result["status"].(string)
-		if status == "success" {
-			s.completeTask(task, &cc, result)
-		} else if status == "failed" {
-			errMsg, _ := result["error"].(string)
-			s.failTask(task, errMsg)
-		}
+		s.applyCallbackResult(&task, &cc, body, result)
 		return nil
 	}
 
 	return fmt.Errorf("no matching task found for callback")
 }
 
+// handleTaskCallback 处理按任务路由的回调
+func (s *CapabilityService) handleTaskCallback(channel *model.Channel, req *CallbackRequest, body map[string]any) error {
+	var task model.Task
+	if err := model.DB().Where("task_no = ? AND channel_id = ?", req.TaskNo, channel.ID).First(&task).Error; err != nil {
+		err = fmt.Errorf("%w: task not found", ErrCallbackUnauthorized)
+		logRejectedCallback(channel, nil, req, err)
+		return err
+	}
+
+	if err := verifyCallbackTask(channel, &task, req); err != nil {
+		logRejectedCallback(channel, &task, req, err)
+		return err
+	}
+
+	var cc model.ChannelCapability
+	if err := model.DB().First(&cc, task.ChannelCapabilityID).Error; err != nil {
+		return fmt.Errorf("channel capability not found")
+	}
+
+	result, err := s.responseMapper.Map(body, callbackMapping(&cc))
+	if err != nil {
+		return fmt.Errorf("map callback: %w", err)
+	}
+
+	s.applyCallbackResult(&task, &cc, body, result)
+	return nil
+}
+
+// applyCallbackResult 根据回调结果更新任务，已结束的任务忽略重复回调
+func (s *CapabilityService) applyCallbackResult(task *model.Task, cc *model.ChannelCapability, body map[string]any, result map[string]any) {
+	if task.Status != model.TaskStatusPending && task.Status != model.TaskStatusProcessing {
+		logger.Info("ignore callback for finished task", zap.String("task_no", task.TaskNo))
+		return
+	}
+
+	// 先检查成功条件（基于原始响应）
+	isSuccess, isFailed := s.responseMapper.CheckSuccess(body, callbackMapping(cc))
+
+	// 如果配置了成功条件，优先使用
+	if isSuccess {
+		s.completeTask(task, cc, result)
+		return
+	}
+	if isFailed {
+		errMsg, _ := result["error"].(string)
+		if errMsg == "" {
+			errMsg = "callback failed by success condition"
+		}
+		s.failTask(task, errMsg)
+		return
+	}
+
+	// 如果没有配置成功条件，使用原有的 status 字段判断逻辑
+	status, _ := result["status"].(string)
+	if status == "success" {
+		s.completeTask(task, cc, result)
+	} else if status == "failed" {
+		errMsg, _ := result["error"].(string)
+		s.failTask(task, errMsg)
+	} else if progress, ok := result["progress"].(float64); ok && int(progress) != task.Progress {
+		model.DB().Model(task).Update("progress", int(progress))
+		webhookService.Emit(task, model.WebhookEventTaskProgress, map[string]any{"progress": int(progress)})
+	}
+}
+
+// callbackMapping 回调响应映射，未配置时使用通用响应映射
+func callbackMapping(cc *model.ChannelCapability) []byte {
+	if len(cc.CallbackMapping) > 0 {
+		return cc.CallbackMapping
+	}
+	return cc.ResponseMapping
+}
+
 // extractString 安全地从 any 类型提取字符串
 func extractString(v any) string {
 	if v == nil {
@@ -672,8 +846,8 @@ func extractString(v any) string {
 	}
 }
 
-// logRequest 记录渠道请求日志
-func (s *CapabilityService) logRequest(task *model.Task, reqType model.RequestType, detail *httputil.RequestDetail) {
+// logTaskRequest 记录任务的渠道请求日志
+func logTaskRequest(task *model.Task, reqType model.RequestType, detail *httputil.RequestDetail) {
 	headersJSON, _ := json.Marshal(detail.RequestHeaders)
 	log := &model.ChannelRequestLog{
 		TaskID:         task.ID,
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/money"
+	"gorm.io/datatypes"
+)
+
+// callbackFixture 回调模式的渠道、能力配置，以及已预扣费用的进行中任务
+type callbackFixture struct {
+	channel model.Channel
+	cc      model.ChannelCapability
+	user    model.User
+	token   model.Token
+	task    model.Task
+}
+
+func newCallbackFixture(t *testing.T, channelConfig string) *callbackFixture {
+	t.Helper()
+	setupTestDB(t)
+	f := &callbackFixture{}
+	f.channel = model.Channel{Type: "vendor", Config: []byte(channelConfig)}
+	f.user = model.User{Username: "alice", Balance: 10 * money.Unit}
+	for _, v := range []any{&f.channel, &f.user} {
+		if err := model.DB().Create(v).Error; err != nil {
+			t.Fatalf("create fixture: %v", err)
+		}
+	}
+	f.token = model.Token{UserID: f.user.ID, KeyHash: "hash", Status: 1}
+	f.cc = model.ChannelCapability{
+		ChannelID:       f.channel.ID,
+		CapabilityCode:  "video",
+		ResultMode:      model.ResultModeCallback,
+		CallbackMapping: datatypes.JSON(`{"field_mapping":{"task_id":"id","status":"state","error":"message"}}`),
+	}
+	for _, v := range []any{&f.token, &f.cc} {
+		if err := model.DB().Create(v).Error; err != nil {
+			t.Fatalf("create fixture: %v", err)
+		}
+	}
+	f.task = model.Task{
+		TaskNo:              "T1",
+		UserID:              f.user.ID,
+		TokenID:             f.token.ID,
+		CapabilityCode:      "video",
+		ChannelID:           f.channel.ID,
+		ChannelCapabilityID: f.cc.ID,
+		VendorTaskID:        "v-1",
+		Status:              model.TaskStatusProcessing,
+		CallbackToken:       "tok",
+		Cost:                2 * money.Unit,
+	}
+	if err := NewBillingService().CreateChargedTask(&f.task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	return f
+}
+
+// reload 重新读取任务和用户余额
+func (f *callbackFixture) reload(t *testing.T) (model.Task, money.Money) {
+	t.Helper()
+	var task model.Task
+	model.DB().First(&task, f.task.ID)
+	var user model.User
+	model.DB().First(&user, f.user.ID)
+	return task, user.Balance
+}
+
+func callbackRequest(taskNo, token, body string) *CallbackRequest {
+	return &CallbackRequest{
+		ChannelType: "vendor",
+		TaskNo:      taskNo,
+		Method:      http.MethodPost,
+		URL:         "/internal/callback/vendor/" + taskNo,
+		ClientIP:    "203.0.113.9",
+		Headers:     http.Header{},
+		Query:       url.Values{"token": {token}},
+		Body:        []byte(body),
+	}
+}
+
+func TestHandleCallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		taskNo      string
+		token       string
+		body        string
+		wantErr     error
+		wantStatus  model.TaskStatus
+		wantBalance money.Money
+	}{
+		{
+			name:        "routed success",
+			config:      `{}`,
+			taskNo:      "T1",
+			token:       "tok",
+			body:        `{"id":"v-1","state":"success","url":"https://vendor.example.com/a.mp4"}`,
+			wantStatus:  model.TaskStatusSuccess,
+			wantBalance: 8 * money.Unit,
+		},
+		{
+			name:        "routed failure refunds",
+			config:      `{}`,
+			taskNo:      "T1",
+			token:       "tok",
+			body:        `{"id":"v-1","state":"failed","message":"nsfw"}`,
+			wantStatus:  model.TaskStatusFailed,
+			wantBalance: 10 * money.Unit,
+		},
+		{
+			name:        "routed wrong token",
+			config:      `{}`,
+			taskNo:      "T1",
+			token:       "bad",
+			body:        `{"id":"v-1","state":"success"}`,
+			wantErr:     ErrCallbackUnauthorized,
+			wantStatus:  model.TaskStatusProcessing,
+			wantBalance: 8 * money.Unit,
+		},
+		{
+			name:        "routed unknown task",
+			config:      `{}`,
+			taskNo:      "T2",
+			token:       "tok",
+			body:        `{"id":"v-1","state":"success"}`,
+			wantErr:     ErrCallbackUnauthorized,
+			wantStatus:  model.TaskStatusProcessing,
+			wantBalance: 8 * money.Unit,
+		},
+		{
+			name:        "legacy disabled",
+			config:      `{"callback_auth":{"type":"none"}}`,
+			body:        `{"id":"v-1","state":"success"}`,
+			wantErr:     ErrCallbackUnauthorized,
+			wantStatus:  model.TaskStatusProcessing,
+			wantBalance: 8 * money.Unit,
+		},
+		{
+			name:        "legacy without auth",
+			config:      `{"legacy_callback":true}`,
+			body:        `{"id":"v-1","state":"success"}`,
+			wantErr:     ErrCallbackUnauthorized,
+			wantStatus:  model.TaskStatusProcessing,
+			wantBalance: 8 * money.Unit,
+		},
+		{
+			name:        "legacy enabled",
+			config:      `{"legacy_callback":true,"callback_auth":{"type":"none"}}`,
+			body:        `{"id":"v-1","state":"failed","message":"timeout"}`,
+			wantStatus:  model.TaskStatusFailed,
+			wantBalance: 10 * money.Unit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newCallbackFixture(t, tt.config)
+			err := NewCapabilityService().HandleCallback(context.Background(), callbackRequest(tt.taskNo, tt.token, tt.body))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("HandleCallback: %v", err)
+			}
+
+			task, balance := f.reload(t)
+			if task.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", task.Status, tt.wantStatus)
+			}
+			if balance != tt.wantBalance {
+				t.Errorf("balance = %s, want %s", balance, tt.wantBalance)
+			}
+		})
+	}
+}
+
+func TestFinishTaskOnce(t *testing.T) {
+	t.Run("duplicate failure refunds once", func(t *testing.T) {
+		f := newCallbackFixture(t, `{}`)
+		s := NewCapabilityService()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			// 每个结束路径持有各自读取的任务副本
+			task := f.task
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.failTask(&task, "vendor error")
+			}()
+		}
+		wg.Wait()
+
+		task, balance := f.reload(t)
+		if task.Status != model.TaskStatusFailed || !task.Refunded {
+			t.Fatalf("task status %s refunded %v", task.Status, task.Refunded)
+		}
+		if balance != 10*money.Unit {
+			t.Fatalf("balance = %s, want 10 (refunded once)", balance)
+		}
+		var refunds int64
+		model.DB().Model(&model.BillingTransaction{}).Where("type = ?", model.BillingTypeRefund).Count(&refunds)
+		if refunds != 1 {
+			t.Fatalf("refund entries = %d, want 1", refunds)
+		}
+	})
+
+	t.Run("complete after failure", func(t *testing.T) {
+		f := newCallbackFixture(t, `{}`)
+		s := NewCapabilityService()
+
+		failed, completed := f.task, f.task
+		s.failTask(&failed, "timeout")
+		s.completeTask(&completed, &f.cc, map[string]any{"url": "https://vendor.example.com/a.mp4"})
+
+		task, balance := f.reload(t)
+		if task.Status != model.TaskStatusFailed || task.ErrorMessage != "timeout" {
+			t.Fatalf("task status %s error %q, want failed", task.Status, task.ErrorMessage)
+		}
+		if len(task.Result) != 0 && string(task.Result) != "null" {
+			t.Errorf("result overwritten: %s", task.Result)
+		}
+		if balance != 10*money.Unit {
+			t.Errorf("balance = %s, want 10", balance)
+		}
+	})
+
+	t.Run("failure after completion", func(t *testing.T) {
+		f := newCallbackFixture(t, `{}`)
+		s := NewCapabilityService()
+
+		completed, failed := f.task, f.task
+		s.completeTask(&completed, &f.cc, map[string]any{"url": "https://vendor.example.com/a.mp4"})
+		s.failTask(&failed, "late timeout")
+
+		task, balance := f.reload(t)
+		if task.Status != model.TaskStatusSuccess || task.Refunded {
+			t.Fatalf("task status %s refunded %v, want success", task.Status, task.Refunded)
+		}
+		if balance != 8*money.Unit {
+			t.Errorf("balance = %s, want 8", balance)
+		}
+	})
+}
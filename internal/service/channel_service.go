@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/secret"
 	"gorm.io/gorm"
 )
 
@@ -206,16 +207,31 @@ func (s *ChannelService) ListChannelAccounts(channelID uint) ([]model.ChannelAcc
 }
 
 func (s *ChannelService) UpdateChannelAccount(id uint, req *UpdateChannelAccountRequest) error {
+	existing, err := s.GetChannelAccountByID(id)
+	if err != nil {
+		return err
+	}
+	// 未修改的脱敏值保持原值；map 更新不经过序列化器，密钥字段需先加密
+	apiKey := restoreMaskedSecrets(existing, req.APIKey, req.Config)
+
 	updates := make(map[string]any)
 	if req.Name != "" {
 		updates["name"] = req.Name
 	}
-	if req.APIKey != "" {
-		updates["api_key"] = req.APIKey
+	if apiKey != "" {
+		encrypted, err := secret.Encrypt(apiKey)
+		if err != nil {
+			return err
+		}
+		updates["api_key"] = encrypted
 	}
 	if req.Config != nil {
 		configJSON, _ := json.Marshal(req.Config)
-		updates["config"] = configJSON
+		encrypted, err := secret.Encrypt(string(configJSON))
+		if err != nil {
+			return err
+		}
+		updates["config"] = encrypted
 	}
 	if req.Weight != nil {
 		updates["weight"] = *req.Weight
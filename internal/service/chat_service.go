@@ -3,25 +3,33 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/majingzhen/prism/internal/model"
 	"github.com/majingzhen/prism/internal/provider/chat"
+	"github.com/majingzhen/prism/internal/provider/vendorauth"
 	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/majingzhen/prism/pkg/money"
 	"go.uber.org/zap"
 )
 
+// DefaultChatMaxTokens 请求和模型都未设置最大输出 token 数时，预授权按此估算
+const DefaultChatMaxTokens = 4096
+
 type ChatService struct {
 	billingService    *BillingService
 	requestLogService *RequestLogService
+	policyService     *TokenPolicyService
 }
 
 func NewChatService() *ChatService {
 	return &ChatService{
 		billingService:    NewBillingService(),
 		requestLogService: NewRequestLogService(),
+		policyService:     NewTokenPolicyService(),
 	}
 }
 
@@ -46,12 +54,24 @@ type CompletionResponse struct {
 	ConversationID string            `json:"conversation_id,omitempty"`
 	Choices        []chat.ChatChoice `json:"choices"`
 	Usage          *chat.ChatUsage   `json:"usage,omitempty"`
+
+	// TokenLimit 每分钟 token 数的限流结果，用于写入响应头
+	TokenLimit *RateLimitResult `json:"-"`
 }
 
 // Complete 执行对话补全
 func (s *ChatService) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
 	startTime := time.Now()
 
+	// 检查令牌的模型范围
+	token, err := s.policyService.Load(req.TokenID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policyService.CheckModel(token, req.Model); err != nil {
+		return nil, err
+	}
+
 	// 1. 查找模型
 	var chatModel model.ChatModel
 	if err := model.DB().Where("code = ? AND status = 1", req.Model).First(&chatModel).Error; err != nil {
@@ -79,7 +99,7 @@ func (s *ChatService) Complete(ctx context.Context, req *CompletionRequest) (*Co
 		return nil, fmt.Errorf("no available account for channel: %s", channel.Type)
 	}
 
-	// 5. 处理对话记忆
+	// 5. 加载对话历史
 	var conversation *model.Conversation
 	messages := req.Messages
 
@@ -89,11 +109,36 @@ func (s *ChatService) Complete(ctx context.Context, req *CompletionRequest) (*Co
 			historyMessages, _ := s.loadMessages(conversation.ID)
 			messages = append(historyMessages, req.Messages...)
 		}
-	} else {
+	}
+
+	// 6. 按预估用量检查每分钟 token 数并预占，调用结束后替换为实际用量
+	estimated := estimateMaxUsage(messages, req.MaxTokens, &chatModel)
+	rateLimitService := NewRateLimitService()
+	tokenLimit := rateLimitService.AllowTokens(ctx, req.TokenID, rateLimitService.Limits(token).TPM, estimated.TotalTokens)
+	if !tokenLimit.Allowed {
+		return nil, &RateLimitError{Kind: RateLimitTokens, Result: tokenLimit}
+	}
+	usedTokens := 0
+	defer func() {
+		if err := rateLimitService.RecordTokens(context.Background(), req.TokenID, tokenLimit.Reservation, usedTokens); err != nil {
+			logger.Warn("record chat tokens failed", zap.Error(err))
+		}
+	}()
+
+	// 按预估费用预授权，余额不足或超出消费上限时直接拒绝，不调用上游
+	hold := s.cost(estimated, modelChannel)
+	holdRef := BillingRef{Remark: "chat hold"}
+	if conversation != nil {
+		holdRef.ConversationID = conversation.ID
+	}
+	if err := s.billingService.Deduct(req.TokenID, req.UserID, hold, holdRef); err != nil {
+		return nil, fmt.Errorf("pre-authorize %s failed: %w", hold, err)
+	}
+	if req.ConversationID == "" {
 		conversation = s.createConversation(req.UserID, req.TokenID, req.Model, req.Messages)
 	}
 
-	// 6. 构建 Provider 并调用
+	// 7. 构建 Provider 并调用
 	providerConfig := chat.ProviderConfig{
 		BaseURL:     channel.BaseURL,
 		APIKey:      account.APIKey,
@@ -101,9 +146,19 @@ func (s *ChatService) Complete(ctx context.Context, req *CompletionRequest) (*Co
 		RequestPath: modelChannel.RequestPath,
 		Timeout:     time.Duration(modelChannel.Timeout) * time.Second,
 	}
+	// 渠道配置了认证策略时替代默认的 APIKey 认证
+	if authConfig := vendorauth.ParseChannelConfig(channel.Config); authConfig != nil {
+		auth, err := vendorauth.New(*authConfig, &account)
+		if err != nil {
+			s.releaseHold(req, hold, conversation)
+			return nil, fmt.Errorf("vendor auth failed: %w", err)
+		}
+		providerConfig.Auth = auth
+	}
 
 	provider, err := chat.GetProvider(chatModel.Provider, providerConfig)
 	if err != nil {
+		s.releaseHold(req, hold, conversation)
 		return nil, fmt.Errorf("get provider failed: %w", err)
 	}
 
@@ -118,7 +173,7 @@ func (s *ChatService) Complete(ctx context.Context, req *CompletionRequest) (*Co
 	chatResp, err := provider.Complete(ctx, chatReq)
 	latencyMs := int(time.Since(startTime).Milliseconds())
 
-	// 7. 记录请求日志
+	// 8. 记录请求日志
 	var conversationID uint
 	if conversation != nil {
 		conversationID = conversation.ID
@@ -130,21 +185,38 @@ func (s *ChatService) Complete(ctx context.Context, req *CompletionRequest) (*Co
 			zap.String("model", req.Model),
 			zap.String("channel", channel.Type),
 			zap.Error(err))
+		s.releaseHold(req, hold, conversation)
 		return nil, fmt.Errorf("chat completion failed: %w", err)
 	}
 
-	// 8. 计费
-	cost, err := s.charge(req.TokenID, req.UserID, chatResp.Usage, modelChannel)
-	if err != nil {
-		logger.Warn("charge failed", zap.Error(err))
+	// 9. 保存消息，上游未返回用量时按输入和输出内容长度估算
+	usage := chatResp.Usage
+	if usage == nil {
+		usage = estimateUsage(messages, chatResp.Choices)
+		logger.Warn("chat usage missing, charging estimated usage",
+			zap.String("model", req.Model),
+			zap.String("channel", channel.Type),
+			zap.Int("estimated_tokens", usage.TotalTokens))
 	}
-
-	// 9. 保存消息
+	cost := s.cost(usage, modelChannel)
+	var messageID uint
 	if conversation != nil {
-		s.saveMessages(conversation, req.Messages, chatResp, modelChannel, &account, latencyMs, cost)
+		messageID = s.saveMessages(conversation, req.Messages, chatResp, modelChannel, &account, latencyMs, cost)
+	}
+
+	// 10. 按实际用量结算预授权，流水关联对话和助手消息
+	billingRef := BillingRef{ConversationID: conversationID, MessageID: messageID, Remark: "chat settlement"}
+	if settled := s.settleHold(req, hold, cost, billingRef); settled != cost {
+		cost = settled
+		if messageID > 0 {
+			model.DB().Model(&model.Message{}).Where("id = ?", messageID).Update("cost", cost)
+		}
 	}
 
-	// 10. 构建响应
+	// 实际 token 用量计入每分钟 token 数限流
+	usedTokens = usage.TotalTokens
+
+	// 11. 构建响应
 	response := &CompletionResponse{
 		ID:      chatResp.ID,
 		Object:  "chat.completion",
@@ -152,6 +224,8 @@ func (s *ChatService) Complete(ctx context.Context, req *CompletionRequest) (*Co
 		Model:   req.Model,
 		Choices: chatResp.Choices,
 		Usage:   chatResp.Usage,
+
+		TokenLimit: tokenLimit,
 	}
 
 	if conversation != nil {
@@ -162,7 +236,7 @@ func (s *ChatService) Complete(ctx context.Context, req *CompletionRequest) (*Co
 		zap.String("model", req.Model),
 		zap.String("channel", channel.Type),
 		zap.Int("latency_ms", latencyMs),
-		zap.Float64("cost", cost))
+		zap.Stringer("cost", cost))
 
 	return response, nil
 }
@@ -305,8 +379,8 @@ func (s *ChatService) saveMessages(
 	mc *model.ChatModelChannel,
 	account *model.ChannelAccount,
 	latencyMs int,
-	cost float64,
-) {
+	cost money.Money,
+) uint {
 	// 保存用户消息
 	for _, msg := range userMessages {
 		model.DB().Create(&model.Message{
@@ -327,7 +401,7 @@ func (s *ChatService) saveMessages(
 			outputTokens = resp.Usage.PromptTokens + resp.Usage.CompletionTokens
 		}
 
-		model.DB().Create(&model.Message{
+		message := &model.Message{
 			ConversationID: conv.ID,
 			Role:           assistantMsg.Role,
 			Content:        assistantMsg.Content,
@@ -338,7 +412,8 @@ func (s *ChatService) saveMessages(
 			AccountID:      account.ID,
 			LatencyMs:      latencyMs,
 			Cost:           cost,
-		})
+		}
+		model.DB().Create(message)
 
 		// 更新对话统计
 		model.DB().Model(conv).Updates(map[string]any{
@@ -346,29 +421,100 @@ func (s *ChatService) saveMessages(
 			"message_count": conv.MessageCount + len(userMessages) + 1,
 			"model":         mc.ModelCode,
 		})
+		return message.ID
 	}
+	return 0
 }
 
-func (s *ChatService) charge(tokenID, userID uint, usage *chat.ChatUsage, mc *model.ChatModelChannel) (float64, error) {
+// cost 按模型渠道计价方式计算本次调用费用
+// 按 token 计价时先累加输入输出的费用再除以一百万，整次调用只四舍五入一次
+func (s *ChatService) cost(usage *chat.ChatUsage, mc *model.ChatModelChannel) money.Money {
 	if usage == nil {
-		return 0, nil
+		return 0
 	}
 
-	var cost float64
 	if mc.PriceMode == model.PriceModeToken {
-		cost = float64(usage.PromptTokens)/1000000*mc.InputPrice +
-			float64(usage.CompletionTokens)/1000000*mc.OutputPrice
-	} else {
-		cost = mc.InputPrice
+		total := mc.InputPrice*money.Money(usage.PromptTokens) + mc.OutputPrice*money.Money(usage.CompletionTokens)
+		return total.MulDiv(1, 1_000_000)
+	}
+	return mc.InputPrice
+}
+
+// estimateMaxUsage 预估本次调用的最大用量，输入按消息长度估算 token 数，输出按 max_tokens 或模型默认值
+func estimateMaxUsage(messages []chat.ChatMessage, maxTokens int, cm *model.ChatModel) *chat.ChatUsage {
+	if maxTokens <= 0 {
+		maxTokens = cm.MaxTokens
+	}
+	if maxTokens <= 0 {
+		maxTokens = DefaultChatMaxTokens
+	}
+	usage := &chat.ChatUsage{PromptTokens: estimatePromptTokens(messages), CompletionTokens: maxTokens}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// releaseHold 上游调用失败时退回预授权金额
+func (s *ChatService) releaseHold(req *CompletionRequest, hold money.Money, conv *model.Conversation) {
+	ref := BillingRef{Remark: "chat hold release"}
+	if conv != nil {
+		ref.ConversationID = conv.ID
 	}
+	if err := s.billingService.Refund(req.TokenID, req.UserID, hold, ref); err != nil {
+		logger.Error("release chat hold failed", zap.Stringer("hold", hold), zap.Error(err))
+	}
+}
 
-	if cost > 0 {
-		if err := s.billingService.Deduct(tokenID, userID, cost); err != nil {
-			return 0, err
+// settleHold 按实际费用结算预授权金额，多退少补，返回最终计费金额
+// 上游已经产生费用，实际费用超出预授权且钱包余额或令牌预算不足时，差额记为欠费，钱包余额可能为负
+func (s *ChatService) settleHold(req *CompletionRequest, hold, cost money.Money, ref BillingRef) money.Money {
+	var err error
+	switch {
+	case cost > hold:
+		err = s.billingService.DeductUsage(req.TokenID, req.UserID, cost-hold, ref)
+		if errors.Is(err, ErrInsufficientUserBalance) || errors.Is(err, ErrSpendLimitExceeded) {
+			logger.Warn("chat cost exceeds hold, recording arrears",
+				zap.Uint("user_id", req.UserID),
+				zap.Stringer("hold", hold),
+				zap.Stringer("cost", cost),
+				zap.Error(err))
+			ref.Remark = "chat arrears"
+			err = s.billingService.DeductArrears(req.TokenID, req.UserID, cost-hold, ref)
 		}
+	case cost < hold:
+		err = s.billingService.Refund(req.TokenID, req.UserID, hold-cost, ref)
 	}
+	if err != nil {
+		logger.Error("settle chat hold failed",
+			zap.Stringer("hold", hold),
+			zap.Stringer("cost", cost),
+			zap.Error(err))
+		return hold
+	}
+	return cost
+}
+
+// estimateUsage 按消息和回复内容长度估算用量，用于上游未返回用量的响应
+func estimateUsage(messages []chat.ChatMessage, choices []chat.ChatChoice) *chat.ChatUsage {
+	usage := &chat.ChatUsage{PromptTokens: estimatePromptTokens(messages)}
+	for _, choice := range choices {
+		usage.CompletionTokens += estimateTextTokens(choice.Message.Content)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// estimatePromptTokens 按 UTF-8 字节数估算输入 token 数（约 3 字节一个 token，中文约一字一个），每条消息另计 4 个
+func estimatePromptTokens(messages []chat.ChatMessage) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += estimateTextTokens(msg.Content) + 4
+	}
+	return tokens
+}
 
-	return cost, nil
+// estimateTextTokens 按 UTF-8 字节数估算文本的 token 数
+func estimateTextTokens(text string) int {
+	return (len(text) + 2) / 3
 }
 
 // ListModels 获取可用模型列表
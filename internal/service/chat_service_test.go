@@ -0,0 +1,113 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/provider/chat"
+	"github.com/majingzhen/prism/pkg/money"
+)
+
+func TestSettleHold(t *testing.T) {
+	tests := []struct {
+		name        string
+		balance     money.Money // 预授权之后的钱包余额
+		budget      money.Money
+		hold        money.Money
+		cost        money.Money
+		wantCost    money.Money
+		wantBalance money.Money
+		wantUsed    money.Money
+		wantRemark  string
+	}{
+		{name: "refund unused hold", balance: 5 * money.Unit, hold: 3 * money.Unit, cost: money.Unit, wantCost: money.Unit, wantBalance: 7 * money.Unit, wantUsed: money.Unit, wantRemark: "chat settlement"},
+		{name: "exact hold", balance: 5 * money.Unit, hold: 3 * money.Unit, cost: 3 * money.Unit, wantCost: 3 * money.Unit, wantBalance: 5 * money.Unit, wantUsed: 3 * money.Unit},
+		{name: "top up", balance: 5 * money.Unit, hold: 3 * money.Unit, cost: 4 * money.Unit, wantCost: 4 * money.Unit, wantBalance: 4 * money.Unit, wantUsed: 4 * money.Unit, wantRemark: "chat settlement"},
+		{name: "shortfall becomes arrears", balance: money.Unit, hold: 3 * money.Unit, cost: 5 * money.Unit, wantCost: 5 * money.Unit, wantBalance: -money.Unit, wantUsed: 5 * money.Unit, wantRemark: "chat arrears"},
+		{name: "over budget becomes arrears", balance: 5 * money.Unit, budget: 3 * money.Unit, hold: 3 * money.Unit, cost: 4 * money.Unit, wantCost: 4 * money.Unit, wantBalance: 4 * money.Unit, wantUsed: 4 * money.Unit, wantRemark: "chat arrears"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user, token := newWallet(t, tt.balance+tt.hold, tt.budget)
+			s := NewChatService()
+			req := &CompletionRequest{UserID: user.ID, TokenID: token.ID}
+			if err := s.billingService.Deduct(token.ID, user.ID, tt.hold, BillingRef{Remark: "chat hold"}); err != nil {
+				t.Fatalf("hold: %v", err)
+			}
+
+			got := s.settleHold(req, tt.hold, tt.cost, BillingRef{MessageID: 1, Remark: "chat settlement"})
+			if got != tt.wantCost {
+				t.Errorf("settled = %s, want %s", got, tt.wantCost)
+			}
+
+			var u model.User
+			model.DB().First(&u, user.ID)
+			var tk model.Token
+			model.DB().First(&tk, token.ID)
+			if u.Balance != tt.wantBalance || tk.TotalUsed != tt.wantUsed {
+				t.Errorf("balance = %s used = %s, want %s / %s", u.Balance, tk.TotalUsed, tt.wantBalance, tt.wantUsed)
+			}
+
+			var last model.BillingTransaction
+			model.DB().Order("id DESC").First(&last)
+			if tt.wantRemark != "" && (last.Remark != tt.wantRemark || last.MessageID != 1) {
+				t.Errorf("last entry = %q message %d, want %q", last.Remark, last.MessageID, tt.wantRemark)
+			}
+			if mismatches, err := NewBillingService().Reconcile(); err != nil || len(mismatches) != 0 {
+				t.Errorf("Reconcile = %v, %v", mismatches, err)
+			}
+		})
+	}
+}
+
+func TestArrearsBlocksDeductUntilRecharge(t *testing.T) {
+	setupTestDB(t)
+	user, token := newWallet(t, money.Unit, 0)
+	s := NewBillingService()
+
+	if err := s.DeductArrears(token.ID, user.ID, 3*money.Unit, BillingRef{Remark: "chat arrears"}); err != nil {
+		t.Fatalf("DeductArrears: %v", err)
+	}
+	if err := s.Deduct(token.ID, user.ID, money.Unit/100, BillingRef{}); err != ErrInsufficientUserBalance {
+		t.Fatalf("Deduct in arrears err = %v, want ErrInsufficientUserBalance", err)
+	}
+	if err := s.RechargeUser(user.ID, 5*money.Unit, BillingRef{}); err != nil {
+		t.Fatalf("RechargeUser: %v", err)
+	}
+	var u model.User
+	model.DB().First(&u, user.ID)
+	if u.Balance != 3*money.Unit {
+		t.Fatalf("balance after recharge = %s, want 3 (arrears offset)", u.Balance)
+	}
+}
+
+func TestEstimateUsage(t *testing.T) {
+	messages := []chat.ChatMessage{{Role: "user", Content: "hello world!"}}
+	tests := []struct {
+		name           string
+		choices        []chat.ChatChoice
+		wantCompletion int
+	}{
+		{name: "no choices", wantCompletion: 0},
+		{name: "ascii", choices: []chat.ChatChoice{{Message: chat.ChatMessage{Content: "abcdef"}}}, wantCompletion: 2},
+		{name: "cjk", choices: []chat.ChatChoice{{Message: chat.ChatMessage{Content: "你好世界"}}}, wantCompletion: 4},
+		{name: "multiple choices", choices: []chat.ChatChoice{{Message: chat.ChatMessage{Content: "abc"}}, {Message: chat.ChatMessage{Content: "abcd"}}}, wantCompletion: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := estimateUsage(messages, tt.choices)
+			// 12 字节约 4 个 token，每条消息另计 4 个
+			if usage.PromptTokens != 8 || usage.CompletionTokens != tt.wantCompletion || usage.TotalTokens != 8+tt.wantCompletion {
+				t.Errorf("usage = %+v, want prompt 8 completion %d", usage, tt.wantCompletion)
+			}
+		})
+	}
+
+	// 按估算用量计费，不再是 0
+	mc := &model.ChatModelChannel{PriceMode: model.PriceModeToken, InputPrice: money.Unit, OutputPrice: 2 * money.Unit}
+	cost := NewChatService().cost(estimateUsage(messages, []chat.ChatChoice{{Message: chat.ChatMessage{Content: "abcdef"}}}), mc)
+	if cost == 0 {
+		t.Error("estimated usage should be charged")
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/money"
 	"gorm.io/gorm"
 )
 
@@ -26,7 +27,7 @@ type ListConversationsRequest struct {
 // ConversationItem 对话列表项
 type ConversationItem struct {
 	model.Conversation
-	TotalCost float64 `json:"total_cost"`
+	TotalCost money.Money `json:"total_cost"`
 }
 
 // ListConversationsResponse 查询对话列表响应
@@ -0,0 +1,363 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/provider"
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/majingzhen/prism/pkg/httputil"
+	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/majingzhen/prism/pkg/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultFileMaxSize 默认单个文件大小上限
+	DefaultFileMaxSize int64 = 50 << 20
+	// DefaultFileTTL 默认文件有效期
+	DefaultFileTTL = 24 * time.Hour
+)
+
+var (
+	ErrFileNotFound          = errors.New("file not found")
+	ErrFileTooLarge          = errors.New("file too large")
+	ErrFileQuotaExceeded     = errors.New("file quota exceeded")
+	ErrStorageNotConfigured  = errors.New("storage not configured")
+	ErrFileCountLimitReached = errors.New("file count limit reached")
+)
+
+// fileIDPattern 能力参数中引用文件的格式
+var fileIDPattern = regexp.MustCompile(`^file-[0-9a-f]{24}$`)
+
+// fileURLPattern 文件访问地址中的文件ID，存储路径见 fileStoragePath
+var fileURLPattern = regexp.MustCompile(`/(file-[0-9a-f]{24})(\.[^/]*)?$`)
+
+// UploadFileRequest 上传文件请求，TTL 为 0 时使用默认有效期
+type UploadFileRequest struct {
+	Filename    string
+	ContentType string
+	Reader      io.Reader
+	TTL         time.Duration
+}
+
+type FileService struct{}
+
+func NewFileService() *FileService {
+	return &FileService{}
+}
+
+// Upload 保存上传的文件，检查大小上限和令牌配额
+func (s *FileService) Upload(ctx context.Context, token *model.Token, req *UploadFileRequest) (*model.File, error) {
+	return s.save(ctx, token, req, model.FileSourceUpload, "")
+}
+
+// Import 下载链接内容保存为文件，链接由调用方提供，只允许下载公网地址
+func (s *FileService) Import(ctx context.Context, token *model.Token, rawURL string, ttl time.Duration) (*model.File, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid url: %s", rawURL)
+	}
+
+	result, err := httputil.DownloadPublic(ctx, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("download: %w", err)
+	}
+	defer result.Body.Close()
+
+	if result.Size > fileMaxSize() {
+		return nil, fmt.Errorf("%w: %d > %d bytes", ErrFileTooLarge, result.Size, fileMaxSize())
+	}
+	contentType, _, _ := strings.Cut(result.ContentType, ";")
+	return s.save(ctx, token, &UploadFileRequest{
+		Filename:    path.Base(u.Path),
+		ContentType: contentType,
+		Reader:      result.Body,
+		TTL:         ttl,
+	}, model.FileSourceURL, rawURL)
+}
+
+// save 读取文件内容并上传到存储，写入文件记录
+func (s *FileService) save(ctx context.Context, token *model.Token, req *UploadFileRequest, source, originURL string) (*model.File, error) {
+	if storage.DefaultStorage == nil {
+		return nil, ErrStorageNotConfigured
+	}
+
+	maxSize := fileMaxSize()
+	data, err := io.ReadAll(io.LimitReader(req.Reader, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrFileTooLarge, maxSize)
+	}
+	if err := s.checkQuota(token, int64(len(data))); err != nil {
+		return nil, err
+	}
+
+	contentType := req.ContentType
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = http.DetectContentType(data)
+	}
+	filename := req.Filename
+	if filename == "" || filename == "." || filename == "/" {
+		filename = "file"
+	}
+
+	fileID := GenerateFileID()
+	key := fileStoragePath(fileID, filename, contentType)
+	finalURL, err := storage.Upload(ctx, bytes.NewReader(data), key, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("upload: %w", err)
+	}
+	if config.C.Storage.Private || storage.URLExpires() {
+		finalURL = ""
+	}
+
+	file := &model.File{
+		FileID:      fileID,
+		UserID:      token.UserID,
+		TokenID:     token.ID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Source:      source,
+		OriginURL:   originURL,
+		StorageKey:  key,
+		URL:         finalURL,
+		ExpiresAt:   time.Now().Add(fileTTL(req.TTL)),
+	}
+	if err := model.DB().Create(file).Error; err != nil {
+		storage.Delete(ctx, key)
+		return nil, fmt.Errorf("create file failed: %w", err)
+	}
+	return file, nil
+}
+
+// checkQuota 检查令牌未过期文件的总大小和数量是否超过配额
+func (s *FileService) checkQuota(token *model.Token, size int64) error {
+	quota := token.FileQuota
+	if quota <= 0 {
+		quota = config.C.Files.TokenQuota
+	}
+	maxFiles := config.C.Files.TokenMaxFiles
+	if quota <= 0 && maxFiles <= 0 {
+		return nil
+	}
+
+	var usage struct {
+		Count int64
+		Total int64
+	}
+	err := model.DB().Model(&model.File{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS total").
+		Where("token_id = ? AND expires_at > ?", token.ID, time.Now()).
+		Scan(&usage).Error
+	if err != nil {
+		return err
+	}
+
+	if maxFiles > 0 && usage.Count >= int64(maxFiles) {
+		return fmt.Errorf("%w: %d files", ErrFileCountLimitReached, maxFiles)
+	}
+	if quota > 0 && usage.Total+size > quota {
+		return fmt.Errorf("%w: used %d of %d bytes", ErrFileQuotaExceeded, usage.Total, quota)
+	}
+	return nil
+}
+
+// Get 获取用户未过期的文件
+func (s *FileService) Get(fileID string, userID uint) (*model.File, error) {
+	var file model.File
+	err := model.DB().Where("file_id = ? AND user_id = ? AND expires_at > ?", fileID, userID, time.Now()).
+		First(&file).Error
+	if err != nil {
+		return nil, ErrFileNotFound
+	}
+	return &file, nil
+}
+
+// List 分页列出令牌上传的未过期文件
+func (s *FileService) List(tokenID uint, page, pageSize int) ([]model.File, int64, error) {
+	query := model.DB().Model(&model.File{}).Where("token_id = ? AND expires_at > ?", tokenID, time.Now())
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var files []model.File
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&files).Error
+	return files, total, err
+}
+
+// Delete 删除文件记录和存储对象
+func (s *FileService) Delete(ctx context.Context, fileID string, userID uint) error {
+	file, err := s.Get(fileID, userID)
+	if err != nil {
+		return err
+	}
+	if err := storage.Delete(ctx, file.StorageKey); err != nil {
+		return fmt.Errorf("delete storage object: %w", err)
+	}
+	return model.DB().Delete(file).Error
+}
+
+// URL 文件访问地址，私有存储或链接会过期的存储生成有效期不超过文件剩余时间的签名链接
+func (s *FileService) URL(ctx context.Context, file *model.File) (string, error) {
+	if file.URL != "" && !storage.URLExpires() {
+		return file.URL, nil
+	}
+	ttl := time.Until(file.ExpiresAt)
+	if ttl <= 0 {
+		return "", ErrFileNotFound
+	}
+	return storage.GetSignedURL(ctx, file.StorageKey, ttl)
+}
+
+// ResolveParams 将参数中引用的文件ID替换为访问地址，返回替换后的参数副本
+// 支持顶层字符串参数和字符串数组中的每一项，文件不存在或已过期时返回错误
+// 以 multipart 文件字段提交时，再通过 Lookup 识别这些地址并从存储读取文件
+func (s *FileService) ResolveParams(ctx context.Context, userID uint, params map[string]any) (map[string]any, error) {
+	resolve := func(v string) (string, error) {
+		if !fileIDPattern.MatchString(v) {
+			return v, nil
+		}
+		file, err := s.Get(v, userID)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", err, v)
+		}
+		return s.URL(ctx, file)
+	}
+
+	resolved := make(map[string]any, len(params))
+	for k, v := range params {
+		switch val := v.(type) {
+		case string:
+			u, err := resolve(val)
+			if err != nil {
+				return nil, err
+			}
+			resolved[k] = u
+		case []any:
+			items := make([]any, len(val))
+			for i, item := range val {
+				items[i] = item
+				if str, ok := item.(string); ok {
+					u, err := resolve(str)
+					if err != nil {
+						return nil, err
+					}
+					items[i] = u
+				}
+			}
+			resolved[k] = items
+		default:
+			resolved[k] = v
+		}
+	}
+	return resolved, nil
+}
+
+// Lookup 返回按用户查找文件地址的函数，供 multipart 文件字段直接从存储读取 ResolveParams 解析出的文件
+// 只识别该用户未过期文件的地址，其他链接 (包括其他用户的文件) 按普通链接下载
+func (s *FileService) Lookup(userID uint) provider.StoredFileLookup {
+	return func(ctx context.Context, rawURL string) (string, bool) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return "", false
+		}
+		match := fileURLPattern.FindStringSubmatch(u.Path)
+		if match == nil {
+			return "", false
+		}
+		file, err := s.Get(match[1], userID)
+		if err != nil || !strings.HasSuffix(u.Path, "/"+file.StorageKey) {
+			return "", false
+		}
+		return file.StorageKey, true
+	}
+}
+
+// CleanupExpired 删除已过期文件的存储对象和记录
+func (s *FileService) CleanupExpired(ctx context.Context, limit int) (int, error) {
+	if storage.DefaultStorage == nil {
+		return 0, nil
+	}
+
+	var files []model.File
+	err := model.DB().Where("expires_at < ?", time.Now()).
+		Order("expires_at ASC").
+		Limit(limit).
+		Find(&files).Error
+	if err != nil {
+		return 0, err
+	}
+
+	cleaned := 0
+	for _, file := range files {
+		if err := storage.Delete(ctx, file.StorageKey); err != nil {
+			logger.Error("delete expired file failed",
+				zap.String("file_id", file.FileID),
+				zap.String("key", file.StorageKey),
+				zap.Error(err))
+			continue
+		}
+		model.DB().Unscoped().Delete(&file)
+		cleaned++
+	}
+	return cleaned, nil
+}
+
+// GenerateFileID 生成文件ID
+func GenerateFileID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "file-" + hex.EncodeToString(b)
+}
+
+// fileStoragePath 生成文件存储路径，如 files/2024/01/01/file-xxx.png
+func fileStoragePath(fileID, filename, contentType string) string {
+	ext := strings.ToLower(path.Ext(filename))
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return fmt.Sprintf("files/%s/%s%s", time.Now().Format("2006/01/02"), fileID, ext)
+}
+
+// fileMaxSize 单个文件大小上限
+func fileMaxSize() int64 {
+	if config.C.Files.MaxSize > 0 {
+		return config.C.Files.MaxSize
+	}
+	return DefaultFileMaxSize
+}
+
+// fileTTL 文件有效期，请求值不超过配置的最长有效期
+func fileTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = time.Duration(config.C.Files.TTL) * time.Second
+	}
+	if ttl <= 0 {
+		ttl = DefaultFileTTL
+	}
+	if maxTTL := time.Duration(config.C.Files.MaxTTL) * time.Second; maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+	return ttl
+}
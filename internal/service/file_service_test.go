@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/httputil"
+)
+
+func TestFileLookup(t *testing.T) {
+	setupTestDB(t)
+	file := model.File{
+		FileID:     "file-0123456789abcdef01234567",
+		UserID:     1,
+		StorageKey: "files/2024/01/01/file-0123456789abcdef01234567.png",
+		ExpiresAt:  time.Now().Add(time.Hour),
+	}
+	model.DB().Create(&file)
+	expired := model.File{
+		FileID:     "file-0123456789abcdef0123abcd",
+		UserID:     1,
+		StorageKey: "files/2024/01/01/file-0123456789abcdef0123abcd.png",
+		ExpiresAt:  time.Now().Add(-time.Hour),
+	}
+	model.DB().Create(&expired)
+
+	tests := []struct {
+		name   string
+		userID uint
+		url    string
+		want   bool
+	}{
+		{name: "signed url", userID: 1, url: "https://s3.example.com/bucket/" + file.StorageKey + "?X-Amz-Signature=abc", want: true},
+		{name: "public url", userID: 1, url: "https://cdn.example.com/" + file.StorageKey, want: true},
+		{name: "other user", userID: 2, url: "https://cdn.example.com/" + file.StorageKey},
+		{name: "expired", userID: 1, url: "https://cdn.example.com/" + expired.StorageKey},
+		{name: "key mismatch", userID: 1, url: "https://cdn.example.com/other/file-0123456789abcdef01234567.png"},
+		{name: "not a file", userID: 1, url: "https://example.com/image.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := NewFileService().Lookup(tt.userID)(context.Background(), tt.url)
+			if ok != tt.want || (ok && key != file.StorageKey) {
+				t.Errorf("Lookup(%s) = %q, %v, want %v", tt.url, key, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileImportRejectsNonPublicAddress(t *testing.T) {
+	setupTestDB(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "loopback", url: server.URL + "/secret.txt"},
+		{name: "metadata", url: "http://169.254.169.254/latest/meta-data/"},
+		{name: "private", url: "http://10.0.0.1/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFileService().Import(context.Background(), &model.Token{UserID: 1}, tt.url, 0)
+			if !errors.Is(err, httputil.ErrNonPublicAddress) {
+				t.Fatalf("Import(%s) err = %v, want ErrNonPublicAddress", tt.url, err)
+			}
+		})
+	}
+	var count int64
+	model.DB().Model(&model.File{}).Count(&count)
+	if count != 0 {
+		t.Errorf("files = %d, want 0", count)
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/majingzhen/prism/pkg/logger"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.L = zap.NewNop()
+	config.C = &config.Config{}
+	os.Exit(m.Run())
+}
+
+// setupTestDB 每个测试使用独立的 SQLite 数据库文件并完成表结构迁移
+// 事务以 BEGIN IMMEDIATE 开始，并发事务按写锁排队，便于测试并发扣费
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=10000&_journal_mode=WAL&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	model.SetDB(db)
+	if err := model.AutoMigrate(); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	config.C = &config.Config{}
+	return db
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/majingzhen/prism/internal/provider"
 )
 
 // ParamMapping 参数映射配置
@@ -15,6 +17,8 @@ type ParamMapping struct {
 	FixedParams    map[string]any                 `json:"fixed_params"`
 	ComputedParams map[string]string              `json:"computed_params"`
 	ParamRules     map[string]ParamRule           `json:"param_rules"`
+	// FileFields multipart 请求中以文件提交的字段，发送请求时读取，见 provider.ResolveFileFields
+	FileFields map[string]provider.FileField `json:"file_fields"`
 }
 
 // ParamTypeConversion 参数类型转换配置
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+)
+
+// DefaultPollInterval 未配置轮询间隔时的默认值
+const DefaultPollInterval = 5 * time.Second
+
+// PollSchedule 轮询计划，由渠道能力的轮询配置生成
+type PollSchedule struct {
+	initialDelay time.Duration
+	interval     time.Duration
+	backoff      string
+	factor       float64
+	steps        []time.Duration
+	jitter       float64
+	maxInterval  time.Duration
+	deadline     time.Duration
+	maxAttempts  int
+}
+
+// NewPollSchedule 根据渠道能力配置创建轮询计划
+func NewPollSchedule(cc *model.ChannelCapability) *PollSchedule {
+	s := &PollSchedule{
+		interval:    time.Duration(cc.PollInterval) * time.Second,
+		backoff:     cc.PollBackoff,
+		factor:      cc.PollBackoffFactor,
+		jitter:      cc.PollJitter,
+		maxInterval: time.Duration(cc.PollMaxInterval) * time.Second,
+		deadline:    time.Duration(cc.PollDeadline) * time.Second,
+		maxAttempts: cc.PollMaxAttempts,
+	}
+	if s.interval <= 0 {
+		s.interval = DefaultPollInterval
+	}
+	s.initialDelay = time.Duration(cc.PollInitialDelay) * time.Second
+	if s.initialDelay <= 0 {
+		s.initialDelay = s.interval
+	}
+	if s.factor <= 1 {
+		s.factor = 2
+	}
+	if s.jitter < 0 {
+		s.jitter = 0
+	} else if s.jitter > 1 {
+		s.jitter = 1
+	}
+
+	var steps []float64
+	if len(cc.PollSteps) > 0 && json.Unmarshal(cc.PollSteps, &steps) == nil {
+		for _, step := range steps {
+			if step > 0 {
+				s.steps = append(s.steps, time.Duration(step*float64(time.Second)))
+			}
+		}
+	}
+	return s
+}
+
+// Delay 第 attempt 次轮询（从 0 开始）前的等待时间
+func (s *PollSchedule) Delay(attempt int) time.Duration {
+	if attempt <= 0 {
+		return s.applyJitter(s.initialDelay)
+	}
+
+	delay := s.interval
+	switch s.backoff {
+	case model.PollBackoffExponential:
+		delay = time.Duration(float64(s.interval) * math.Pow(s.factor, float64(attempt-1)))
+		if delay <= 0 {
+			// 溢出时使用最大间隔
+			delay = s.maxInterval
+		}
+	case model.PollBackoffStepped:
+		if len(s.steps) > 0 {
+			delay = s.steps[min(attempt-1, len(s.steps)-1)]
+		}
+	}
+
+	if s.maxInterval > 0 && delay > s.maxInterval {
+		delay = s.maxInterval
+	}
+	return s.applyJitter(delay)
+}
+
+// NextDelay 结合供应商提示计算下一次轮询的等待时间
+// retryAfter 为 Retry-After 响应头，作为最小等待时间；eta 为供应商预计剩余时间，受最大间隔限制
+func (s *PollSchedule) NextDelay(attempt int, retryAfter, eta time.Duration) time.Duration {
+	delay := s.Delay(attempt)
+	if eta > delay {
+		delay = eta
+		if s.maxInterval > 0 && delay > s.maxInterval {
+			delay = s.maxInterval
+		}
+	}
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// Exhausted 是否已达到最大轮询次数或总时限
+func (s *PollSchedule) Exhausted(attempt int, startedAt time.Time) bool {
+	if s.maxAttempts > 0 && attempt >= s.maxAttempts {
+		return true
+	}
+	return s.deadline > 0 && time.Since(startedAt) >= s.deadline
+}
+
+// Clamp 将等待时间限制在总时限内，保证时限到达时还能轮询最后一次
+func (s *PollSchedule) Clamp(delay time.Duration, startedAt time.Time) time.Duration {
+	if s.deadline <= 0 {
+		return delay
+	}
+	remaining := s.deadline - time.Since(startedAt)
+	if remaining < 0 {
+		return 0
+	}
+	return min(delay, remaining)
+}
+
+func (s *PollSchedule) applyJitter(delay time.Duration) time.Duration {
+	if s.jitter == 0 || delay <= 0 {
+		return delay
+	}
+	// 在 [1-jitter, 1+jitter] 范围内随机
+	ratio := 1 + s.jitter*(2*rand.Float64()-1)
+	return time.Duration(float64(delay) * ratio)
+}
+
+// ETAFromResult 从映射后的结果中读取供应商预计剩余时间 (eta 字段，单位秒)
+func ETAFromResult(result map[string]any) time.Duration {
+	switch v := result["eta"].(type) {
+	case float64:
+		return time.Duration(v * float64(time.Second))
+	case int:
+		return time.Duration(v) * time.Second
+	case string:
+		var seconds float64
+		if err := json.Unmarshal([]byte(v), &seconds); err == nil {
+			return time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/provider"
+	"github.com/majingzhen/prism/pkg/httputil"
+)
+
+// PreSubmitStep 提交前置步骤，如先把输入图片上传到供应商的文件接口再提交任务
+type PreSubmitStep struct {
+	Name        string                        `json:"name"`
+	When        string                        `json:"when"`         // 变量为空时跳过该步骤，如 params.image
+	ContentType string                        `json:"content_type"` // 为空时使用渠道能力的内容类型
+	Request     provider.RequestTemplate      `json:"request"`      // 请求模板，默认 POST 到渠道 base_url
+	FileFields  map[string]provider.FileField `json:"file_fields"`  // multipart 请求中以文件提交的字段
+	Outputs     map[string]string             `json:"outputs"`      // 输出参数名 -> 响应中的路径，如 data.file_id
+}
+
+// ParsePreSubmitSteps 解析提交前置步骤配置
+func ParsePreSubmitSteps(data []byte) ([]PreSubmitStep, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var steps []PreSubmitStep
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return nil, fmt.Errorf("parse pre-submit steps: %w", err)
+	}
+	for i, step := range steps {
+		if step.Name == "" {
+			return nil, fmt.Errorf("pre-submit step %d: name is required", i)
+		}
+	}
+	return steps, nil
+}
+
+// RunPreSubmitSteps 依次执行提交前置步骤，返回各步骤的输出参数
+// 步骤中 {params.xxx} 为原始请求参数，前面步骤的输出可通过 {params.输出名} 或 {steps.步骤名.输出名} 引用
+// 每个步骤记录为一条 pre_submit 类型的请求日志，任一步骤失败时返回错误
+func RunPreSubmitSteps(
+	ctx context.Context,
+	task *model.Task,
+	channel *model.Channel,
+	cc *model.ChannelCapability,
+	account *model.ChannelAccount,
+	params map[string]any,
+) (map[string]any, error) {
+	steps, err := ParsePreSubmitSteps(cc.PreSubmitSteps)
+	if err != nil {
+		return nil, err
+	}
+
+	capabilityService := NewCapabilityService()
+	vars := templateVars(task, channel, cc, account, params)
+	outputs := make(map[string]any)
+
+	for _, step := range steps {
+		if step.When != "" && vars[step.When] == "" {
+			continue
+		}
+
+		contentType := step.ContentType
+		if contentType == "" {
+			contentType = cc.ContentType
+		}
+		req := &httputil.Request{
+			Method:      http.MethodPost,
+			URL:         channel.BaseURL,
+			Headers:     make(map[string]string),
+			ContentType: contentType,
+		}
+		if err := step.Request.Apply(req, channel.BaseURL, vars); err != nil {
+			return nil, fmt.Errorf("pre-submit step %s: %w", step.Name, err)
+		}
+		if req.Params, err = provider.ResolveFileFields(ctx, req.Params, step.FileFields, req.ContentType, NewFileService().Lookup(task.UserID)); err != nil {
+			return nil, fmt.Errorf("pre-submit step %s: %w", step.Name, err)
+		}
+		if err := capabilityService.applyAuth(ctx, channel, cc, account, req); err != nil {
+			return nil, fmt.Errorf("pre-submit step %s: %w", step.Name, err)
+		}
+
+		detail := httputil.Do(ctx, req)
+		logTaskRequest(task, model.RequestTypePreSubmit, detail)
+		if detail.Error != nil {
+			return nil, fmt.Errorf("pre-submit step %s: %w", step.Name, detail.Error)
+		}
+
+		var resp map[string]any
+		if err := json.Unmarshal(detail.ResponseBody, &resp); err != nil && len(step.Outputs) > 0 {
+			return nil, fmt.Errorf("pre-submit step %s: invalid response: %w", step.Name, err)
+		}
+		for name, path := range step.Outputs {
+			value := capabilityService.responseMapper.getValueByPath(resp, path)
+			if value == nil {
+				return nil, fmt.Errorf("pre-submit step %s: output %s not found at %s", step.Name, name, path)
+			}
+			outputs[name] = value
+			vars.Set("params."+name, value)
+			vars.Set("steps."+step.Name+"."+name, value)
+		}
+	}
+
+	return outputs, nil
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/money"
+)
+
+// 计价规则类型
+const (
+	PricingRulePerUnit = "per_unit" // 按参数值计量，倍数 = 参数值 / unit
+	PricingRuleMap     = "map"      // 按参数取值查表，如分辨率、质量
+	PricingRuleTier    = "tier"     // 按参数值所在区间取倍数
+)
+
+// ErrInvalidPricingParam 请求参数无法按计价规则计价
+var ErrInvalidPricingParam = errors.New("invalid pricing param")
+
+// PricingRule 计价规则，根据请求参数得到价格倍数，多条规则的倍数相乘
+type PricingRule struct {
+	Param   string                 `json:"param"`             // 请求参数名，如 duration、resolution、n
+	Type    string                 `json:"type"`              // per_unit/map/tier
+	Default any                    `json:"default,omitempty"` // 参数缺失时使用的值，未配置时该规则不生效
+	Unit    json.Number            `json:"unit,omitempty"`    // per_unit: 每多少参数值计一次基础价格，默认 1
+	Ceil    bool                   `json:"ceil,omitempty"`    // per_unit: 倍数向上取整，如不足 5 秒按 5 秒计
+	Values  map[string]json.Number `json:"values,omitempty"`  // map: 参数值 -> 倍数，"*" 为未列出取值的倍数
+	Tiers   []PricingTier          `json:"tiers,omitempty"`   // tier: 按上限从小到大匹配
+}
+
+// PricingTier 阶梯区间，参数值不超过 Max 时使用该倍数，Max 为空表示不限
+type PricingTier struct {
+	Max    json.Number `json:"max,omitempty"`
+	Factor json.Number `json:"factor"`
+}
+
+// PriceBreakdown 计价明细，保存在任务上
+type PriceBreakdown struct {
+	Base  money.Money `json:"base"`
+	Unit  string      `json:"unit,omitempty"`
+	Items []PriceItem `json:"items,omitempty"`
+	Total money.Money `json:"total"`
+
+	Settlement *PriceSettlement `json:"settlement,omitempty"` // 按实际用量结算的结果
+}
+
+// PriceItem 单条规则的计价结果
+type PriceItem struct {
+	Param  string      `json:"param"`
+	Type   string      `json:"type"`
+	Value  any         `json:"value"`
+	Factor json.Number `json:"factor"`
+}
+
+// ParsePricingRules 解析并校验计价规则配置
+func ParsePricingRules(data []byte) ([]PricingRule, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var rules []PricingRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse pricing rules: %w", err)
+	}
+	for i, rule := range rules {
+		if rule.Param == "" {
+			return nil, fmt.Errorf("pricing rule %d: param is required", i)
+		}
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("pricing rule %s: %w", rule.Param, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *PricingRule) validate() error {
+	switch r.Type {
+	case PricingRulePerUnit:
+		if r.Unit != "" {
+			unit, err := parseRat(r.Unit.String())
+			if err != nil || unit.Sign() <= 0 {
+				return fmt.Errorf("invalid unit %q", r.Unit)
+			}
+		}
+	case PricingRuleMap:
+		if len(r.Values) == 0 {
+			return fmt.Errorf("values is required")
+		}
+		for k, v := range r.Values {
+			if f, err := parseRat(v.String()); err != nil || f.Sign() < 0 {
+				return fmt.Errorf("invalid factor for %q", k)
+			}
+		}
+	case PricingRuleTier:
+		if len(r.Tiers) == 0 {
+			return fmt.Errorf("tiers is required")
+		}
+		for i, tier := range r.Tiers {
+			if f, err := parseRat(tier.Factor.String()); err != nil || f.Sign() < 0 {
+				return fmt.Errorf("tier %d: invalid factor", i)
+			}
+			if tier.Max != "" {
+				if _, err := parseRat(tier.Max.String()); err != nil {
+					return fmt.Errorf("tier %d: invalid max", i)
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unknown type %q", r.Type)
+	}
+	return nil
+}
+
+// CalculatePrice 按渠道能力的基础价格和计价规则计算本次请求的价格
+// 所有倍数按十进制精确相乘，最后只四舍五入一次
+func CalculatePrice(cc *model.ChannelCapability, params map[string]any) (*PriceBreakdown, error) {
+	breakdown := &PriceBreakdown{Base: cc.Price, Unit: cc.PriceUnit, Total: cc.Price}
+	rules, err := ParsePricingRules(cc.PricingRules)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 || cc.Price == 0 {
+		return breakdown, nil
+	}
+
+	total := big.NewRat(1, 1)
+	for _, rule := range rules {
+		value, ok := params[rule.Param]
+		if !ok || value == nil {
+			if rule.Default == nil {
+				continue
+			}
+			value = rule.Default
+		}
+		factor, err := rule.factor(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %v", ErrInvalidPricingParam, rule.Param, err)
+		}
+		total.Mul(total, factor)
+		breakdown.Items = append(breakdown.Items, PriceItem{
+			Param:  rule.Param,
+			Type:   rule.Type,
+			Value:  value,
+			Factor: json.Number(formatRat(factor)),
+		})
+	}
+
+	if breakdown.Total, err = cc.Price.MulRat(total); err != nil {
+		return nil, err
+	}
+	return breakdown, nil
+}
+
+// factor 计算参数值对应的倍数
+func (r *PricingRule) factor(value any) (*big.Rat, error) {
+	switch r.Type {
+	case PricingRulePerUnit:
+		v, err := parseRat(paramString(value))
+		if err != nil || v.Sign() < 0 {
+			return nil, fmt.Errorf("invalid value %v", value)
+		}
+		if r.Unit != "" {
+			unit, _ := parseRat(r.Unit.String())
+			v.Quo(v, unit)
+		}
+		if r.Ceil && !v.IsInt() {
+			q := new(big.Int).Quo(v.Num(), v.Denom())
+			v.SetInt(q.Add(q, big.NewInt(1)))
+		}
+		return v, nil
+	case PricingRuleMap:
+		f, ok := r.Values[paramString(value)]
+		if !ok {
+			if f, ok = r.Values["*"]; !ok {
+				return big.NewRat(1, 1), nil
+			}
+		}
+		return parseRat(f.String())
+	case PricingRuleTier:
+		v, err := parseRat(paramString(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %v", value)
+		}
+		for _, tier := range r.Tiers {
+			if tier.Max != "" {
+				limit, _ := parseRat(tier.Max.String())
+				if v.Cmp(limit) > 0 {
+					continue
+				}
+			}
+			return parseRat(tier.Factor.String())
+		}
+		return nil, fmt.Errorf("value %v exceeds all tiers", value)
+	}
+	return nil, fmt.Errorf("unknown type %q", r.Type)
+}
+
+// paramString 参数值的十进制文本，浮点数使用最短表示避免精度误差
+func paramString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func parseRat(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return r, nil
+}
+
+// formatRat 最多 6 位小数，去掉末尾的 0
+func formatRat(r *big.Rat) string {
+	s := r.FloatString(6)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/money"
+	"gorm.io/datatypes"
+)
+
+func TestParsePricingRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		want    int
+		wantErr bool
+	}{
+		{name: "empty", rules: ``},
+		{name: "null", rules: `null`},
+		{name: "all types", rules: `[{"param":"duration","type":"per_unit","unit":5,"ceil":true},{"param":"resolution","type":"map","values":{"720p":1,"1080p":1.5}},{"param":"n","type":"tier","tiers":[{"max":4,"factor":1},{"factor":0.8}]}]`, want: 3},
+		{name: "missing param", rules: `[{"type":"map","values":{"a":1}}]`, wantErr: true},
+		{name: "unknown type", rules: `[{"param":"n","type":"linear"}]`, wantErr: true},
+		{name: "zero unit", rules: `[{"param":"n","type":"per_unit","unit":0}]`, wantErr: true},
+		{name: "map without values", rules: `[{"param":"q","type":"map"}]`, wantErr: true},
+		{name: "negative map factor", rules: `[{"param":"q","type":"map","values":{"hd":-1}}]`, wantErr: true},
+		{name: "tier without tiers", rules: `[{"param":"n","type":"tier"}]`, wantErr: true},
+		{name: "invalid tier max", rules: `[{"param":"n","type":"tier","tiers":[{"max":"x","factor":1}]}]`, wantErr: true},
+		{name: "not json", rules: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParsePricingRules([]byte(tt.rules))
+			if (err != nil) != tt.wantErr || len(rules) != tt.want {
+				t.Errorf("ParsePricingRules = %d rules, %v, want %d (err %v)", len(rules), err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCalculatePrice(t *testing.T) {
+	const (
+		perUnit   = `{"param":"duration","type":"per_unit","unit":5}`
+		perUnitUp = `{"param":"duration","type":"per_unit","unit":5,"ceil":true}`
+		mapRule   = `{"param":"resolution","type":"map","values":{"720p":1,"1080p":1.5,"*":2}}`
+		tierRule  = `{"param":"n","type":"tier","tiers":[{"max":1,"factor":1},{"max":4,"factor":3.5},{"max":10,"factor":8}]}`
+		defaulted = `{"param":"duration","type":"per_unit","unit":5,"default":5}`
+	)
+	tests := []struct {
+		name    string
+		price   money.Money
+		rules   string
+		params  map[string]any
+		want    money.Money
+		items   int
+		wantErr error
+	}{
+		{name: "no rules", price: 2 * money.Unit, params: map[string]any{"duration": 10}, want: 2 * money.Unit},
+		{name: "free", rules: `[` + perUnit + `]`, params: map[string]any{"duration": 10}, want: 0},
+		{name: "per unit", price: money.Unit, rules: `[` + perUnit + `]`, params: map[string]any{"duration": 10}, want: 2 * money.Unit, items: 1},
+		{name: "per unit fraction", price: money.Unit, rules: `[` + perUnit + `]`, params: map[string]any{"duration": 7}, want: 1_400_000, items: 1},
+		{name: "per unit ceil", price: money.Unit, rules: `[` + perUnitUp + `]`, params: map[string]any{"duration": 7}, want: 2 * money.Unit, items: 1},
+		{name: "per unit ceil exact", price: money.Unit, rules: `[` + perUnitUp + `]`, params: map[string]any{"duration": 10.0}, want: 2 * money.Unit, items: 1},
+		{name: "per unit string value", price: money.Unit, rules: `[` + perUnit + `]`, params: map[string]any{"duration": "2.5"}, want: 500_000, items: 1},
+		{name: "per unit negative", price: money.Unit, rules: `[` + perUnit + `]`, params: map[string]any{"duration": -5}, wantErr: ErrInvalidPricingParam},
+		{name: "map listed", price: money.Unit, rules: `[` + mapRule + `]`, params: map[string]any{"resolution": "1080p"}, want: 1_500_000, items: 1},
+		{name: "map wildcard", price: money.Unit, rules: `[` + mapRule + `]`, params: map[string]any{"resolution": "4k"}, want: 2 * money.Unit, items: 1},
+		{name: "map without wildcard", price: money.Unit, rules: `[{"param":"q","type":"map","values":{"hd":2}}]`, params: map[string]any{"q": "sd"}, want: money.Unit, items: 1},
+		{name: "tier first", price: money.Unit, rules: `[` + tierRule + `]`, params: map[string]any{"n": 1}, want: money.Unit, items: 1},
+		{name: "tier boundary", price: money.Unit, rules: `[` + tierRule + `]`, params: map[string]any{"n": 4}, want: 3_500_000, items: 1},
+		{name: "tier exceeded", price: money.Unit, rules: `[` + tierRule + `]`, params: map[string]any{"n": 11}, wantErr: ErrInvalidPricingParam},
+		{name: "missing param skipped", price: money.Unit, rules: `[` + perUnit + `]`, params: map[string]any{}, want: money.Unit},
+		{name: "missing param default", price: money.Unit, rules: `[` + defaulted + `]`, params: map[string]any{}, want: money.Unit, items: 1},
+		{name: "rules multiply", price: money.Unit, rules: `[` + perUnitUp + `,` + mapRule + `,` + tierRule + `]`, params: map[string]any{"duration": 12, "resolution": "1080p", "n": 2}, want: 15_750_000, items: 3},
+		// 0.1 * 3 按十进制精确计算，只在最后四舍五入
+		{name: "exact decimal", price: 100_000, rules: `[{"param":"n","type":"per_unit"}]`, params: map[string]any{"n": 3}, want: 300_000, items: 1},
+		{name: "round once", price: 1, rules: `[{"param":"n","type":"per_unit","unit":3}]`, params: map[string]any{"n": 2}, want: 1, items: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := &model.ChannelCapability{Price: tt.price}
+			if tt.rules != "" {
+				cc.PricingRules = datatypes.JSON(tt.rules)
+			}
+			got, err := CalculatePrice(cc, tt.params)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CalculatePrice: %v", err)
+			}
+			if got.Total != tt.want || got.Base != tt.price || len(got.Items) != tt.items {
+				t.Errorf("breakdown = %+v, want total %s with %d items", got, tt.want, tt.items)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/cache"
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	rateLimitWindow         = time.Minute
+	rateLimitRequestsKey    = "ratelimit:rpm:"
+	rateLimitTokensKey      = "ratelimit:tpm:"
+	rateLimitConcurrencyKey = "ratelimit:concurrency:"
+
+	// taskSlotTTL 并发名额的最长占用时间，任务异常未释放时到期自动归还
+	taskSlotTTL = 24 * time.Hour
+)
+
+// 限流类型，与响应头 x-ratelimit-*-{kind} 和 429 响应体的 error.type 一致
+const (
+	RateLimitRequests    = "requests"
+	RateLimitTokens      = "tokens"
+	RateLimitConcurrency = "concurrency"
+)
+
+// requestWindowScript 滑动窗口计数，未超限时记录本次请求
+// 返回 {是否允许, 窗口内请求数, 最早一条记录离开窗口的毫秒数}
+var requestWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+  redis.call('ZADD', key, now, ARGV[4])
+  redis.call('PEXPIRE', key, window)
+  count = count + 1
+  allowed = 1
+end
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local reset = 0
+if #oldest > 0 then
+  reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, count, reset}
+`)
+
+// tokenWindowScript 汇总滑动窗口内的 token 用量，记录格式为 "数量:唯一ID"
+// 窗口内用量加上本次预估不超过上限时，以 ARGV[5] 预占本次预估的 token 数
+// 返回 {是否允许, 窗口内 token 数（含本次预占）, 最早一条记录离开窗口的毫秒数}
+var tokenWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local estimated = tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local entries = redis.call('ZRANGE', key, 0, -1, 'WITHSCORES')
+local used = 0
+for i = 1, #entries, 2 do
+  used = used + tonumber(string.match(entries[i], '^(%d+):'))
+end
+local allowed = 0
+if used + estimated <= limit then
+  redis.call('ZADD', key, now, ARGV[5])
+  redis.call('PEXPIRE', key, window)
+  used = used + estimated
+  allowed = 1
+end
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local reset = 0
+if #oldest > 0 then
+  reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, used, reset}
+`)
+
+// concurrencyScript 进行中任务计数，未超限时以任务编号占用一个名额，同一任务重复占用不重复计数
+// 返回 {是否允许, 占用的名额数}
+var concurrencyScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - ttl)
+local count = redis.call('ZCARD', key)
+if redis.call('ZSCORE', key, ARGV[4]) then
+  return {1, count}
+end
+if count >= limit then
+  return {0, count}
+end
+redis.call('ZADD', key, now, ARGV[4])
+redis.call('PEXPIRE', key, ttl)
+return {1, count + 1}
+`)
+
+// RateLimitResult 限流检查结果，Limit 为 0 表示不限制
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration // 窗口内最早的记录离开窗口前的时间
+	// Reservation 每分钟 token 数的预占记录，调用结束后由 RecordTokens 替换为实际用量
+	Reservation string
+}
+
+// RateLimitError 超出限流额度
+type RateLimitError struct {
+	Kind   string // requests / tokens / concurrency
+	Result *RateLimitResult
+}
+
+func (e *RateLimitError) Error() string {
+	switch e.Kind {
+	case RateLimitTokens:
+		return fmt.Sprintf("rate limit exceeded: %d tokens per minute", e.Result.Limit)
+	case RateLimitConcurrency:
+		return fmt.Sprintf("rate limit exceeded: %d tasks in progress", e.Result.Limit)
+	}
+	return fmt.Sprintf("rate limit exceeded: %d requests per minute", e.Result.Limit)
+}
+
+type RateLimitService struct{}
+
+func NewRateLimitService() *RateLimitService {
+	return &RateLimitService{}
+}
+
+// Enabled 是否启用限流
+func (s *RateLimitService) Enabled() bool {
+	return config.C.RateLimit.Enabled && cache.Client != nil
+}
+
+// Limits 令牌的限流额度：用户等级的配置（未配置时为默认值）是上限，令牌设置了更低的值时使用令牌的值
+func (s *RateLimitService) Limits(token *model.Token) config.RateLimits {
+	cfg := config.C.RateLimit
+	limits := cfg.Default
+
+	var user model.User
+	if token.UserID > 0 && model.DB().Select("tier").First(&user, token.UserID).Error == nil {
+		if tier, ok := cfg.Tiers[user.Tier]; ok {
+			limits = tier
+		}
+	}
+
+	limits.RPM = lowerLimit(limits.RPM, token.RateLimit)
+	limits.TPM = lowerLimit(limits.TPM, token.TPMLimit)
+	limits.Concurrency = lowerLimit(limits.Concurrency, token.ConcurrencyLimit)
+	return limits
+}
+
+// AllowRequest 检查每分钟请求数，未超限时计入本次请求
+func (s *RateLimitService) AllowRequest(ctx context.Context, tokenID uint, limit int) *RateLimitResult {
+	if limit <= 0 || !s.Enabled() {
+		return &RateLimitResult{Allowed: true}
+	}
+
+	now := time.Now().UnixMilli()
+	key := fmt.Sprintf("%s%d", rateLimitRequestsKey, tokenID)
+	values, err := requestWindowScript.Run(ctx, cache.Client, []string{key},
+		now, rateLimitWindow.Milliseconds(), limit, fmt.Sprintf("%d:%s", now, uuid.New().String()[:8])).Int64Slice()
+	if err != nil {
+		return rateLimitFailOpen(RateLimitRequests, tokenID, err)
+	}
+
+	return &RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     limit,
+		Remaining: max(limit-int(values[1]), 0),
+		Reset:     time.Duration(values[2]) * time.Millisecond,
+	}
+}
+
+// AllowTokens 检查每分钟 chat token 数，窗口内用量加上本次预估超过上限时拒绝
+// 未超限时预占本次预估的 token 数，调用结束后通过 RecordTokens 替换为实际用量
+func (s *RateLimitService) AllowTokens(ctx context.Context, tokenID uint, limit int, estimated int) *RateLimitResult {
+	if limit <= 0 || !s.Enabled() {
+		return &RateLimitResult{Allowed: true}
+	}
+
+	key := fmt.Sprintf("%s%d", rateLimitTokensKey, tokenID)
+	reservation := fmt.Sprintf("%d:%s", max(estimated, 0), uuid.New().String())
+	values, err := tokenWindowScript.Run(ctx, cache.Client, []string{key},
+		time.Now().UnixMilli(), rateLimitWindow.Milliseconds(), limit, max(estimated, 0), reservation).Int64Slice()
+	if err != nil {
+		return rateLimitFailOpen(RateLimitTokens, tokenID, err)
+	}
+
+	result := &RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     limit,
+		Remaining: max(limit-int(values[1]), 0),
+		Reset:     time.Duration(values[2]) * time.Millisecond,
+	}
+	if result.Allowed {
+		result.Reservation = reservation
+	}
+	return result
+}
+
+// RecordTokens 以一次 chat 调用的实际 token 用量替换预占记录，调用失败时 tokens 为 0 只释放预占
+func (s *RateLimitService) RecordTokens(ctx context.Context, tokenID uint, reservation string, tokens int) error {
+	if !s.Enabled() || (reservation == "" && tokens <= 0) {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s%d", rateLimitTokensKey, tokenID)
+	now := time.Now().UnixMilli()
+	pipe := cache.Client.TxPipeline()
+	if reservation != "" {
+		pipe.ZRem(ctx, key, reservation)
+	}
+	if tokens > 0 {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now), Member: fmt.Sprintf("%d:%s", tokens, uuid.New().String())})
+		pipe.PExpire(ctx, key, rateLimitWindow)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// AcquireTask 检查令牌进行中的任务数，未超限时为任务占用一个并发名额
+// 任务结束（成功、失败或取消）时通过 ReleaseTask 归还
+func (s *RateLimitService) AcquireTask(ctx context.Context, tokenID uint, taskNo string, limit int) *RateLimitResult {
+	if limit <= 0 || !s.Enabled() {
+		return &RateLimitResult{Allowed: true}
+	}
+
+	key := fmt.Sprintf("%s%d", rateLimitConcurrencyKey, tokenID)
+	values, err := concurrencyScript.Run(ctx, cache.Client, []string{key},
+		time.Now().UnixMilli(), taskSlotTTL.Milliseconds(), limit, taskNo).Int64Slice()
+	if err != nil {
+		return rateLimitFailOpen(RateLimitConcurrency, tokenID, err)
+	}
+
+	return &RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     limit,
+		Remaining: max(limit-int(values[1]), 0),
+	}
+}
+
+// ReleaseTask 归还任务占用的并发名额，未占用时不做处理
+func (s *RateLimitService) ReleaseTask(ctx context.Context, tokenID uint, taskNo string) {
+	if !s.Enabled() {
+		return
+	}
+	key := fmt.Sprintf("%s%d", rateLimitConcurrencyKey, tokenID)
+	if err := cache.Client.ZRem(ctx, key, taskNo).Err(); err != nil {
+		logger.Error("release task concurrency failed",
+			zap.Uint("token_id", tokenID),
+			zap.String("task_no", taskNo),
+			zap.Error(err))
+	}
+}
+
+// rateLimitFailOpen Redis 不可用时放行，记录错误日志便于发现限流失效
+func rateLimitFailOpen(kind string, tokenID uint, err error) *RateLimitResult {
+	logger.Error("rate limit unavailable, request allowed",
+		zap.String("kind", kind),
+		zap.Uint("token_id", tokenID),
+		zap.Error(err))
+	return &RateLimitResult{Allowed: true}
+}
+
+// lowerLimit 取较低的限制，0 表示不限制
+func lowerLimit(ceiling, value int) int {
+	if value <= 0 {
+		return ceiling
+	}
+	if ceiling <= 0 || value < ceiling {
+		return value
+	}
+	return ceiling
+}
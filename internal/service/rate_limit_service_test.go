@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/cache"
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// setupTestRedis 启用限流并使用内存 Redis
+func setupTestRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	cache.Client = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	config.C.RateLimit.Enabled = true
+	t.Cleanup(func() {
+		cache.Client.Close()
+		cache.Client = nil
+		config.C.RateLimit.Enabled = false
+	})
+	return mr
+}
+
+func TestAllowRequest(t *testing.T) {
+	setupTestRedis(t)
+	s := NewRateLimitService()
+	ctx := context.Background()
+
+	tests := []struct {
+		allowed   bool
+		remaining int
+	}{
+		{true, 1},
+		{true, 0},
+		{false, 0},
+	}
+	for i, tt := range tests {
+		got := s.AllowRequest(ctx, 1, 2)
+		if got.Allowed != tt.allowed || got.Remaining != tt.remaining || got.Limit != 2 {
+			t.Errorf("request %d = %+v, want allowed %v remaining %d", i, got, tt.allowed, tt.remaining)
+		}
+	}
+	if got := s.AllowRequest(ctx, 2, 2); !got.Allowed {
+		t.Error("other token should have its own window")
+	}
+	if got := s.AllowRequest(ctx, 1, 0); !got.Allowed || got.Limit != 0 {
+		t.Errorf("unlimited = %+v", got)
+	}
+}
+
+func TestAllowTokensReservesEstimate(t *testing.T) {
+	setupTestRedis(t)
+	s := NewRateLimitService()
+	ctx := context.Background()
+
+	first := s.AllowTokens(ctx, 1, 100, 60)
+	if !first.Allowed || first.Remaining != 40 || first.Reservation == "" {
+		t.Fatalf("first = %+v, want allowed with 40 remaining", first)
+	}
+	// 预占的 60 计入窗口，本次 50 超出上限
+	if second := s.AllowTokens(ctx, 1, 100, 50); second.Allowed || second.Reservation != "" {
+		t.Fatalf("second = %+v, want rejected", second)
+	}
+	// 实际只用了 20，替换预占后可以继续
+	if err := s.RecordTokens(ctx, 1, first.Reservation, 20); err != nil {
+		t.Fatalf("RecordTokens: %v", err)
+	}
+	third := s.AllowTokens(ctx, 1, 100, 50)
+	if !third.Allowed || third.Remaining != 30 {
+		t.Fatalf("third = %+v, want allowed with 30 remaining", third)
+	}
+	// 调用失败只释放预占
+	if err := s.RecordTokens(ctx, 1, third.Reservation, 0); err != nil {
+		t.Fatalf("RecordTokens: %v", err)
+	}
+	if got := s.AllowTokens(ctx, 1, 100, 80); !got.Allowed || got.Remaining != 0 {
+		t.Fatalf("after release = %+v, want allowed with 0 remaining", got)
+	}
+	if got := s.AllowTokens(ctx, 1, 100, 1); got.Allowed {
+		t.Fatalf("full window = %+v, want rejected", got)
+	}
+}
+
+func TestAcquireTask(t *testing.T) {
+	setupTestRedis(t)
+	s := NewRateLimitService()
+	ctx := context.Background()
+
+	steps := []struct {
+		name      string
+		acquire   string
+		release   string
+		allowed   bool
+		remaining int
+	}{
+		{name: "first", acquire: "T1", allowed: true, remaining: 1},
+		{name: "second", acquire: "T2", allowed: true, remaining: 0},
+		{name: "over limit", acquire: "T3", allowed: false, remaining: 0},
+		{name: "same task again", acquire: "T1", allowed: true, remaining: 0},
+		{name: "after release", release: "T1", acquire: "T3", allowed: true, remaining: 0},
+		{name: "release unknown", release: "T9", acquire: "T4", allowed: false, remaining: 0},
+	}
+	for _, step := range steps {
+		if step.release != "" {
+			s.ReleaseTask(ctx, 1, step.release)
+		}
+		got := s.AcquireTask(ctx, 1, step.acquire, 2)
+		if got.Allowed != step.allowed || got.Remaining != step.remaining {
+			t.Errorf("%s: got %+v, want allowed %v remaining %d", step.name, got, step.allowed, step.remaining)
+		}
+	}
+}
+
+func TestAcquireTaskConcurrent(t *testing.T) {
+	setupTestRedis(t)
+	s := NewRateLimitService()
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if s.AcquireTask(context.Background(), 1, GenerateTaskNo(), 5).Allowed {
+				allowed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if allowed.Load() != 5 {
+		t.Fatalf("allowed = %d, want 5", allowed.Load())
+	}
+}
+
+func TestFinishTaskReleasesConcurrency(t *testing.T) {
+	f := newCallbackFixture(t, `{}`)
+	setupTestRedis(t)
+	s := NewRateLimitService()
+	ctx := context.Background()
+
+	if got := s.AcquireTask(ctx, f.token.ID, f.task.TaskNo, 1); !got.Allowed {
+		t.Fatalf("acquire = %+v", got)
+	}
+	if got := s.AcquireTask(ctx, f.token.ID, "T2", 1); got.Allowed {
+		t.Fatalf("second task should be rejected while T1 runs")
+	}
+
+	NewCapabilityService().failTask(&f.task, "vendor error")
+	if got := s.AcquireTask(ctx, f.token.ID, "T2", 1); !got.Allowed {
+		t.Fatalf("slot not released after task finished: %+v", got)
+	}
+}
+
+func TestRateLimitFailOpen(t *testing.T) {
+	mr := setupTestRedis(t)
+	core, logs := observer.New(zap.ErrorLevel)
+	defer func(l *zap.Logger) { logger.L = l }(logger.L)
+	logger.L = zap.New(core)
+
+	mr.Close()
+	s := NewRateLimitService()
+	ctx := context.Background()
+	results := map[string]*RateLimitResult{
+		RateLimitRequests:    s.AllowRequest(ctx, 1, 1),
+		RateLimitTokens:      s.AllowTokens(ctx, 1, 1, 10),
+		RateLimitConcurrency: s.AcquireTask(ctx, 1, "T1", 1),
+	}
+	for kind, got := range results {
+		if !got.Allowed || got.Limit != 0 {
+			t.Errorf("%s = %+v, want allowed without limit", kind, got)
+		}
+	}
+	if n := logs.FilterMessage("rate limit unavailable, request allowed").Len(); n != 3 {
+		t.Errorf("fail-open logs = %d, want 3", n)
+	}
+}
+
+func TestRateLimitsLowerOfTierAndToken(t *testing.T) {
+	setupTestDB(t)
+	config.C.RateLimit = config.RateLimitConfig{
+		Default: config.RateLimits{RPM: 60, TPM: 10000, Concurrency: 5},
+		Tiers:   map[string]config.RateLimits{"pro": {RPM: 600}},
+	}
+	pro := model.User{Username: "pro", Tier: "pro"}
+	free := model.User{Username: "free"}
+	model.DB().Create(&pro)
+	model.DB().Create(&free)
+
+	tests := []struct {
+		name  string
+		token model.Token
+		want  config.RateLimits
+	}{
+		{name: "default tier", token: model.Token{UserID: free.ID}, want: config.RateLimits{RPM: 60, TPM: 10000, Concurrency: 5}},
+		{name: "token lower", token: model.Token{UserID: free.ID, RateLimit: 10, ConcurrencyLimit: 1}, want: config.RateLimits{RPM: 10, TPM: 10000, Concurrency: 1}},
+		{name: "token higher is capped", token: model.Token{UserID: free.ID, RateLimit: 1000}, want: config.RateLimits{RPM: 60, TPM: 10000, Concurrency: 5}},
+		{name: "tier unlimited tpm", token: model.Token{UserID: pro.ID, TPMLimit: 500}, want: config.RateLimits{RPM: 600, TPM: 500}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewRateLimitService().Limits(&tt.token); got != tt.want {
+				t.Errorf("Limits = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,15 +1,18 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
 	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/provider"
+	"github.com/majingzhen/prism/internal/provider/vendorauth"
+	"github.com/majingzhen/prism/pkg/httputil"
 	"github.com/majingzhen/prism/pkg/logger"
 	"go.uber.org/zap"
 )
@@ -20,9 +23,10 @@ func NewRequestLogService() *RequestLogService {
 	return &RequestLogService{}
 }
 
-// Log 异步写入请求日志
+// Log 异步写入请求日志，写入前去掉账号密钥
 func (s *RequestLogService) Log(log *model.ChannelRequestLog) {
 	go func() {
+		redactRequestLog(log)
 		if err := model.DB().Create(log).Error; err != nil {
 			logger.Error("save request log failed", zap.Error(err))
 		}
@@ -135,39 +139,30 @@ func (s *RequestLogService) RetryRequest(id uint) (*model.ChannelRequestLog, err
 		}
 	}
 
-	// 获取认证配置
-	authLocation, authKey, authValuePrefix := s.resolveAuthConfig(original)
-
 	// 还原原始请求头（排除旧的认证头）
 	headers := make(map[string]string)
 	if original.RequestHeaders != "" {
 		json.Unmarshal([]byte(original.RequestHeaders), &headers)
 	}
 
-	// 用最新的 APIKey 重新填充认证信息
+	// 用最新的账号密钥重新生成认证信息
 	reqURL := original.URL
 	requestBody := original.RequestBody
-	if account.APIKey != "" {
-		authValue := authValuePrefix + account.APIKey
-		switch authLocation {
-		case "header":
-			headers[authKey] = authValue
-		case "query":
-			sep := "?"
-			if strings.Contains(reqURL, "?") {
-				sep = "&"
-			}
-			reqURL = reqURL + sep + url.QueryEscape(authKey) + "=" + url.QueryEscape(account.APIKey)
-		case "body":
-			// 将认证信息注入到请求体 JSON 中
-			var bodyMap map[string]any
-			if json.Unmarshal([]byte(requestBody), &bodyMap) == nil {
-				bodyMap[authKey] = authValue
-				if bodyBytes, err := json.Marshal(bodyMap); err == nil {
-					requestBody = string(bodyBytes)
-				}
-			}
+	if original.AccountID > 0 {
+		auth, err := s.resolveAuth(original, &account)
+		if err != nil {
+			return nil, err
+		}
+		authReq := &httputil.Request{
+			Method:  original.Method,
+			URL:     reqURL,
+			Headers: headers,
+			Body:    []byte(requestBody),
 		}
+		if err := auth.Apply(context.Background(), authReq); err != nil {
+			return nil, err
+		}
+		reqURL, headers, requestBody = authReq.URL, authReq.Headers, string(authReq.Body)
 	}
 
 	// 序列化新的请求头用于日志记录
@@ -220,6 +215,7 @@ func (s *RequestLogService) RetryRequest(id uint) (*model.ChannelRequestLog, err
 		newLog.ResponseBody = string(respBody)
 	}
 
+	redactRequestLog(newLog)
 	if err := model.DB().Create(newLog).Error; err != nil {
 		logger.Error("save retry request log failed", zap.Error(err))
 		return nil, err
@@ -228,32 +224,25 @@ func (s *RequestLogService) RetryRequest(id uint) (*model.ChannelRequestLog, err
 	return s.GetRequestLog(newLog.ID)
 }
 
-// resolveAuthConfig 根据请求类型解析认证配置
-func (s *RequestLogService) resolveAuthConfig(log *model.ChannelRequestLog) (location, key, valuePrefix string) {
+// resolveAuth 根据请求类型解析认证策略，渠道配置了认证策略时优先使用
+func (s *RequestLogService) resolveAuth(log *model.ChannelRequestLog, account *model.ChannelAccount) (vendorauth.Authenticator, error) {
 	// Chat 请求默认使用 Bearer Token
-	if log.RequestType == model.RequestTypeChat {
-		return "header", "Authorization", "Bearer "
-	}
+	fallback := vendorauth.Static("header", "Authorization", "Bearer ")
 
 	// 能力请求从 ChannelCapability 读取认证配置
-	if log.ChannelID > 0 && log.CapabilityCode != "" {
+	if log.RequestType != model.RequestTypeChat && log.ChannelID > 0 && log.CapabilityCode != "" {
 		var cc model.ChannelCapability
 		err := model.DB().
 			Where("channel_id = ? AND capability_code = ?", log.ChannelID, log.CapabilityCode).
 			First(&cc).Error
 		if err == nil {
-			loc := cc.AuthLocation
-			if loc == "" {
-				loc = "header"
-			}
-			k := cc.AuthKey
-			if k == "" {
-				k = "Authorization"
-			}
-			return loc, k, cc.AuthValuePrefix
+			fallback = provider.StaticAuthConfig(&cc)
 		}
 	}
 
-	// 默认 Bearer Header 认证
-	return "header", "Authorization", "Bearer "
+	var channel model.Channel
+	if log.ChannelID > 0 && model.DB().First(&channel, log.ChannelID).Error == nil {
+		return vendorauth.Resolve(&channel, account, fallback)
+	}
+	return vendorauth.New(fallback, account)
 }
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+
+	"github.com/majingzhen/prism/internal/provider"
 )
 
 // ResponseMapping 响应映射配置
@@ -14,6 +16,7 @@ type ResponseMapping struct {
 	TypeConvert      map[string]TypeConversion    `json:"type_convert"`
 	ArrayHandling    map[string]ArrayMapping      `json:"array_handling"`
 	SuccessCondition *SuccessCondition            `json:"success_condition"`
+	Usage            *provider.UsageMapping       `json:"usage"` // 实际用量，映射到结果的 usage 字段用于结算
 }
 
 // SuccessCondition 成功条件配置
@@ -95,6 +98,16 @@ func (m *ResponseMapper) Map(vendorResponse map[string]any, mappingConfig []byte
 		}
 	}
 
+	// 实际用量，值为数组时取数组长度
+	if mapping.Usage != nil && mapping.Usage.Path != "" {
+		if value := m.getValueByPath(vendorResponse, mapping.Usage.Path); value != nil {
+			if arr, ok := value.([]any); ok {
+				value = len(arr)
+			}
+			result["usage"] = value
+		}
+	}
+
 	return result, nil
 }
 
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/internal/provider"
+	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/majingzhen/prism/pkg/money"
+	"go.uber.org/zap"
+)
+
+// PriceSettlement 按实际用量结算的结果
+type PriceSettlement struct {
+	Quantity   json.Number `json:"quantity"`
+	Estimated  money.Money `json:"estimated"`       // 预扣金额
+	Actual     money.Money `json:"actual"`          // 实际金额
+	Difference money.Money `json:"difference"`      // 补扣为正，退回为负
+	Error      string      `json:"error,omitempty"` // 补扣失败时按预扣金额计费
+	SettledAt  time.Time   `json:"settled_at"`
+}
+
+// SettleTaskUsage 按实际用量结算任务费用，与预扣金额的差额补扣或退回，返回任务最终费用
+// 未配置用量映射或响应中没有用量时不结算；同一任务只结算一次；补扣时余额不足则保留预扣金额
+func (s *BillingService) SettleTaskUsage(task *model.Task, cc *model.ChannelCapability, quantity string) money.Money {
+	usage := usageMapping(cc)
+	if usage == nil || quantity == "" || (usage.UnitPrice == 0 && usage.Param == "") {
+		return task.Cost
+	}
+
+	q, err := parseRat(quantity)
+	if err != nil || q.Sign() < 0 {
+		logger.Warn("invalid task usage", zap.String("task_no", task.TaskNo), zap.String("usage", quantity))
+		return task.Cost
+	}
+	actual, err := usageCost(task, cc, usage, q)
+	if err != nil {
+		logger.Warn("calculate usage cost failed", zap.String("task_no", task.TaskNo), zap.Error(err))
+		return task.Cost
+	}
+
+	// 占用结算标记，重复完成的任务不再结算
+	now := time.Now()
+	result := model.DB().Model(&model.Task{}).Where("id = ? AND settled_at IS NULL", task.ID).Update("settled_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		var cost money.Money
+		model.DB().Model(&model.Task{}).Where("id = ?", task.ID).Select("cost").Scan(&cost)
+		return cost
+	}
+
+	settlement := &PriceSettlement{
+		Quantity:   json.Number(formatRat(q)),
+		Estimated:  task.Cost,
+		Actual:     actual,
+		Difference: actual - task.Cost,
+		SettledAt:  now,
+	}
+	ref := TaskRef(task)
+	ref.Remark = "usage settlement"
+	switch {
+	case settlement.Difference > 0:
+		err = s.DeductUsage(task.TokenID, task.UserID, settlement.Difference, ref)
+	case settlement.Difference < 0:
+		err = s.Refund(task.TokenID, task.UserID, -settlement.Difference, ref)
+	}
+	if err != nil {
+		logger.Error("settle task usage failed",
+			zap.String("task_no", task.TaskNo),
+			zap.Stringer("difference", settlement.Difference),
+			zap.Error(err))
+		settlement.Error = err.Error()
+		settlement.Actual = task.Cost
+		settlement.Difference = 0
+	}
+
+	var breakdown PriceBreakdown
+	if len(task.PriceDetail) == 0 || json.Unmarshal(task.PriceDetail, &breakdown) != nil {
+		breakdown = PriceBreakdown{Base: task.Cost, Total: task.Cost}
+	}
+	breakdown.Settlement = settlement
+	task.Cost = settlement.Actual
+	task.PriceDetail, _ = json.Marshal(breakdown)
+	model.DB().Model(&model.Task{}).Where("id = ?", task.ID).Updates(map[string]any{
+		"cost":         task.Cost,
+		"price_detail": task.PriceDetail,
+	})
+
+	logger.Info("task usage settled",
+		zap.String("task_no", task.TaskNo),
+		zap.String("usage", quantity),
+		zap.Stringer("estimated", settlement.Estimated),
+		zap.Stringer("actual", settlement.Actual))
+	return task.Cost
+}
+
+// usageCost 实际用量对应的价格，配置了单价时按单价计算，否则替换计价参数后按计价规则重新计算
+func usageCost(task *model.Task, cc *model.ChannelCapability, usage *provider.UsageMapping, quantity *big.Rat) (money.Money, error) {
+	if usage.UnitPrice != 0 {
+		return usage.UnitPrice.MulRat(quantity)
+	}
+
+	var params map[string]any
+	json.Unmarshal(task.RequestParams, &params)
+	if params == nil {
+		params = make(map[string]any)
+	}
+	params[usage.Param] = formatRat(quantity)
+
+	breakdown, err := CalculatePrice(cc, params)
+	if err != nil {
+		return 0, fmt.Errorf("usage pricing: %w", err)
+	}
+	return breakdown.Total, nil
+}
+
+// usageMapping 渠道能力配置的用量映射，依次查找响应、轮询响应和回调映射
+func usageMapping(cc *model.ChannelCapability) *provider.UsageMapping {
+	for _, data := range [][]byte{cc.ResponseMapping, cc.PollResponseMapping, cc.CallbackMapping} {
+		var mapping struct {
+			Usage *provider.UsageMapping `json:"usage"`
+		}
+		if len(data) > 0 && json.Unmarshal(data, &mapping) == nil && mapping.Usage != nil {
+			return mapping.Usage
+		}
+	}
+	return nil
+}
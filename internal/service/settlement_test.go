@@ -0,0 +1,96 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/money"
+	"gorm.io/datatypes"
+)
+
+func TestSettleTaskUsage(t *testing.T) {
+	const (
+		unitPrice = `{"usage":{"path":"usage.seconds","unit_price":0.5}}`
+		byParam   = `{"usage":{"path":"usage.seconds","param":"duration"}}`
+	)
+	tests := []struct {
+		name           string
+		balance        money.Money
+		mapping        string
+		rules          string
+		params         string
+		quantity       string
+		wantCost       money.Money
+		wantBalance    money.Money
+		wantSettlement bool
+		wantErr        bool
+	}{
+		{name: "no mapping", balance: 10 * money.Unit, quantity: "12", wantCost: 4 * money.Unit, wantBalance: 6 * money.Unit},
+		{name: "no usage", balance: 10 * money.Unit, mapping: unitPrice, wantCost: 4 * money.Unit, wantBalance: 6 * money.Unit},
+		{name: "invalid usage", balance: 10 * money.Unit, mapping: unitPrice, quantity: "-1", wantCost: 4 * money.Unit, wantBalance: 6 * money.Unit},
+		{name: "equal", balance: 10 * money.Unit, mapping: unitPrice, quantity: "8", wantCost: 4 * money.Unit, wantBalance: 6 * money.Unit, wantSettlement: true},
+		{name: "top up", balance: 10 * money.Unit, mapping: unitPrice, quantity: "12", wantCost: 6 * money.Unit, wantBalance: 4 * money.Unit, wantSettlement: true},
+		{name: "refund", balance: 10 * money.Unit, mapping: unitPrice, quantity: "3", wantCost: 1_500_000, wantBalance: 8_500_000, wantSettlement: true},
+		{name: "by pricing param", balance: 10 * money.Unit, mapping: byParam, rules: `[{"param":"duration","type":"per_unit","unit":5}]`, params: `{"duration":10}`, quantity: "7.5", wantCost: 3 * money.Unit, wantBalance: 7 * money.Unit, wantSettlement: true},
+		// 补扣失败时按预扣金额计费
+		{name: "top up insufficient", balance: 5 * money.Unit, mapping: unitPrice, quantity: "20", wantCost: 4 * money.Unit, wantBalance: money.Unit, wantSettlement: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user, token := newWallet(t, tt.balance, 0)
+			cc := &model.ChannelCapability{Price: 2 * money.Unit}
+			if tt.mapping != "" {
+				cc.ResponseMapping = datatypes.JSON(tt.mapping)
+			}
+			if tt.rules != "" {
+				cc.PricingRules = datatypes.JSON(tt.rules)
+			}
+			task := &model.Task{TaskNo: "T1", UserID: user.ID, TokenID: token.ID, Cost: 4 * money.Unit}
+			if tt.params != "" {
+				task.RequestParams = datatypes.JSON(tt.params)
+			}
+			s := NewBillingService()
+			if err := s.CreateChargedTask(task); err != nil {
+				t.Fatalf("CreateChargedTask: %v", err)
+			}
+
+			if got := s.SettleTaskUsage(task, cc, tt.quantity); got != tt.wantCost {
+				t.Fatalf("SettleTaskUsage = %s, want %s", got, tt.wantCost)
+			}
+			// 重复完成的任务不再结算
+			if got := s.SettleTaskUsage(task, cc, tt.quantity); got != tt.wantCost {
+				t.Fatalf("second SettleTaskUsage = %s, want %s", got, tt.wantCost)
+			}
+
+			var saved model.Task
+			model.DB().First(&saved, task.ID)
+			if saved.Cost != tt.wantCost || (saved.SettledAt != nil) != tt.wantSettlement {
+				t.Errorf("task cost = %s, settled_at = %v", saved.Cost, saved.SettledAt)
+			}
+			var u model.User
+			model.DB().First(&u, user.ID)
+			if u.Balance != tt.wantBalance {
+				t.Errorf("balance = %s, want %s", u.Balance, tt.wantBalance)
+			}
+
+			var breakdown PriceBreakdown
+			json.Unmarshal(saved.PriceDetail, &breakdown)
+			if (breakdown.Settlement != nil) != tt.wantSettlement {
+				t.Fatalf("settlement = %+v, want present %v", breakdown.Settlement, tt.wantSettlement)
+			}
+			if tt.wantSettlement {
+				st := breakdown.Settlement
+				if st.Estimated != 4*money.Unit || st.Actual != tt.wantCost || st.Difference != tt.wantCost-4*money.Unit || (st.Error != "") != tt.wantErr {
+					t.Errorf("settlement = %+v", st)
+				}
+			}
+
+			mismatches, err := s.Reconcile()
+			if err != nil || len(mismatches) != 0 {
+				t.Errorf("Reconcile = %v, %v", mismatches, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,15 +10,19 @@ import (
 	"github.com/google/uuid"
 	"github.com/majingzhen/prism/internal/model"
 	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/majingzhen/prism/pkg/money"
+	"github.com/majingzhen/prism/pkg/storage"
 	"go.uber.org/zap"
 )
 
 var (
 	ErrTaskNotFound = errors.New("task not found")
 	billingService  = NewBillingService()
+	webhookService  = NewWebhookService()
 )
 
 type CreateTaskRequest struct {
+	TaskNo              string // 为空时自动生成
 	UserID              uint
 	TokenID             uint
 	CapabilityCode      string
@@ -27,7 +32,8 @@ type CreateTaskRequest struct {
 	RequestParams       map[string]any
 	MappedParams        map[string]any
 	CallbackURL         string
-	Cost                float64
+	Cost                money.Money
+	PriceDetail         *PriceBreakdown
 }
 
 type TaskService struct{}
@@ -41,12 +47,18 @@ func GenerateTaskNo() string {
 	return fmt.Sprintf("task_%d_%s", time.Now().UnixMilli(), uuid.New().String()[:8])
 }
 
+// CreateTask 创建任务并预扣 Cost，扣费失败时任务不会创建
 func (s *TaskService) CreateTask(req *CreateTaskRequest) (*model.Task, error) {
 	requestParamsJSON, _ := json.Marshal(req.RequestParams)
 	mappedParamsJSON, _ := json.Marshal(req.MappedParams)
+	priceDetailJSON, _ := json.Marshal(req.PriceDetail)
+	taskNo := req.TaskNo
+	if taskNo == "" {
+		taskNo = GenerateTaskNo()
+	}
 
 	task := &model.Task{
-		TaskNo:              GenerateTaskNo(),
+		TaskNo:              taskNo,
 		UserID:              req.UserID,
 		TokenID:             req.TokenID,
 		CapabilityCode:      req.CapabilityCode,
@@ -57,10 +69,13 @@ func (s *TaskService) CreateTask(req *CreateTaskRequest) (*model.Task, error) {
 		MappedParams:        mappedParamsJSON,
 		Status:              model.TaskStatusPending,
 		CallbackURL:         req.CallbackURL,
+		CallbackToken:       GenerateCallbackToken(),
 		Cost:                req.Cost,
+		PriceDetail:         priceDetailJSON,
 	}
 
-	if err := model.DB().Create(task).Error; err != nil {
+	// 任务和预扣费流水在同一个事务中写入
+	if err := billingService.CreateChargedTask(task); err != nil {
 		return nil, err
 	}
 
@@ -125,7 +140,13 @@ func (s *TaskService) UpdateTaskStatus(taskID uint, status model.TaskStatus, ven
 		zap.String("status", string(status)),
 		zap.String("vendor_task_id", vendorTaskID))
 
-	return model.DB().Model(&model.Task{}).Where("id = ?", taskID).Updates(updates).Error
+	if err := model.DB().Model(&model.Task{}).Where("id = ?", taskID).Updates(updates).Error; err != nil {
+		return err
+	}
+	if status == model.TaskStatusProcessing {
+		webhookService.EmitByID(taskID, model.WebhookEventTaskStarted, nil)
+	}
+	return nil
 }
 
 func (s *TaskService) UpdateTaskProgress(taskID uint, progress int) error {
@@ -133,23 +154,63 @@ func (s *TaskService) UpdateTaskProgress(taskID uint, progress int) error {
 		zap.Uint("task_id", taskID),
 		zap.Int("progress", progress))
 
-	return model.DB().Model(&model.Task{}).Where("id = ?", taskID).
-		Update("progress", progress).Error
+	if err := model.DB().Model(&model.Task{}).Where("id = ?", taskID).
+		Update("progress", progress).Error; err != nil {
+		return err
+	}
+	webhookService.EmitByID(taskID, model.WebhookEventTaskProgress, map[string]any{"progress": progress})
+	return nil
 }
 
-func (s *TaskService) UpdateTaskSuccess(taskID uint, result map[string]any, cost float64) error {
+// UpdateTaskSuccess 把转存后的结果写入任务，占用成功终态后才发送资源通知并按实际用量结算
+// 任务已被超时检查、回调等其他路径结束时删除本次转存的资源并返回 false，调用方据此决定是否归还账号并发
+func (s *TaskService) UpdateTaskSuccess(taskID uint, result map[string]any, usage string) (bool, error) {
 	resultJSON, _ := json.Marshal(result)
 	now := time.Now()
 
-	logger.Info("task succeeded", zap.Uint("task_id", taskID))
+	var task model.Task
+	if err := model.DB().First(&task, taskID).Error; err != nil {
+		return false, ErrTaskNotFound
+	}
 
-	return model.DB().Model(&model.Task{}).Where("id = ?", taskID).Updates(map[string]any{
+	updates := map[string]any{
 		"status":       model.TaskStatusSuccess,
 		"progress":     100,
 		"result":       resultJSON,
-		"cost":         cost,
 		"completed_at": now,
-	}).Error
+	}
+	// 记录存储用量和资源过期时间
+	for k, v := range NewAssetService().RetentionUpdates(task.CapabilityCode, task.UserID, result) {
+		updates[k] = v
+	}
+
+	claimed, err := claimTaskFinish(&task, updates)
+	if err != nil || !claimed {
+		// 结果未写入任务，删除本次转存的资源
+		logger.Warn("task already finished, skip completion", zap.Uint("task_id", taskID), zap.Error(err))
+		for _, key := range collectResultKeys(result) {
+			storage.Delete(context.Background(), key)
+		}
+		return false, err
+	}
+	logger.Info("task succeeded", zap.Uint("task_id", taskID))
+	task.Status = model.TaskStatusSuccess
+	task.Progress = 100
+	task.Result = resultJSON
+	task.CompletedAt = &now
+
+	webhookService.EmitAssets(&task, result)
+
+	// 按实际用量结算预扣的费用
+	if usage != "" {
+		var cc model.ChannelCapability
+		if err := model.DB().First(&cc, task.ChannelCapabilityID).Error; err == nil {
+			billingService.SettleTaskUsage(&task, &cc, usage)
+		}
+	}
+
+	webhookService.Emit(&task, model.WebhookEventTaskSucceeded, nil)
+	return true, nil
 }
 
 func (s *TaskService) UpdateTaskFail(taskID uint, errMsg string) error {
@@ -164,26 +225,31 @@ func (s *TaskService) UpdateTaskFail(taskID uint, errMsg string) error {
 		return ErrTaskNotFound
 	}
 
-	updates := map[string]any{
+	// 占用终态和退款在同一事务中写入，已结束的任务不再重复退款和通知
+	// 退款失败时整体回滚，任务保持进行中，由超时检查再次结束
+	claimed, err := billingService.claimTaskFailure(&task, map[string]any{
 		"status":        model.TaskStatusFailed,
 		"error_message": errMsg,
 		"completed_at":  now,
+	})
+	if err != nil {
+		logger.Error("fail task failed",
+			zap.Uint("task_id", task.ID),
+			zap.Uint("token_id", task.TokenID),
+			zap.Uint("user_id", task.UserID),
+			zap.Stringer("cost", task.Cost),
+			zap.Error(err))
+		return err
 	}
-
-	if task.Cost > 0 && !task.Refunded {
-		if err := billingService.Refund(task.TokenID, task.UserID, task.Cost); err != nil {
-			logger.Error("refund failed",
-				zap.Uint("task_id", task.ID),
-				zap.Uint("token_id", task.TokenID),
-				zap.Uint("user_id", task.UserID),
-				zap.Float64("cost", task.Cost),
-				zap.Error(err))
-		} else {
-			updates["refunded"] = true
-		}
+	if !claimed {
+		return nil
 	}
+	task.Status = model.TaskStatusFailed
+	task.ErrorMessage = errMsg
+	task.CompletedAt = &now
 
-	return model.DB().Model(&model.Task{}).Where("id = ?", taskID).Updates(updates).Error
+	webhookService.Emit(&task, model.WebhookEventTaskFailed, nil)
+	return nil
 }
 
 func (s *TaskService) UpdateVendorResponse(taskID uint, resp json.RawMessage) error {
@@ -193,13 +259,21 @@ func (s *TaskService) UpdateVendorResponse(taskID uint, resp json.RawMessage) er
 
 func (s *TaskService) CancelTask(taskNo string, userID uint) error {
 	result := model.DB().Model(&model.Task{}).
-		Where("task_no = ? AND user_id = ? AND status IN ?", taskNo, userID,
-			[]model.TaskStatus{model.TaskStatusPending, model.TaskStatusProcessing}).
+		Where("task_no = ? AND user_id = ? AND status IN ?", taskNo, userID, activeTaskStatuses).
 		Update("status", model.TaskStatusCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
 	if result.RowsAffected == 0 {
 		return errors.New("task not found or cannot be cancelled")
 	}
-	return result.Error
+
+	// 归还并发名额
+	var task model.Task
+	if err := model.DB().Select("token_id").Where("task_no = ?", taskNo).First(&task).Error; err == nil {
+		NewRateLimitService().ReleaseTask(context.Background(), task.TokenID, taskNo)
+	}
+	return nil
 }
 
 func (s *TaskService) UpdateCallbackStatus(taskID uint, status string, attempts int) error {
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/cache"
+	"github.com/majingzhen/prism/pkg/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyPrefix       = "sk-prism-"
+	apiKeyVisibleChars = 4 // 前缀之后保留明文的字符数，用于在控制台区分令牌
+
+	tokenKeyCachePrefix = "token:key:"
+	tokenKeyCacheTTL    = 5 * time.Minute
+)
+
+var ErrInvalidAPIKey = errors.New("invalid or disabled api key")
+
+// TokenKeyService API 密钥只保存 SHA-256 摘要和可见前缀，完整密钥仅在创建时返回一次
+type TokenKeyService struct{}
+
+func NewTokenKeyService() *TokenKeyService {
+	return &TokenKeyService{}
+}
+
+// Generate 生成新的 API 密钥，返回完整密钥、摘要和可见前缀
+func (s *TokenKeyService) Generate() (key, hash, prefix string) {
+	b := make([]byte, 24)
+	rand.Read(b)
+	key = apiKeyPrefix + hex.EncodeToString(b)
+	return key, HashAPIKey(key), visibleKeyPrefix(key)
+}
+
+// Authenticate 按密钥摘要查找启用中的令牌，优先读取 Redis 缓存
+func (s *TokenKeyService) Authenticate(ctx context.Context, key string) (*model.Token, error) {
+	hash := HashAPIKey(key)
+	if token := s.cached(ctx, hash); token != nil {
+		return token, nil
+	}
+
+	var token model.Token
+	if err := model.DB().Where("key_hash = ? AND status = 1", hash).First(&token).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	s.store(ctx, &token)
+	return &token, nil
+}
+
+// Invalidate 令牌修改或删除后清除缓存
+func (s *TokenKeyService) Invalidate(ctx context.Context, keyHash string) {
+	if cache.Client == nil || keyHash == "" {
+		return
+	}
+	if err := cache.Client.Del(ctx, tokenKeyCachePrefix+keyHash).Err(); err != nil {
+		logger.Warn("invalidate token cache failed", zap.Error(err))
+	}
+}
+
+// MigrateKeys 将明文保存的旧密钥转为摘要和可见前缀，完成后删除明文列
+func (s *TokenKeyService) MigrateKeys() error {
+	migrator := model.DB().Migrator()
+	if !migrator.HasColumn(&model.Token{}, "key") {
+		return nil
+	}
+
+	var rows []struct {
+		ID  uint
+		Key string
+	}
+	if err := model.DB().Unscoped().Table("tokens").Select("id", "`key`").
+		Where("key_hash IS NULL OR key_hash = ''").Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	err := model.DB().Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			if err := tx.Unscoped().Model(&model.Token{}).Where("id = ?", row.ID).Updates(map[string]any{
+				"key_hash":   HashAPIKey(row.Key),
+				"key_prefix": visibleKeyPrefix(row.Key),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := migrator.DropColumn(&model.Token{}, "key"); err != nil {
+		return err
+	}
+	logger.Info("token keys hashed", zap.Int("tokens", len(rows)))
+	return nil
+}
+
+func (s *TokenKeyService) cached(ctx context.Context, hash string) *model.Token {
+	if cache.Client == nil {
+		return nil
+	}
+	data, err := cache.Client.Get(ctx, tokenKeyCachePrefix+hash).Bytes()
+	if err != nil {
+		return nil
+	}
+	var token model.Token
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&token); err != nil {
+		return nil
+	}
+	return &token
+}
+
+// store 缓存令牌，使用 gob 编码以保留 json:"-" 的字段
+func (s *TokenKeyService) store(ctx context.Context, token *model.Token) {
+	if cache.Client == nil {
+		return
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(token); err != nil {
+		return
+	}
+	cache.Client.Set(ctx, tokenKeyCachePrefix+token.KeyHash, buf.Bytes(), tokenKeyCacheTTL)
+}
+
+// HashAPIKey API 密钥的 SHA-256 十六进制摘要
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// visibleKeyPrefix 密钥的可见前缀，如 sk-prism-1a2b
+func visibleKeyPrefix(key string) string {
+	n := apiKeyVisibleChars
+	if strings.HasPrefix(key, apiKeyPrefix) {
+		n += len(apiKeyPrefix)
+	}
+	return key[:min(n, len(key))]
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/majingzhen/prism/internal/model"
+)
+
+func TestHashAPIKey(t *testing.T) {
+	tests := []struct {
+		key        string
+		wantHash   string
+		wantPrefix string
+	}{
+		{key: "sk-prism-test", wantHash: "f9cffa10217d99f4c164a61e526b6cf98440209b240987ab991054f428635194", wantPrefix: "sk-prism-test"},
+		{key: "sk-prism-0123456789abcdef", wantPrefix: "sk-prism-0123"},
+		{key: "legacy-key-abc", wantPrefix: "lega"}, // 旧格式密钥只保留前几位
+		{key: "ab", wantPrefix: "ab"},
+		{key: "", wantPrefix: ""},
+	}
+	for _, tt := range tests {
+		hash := HashAPIKey(tt.key)
+		if len(hash) != 64 || (tt.wantHash != "" && hash != tt.wantHash) {
+			t.Errorf("HashAPIKey(%q) = %s, want %s", tt.key, hash, tt.wantHash)
+		}
+		if got := visibleKeyPrefix(tt.key); got != tt.wantPrefix {
+			t.Errorf("visibleKeyPrefix(%q) = %q, want %q", tt.key, got, tt.wantPrefix)
+		}
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	s := NewTokenKeyService()
+	key, hash, prefix := s.Generate()
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(key) != len(apiKeyPrefix)+48 {
+		t.Fatalf("key = %q", key)
+	}
+	if hash != HashAPIKey(key) || strings.Contains(hash, key[len(apiKeyPrefix):]) {
+		t.Errorf("hash = %q", hash)
+	}
+	if prefix != key[:len(apiKeyPrefix)+apiKeyVisibleChars] {
+		t.Errorf("prefix = %q", prefix)
+	}
+	if other, _, _ := s.Generate(); other == key {
+		t.Error("generated keys should differ")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		deleted bool
+		key     string
+		wantErr bool
+	}{
+		{name: "valid", status: 1},
+		{name: "wrong key", status: 1, key: "sk-prism-wrong", wantErr: true},
+		{name: "disabled", status: 0, wantErr: true},
+		{name: "deleted", status: 1, deleted: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			s := NewTokenKeyService()
+			key, hash, prefix := s.Generate()
+			token := model.Token{UserID: 1, KeyHash: hash, KeyPrefix: prefix, Status: 1}
+			model.DB().Create(&token)
+			model.DB().Model(&token).Update("status", tt.status)
+			if tt.deleted {
+				model.DB().Delete(&token)
+			}
+			if tt.key != "" {
+				key = tt.key
+			}
+
+			got, err := s.Authenticate(context.Background(), key)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAPIKey) {
+					t.Fatalf("err = %v, want ErrInvalidAPIKey", err)
+				}
+				return
+			}
+			if err != nil || got.ID != token.ID {
+				t.Fatalf("Authenticate = %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateCache(t *testing.T) {
+	setupTestDB(t)
+	mr := setupTestRedis(t)
+	s := NewTokenKeyService()
+	key, hash, prefix := s.Generate()
+	token := model.Token{UserID: 1, KeyHash: hash, KeyPrefix: prefix, WebhookSecret: "whsec_1", Status: 1}
+	model.DB().Create(&token)
+
+	if _, err := s.Authenticate(context.Background(), key); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	// 缓存键只包含摘要，不包含明文密钥
+	if !mr.Exists(tokenKeyCachePrefix+hash) || strings.Contains(strings.Join(mr.Keys(), ","), key) {
+		t.Fatalf("cache keys = %v", mr.Keys())
+	}
+
+	// 命中缓存时保留 json:"-" 的字段
+	model.DB().Model(&token).Update("status", 0)
+	got, err := s.Authenticate(context.Background(), key)
+	if err != nil || got.WebhookSecret != "whsec_1" || got.KeyHash != hash {
+		t.Fatalf("cached Authenticate = %+v, %v", got, err)
+	}
+
+	s.Invalidate(context.Background(), hash)
+	if _, err := s.Authenticate(context.Background(), key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("err after invalidate = %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	setupTestDB(t)
+	s := NewTokenKeyService()
+
+	// 升级前的明文密钥列；SQLite 删除列时按带引号的列名重建表
+	if err := model.DB().Exec("ALTER TABLE tokens ADD COLUMN `key` varchar(64)").Error; err != nil {
+		t.Fatalf("add legacy key column: %v", err)
+	}
+	tests := []struct {
+		name       string
+		key        string
+		wantPrefix string
+	}{
+		{name: "current format", key: "sk-prism-0123456789abcdef", wantPrefix: "sk-prism-0123"},
+		{name: "legacy format", key: "sk-legacy-abcdef", wantPrefix: "sk-l"},
+	}
+	tokens := make([]model.Token, len(tests))
+	for i, tt := range tests {
+		tokens[i] = model.Token{UserID: 1, KeyHash: tt.name, Status: 1}
+		model.DB().Create(&tokens[i])
+		model.DB().Exec("UPDATE tokens SET `key` = ?, key_hash = NULL WHERE id = ?", tt.key, tokens[i].ID)
+	}
+	// 已删除的令牌也需要迁移，否则唯一索引上残留空摘要
+	model.DB().Delete(&tokens[1])
+
+	if err := s.MigrateKeys(); err != nil {
+		t.Fatalf("MigrateKeys: %v", err)
+	}
+	// SQLite 的 HasColumn 按建表语句模糊匹配，"key" 会命中 PRIMARY KEY，这里直接查表结构
+	var columns int64
+	model.DB().Raw("SELECT COUNT(*) FROM pragma_table_info('tokens') WHERE name = 'key'").Scan(&columns)
+	if columns != 0 {
+		t.Error("plaintext key column should be dropped")
+	}
+	for i, tt := range tests {
+		var got model.Token
+		model.DB().Unscoped().First(&got, tokens[i].ID)
+		if got.KeyHash != HashAPIKey(tt.key) || got.KeyPrefix != tt.wantPrefix {
+			t.Errorf("%s: key hash/prefix = %s/%s, want %s", tt.name, got.KeyHash, got.KeyPrefix, tt.wantPrefix)
+		}
+	}
+	if token, err := s.Authenticate(context.Background(), tests[0].key); err != nil || token.ID != tokens[0].ID {
+		t.Errorf("Authenticate migrated key = %+v, %v", token, err)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTokenNotFound        = errors.New("token not found")
+	ErrTokenExpired         = errors.New("token expired")
+	ErrTokenReadOnly        = errors.New("token is read-only")
+	ErrIPNotAllowed         = errors.New("client ip not allowed for this token")
+	ErrCapabilityNotAllowed = errors.New("capability not allowed for this token")
+	ErrModelNotAllowed      = errors.New("model not allowed for this token")
+	ErrSpendLimitExceeded   = errors.New("token spend limit exceeded")
+)
+
+// TokenPolicyService 令牌使用限制：过期时间、来源 IP、只读、能力和模型范围，消费上限在扣费事务中检查
+type TokenPolicyService struct{}
+
+func NewTokenPolicyService() *TokenPolicyService {
+	return &TokenPolicyService{}
+}
+
+// Load 获取启用中的令牌
+func (s *TokenPolicyService) Load(tokenID uint) (*model.Token, error) {
+	var token model.Token
+	if err := model.DB().Where("id = ? AND status = 1", tokenID).First(&token).Error; err != nil {
+		return nil, ErrTokenNotFound
+	}
+	return &token, nil
+}
+
+// CheckAccess 检查令牌是否过期、来源 IP 是否在白名单内，只读令牌只允许查询请求
+func (s *TokenPolicyService) CheckAccess(token *model.Token, clientIP string, readOnly bool) error {
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return ErrTokenExpired
+	}
+	if allowed := ParseStringList(token.AllowedIPs); len(allowed) > 0 && !ipAllowed(clientIP, allowed) {
+		return fmt.Errorf("%w: %s", ErrIPNotAllowed, clientIP)
+	}
+	if token.ReadOnly && !readOnly {
+		return ErrTokenReadOnly
+	}
+	return nil
+}
+
+// CheckCapability 检查令牌是否允许调用能力，未配置范围时不限制
+func (s *TokenPolicyService) CheckCapability(token *model.Token, code string) error {
+	if token.ReadOnly {
+		return ErrTokenReadOnly
+	}
+	if allowed := ParseStringList(token.AllowedCapabilities); len(allowed) > 0 && !slices.Contains(allowed, code) {
+		return fmt.Errorf("%w: %s", ErrCapabilityNotAllowed, code)
+	}
+	return nil
+}
+
+// CheckModel 检查令牌是否允许调用 chat 模型，未配置范围时不限制
+func (s *TokenPolicyService) CheckModel(token *model.Token, code string) error {
+	if token.ReadOnly {
+		return ErrTokenReadOnly
+	}
+	if allowed := ParseStringList(token.AllowedModels); len(allowed) > 0 && !slices.Contains(allowed, code) {
+		return fmt.Errorf("%w: %s", ErrModelNotAllowed, code)
+	}
+	return nil
+}
+
+// checkSpend 在扣费事务中检查本次扣费后令牌当日、当月的净消费（扣费减退款）是否超过上限
+// token 须是事务内加锁读取的行，同一令牌的并发扣费排队检查，不会同时通过
+func checkSpend(tx *gorm.DB, token *model.Token, amount money.Money) error {
+	if amount <= 0 || (token.DailyLimit <= 0 && token.MonthlyLimit <= 0) {
+		return nil
+	}
+
+	now := time.Now()
+	if token.DailyLimit > 0 {
+		spent, err := tokenSpend(tx, token.ID, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+		if err != nil {
+			return err
+		}
+		if spent+amount > token.DailyLimit {
+			return fmt.Errorf("%w: daily limit %s, spent %s", ErrSpendLimitExceeded, token.DailyLimit, spent)
+		}
+	}
+	if token.MonthlyLimit > 0 {
+		spent, err := tokenSpend(tx, token.ID, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()))
+		if err != nil {
+			return err
+		}
+		if spent+amount > token.MonthlyLimit {
+			return fmt.Errorf("%w: monthly limit %s, spent %s", ErrSpendLimitExceeded, token.MonthlyLimit, spent)
+		}
+	}
+	return nil
+}
+
+// tokenSpend 令牌自 since 起的净消费，按账务流水汇总
+// 任务退款只抵扣同一时段内的扣费：任务首次扣费早于 since 时不计入，避免过期任务的退款抬高当期额度
+// 对话的预授权退回在同一请求内完成，按退款时间计入
+func tokenSpend(tx *gorm.DB, tokenID uint, since time.Time) (money.Money, error) {
+	var spent money.Money
+	err := tx.Model(&model.BillingTransaction{}).
+		Select("COALESCE(-SUM(token_amount), 0)").
+		Where("token_id = ? AND created_at >= ?", tokenID, since).
+		Where("type = ? OR (type = ? AND (task_id = 0 OR (SELECT MIN(d.created_at) FROM billing_transactions d WHERE d.task_id = billing_transactions.task_id AND d.type = ?) >= ?))",
+			model.BillingTypeDeduct, model.BillingTypeRefund, model.BillingTypeDeduct, since).
+		Scan(&spent).Error
+	return spent, err
+}
+
+// ValidateIPAllowlist 校验 IP 白名单，每项为 IP 或 CIDR
+func ValidateIPAllowlist(entries []string) error {
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("invalid cidr: %s", entry)
+			}
+			continue
+		}
+		if net.ParseIP(entry) == nil {
+			return fmt.Errorf("invalid ip: %s", entry)
+		}
+	}
+	return nil
+}
+
+// ParseStringList 解析 JSON 字符串数组，为空或格式错误时返回 nil
+func ParseStringList(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	var list []string
+	json.Unmarshal(data, &list)
+	return list
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/money"
+	"gorm.io/datatypes"
+)
+
+func TestCheckAccess(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name     string
+		token    model.Token
+		clientIP string
+		readOnly bool
+		wantErr  error
+	}{
+		{name: "no limits", clientIP: "1.2.3.4"},
+		{name: "expired", token: model.Token{ExpiresAt: &past}, clientIP: "1.2.3.4", wantErr: ErrTokenExpired},
+		{name: "not expired", token: model.Token{ExpiresAt: &future}, clientIP: "1.2.3.4"},
+		{name: "ip in list", token: model.Token{AllowedIPs: datatypes.JSON(`["1.2.3.4"]`)}, clientIP: "1.2.3.4"},
+		{name: "ip in cidr", token: model.Token{AllowedIPs: datatypes.JSON(`["10.0.0.0/8"]`)}, clientIP: "10.1.2.3"},
+		{name: "ip not allowed", token: model.Token{AllowedIPs: datatypes.JSON(`["10.0.0.0/8"]`)}, clientIP: "1.2.3.4", wantErr: ErrIPNotAllowed},
+		{name: "read-only query", token: model.Token{ReadOnly: true}, clientIP: "1.2.3.4", readOnly: true},
+		{name: "read-only invoke", token: model.Token{ReadOnly: true}, clientIP: "1.2.3.4", wantErr: ErrTokenReadOnly},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewTokenPolicyService().CheckAccess(&tt.token, tt.clientIP, tt.readOnly)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckCapabilityAndModel(t *testing.T) {
+	tests := []struct {
+		name         string
+		token        model.Token
+		wantCapErr   error
+		wantModelErr error
+	}{
+		{name: "unrestricted"},
+		{name: "allowed", token: model.Token{AllowedCapabilities: datatypes.JSON(`["image"]`), AllowedModels: datatypes.JSON(`["image"]`)}},
+		{name: "not allowed", token: model.Token{AllowedCapabilities: datatypes.JSON(`["video"]`), AllowedModels: datatypes.JSON(`["video"]`)}, wantCapErr: ErrCapabilityNotAllowed, wantModelErr: ErrModelNotAllowed},
+		{name: "read-only", token: model.Token{ReadOnly: true}, wantCapErr: ErrTokenReadOnly, wantModelErr: ErrTokenReadOnly},
+	}
+	s := NewTokenPolicyService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.CheckCapability(&tt.token, "image"); !errors.Is(err, tt.wantCapErr) {
+				t.Errorf("CheckCapability err = %v, want %v", err, tt.wantCapErr)
+			}
+			if err := s.CheckModel(&tt.token, "image"); !errors.Is(err, tt.wantModelErr) {
+				t.Errorf("CheckModel err = %v, want %v", err, tt.wantModelErr)
+			}
+		})
+	}
+}
+
+func TestDeductSpendLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		daily   money.Money
+		monthly money.Money
+		spent   money.Money // 之前的扣费
+		refund  money.Money
+		amount  money.Money
+		wantErr error
+	}{
+		{name: "no limits", spent: 10 * money.Unit, amount: money.Unit},
+		{name: "within daily", daily: 5 * money.Unit, spent: 3 * money.Unit, amount: 2 * money.Unit},
+		{name: "over daily", daily: 5 * money.Unit, spent: 3 * money.Unit, amount: 3 * money.Unit, wantErr: ErrSpendLimitExceeded},
+		{name: "refund frees daily", daily: 5 * money.Unit, spent: 3 * money.Unit, refund: 2 * money.Unit, amount: 3 * money.Unit},
+		{name: "over monthly", monthly: 4 * money.Unit, spent: 3 * money.Unit, amount: 2 * money.Unit, wantErr: ErrSpendLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user, token := newWallet(t, 100*money.Unit, 0)
+			s := NewBillingService()
+			if err := s.Deduct(token.ID, user.ID, tt.spent, BillingRef{}); err != nil {
+				t.Fatalf("spend: %v", err)
+			}
+			if err := s.Refund(token.ID, user.ID, tt.refund, BillingRef{}); err != nil {
+				t.Fatalf("refund: %v", err)
+			}
+			model.DB().Model(&token).Updates(map[string]any{"daily_limit": tt.daily, "monthly_limit": tt.monthly})
+
+			err := s.Deduct(token.ID, user.ID, tt.amount, BillingRef{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			// 补扣实际用量不受消费上限限制
+			if err := s.DeductUsage(token.ID, user.ID, tt.amount, BillingRef{}); err != nil {
+				t.Errorf("DeductUsage err = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestDeductSpendLimitConcurrent(t *testing.T) {
+	setupTestDB(t)
+	user, token := newWallet(t, 100*money.Unit, 0)
+	model.DB().Model(&token).Update("daily_limit", 5*money.Unit)
+	s := NewBillingService()
+
+	var charged atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Deduct(token.ID, user.ID, money.Unit, BillingRef{})
+			switch {
+			case err == nil:
+				charged.Add(1)
+			case !errors.Is(err, ErrSpendLimitExceeded):
+				t.Errorf("Deduct: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if charged.Load() != 5 {
+		t.Fatalf("charged = %d, want 5", charged.Load())
+	}
+	var u model.User
+	model.DB().First(&u, user.ID)
+	if u.Balance != 95*money.Unit {
+		t.Fatalf("balance = %s, want 95", u.Balance)
+	}
+}
+
+func TestTokenSpendRefundWindow(t *testing.T) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tests := []struct {
+		name      string
+		chargedAt time.Time // 扣费时间，退款总在当前时间
+		ref       BillingRef
+		want      money.Money
+	}{
+		{name: "task charged today", chargedAt: now, ref: BillingRef{TaskID: 1, TaskNo: "T1"}, want: money.Unit},
+		{name: "task charged yesterday", chargedAt: today.Add(-time.Hour), ref: BillingRef{TaskID: 1, TaskNo: "T1"}, want: 0},
+		{name: "chat hold release", chargedAt: now, ref: BillingRef{Remark: "chat hold"}, want: money.Unit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user, token := newWallet(t, 100*money.Unit, 0)
+			s := NewBillingService()
+			if err := s.Deduct(token.ID, user.ID, 3*money.Unit, tt.ref); err != nil {
+				t.Fatalf("Deduct: %v", err)
+			}
+			model.DB().Model(&model.BillingTransaction{}).
+				Where("type = ?", model.BillingTypeDeduct).
+				Update("created_at", tt.chargedAt)
+			if err := s.Refund(token.ID, user.ID, 2*money.Unit, tt.ref); err != nil {
+				t.Fatalf("Refund: %v", err)
+			}
+
+			got, err := tokenSpend(model.DB(), token.ID, today)
+			if err != nil || got != tt.want {
+				t.Errorf("tokenSpend = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/majingzhen/prism/pkg/auth"
 	"github.com/majingzhen/prism/pkg/cache"
 	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/majingzhen/prism/pkg/money"
 	"gorm.io/gorm"
 )
 
@@ -116,14 +117,17 @@ func (s *UserService) UpdateUserRole(userID uint, role model.UserRole) error {
 	return model.DB().Model(&model.User{}).Where("id = ?", userID).Update("role", role).Error
 }
 
+func (s *UserService) UpdateUserTier(userID uint, tier string) error {
+	return model.DB().Model(&model.User{}).Where("id = ?", userID).Update("tier", tier).Error
+}
+
 func (s *UserService) UpdateUserStatus(userID uint, status int8) error {
 	return model.DB().Model(&model.User{}).Where("id = ?", userID).Update("status", status).Error
 }
 
-// RechargeUser 给指定用户充值额度
-func (s *UserService) RechargeUser(userID uint, amount float64) error {
-	return model.DB().Model(&model.User{}).Where("id = ?", userID).
-		UpdateColumn("balance", gorm.Expr("balance + ?", amount)).Error
+// RechargeUser 管理员给指定用户充值额度，记录充值流水
+func (s *UserService) RechargeUser(userID uint, amount money.Money, operatorID uint, remark string) error {
+	return NewBillingService().RechargeUser(userID, amount, BillingRef{OperatorID: operatorID, Remark: remark})
 }
 
 type ChangePasswordRequest struct {
@@ -0,0 +1,675 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/cache"
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/majingzhen/prism/pkg/httputil"
+	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/majingzhen/prism/pkg/queue"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// TypeWebhookDeliver 回调投递任务类型
+const TypeWebhookDeliver = "task:notify"
+
+// 回调签名相关请求头
+const (
+	WebhookHeaderEvent     = "X-Prism-Event"
+	WebhookHeaderDelivery  = "X-Prism-Delivery"
+	WebhookHeaderTimestamp = "X-Prism-Timestamp"
+	WebhookHeaderSignature = "X-Prism-Signature"
+)
+
+const (
+	DefaultWebhookTimeout        = 10 * time.Second
+	DefaultWebhookRetryBaseDelay = 10 * time.Second
+	DefaultWebhookRetryMaxDelay  = time.Hour
+	DefaultWebhookRetryHorizon   = 24 * time.Hour
+	DefaultWebhookProgressGap    = 10 * time.Second
+
+	// WebhookEventVersion 事件信封版本
+	WebhookEventVersion = "1"
+
+	// webhookMaxRetry asynq 最大重试次数，实际由重试时限控制
+	webhookMaxRetry = 100
+	// webhookResponseLimit 投递记录中保存的响应体长度
+	webhookResponseLimit = 2048
+)
+
+var (
+	ErrWebhookNoCallback = errors.New("task has no callback url")
+	ErrWebhookNotFinal   = errors.New("task is not finished")
+	ErrWebhookInvalidURL = errors.New("invalid webhook url")
+	ErrWebhookEvents     = errors.New("invalid webhook events")
+	ErrWebhookNotFound   = errors.New("webhook subscription not found")
+)
+
+// webhookProgressPrefix 进度事件节流 key 前缀
+const webhookProgressPrefix = "webhook:progress:"
+
+// WebhookPayload 回调投递任务载荷
+// SubscriptionID 为 0 时投递到任务的 callback_url，否则投递到对应订阅
+type WebhookPayload struct {
+	TaskID         uint           `json:"task_id"`
+	DeliveryID     string         `json:"delivery_id"`
+	EnqueuedAt     int64          `json:"enqueued_at"`
+	SubscriptionID uint           `json:"subscription_id,omitempty"`
+	EventID        string         `json:"event_id,omitempty"`
+	Event          string         `json:"event,omitempty"`
+	Data           map[string]any `json:"data,omitempty"`
+}
+
+// enqueuedAt 投递创建时间，升级前入队的载荷没有 enqueued_at，按任务完成时间计算重试时限
+func (p *WebhookPayload) enqueuedAt(task *model.Task) time.Time {
+	if p.EnqueuedAt > 0 {
+		return time.Unix(p.EnqueuedAt, 0)
+	}
+	if task.CompletedAt != nil {
+		return *task.CompletedAt
+	}
+	return time.Now()
+}
+
+// WebhookEvent 订阅事件信封
+type WebhookEvent struct {
+	ID        string         `json:"id"`
+	Version   string         `json:"version"`
+	Type      string         `json:"type"`
+	CreatedAt int64          `json:"created_at"`
+	Data      map[string]any `json:"data"`
+}
+
+// WebhookBody 任务 callback_url 回调请求体
+type WebhookBody struct {
+	TaskID   string         `json:"task_id"`
+	Status   string         `json:"status"`
+	Progress int            `json:"progress"`
+	Result   map[string]any `json:"result,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+type WebhookService struct{}
+
+func NewWebhookService() *WebhookService {
+	return &WebhookService{}
+}
+
+func init() {
+	queue.SetRetryDelay(TypeWebhookDeliver, WebhookRetryDelay)
+}
+
+// WebhookRetryDelay 回调重试间隔，按指数退避并限制最大间隔
+func WebhookRetryDelay(n int, err error, t *asynq.Task) time.Duration {
+	base := durationOrDefault(config.C.Webhook.RetryBaseDelay, DefaultWebhookRetryBaseDelay)
+	maxDelay := durationOrDefault(config.C.Webhook.RetryMaxDelay, DefaultWebhookRetryMaxDelay)
+
+	delay := base
+	for i := 0; i < n && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// Enqueue 创建一次新的回调投递
+func (s *WebhookService) Enqueue(taskID uint) error {
+	payload := WebhookPayload{
+		TaskID:     taskID,
+		DeliveryID: uuid.New().String(),
+		EnqueuedAt: time.Now().Unix(),
+	}
+	payloadBytes, _ := json.Marshal(payload)
+
+	model.DB().Model(&model.Task{}).Where("id = ?", taskID).
+		Update("callback_status", model.CallbackStatusPending)
+
+	_, err := queue.Client.Enqueue(asynq.NewTask(TypeWebhookDeliver, payloadBytes), asynq.MaxRetry(webhookMaxRetry))
+	if err != nil {
+		logger.Error("enqueue webhook error", zap.Uint("task_id", taskID), zap.Error(err))
+	}
+	return err
+}
+
+// Deliver 投递回调，返回错误时由 asynq 按退避策略重试
+func (s *WebhookService) Deliver(ctx context.Context, payload *WebhookPayload, attempt int) error {
+	var task model.Task
+	if err := model.DB().First(&task, payload.TaskID).Error; err != nil {
+		return fmt.Errorf("get task: %w: %w", err, asynq.SkipRetry)
+	}
+
+	var (
+		targetURL string
+		event     string
+		body      any
+	)
+	if payload.SubscriptionID > 0 {
+		var sub model.WebhookSubscription
+		if err := model.DB().First(&sub, payload.SubscriptionID).Error; err != nil || sub.Status != 1 {
+			// 订阅已删除或禁用，丢弃该投递
+			return nil
+		}
+		targetURL = sub.URL
+		event = payload.Event
+		body = WebhookEvent{
+			ID:        payload.EventID,
+			Version:   WebhookEventVersion,
+			Type:      payload.Event,
+			CreatedAt: payload.EnqueuedAt,
+			Data:      s.eventData(ctx, &task, payload.Data),
+		}
+	} else {
+		if task.CallbackURL == "" {
+			return nil
+		}
+		targetURL = task.CallbackURL
+		event = model.TerminalWebhookEvent(task.Status)
+		body = s.callbackBody(ctx, &task)
+	}
+
+	secret, err := s.tokenSecret(task.TokenID)
+	if err != nil {
+		s.markFailed(&task, payload)
+		return fmt.Errorf("get webhook secret: %w: %w", err, asynq.SkipRetry)
+	}
+
+	bodyBytes, _ := json.Marshal(body)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string]string{
+		WebhookHeaderEvent:     event,
+		WebhookHeaderDelivery:  payload.DeliveryID,
+		WebhookHeaderTimestamp: timestamp,
+		WebhookHeaderSignature: "sha256=" + SignWebhook(secret, timestamp, bodyBytes),
+	}
+
+	timeout := durationOrDefault(config.C.Webhook.Timeout, DefaultWebhookTimeout)
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	detail := httputil.PostJSONWithDetail(reqCtx, targetURL, json.RawMessage(bodyBytes), headers)
+
+	s.record(&task, payload, targetURL, event, attempt, detail)
+
+	if detail.Error == nil {
+		if payload.SubscriptionID == 0 {
+			model.DB().Model(&task).Updates(map[string]any{
+				"callback_status":   model.CallbackStatusSuccess,
+				"callback_attempts": gorm.Expr("callback_attempts + 1"),
+			})
+		}
+		logger.Info("webhook delivered",
+			zap.String("task_no", task.TaskNo),
+			zap.String("event", event),
+			zap.Int("attempt", attempt))
+		return nil
+	}
+
+	if payload.SubscriptionID == 0 {
+		model.DB().Model(&task).UpdateColumn("callback_attempts", gorm.Expr("callback_attempts + 1"))
+	}
+
+	// 超过重试时限后不再重试，可通过重新投递接口手动补发
+	horizon := durationOrDefault(config.C.Webhook.RetryHorizon, DefaultWebhookRetryHorizon)
+	nextAt := time.Now().Add(WebhookRetryDelay(attempt-1, detail.Error, nil))
+	if nextAt.After(payload.enqueuedAt(&task).Add(horizon)) {
+		s.markFailed(&task, payload)
+		logger.Warn("webhook delivery gave up",
+			zap.String("task_no", task.TaskNo),
+			zap.String("event", event),
+			zap.Int("attempt", attempt),
+			zap.Error(detail.Error))
+		return fmt.Errorf("webhook delivery: %w: %w", detail.Error, asynq.SkipRetry)
+	}
+
+	logger.Warn("webhook delivery failed, will retry",
+		zap.String("task_no", task.TaskNo),
+		zap.String("event", event),
+		zap.Int("attempt", attempt),
+		zap.Error(detail.Error))
+	return fmt.Errorf("webhook delivery: %w", detail.Error)
+}
+
+// Emit 触发任务事件：投递给订阅了该事件的地址，终态事件同时投递给任务的 callback_url
+func (s *WebhookService) Emit(task *model.Task, event string, data map[string]any) {
+	if task.CallbackURL != "" && (event == model.WebhookEventTaskSucceeded || event == model.WebhookEventTaskFailed) {
+		s.Enqueue(task.ID)
+	}
+
+	var subs []model.WebhookSubscription
+	model.DB().Where("token_id = ? AND status = 1", task.TokenID).Find(&subs)
+
+	matched := subs[:0]
+	for _, sub := range subs {
+		if sub.HasEvent(event) {
+			matched = append(matched, sub)
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+	if event == model.WebhookEventTaskProgress && !s.allowProgress(task.ID) {
+		return
+	}
+
+	eventID := uuid.New().String()
+	now := time.Now().Unix()
+	for _, sub := range matched {
+		payload := WebhookPayload{
+			TaskID:         task.ID,
+			DeliveryID:     uuid.New().String(),
+			EnqueuedAt:     now,
+			SubscriptionID: sub.ID,
+			EventID:        eventID,
+			Event:          event,
+			Data:           data,
+		}
+		payloadBytes, _ := json.Marshal(payload)
+		if _, err := queue.Client.Enqueue(asynq.NewTask(TypeWebhookDeliver, payloadBytes), asynq.MaxRetry(webhookMaxRetry)); err != nil {
+			logger.Error("enqueue webhook event error",
+				zap.String("task_no", task.TaskNo),
+				zap.String("event", event),
+				zap.Error(err))
+		}
+	}
+}
+
+// EmitByID 按任务ID触发事件
+func (s *WebhookService) EmitByID(taskID uint, event string, data map[string]any) {
+	var task model.Task
+	if err := model.DB().First(&task, taskID).Error; err != nil {
+		return
+	}
+	s.Emit(&task, event, data)
+}
+
+// EmitAssets 为转存完成的每个资源触发 task.asset_ready 事件
+func (s *WebhookService) EmitAssets(task *model.Task, result map[string]any) {
+	assets, _ := result["assets"].([]AssetTransfer)
+	for _, asset := range assets {
+		if asset.Error != "" || (asset.URL == "" && asset.Key == "") {
+			continue
+		}
+		s.Emit(task, model.WebhookEventTaskAssetReady, map[string]any{
+			"asset": map[string]any{
+				"url":        asset.URL,
+				"key":        asset.Key,
+				"size":       asset.Size,
+				"origin_url": asset.OriginURL,
+			},
+		})
+	}
+}
+
+// allowProgress 进度事件节流，同一任务在间隔内只发送一次
+func (s *WebhookService) allowProgress(taskID uint) bool {
+	if cache.Client == nil {
+		return true
+	}
+	gap := durationOrDefault(config.C.Webhook.ProgressInterval, DefaultWebhookProgressGap)
+	ok, err := cache.Client.SetNX(context.Background(), fmt.Sprintf("%s%d", webhookProgressPrefix, taskID), 1, gap).Result()
+	if err != nil {
+		return true
+	}
+	return ok
+}
+
+// callbackBody 构建任务 callback_url 回调请求体
+func (s *WebhookService) callbackBody(ctx context.Context, task *model.Task) WebhookBody {
+	body := WebhookBody{
+		TaskID:   task.TaskNo,
+		Status:   string(task.Status),
+		Progress: task.Progress,
+	}
+	if task.Status == model.TaskStatusSuccess {
+		body.Result = NewAssetService().ResolveResultJSON(ctx, task.Result)
+	}
+	if task.ErrorMessage != "" {
+		body.Error = task.ErrorMessage
+	}
+	return body
+}
+
+// eventData 构建事件数据，以任务当前状态为基础并合并事件触发时的快照
+func (s *WebhookService) eventData(ctx context.Context, task *model.Task, snapshot map[string]any) map[string]any {
+	data := map[string]any{
+		"task_id":    task.TaskNo,
+		"capability": task.CapabilityCode,
+		"status":     task.Status,
+		"progress":   task.Progress,
+	}
+	switch task.Status {
+	case model.TaskStatusSuccess:
+		data["result"] = NewAssetService().ResolveResultJSON(ctx, task.Result)
+		data["cost"] = task.Cost
+	case model.TaskStatusFailed:
+		data["error"] = task.ErrorMessage
+	}
+
+	for k, v := range snapshot {
+		data[k] = v
+	}
+	// 私有资源在投递时生成签名链接
+	if asset, ok := data["asset"].(map[string]any); ok {
+		NewAssetService().ResolveResult(ctx, asset)
+	}
+	return data
+}
+
+// Redeliver 重新投递指定任务的回调
+func (s *WebhookService) Redeliver(taskNo string, userID uint) error {
+	var task model.Task
+	if err := model.DB().Where("task_no = ? AND user_id = ?", taskNo, userID).First(&task).Error; err != nil {
+		return ErrTaskNotFound
+	}
+	if task.CallbackURL == "" {
+		return ErrWebhookNoCallback
+	}
+	if task.Status != model.TaskStatusSuccess && task.Status != model.TaskStatusFailed {
+		return ErrWebhookNotFinal
+	}
+	return s.Enqueue(task.ID)
+}
+
+// RedeliverFailed 批量重新投递失败的回调，返回投递数量
+func (s *WebhookService) RedeliverFailed(since time.Time, limit int) (int, error) {
+	query := model.DB().Model(&model.Task{}).
+		Where("callback_status = ? AND callback_url <> ''", model.CallbackStatusFailed)
+	if !since.IsZero() {
+		query = query.Where("completed_at >= ?", since)
+	}
+
+	var taskIDs []uint
+	if err := query.Order("id ASC").Limit(limit).Pluck("id", &taskIDs).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, id := range taskIDs {
+		if err := s.Enqueue(id); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// ListDeliveriesRequest 查询投递记录参数
+type ListDeliveriesRequest struct {
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+	TaskNo   string `form:"task_no"`
+	UserID   uint   `form:"user_id"`
+	Success  *bool  `form:"success"`
+}
+
+// ListDeliveries 查询回调投递记录
+func (s *WebhookService) ListDeliveries(req *ListDeliveriesRequest) ([]model.WebhookDelivery, int64, error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 20
+	}
+	if req.PageSize > 100 {
+		req.PageSize = 100
+	}
+
+	query := model.DB().Model(&model.WebhookDelivery{})
+	if req.TaskNo != "" {
+		query = query.Where("task_no = ?", req.TaskNo)
+	}
+	if req.UserID > 0 {
+		query = query.Where("user_id = ?", req.UserID)
+	}
+	if req.Success != nil {
+		query = query.Where("success = ?", *req.Success)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []model.WebhookDelivery
+	err := query.Order("id DESC").
+		Offset((req.Page - 1) * req.PageSize).
+		Limit(req.PageSize).
+		Find(&items).Error
+	return items, total, err
+}
+
+// SubscriptionRequest 创建/更新事件订阅参数
+type SubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Status *int8    `json:"status"`
+}
+
+// ListSubscriptions 查询令牌的事件订阅
+func (s *WebhookService) ListSubscriptions(tokenID, userID uint) ([]model.WebhookSubscription, error) {
+	var subs []model.WebhookSubscription
+	err := model.DB().Where("token_id = ? AND user_id = ?", tokenID, userID).
+		Order("id ASC").Find(&subs).Error
+	return subs, err
+}
+
+// CreateSubscription 为令牌创建事件订阅
+func (s *WebhookService) CreateSubscription(tokenID, userID uint, req *SubscriptionRequest) (*model.WebhookSubscription, error) {
+	var count int64
+	model.DB().Model(&model.Token{}).Where("id = ? AND user_id = ?", tokenID, userID).Count(&count)
+	if count == 0 {
+		return nil, ErrWebhookNotFound
+	}
+
+	if !isRemoteURL(req.URL) {
+		return nil, ErrWebhookInvalidURL
+	}
+	events, err := normalizeWebhookEvents(req.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &model.WebhookSubscription{
+		UserID:  userID,
+		TokenID: tokenID,
+		URL:     req.URL,
+		Events:  events,
+		Status:  1,
+	}
+	if req.Status != nil {
+		sub.Status = *req.Status
+	}
+	if err := model.DB().Create(sub).Error; err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// UpdateSubscription 更新事件订阅
+func (s *WebhookService) UpdateSubscription(id, tokenID, userID uint, req *SubscriptionRequest) error {
+	updates := map[string]any{}
+	if req.URL != "" {
+		if !isRemoteURL(req.URL) {
+			return ErrWebhookInvalidURL
+		}
+		updates["url"] = req.URL
+	}
+	if req.Events != nil {
+		events, err := normalizeWebhookEvents(req.Events)
+		if err != nil {
+			return err
+		}
+		updates["events"] = events
+	}
+	if req.Status != nil {
+		updates["status"] = *req.Status
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	result := model.DB().Model(&model.WebhookSubscription{}).
+		Where("id = ? AND token_id = ? AND user_id = ?", id, tokenID, userID).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// DeleteSubscription 删除事件订阅
+func (s *WebhookService) DeleteSubscription(id, tokenID, userID uint) error {
+	result := model.DB().Where("id = ? AND token_id = ? AND user_id = ?", id, tokenID, userID).
+		Delete(&model.WebhookSubscription{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// RotateSecret 重新生成令牌的回调签名密钥
+func (s *WebhookService) RotateSecret(tokenID uint, userID uint) (string, error) {
+	secret := GenerateWebhookSecret()
+	result := model.DB().Model(&model.Token{}).
+		Where("id = ? AND user_id = ?", tokenID, userID).
+		Update("webhook_secret", secret)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+	return secret, nil
+}
+
+// tokenSecret 获取令牌的签名密钥，旧令牌没有密钥时自动生成
+func (s *WebhookService) tokenSecret(tokenID uint) (string, error) {
+	var token model.Token
+	if err := model.DB().Unscoped().Select("id", "webhook_secret").First(&token, tokenID).Error; err != nil {
+		return "", err
+	}
+	if token.WebhookSecret != "" {
+		return token.WebhookSecret, nil
+	}
+
+	secret := GenerateWebhookSecret()
+	result := model.DB().Unscoped().Model(&model.Token{}).
+		Where("id = ? AND (webhook_secret = '' OR webhook_secret IS NULL)", tokenID).
+		Update("webhook_secret", secret)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 并发投递时已被其他任务生成
+		model.DB().Unscoped().Select("id", "webhook_secret").First(&token, tokenID)
+		return token.WebhookSecret, nil
+	}
+	return secret, nil
+}
+
+// record 写入投递记录
+func (s *WebhookService) record(task *model.Task, payload *WebhookPayload, targetURL, event string, attempt int, detail *httputil.RequestDetail) {
+	delivery := &model.WebhookDelivery{
+		DeliveryID:     payload.DeliveryID,
+		EventID:        payload.EventID,
+		SubscriptionID: payload.SubscriptionID,
+		TaskID:         task.ID,
+		TaskNo:         task.TaskNo,
+		UserID:         task.UserID,
+		TokenID:        task.TokenID,
+		Event:          event,
+		URL:            targetURL,
+		Attempt:        attempt,
+		RequestBody:    detail.RequestBody,
+		StatusCode:     detail.StatusCode,
+		DurationMs:     detail.DurationMs,
+		Success:        detail.Error == nil,
+	}
+	respBody := detail.ResponseBody
+	if len(respBody) > webhookResponseLimit {
+		respBody = respBody[:webhookResponseLimit]
+	}
+	delivery.ResponseBody = string(respBody)
+	if detail.Error != nil {
+		delivery.ErrorMessage = detail.Error.Error()
+	}
+
+	if err := model.DB().Create(delivery).Error; err != nil {
+		logger.Error("save webhook delivery failed", zap.Error(err))
+	}
+}
+
+// markFailed 标记任务 callback_url 回调失败，订阅投递不影响任务回调状态
+func (s *WebhookService) markFailed(task *model.Task, payload *WebhookPayload) {
+	if payload.SubscriptionID > 0 {
+		return
+	}
+	model.DB().Model(task).Update("callback_status", model.CallbackStatusFailed)
+}
+
+// normalizeWebhookEvents 校验订阅事件并转换为逗号分隔格式
+func normalizeWebhookEvents(events []string) (string, error) {
+	if len(events) == 0 {
+		return "", ErrWebhookEvents
+	}
+	seen := make(map[string]bool, len(events))
+	result := make([]string, 0, len(events))
+	for _, e := range events {
+		e = strings.TrimSpace(e)
+		if e != model.WebhookEventAll && !slices.Contains(model.WebhookEvents, e) {
+			return "", fmt.Errorf("%w: %s", ErrWebhookEvents, e)
+		}
+		if !seen[e] {
+			seen[e] = true
+			result = append(result, e)
+		}
+	}
+	return strings.Join(result, ","), nil
+}
+
+// SignWebhook 计算回调签名：HMAC-SHA256(secret, timestamp + "." + body)
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateWebhookSecret 生成回调签名密钥
+func GenerateWebhookSecret() string {
+	bytes := make([]byte, 24)
+	rand.Read(bytes)
+	return "whsec_" + hex.EncodeToString(bytes)
+}
+
+// durationOrDefault 将秒数配置转换为时长，未配置时使用默认值
+func durationOrDefault(seconds int, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
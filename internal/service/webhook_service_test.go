@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/majingzhen/prism/internal/model"
+)
+
+func TestSignWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{name: "body", secret: "whsec_test", timestamp: "1700000000", body: `{"task_id":"T1","status":"success"}`, want: "a501260994fc7dbaa66c54a984b2acedaea2194916dd1b6317cdd008846e16f6"},
+		{name: "empty body", secret: "whsec_test", timestamp: "1700000000", want: "5967f3c560522fa40cf2876ebc3c3a08551dd6959aaade3b413460591895bdcc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignWebhook(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("SignWebhook = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// 密钥、时间戳或请求体任一变化签名都不同
+	base := SignWebhook("whsec_test", "1700000000", []byte("{}"))
+	for _, sig := range []string{
+		SignWebhook("whsec_other", "1700000000", []byte("{}")),
+		SignWebhook("whsec_test", "1700000001", []byte("{}")),
+		SignWebhook("whsec_test", "1700000000", []byte("{} ")),
+	} {
+		if sig == base {
+			t.Errorf("signature %s should differ", sig)
+		}
+	}
+
+	if secret := GenerateWebhookSecret(); !strings.HasPrefix(secret, "whsec_") || len(secret) != len("whsec_")+48 || secret == GenerateWebhookSecret() {
+		t.Errorf("GenerateWebhookSecret = %q", secret)
+	}
+}
+
+func TestDeliverSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{name: "token secret", secret: "whsec_existing"},
+		{name: "generated for old token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			var got *http.Request
+			var body []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				body, _ = io.ReadAll(r.Body)
+			}))
+			defer srv.Close()
+
+			token := model.Token{UserID: 1, KeyHash: "hash", Status: 1, WebhookSecret: tt.secret}
+			model.DB().Create(&token)
+			task := model.Task{TaskNo: "T1", UserID: 1, TokenID: token.ID, Status: model.TaskStatusFailed, ErrorMessage: "boom", CallbackURL: srv.URL}
+			model.DB().Create(&task)
+
+			payload := &WebhookPayload{TaskID: task.ID, DeliveryID: "d1"}
+			if err := NewWebhookService().Deliver(context.Background(), payload, 1); err != nil {
+				t.Fatalf("Deliver: %v", err)
+			}
+			if got == nil {
+				t.Fatal("webhook not delivered")
+			}
+
+			model.DB().First(&token, token.ID)
+			if token.WebhookSecret == "" || (tt.secret != "" && token.WebhookSecret != tt.secret) {
+				t.Fatalf("webhook secret = %q", token.WebhookSecret)
+			}
+			// 接收方用时间戳和原始请求体验签
+			timestamp := got.Header.Get(WebhookHeaderTimestamp)
+			want := "sha256=" + SignWebhook(token.WebhookSecret, timestamp, body)
+			if timestamp == "" || got.Header.Get(WebhookHeaderSignature) != want {
+				t.Errorf("signature = %q, want %q", got.Header.Get(WebhookHeaderSignature), want)
+			}
+			if got.Header.Get(WebhookHeaderEvent) != model.WebhookEventTaskFailed || got.Header.Get(WebhookHeaderDelivery) != "d1" {
+				t.Errorf("headers = %v", got.Header)
+			}
+
+			var saved model.Task
+			model.DB().First(&saved, task.ID)
+			if saved.CallbackStatus != model.CallbackStatusSuccess {
+				t.Errorf("callback status = %q, want success", saved.CallbackStatus)
+			}
+		})
+	}
+}
+
+func TestDeliverRetryHorizon(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	tests := []struct {
+		name        string
+		enqueuedAt  int64
+		completedAt *time.Time
+		wantGiveUp  bool
+	}{
+		{name: "within horizon", enqueuedAt: now.Unix()},
+		{name: "past horizon", enqueuedAt: old.Unix(), wantGiveUp: true},
+		// 升级前入队的载荷没有 enqueued_at，按任务完成时间计算
+		{name: "legacy recently completed", completedAt: &now},
+		{name: "legacy completed long ago", completedAt: &old, wantGiveUp: true},
+		{name: "legacy without completed time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer srv.Close()
+
+			token := model.Token{UserID: 1, KeyHash: "hash", Status: 1, WebhookSecret: "whsec_1"}
+			model.DB().Create(&token)
+			task := model.Task{TaskNo: "T1", UserID: 1, TokenID: token.ID, Status: model.TaskStatusFailed, CallbackURL: srv.URL, CompletedAt: tt.completedAt}
+			model.DB().Create(&task)
+
+			payload := &WebhookPayload{TaskID: task.ID, DeliveryID: "d1", EnqueuedAt: tt.enqueuedAt}
+			err := NewWebhookService().Deliver(context.Background(), payload, 1)
+			if err == nil || errors.Is(err, asynq.SkipRetry) != tt.wantGiveUp {
+				t.Fatalf("err = %v, want give up %v", err, tt.wantGiveUp)
+			}
+			var saved model.Task
+			model.DB().First(&saved, task.ID)
+			if (saved.CallbackStatus == model.CallbackStatusFailed) != tt.wantGiveUp {
+				t.Errorf("callback status = %q", saved.CallbackStatus)
+			}
+		})
+	}
+}
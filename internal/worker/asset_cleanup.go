@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/hibiken/asynq"
+	"github.com/majingzhen/prism/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	TypeAssetCleanup = "asset:cleanup"
+
+	// assetCleanupBatchSize 每次清理的任务数量
+	assetCleanupBatchSize = 200
+)
+
+// HandleAssetCleanup 清理超过保留期限的存储资源和过期的用户文件
+func HandleAssetCleanup(ctx context.Context, t *asynq.Task) error {
+	logger.Info("cleaning up expired assets")
+
+	count, err := assetService.CleanupExpired(ctx, assetCleanupBatchSize)
+	if err != nil {
+		logger.Error("cleanup expired assets error", zap.Error(err))
+	} else {
+		logger.Info("asset cleanup completed", zap.Int("count", count))
+	}
+
+	fileCount, err := fileService.CleanupExpired(ctx, assetCleanupBatchSize)
+	if err != nil {
+		logger.Error("cleanup expired files error", zap.Error(err))
+	} else {
+		logger.Info("file cleanup completed", zap.Int("count", fileCount))
+	}
+
+	return nil
+}
+
+func NewAssetCleanupTask() *asynq.Task {
+	return asynq.NewTask(TypeAssetCleanup, nil)
+}
@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/hibiken/asynq"
+	"github.com/majingzhen/prism/internal/service"
+	"github.com/majingzhen/prism/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const TypeBillingReconcile = "billing:reconcile"
+
+var billingService = service.NewBillingService()
+
+// HandleBillingReconcile 核对余额与账务流水，不一致的账户记录告警日志
+func HandleBillingReconcile(ctx context.Context, t *asynq.Task) error {
+	logger.Info("reconciling billing ledger")
+
+	mismatches, err := billingService.Reconcile()
+	if err != nil {
+		logger.Error("reconcile billing ledger error", zap.Error(err))
+		return nil
+	}
+
+	logger.Info("billing reconcile completed", zap.Int("mismatches", len(mismatches)))
+
+	return nil
+}
+
+func NewBillingReconcileTask() *asynq.Task {
+	return asynq.NewTask(TypeBillingReconcile, nil)
+}
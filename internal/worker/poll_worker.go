@@ -9,13 +9,12 @@ import (
 	"github.com/hibiken/asynq"
 	"github.com/majingzhen/prism/internal/model"
 	"github.com/majingzhen/prism/internal/provider"
+	"github.com/majingzhen/prism/internal/service"
 	"github.com/majingzhen/prism/pkg/logger"
 	"github.com/majingzhen/prism/pkg/queue"
 	"go.uber.org/zap"
 )
 
-const MaxPollCount = 360 // 约 30 分钟
-
 func HandleTaskPoll(ctx context.Context, t *asynq.Task) error {
 	var payload TaskPollPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
@@ -24,13 +23,6 @@ func HandleTaskPoll(ctx context.Context, t *asynq.Task) error {
 
 	logger.Info("processing poll task", zap.Uint("task_id", payload.TaskID), zap.Int("poll_count", payload.PollCount))
 
-	// 超时保护
-	if payload.PollCount >= MaxPollCount {
-		taskService.UpdateTaskFail(payload.TaskID, "poll timeout")
-		decrementAccountTasks(payload.TaskID)
-		return nil
-	}
-
 	// 1. 获取任务
 	task, err := taskService.GetTaskByID(payload.TaskID)
 	if err != nil {
@@ -52,17 +44,36 @@ func HandleTaskPoll(ctx context.Context, t *asynq.Task) error {
 	var channelCapability model.ChannelCapability
 	model.DB().First(&channelCapability, task.ChannelCapabilityID)
 
+	schedule := service.NewPollSchedule(&channelCapability)
+	startedAt := time.Unix(payload.StartedAt, 0)
+	if payload.StartedAt == 0 {
+		startedAt = time.Now()
+		payload.StartedAt = startedAt.Unix()
+	}
+
 	// 3. 创建 Provider 并查询进度
 	prov, err := provider.NewProvider(&channel, &account, &channelCapability)
 	if err != nil {
 		return fmt.Errorf("create provider: %w", err)
 	}
 
+	// 本次轮询仍未完成时，超过轮询次数或总时限则失败，否则继续轮询
+	// 先轮询再判断，保证时限到达时的最后一次轮询能够执行
+	nextPoll := func(result provider.ProgressResult) error {
+		if schedule.Exhausted(payload.PollCount+1, startedAt) {
+			taskService.UpdateTaskFail(task.ID, "poll timeout")
+			strategyService.DecrementAccountTasks(task.AccountID)
+			return nil
+		}
+		delay := schedule.NextDelay(payload.PollCount+1, result.RetryAfter, result.ETA)
+		return requeuePoll(payload.TaskID, payload.PollCount+1, payload.StartedAt, schedule.Clamp(delay, startedAt))
+	}
+
 	result, err := prov.GetProgress(ctx, task.VendorTaskID)
 	if err != nil {
 		logger.Error("get progress error", zap.Error(err))
 		// 继续轮询
-		return requeuePoll(payload.TaskID, payload.PollCount+1)
+		return nextPoll(result)
 	}
 
 	logger.Info("poll result", zap.String("status", string(result.Status)), zap.Int("progress", result.Progress))
@@ -72,54 +83,51 @@ func HandleTaskPoll(ctx context.Context, t *asynq.Task) error {
 	case provider.StatusSuccess:
 		// 更新进度
 		taskService.UpdateTaskProgress(task.ID, 100)
+
 		// 入队上传任务
 		originURL := ""
 		if len(result.URLs) > 0 {
 			originURL = result.URLs[0]
 		}
-		return enqueueUpload(task.ID, originURL, result.URLs)
+		return enqueueUpload(task.ID, originURL, result.URLs, result.Usage)
 
 	case provider.StatusFail:
 		taskService.UpdateTaskFail(task.ID, result.Error)
-		decrementAccountTasks(task.ID)
+		strategyService.DecrementAccountTasks(task.AccountID)
 		return nil
 
 	case provider.StatusProcessing, provider.StatusSubmitted, provider.StatusPending:
 		// 更新进度
-		taskService.UpdateTaskProgress(task.ID, result.Progress)
-		// 继续轮询
-		return requeuePoll(payload.TaskID, payload.PollCount+1)
+		if result.Progress != task.Progress {
+			taskService.UpdateTaskProgress(task.ID, result.Progress)
+		}
 	}
 
-	return nil
+	// 继续轮询（包括供应商返回错误状态码的情况）
+	return nextPoll(result)
 }
 
-func requeuePoll(taskID uint, pollCount int) error {
+func requeuePoll(taskID uint, pollCount int, startedAt int64, delay time.Duration) error {
 	payload := TaskPollPayload{
 		TaskID:    taskID,
 		PollCount: pollCount,
+		StartedAt: startedAt,
 	}
 	payloadBytes, _ := json.Marshal(payload)
 	task := asynq.NewTask(TypeTaskPoll, payloadBytes)
-	_, err := queue.Client.Enqueue(task, asynq.ProcessIn(5*time.Second))
+	_, err := queue.Client.Enqueue(task, asynq.ProcessIn(delay))
 	return err
 }
 
-func enqueueUpload(taskID uint, originURL string, urls []string) error {
+func enqueueUpload(taskID uint, originURL string, urls []string, usage string) error {
 	payload := TaskUploadPayload{
 		TaskID:    taskID,
 		OriginURL: originURL,
 		URLs:      urls,
+		Usage:     usage,
 	}
 	payloadBytes, _ := json.Marshal(payload)
 	task := asynq.NewTask(TypeTaskUpload, payloadBytes)
 	_, err := queue.Client.Enqueue(task)
 	return err
 }
-
-func decrementAccountTasks(taskID uint) {
-	task, err := taskService.GetTaskByID(taskID)
-	if err == nil {
-		strategyService.DecrementAccountTasks(task.AccountID)
-	}
-}
@@ -18,6 +18,9 @@ import (
 var (
 	taskService     = service.NewTaskService()
 	strategyService = service.NewStrategyService()
+	assetService    = service.NewAssetService()
+	webhookService  = service.NewWebhookService()
+	fileService     = service.NewFileService()
 )
 
 func HandleTaskSubmit(ctx context.Context, t *asynq.Task) error {
@@ -61,11 +64,41 @@ func HandleTaskSubmit(ctx context.Context, t *asynq.Task) error {
 	var mappedParams map[string]any
 	json.Unmarshal(task.MappedParams, &mappedParams)
 
+	// 执行提交前置步骤，输出合并到请求参数后重新转换
+	if len(channelCapability.PreSubmitSteps) > 0 {
+		var requestParams map[string]any
+		json.Unmarshal(task.RequestParams, &requestParams)
+		requestParams, err := fileService.ResolveParams(ctx, task.UserID, requestParams)
+		if err != nil {
+			taskService.UpdateTaskFail(task.ID, err.Error())
+			strategyService.DecrementAccountTasks(task.AccountID)
+			return nil
+		}
+		outputs, err := service.RunPreSubmitSteps(ctx, task, &channel, &channelCapability, &account, requestParams)
+		if err != nil {
+			taskService.UpdateTaskFail(task.ID, err.Error())
+			strategyService.DecrementAccountTasks(task.AccountID)
+			return nil
+		}
+		for k, v := range outputs {
+			requestParams[k] = v
+		}
+		paramTemplate, _ := provider.ParseParamTemplate(channelCapability.ParamMapping)
+		mappedParams, err = provider.NewDefaultConverter().Convert(requestParams, paramTemplate)
+		if err != nil {
+			taskService.UpdateTaskFail(task.ID, "param convert error: "+err.Error())
+			strategyService.DecrementAccountTasks(task.AccountID)
+			return nil
+		}
+	}
+	service.InjectVendorCallback(&channel, &channelCapability, task, mappedParams)
+
 	// 5. 提交到上游
 	submitReq := provider.SubmitRequest{
 		TaskNo:      task.TaskNo,
 		Params:      mappedParams,
-		CallbackURL: task.CallbackURL,
+		CallbackURL: service.VendorCallbackURL(&channel, task),
+		Files:       fileService.Lookup(task.UserID),
 	}
 
 	result, err := prov.Submit(ctx, submitReq)
@@ -80,13 +113,8 @@ func HandleTaskSubmit(ctx context.Context, t *asynq.Task) error {
 
 	// 7. 根据 result_mode 入队
 	if channelCapability.ResultMode == string(provider.ResultModePoll) {
-		pollPayload := TaskPollPayload{
-			TaskID:    task.ID,
-			PollCount: 0,
-		}
-		payloadBytes, _ := json.Marshal(pollPayload)
-		pollTask := asynq.NewTask(TypeTaskPoll, payloadBytes)
-		queue.Client.Enqueue(pollTask, asynq.ProcessIn(time.Duration(channelCapability.PollInterval)*time.Second))
+		schedule := service.NewPollSchedule(&channelCapability)
+		requeuePoll(task.ID, 0, time.Now().Unix(), schedule.Delay(0))
 	}
 
 	logger.Info("task submitted", zap.Uint("task_id", task.ID), zap.String("vendor_task_id", result.ProviderTaskID))
@@ -1,10 +1,12 @@
 package worker
 
+import "github.com/majingzhen/prism/internal/service"
+
 const (
 	TypeTaskSubmit = "task:submit"
 	TypeTaskPoll   = "task:poll"
 	TypeTaskUpload = "task:upload"
-	TypeTaskNotify = "task:notify"
+	TypeTaskNotify = service.TypeWebhookDeliver
 )
 
 type TaskSubmitPayload struct {
@@ -12,16 +14,16 @@ type TaskSubmitPayload struct {
 }
 
 type TaskPollPayload struct {
-	TaskID    uint `json:"task_id"`
-	PollCount int  `json:"poll_count"`
+	TaskID    uint  `json:"task_id"`
+	PollCount int   `json:"poll_count"`
+	StartedAt int64 `json:"started_at"` // 开始轮询时间，用于计算轮询总时限
 }
 
 type TaskUploadPayload struct {
 	TaskID    uint     `json:"task_id"`
 	OriginURL string   `json:"origin_url"`
 	URLs      []string `json:"urls"`
+	Usage     string   `json:"usage,omitempty"` // 实际用量，用于结算
 }
 
-type TaskNotifyPayload struct {
-	TaskID uint `json:"task_id"`
-}
+type TaskNotifyPayload = service.WebhookPayload
@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/majingzhen/prism/internal/model"
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/majingzhen/prism/pkg/logger"
+	"github.com/majingzhen/prism/pkg/money"
+	"github.com/majingzhen/prism/pkg/storage"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.L = zap.NewNop()
+	config.C = &config.Config{}
+	os.Exit(m.Run())
+}
+
+// setupTestDB 每个测试使用独立的 SQLite 数据库文件并完成表结构迁移
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=10000&_journal_mode=WAL&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	model.SetDB(db)
+	if err := model.AutoMigrate(); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	config.C = &config.Config{}
+}
+
+// memoryStorage 记录上传和删除的对象路径
+type memoryStorage struct {
+	mu       sync.Mutex
+	uploaded []string
+	deleted  []string
+}
+
+func (m *memoryStorage) Upload(ctx context.Context, reader io.Reader, path string, contentType string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploaded = append(m.uploaded, path)
+	return "https://cdn.example.com/" + path, nil
+}
+
+func (m *memoryStorage) Delete(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleted = append(m.deleted, path)
+	return nil
+}
+
+func (m *memoryStorage) GetURL(path string) string {
+	return "https://cdn.example.com/" + path
+}
+
+func (m *memoryStorage) GetSignedURL(ctx context.Context, path string, ttl time.Duration) (string, error) {
+	return "https://cdn.example.com/" + path + "?signed", nil
+}
+
+func TestHandleTaskUploadAfterTaskFinished(t *testing.T) {
+	vendor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\nimage"))
+	}))
+	defer vendor.Close()
+
+	tests := []struct {
+		name   string
+		status model.TaskStatus
+	}{
+		{name: "failed by timeout checker", status: model.TaskStatusFailed},
+		{name: "completed by callback", status: model.TaskStatusSuccess},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			store := &memoryStorage{}
+			storage.SetDefault(store)
+			t.Cleanup(func() { storage.SetDefault(nil) })
+
+			user := model.User{Username: "u1", Balance: 10 * money.Unit}
+			model.DB().Create(&user)
+			cc := model.ChannelCapability{ResponseMapping: []byte(`{"usage":{"unit_price":"1"}}`)}
+			model.DB().Create(&cc)
+			account := model.ChannelAccount{CurrentTasks: 1}
+			model.DB().Create(&account)
+			task := model.Task{
+				TaskNo:              "T1",
+				UserID:              user.ID,
+				CapabilityCode:      "image",
+				ChannelCapabilityID: cc.ID,
+				AccountID:           account.ID,
+				Status:              tt.status,
+				Cost:                4 * money.Unit,
+				Refunded:            tt.status == model.TaskStatusFailed,
+			}
+			model.DB().Create(&task)
+
+			payload, _ := json.Marshal(TaskUploadPayload{TaskID: task.ID, URLs: []string{vendor.URL + "/a.png"}, Usage: "10"})
+			if err := HandleTaskUpload(context.Background(), asynq.NewTask(TypeTaskUpload, payload)); err != nil {
+				t.Fatalf("HandleTaskUpload: %v", err)
+			}
+
+			if len(store.uploaded) != 1 || len(store.deleted) != 1 || store.deleted[0] != store.uploaded[0] {
+				t.Errorf("uploaded = %v, deleted = %v, want transferred asset deleted", store.uploaded, store.deleted)
+			}
+			var got model.Task
+			model.DB().First(&got, task.ID)
+			if got.Status != tt.status || got.Cost != task.Cost || got.SettledAt != nil || len(got.Result) != 0 {
+				t.Errorf("task = %s cost=%s settled=%v result=%s, want unchanged", got.Status, got.Cost, got.SettledAt, got.Result)
+			}
+			var entries int64
+			model.DB().Model(&model.BillingTransaction{}).Count(&entries)
+			if entries != 0 {
+				t.Errorf("billing entries = %d, want 0", entries)
+			}
+			model.DB().First(&account, account.ID)
+			if account.CurrentTasks != 1 {
+				t.Errorf("account current_tasks = %d, want 1", account.CurrentTasks)
+			}
+		})
+	}
+}
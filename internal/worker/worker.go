@@ -10,4 +10,6 @@ func RegisterHandlers(mux *asynq.ServeMux) {
 	mux.HandleFunc(TypeTaskUpload, HandleTaskUpload)
 	mux.HandleFunc(TypeTaskNotify, HandleTaskNotify)
 	mux.HandleFunc(TypeTaskTimeoutCheck, HandleTaskTimeoutCheck)
+	mux.HandleFunc(TypeAssetCleanup, HandleAssetCleanup)
+	mux.HandleFunc(TypeBillingReconcile, HandleBillingReconcile)
 }
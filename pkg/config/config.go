@@ -5,16 +5,21 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	Storage  StorageConfig  `mapstructure:"storage"`
-	Worker   WorkerConfig   `mapstructure:"worker"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	Storage   StorageConfig   `mapstructure:"storage"`
+	Worker    WorkerConfig    `mapstructure:"worker"`
+	Webhook   WebhookConfig   `mapstructure:"webhook"`
+	Files     FilesConfig     `mapstructure:"files"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Secrets   SecretsConfig   `mapstructure:"secrets"`
 }
 
 type ServerConfig struct {
 	Port      int    `mapstructure:"port"`
 	JWTSecret string `mapstructure:"jwt_secret"`
+	PublicURL string `mapstructure:"public_url"`
 }
 
 type DatabaseConfig struct {
@@ -32,8 +37,20 @@ type RedisConfig struct {
 }
 
 type StorageConfig struct {
-	Type    string           `mapstructure:"type"`
-	Tencent TencentCOSConfig `mapstructure:"tencent"`
+	Type                string             `mapstructure:"type"`
+	TransferConcurrency int                `mapstructure:"transfer_concurrency"`
+	Private             bool               `mapstructure:"private"`
+	SignedURLTTL        int                `mapstructure:"signed_url_ttl"`
+	Retention           RetentionConfig    `mapstructure:"retention"`
+	Tencent             TencentCOSConfig   `mapstructure:"tencent"`
+	Local               LocalStorageConfig `mapstructure:"local"`
+	S3                  S3Config           `mapstructure:"s3"`
+}
+
+// RetentionConfig 存储资源保留策略，天数为 0 表示永久保留
+type RetentionConfig struct {
+	DefaultDays int            `mapstructure:"default_days"`
+	Tiers       map[string]int `mapstructure:"tiers"`
 }
 
 type TencentCOSConfig struct {
@@ -44,12 +61,78 @@ type TencentCOSConfig struct {
 	CDN       string `mapstructure:"cdn"`
 }
 
+type LocalStorageConfig struct {
+	Dir        string `mapstructure:"dir"`
+	BaseURL    string `mapstructure:"base_url"`
+	SignSecret string `mapstructure:"sign_secret"`
+	URLTTL     int    `mapstructure:"url_ttl"`
+}
+
+type S3Config struct {
+	Endpoint   string `mapstructure:"endpoint"`
+	Region     string `mapstructure:"region"`
+	Bucket     string `mapstructure:"bucket"`
+	AccessKey  string `mapstructure:"access_key"`
+	SecretKey  string `mapstructure:"secret_key"`
+	PathStyle  bool   `mapstructure:"path_style"`
+	CDN        string `mapstructure:"cdn"`
+	PartSize   int    `mapstructure:"part_size"`
+	PresignGet bool   `mapstructure:"presign_get"`
+	PresignTTL int    `mapstructure:"presign_ttl"`
+}
+
 type WorkerConfig struct {
 	Concurrency  int    `mapstructure:"concurrency"`
 	PollInterval string `mapstructure:"poll_interval"`
 	MaxRetry     int    `mapstructure:"max_retry"`
 }
 
+// WebhookConfig 回调投递配置，时间单位为秒
+type WebhookConfig struct {
+	Timeout          int `mapstructure:"timeout"`
+	RetryBaseDelay   int `mapstructure:"retry_base_delay"`
+	RetryMaxDelay    int `mapstructure:"retry_max_delay"`
+	RetryHorizon     int `mapstructure:"retry_horizon"`
+	ProgressInterval int `mapstructure:"progress_interval"`
+}
+
+// FilesConfig 用户文件配置，大小单位为字节，时间单位为秒，配额为 0 表示不限制
+type FilesConfig struct {
+	MaxSize       int64 `mapstructure:"max_size"`
+	TTL           int   `mapstructure:"ttl"`
+	MaxTTL        int   `mapstructure:"max_ttl"`
+	TokenQuota    int64 `mapstructure:"token_quota"`
+	TokenMaxFiles int   `mapstructure:"token_max_files"`
+}
+
+// RateLimitConfig 令牌限流配置，按用户等级设置上限，令牌只能设置更低的值
+type RateLimitConfig struct {
+	Enabled bool                  `mapstructure:"enabled"`
+	Default RateLimits            `mapstructure:"default"`
+	Tiers   map[string]RateLimits `mapstructure:"tiers"`
+}
+
+// RateLimits 限流额度，0 表示不限制
+type RateLimits struct {
+	RPM         int `mapstructure:"rpm"`         // 每分钟请求数
+	TPM         int `mapstructure:"tpm"`         // 每分钟 chat token 数
+	Concurrency int `mapstructure:"concurrency"` // 同时进行中的任务数
+}
+
+// SecretsConfig 渠道账号密钥加密配置，主密钥为 base64 编码的 32 字节，环境变量 PRISM_MASTER_KEY 优先
+type SecretsConfig struct {
+	MasterKey   string      `mapstructure:"master_key"`
+	KeyID       string      `mapstructure:"key_id"`       // 当前主密钥标识
+	OldKeys     []MasterKey `mapstructure:"old_keys"`     // 轮换前的主密钥，仅用于解密
+	RevealUsers []string    `mapstructure:"reveal_users"` // 允许查看密钥明文的管理员用户名
+}
+
+// MasterKey 轮换前的主密钥；按列表配置，避免作为 map 键的标识被转为小写后与密文中的标识不一致
+type MasterKey struct {
+	ID  string `mapstructure:"id"`
+	Key string `mapstructure:"key"`
+}
+
 var C *Config
 
 func Load(path string) error {
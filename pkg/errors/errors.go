@@ -23,6 +23,13 @@ var (
 	ErrTaskNotFound      = New(40004, "task not found")
 	ErrNoPermission      = New(40005, "no permission to access this task")
 	ErrModelNotFound     = New(40006, "model not found")
+	ErrTokenExpired      = New(40008, "token expired")
+	ErrTokenReadOnly     = New(40009, "token is read-only")
+	ErrIPNotAllowed      = New(40010, "client ip not allowed")
+	ErrCapabilityDenied  = New(40011, "capability not allowed for this token")
+	ErrModelDenied       = New(40012, "model not allowed for this token")
+	ErrSpendLimit        = New(40013, "token spend limit exceeded")
+	ErrRateLimited       = New(40029, "rate limit exceeded")
 )
 
 // 服务端错误 5xxxx
@@ -9,6 +9,8 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,14 +20,15 @@ var client = &http.Client{
 
 // RequestDetail HTTP 请求详情
 type RequestDetail struct {
-	Method         string
-	URL            string
-	RequestHeaders map[string]string
-	RequestBody    string
-	StatusCode     int
-	ResponseBody   []byte
-	DurationMs     int64
-	Error          error
+	Method          string
+	URL             string
+	RequestHeaders  map[string]string
+	RequestBody     string
+	StatusCode      int
+	ResponseHeaders http.Header
+	ResponseBody    []byte
+	DurationMs      int64
+	Error           error
 }
 
 // DownloadResult 下载结果
@@ -37,6 +40,10 @@ type DownloadResult struct {
 
 // Download 下载文件
 func Download(ctx context.Context, url string) (*DownloadResult, error) {
+	return download(ctx, client, url)
+}
+
+func download(ctx context.Context, client *http.Client, url string) (*DownloadResult, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
@@ -145,7 +152,9 @@ func Post(ctx context.Context, reqURL string, params map[string]any, headers map
 		var buf bytes.Buffer
 		writer := multipart.NewWriter(&buf)
 		for k, v := range params {
-			writer.WriteField(k, fmt.Sprintf("%v", v))
+			if err := writeMultipartField(writer, k, v); err != nil {
+				return nil, fmt.Errorf("write multipart field %s: %w", k, err)
+			}
 		}
 		writer.Close()
 		body = &buf
@@ -190,101 +199,127 @@ func Post(ctx context.Context, reqURL string, params map[string]any, headers map
 
 // PostWithDetail 发送 POST 请求并返回详情
 func PostWithDetail(ctx context.Context, reqURL string, params map[string]any, headers map[string]string, contentType string) *RequestDetail {
-	detail := &RequestDetail{
-		Method:         http.MethodPost,
-		URL:            reqURL,
-		RequestHeaders: headers,
-	}
+	return DoWithDetail(ctx, http.MethodPost, reqURL, params, headers, contentType)
+}
 
-	var body io.Reader
-	var actualContentType string
-	var requestBodyStr string
+// GetJSONWithDetail 发送 GET 请求并返回详情
+func GetJSONWithDetail(ctx context.Context, reqURL string, headers map[string]string) *RequestDetail {
+	return DoWithDetail(ctx, http.MethodGet, reqURL, nil, headers, "")
+}
 
-	switch contentType {
-	case "application/x-www-form-urlencoded":
+// Request 待发送的 HTTP 请求
+type Request struct {
+	Method      string
+	URL         string
+	Headers     map[string]string
+	Params      map[string]any // 按 ContentType 编码为请求体，GET/HEAD/DELETE 追加到 query
+	Body        []byte         // 已编码的请求体，Params 为空时使用
+	ContentType string
+}
+
+// encode 编码请求，返回最终的 URL、请求体和 Content-Type
+func (r *Request) encode() (string, []byte, string, error) {
+	method := r.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	if r.Params == nil {
+		return r.URL, r.Body, r.ContentType, nil
+	}
+
+	switch {
+	case method == http.MethodGet || method == http.MethodHead || method == http.MethodDelete:
+		query := url.Values{}
+		for k, v := range r.Params {
+			query.Set(k, fmt.Sprintf("%v", v))
+		}
+		return AppendQuery(r.URL, query), nil, "", nil
+	case r.ContentType == "application/x-www-form-urlencoded":
 		form := url.Values{}
-		for k, v := range params {
+		for k, v := range r.Params {
 			form.Set(k, fmt.Sprintf("%v", v))
 		}
-		requestBodyStr = form.Encode()
-		body = bytes.NewBufferString(requestBodyStr)
-		actualContentType = contentType
-	case "multipart/form-data":
+		return r.URL, []byte(form.Encode()), r.ContentType, nil
+	case r.ContentType == "multipart/form-data":
 		var buf bytes.Buffer
 		writer := multipart.NewWriter(&buf)
-		for k, v := range params {
-			writer.WriteField(k, fmt.Sprintf("%v", v))
+		for k, v := range r.Params {
+			if err := writeMultipartField(writer, k, v); err != nil {
+				return r.URL, nil, "", fmt.Errorf("write multipart field %s: %w", k, err)
+			}
 		}
 		writer.Close()
-		requestBodyStr = buf.String()
-		body = bytes.NewBufferString(requestBodyStr)
-		actualContentType = writer.FormDataContentType()
+		return r.URL, buf.Bytes(), writer.FormDataContentType(), nil
 	default:
-		bodyBytes, err := json.Marshal(params)
+		bodyBytes, err := json.Marshal(r.Params)
 		if err != nil {
-			detail.Error = fmt.Errorf("marshal body: %w", err)
-			return detail
+			return r.URL, nil, "", fmt.Errorf("marshal body: %w", err)
 		}
-		requestBodyStr = string(bodyBytes)
-		body = bytes.NewReader(bodyBytes)
-		actualContentType = "application/json"
+		return r.URL, bodyBytes, "application/json", nil
 	}
+}
 
-	detail.RequestBody = requestBodyStr
+// Payload 返回将要发送的请求体，用于请求签名
+// multipart 请求每次编码的分隔符不同，不适合签名
+func (r *Request) Payload() []byte {
+	_, body, _, _ := r.encode()
+	return body
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, body)
-	if err != nil {
-		detail.Error = fmt.Errorf("create request: %w", err)
-		return detail
-	}
+// DoWithDetail 按指定方法发送请求并返回详情
+// GET/HEAD/DELETE 请求的参数追加到 query，其他方法根据 contentType 处理请求体格式
+func DoWithDetail(ctx context.Context, method, reqURL string, params map[string]any, headers map[string]string, contentType string) *RequestDetail {
+	if params == nil && method != http.MethodGet {
+		params = map[string]any{}
+	}
+	return Do(ctx, &Request{
+		Method:      method,
+		URL:         reqURL,
+		Headers:     headers,
+		Params:      params,
+		ContentType: contentType,
+	})
+}
 
-	req.Header.Set("Content-Type", actualContentType)
-	for k, v := range headers {
-		req.Header.Set(k, v)
+// Do 发送请求并返回详情
+func Do(ctx context.Context, r *Request) *RequestDetail {
+	method := r.Method
+	if method == "" {
+		method = http.MethodPost
 	}
-
-	startTime := time.Now()
-	resp, err := client.Do(req)
-	detail.DurationMs = time.Since(startTime).Milliseconds()
-
-	if err != nil {
-		detail.Error = fmt.Errorf("do request: %w", err)
-		return detail
+	detail := &RequestDetail{
+		Method:         method,
+		URL:            r.URL,
+		RequestHeaders: r.Headers,
 	}
-	defer resp.Body.Close()
-
-	detail.StatusCode = resp.StatusCode
 
-	respBody, err := io.ReadAll(resp.Body)
+	reqURL, bodyBytes, contentType, err := r.encode()
 	if err != nil {
-		detail.Error = fmt.Errorf("read response: %w", err)
+		detail.Error = err
 		return detail
 	}
-
-	detail.ResponseBody = respBody
-
-	if resp.StatusCode >= 400 {
-		detail.Error = fmt.Errorf("http error: %d, body: %s", resp.StatusCode, string(respBody))
+	detail.URL = reqURL
+	detail.RequestBody = string(bodyBytes)
+	if hasFormFile(r.Params) {
+		// 文件内容不写入日志，记录字段和文件描述
+		summary, _ := json.Marshal(r.Params)
+		detail.RequestBody = string(summary)
 	}
 
-	return detail
-}
-
-// GetJSONWithDetail 发送 GET 请求并返回详情
-func GetJSONWithDetail(ctx context.Context, reqURL string, headers map[string]string) *RequestDetail {
-	detail := &RequestDetail{
-		Method:         http.MethodGet,
-		URL:            reqURL,
-		RequestHeaders: headers,
+	var body io.Reader
+	if bodyBytes != nil {
+		body = bytes.NewReader(bodyBytes)
 	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
 	if err != nil {
 		detail.Error = fmt.Errorf("create request: %w", err)
 		return detail
 	}
 
-	for k, v := range headers {
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range r.Headers {
 		req.Header.Set(k, v)
 	}
 
@@ -299,6 +334,7 @@ func GetJSONWithDetail(ctx context.Context, reqURL string, headers map[string]st
 	defer resp.Body.Close()
 
 	detail.StatusCode = resp.StatusCode
+	detail.ResponseHeaders = resp.Header
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -315,6 +351,18 @@ func GetJSONWithDetail(ctx context.Context, reqURL string, headers map[string]st
 	return detail
 }
 
+// AppendQuery 给 URL 追加 query 参数
+func AppendQuery(rawURL string, query url.Values) string {
+	if len(query) == 0 {
+		return rawURL
+	}
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	return rawURL + sep + query.Encode()
+}
+
 // PostJSONWithDetail 发送 JSON POST 请求并返回详情
 func PostJSONWithDetail(ctx context.Context, reqURL string, body any, headers map[string]string) *RequestDetail {
 	detail := &RequestDetail{
@@ -357,6 +405,7 @@ func PostJSONWithDetail(ctx context.Context, reqURL string, body any, headers ma
 	defer resp.Body.Close()
 
 	detail.StatusCode = resp.StatusCode
+	detail.ResponseHeaders = resp.Header
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -372,3 +421,23 @@ func PostJSONWithDetail(ctx context.Context, reqURL string, body any, headers ma
 
 	return detail
 }
+
+// ParseRetryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式
+func ParseRetryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
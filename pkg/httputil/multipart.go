@@ -0,0 +1,78 @@
+package httputil
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// FormFile multipart/form-data 请求中的文件字段
+type FormFile struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// String 日志中的文件描述，不包含文件内容
+func (f *FormFile) String() string {
+	return fmt.Sprintf("[file %s %s %d bytes]", f.Filename, f.ContentType, len(f.Data))
+}
+
+// MarshalJSON 序列化为文件描述，避免文件内容写入日志或 JSON 请求体
+func (f *FormFile) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.String())
+}
+
+// writeMultipartField 写入 multipart 字段，文件字段写为带文件名和类型的文件部分
+func writeMultipartField(writer *multipart.Writer, key string, value any) error {
+	switch v := value.(type) {
+	case *FormFile:
+		return writeFormFile(writer, key, v)
+	case []*FormFile:
+		for _, f := range v {
+			if err := writeFormFile(writer, key, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return writer.WriteField(key, fmt.Sprintf("%v", value))
+	}
+}
+
+func writeFormFile(writer *multipart.Writer, key string, f *FormFile) error {
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		escapeQuotes(key), escapeQuotes(f.Filename)))
+	header.Set("Content-Type", contentType)
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(f.Data)
+	return err
+}
+
+// hasFormFile 参数中是否包含文件字段
+func hasFormFile(params map[string]any) bool {
+	for _, v := range params {
+		switch v.(type) {
+		case *FormFile, []*FormFile:
+			return true
+		}
+	}
+	return false
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,53 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "8.8.8.8", want: true},
+		{ip: "2606:4700::1111", want: true},
+		{ip: "127.0.0.1"},
+		{ip: "10.0.0.1"},
+		{ip: "172.16.5.4"},
+		{ip: "192.168.1.1"},
+		{ip: "169.254.169.254"}, // 云元数据
+		{ip: "100.64.0.1"},
+		{ip: "0.0.0.0"},
+		{ip: "::1"},
+		{ip: "fd00:ec2::254"},
+		{ip: "fe80::1"},
+		{ip: "::ffff:127.0.0.1"},
+		{ip: "64:ff9b::a00:1"},
+	}
+	for _, tt := range tests {
+		if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadPublic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	if _, err := DownloadPublic(context.Background(), server.URL); !errors.Is(err, ErrNonPublicAddress) {
+		t.Fatalf("DownloadPublic(loopback) err = %v, want ErrNonPublicAddress", err)
+	}
+	result, err := Download(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	result.Body.Close()
+}
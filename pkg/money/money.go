@@ -0,0 +1,158 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money 金额，以百万分之一为单位的定点整数，计算过程不使用浮点数
+// 数据库中统一存为 decimal(20,6)，JSON 中序列化为数字
+type Money int64
+
+// Unit 1 个计费单位对应的最小单位数
+const Unit Money = 1_000_000
+
+// FromFloat 浮点数转换为金额，四舍五入到最小单位，仅用于无法取得原始文本的输入
+func FromFloat(f float64) Money {
+	return Money(math.Round(f * float64(Unit)))
+}
+
+// Parse 解析十进制文本，超出精度的部分四舍五入（远离零）
+func Parse(s string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, fmt.Errorf("invalid money: %q", s)
+	}
+	return fromRat(r.Mul(r, big.NewRat(int64(Unit), 1)))
+}
+
+// FromAny 转换 JSON 解码后的数值或字符串
+func FromAny(v any) (Money, error) {
+	switch val := v.(type) {
+	case nil:
+		return 0, nil
+	case Money:
+		return val, nil
+	case float64:
+		return FromFloat(val), nil
+	case int:
+		return Money(val) * Unit, nil
+	case int64:
+		return Money(val) * Unit, nil
+	case json.Number:
+		return Parse(val.String())
+	case string:
+		return Parse(val)
+	default:
+		return 0, fmt.Errorf("invalid money: %v", v)
+	}
+}
+
+// MulDiv 按比例计算 m*n/d，只在最后四舍五入一次
+func (m Money) MulDiv(n, d int64) Money {
+	if d == 0 {
+		return 0
+	}
+	r := new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(n)), big.NewInt(d))
+	result, _ := fromRat(r)
+	return result
+}
+
+// MulRat 乘以有理数倍数，只在最后四舍五入一次
+func (m Money) MulRat(r *big.Rat) (Money, error) {
+	return fromRat(new(big.Rat).Mul(new(big.Rat).SetInt64(int64(m)), r))
+}
+
+// Float64 转换为浮点数，仅用于展示和比例计算
+func (m Money) Float64() float64 {
+	return float64(m) / float64(Unit)
+}
+
+// String 完整精度的十进制文本，如 1.500000
+func (m Money) String() string {
+	sign := ""
+	abs := uint64(m)
+	if m < 0 {
+		sign = "-"
+		abs = uint64(-m)
+	}
+	return fmt.Sprintf("%s%d.%06d", sign, abs/uint64(Unit), abs%uint64(Unit))
+}
+
+// Value 写入数据库时使用十进制文本，避免驱动转换为浮点数
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan 读取 decimal 列
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		parsed, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case int64:
+		*m = Money(v) * Unit
+	case float64:
+		*m = FromFloat(v)
+	default:
+		return fmt.Errorf("cannot scan %T into money", src)
+	}
+	return nil
+}
+
+// MarshalJSON 序列化为去掉末尾 0 的数字，如 1.5
+func (m Money) MarshalJSON() ([]byte, error) {
+	s := m.String()
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return []byte(s), nil
+}
+
+// UnmarshalJSON 支持数字和字符串，按原始文本精确解析
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// fromRat 四舍五入（远离零）为整数最小单位
+func fromRat(r *big.Rat) (Money, error) {
+	num, den := r.Num(), r.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("money out of range")
+	}
+	return Money(q.Int64()), nil
+}
@@ -0,0 +1,171 @@
+package money
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "1", want: Unit},
+		{in: "1.5", want: 1_500_000},
+		{in: " 0.000001 ", want: 1},
+		{in: "-2.25", want: -2_250_000},
+		{in: "0.1", want: 100_000},
+		{in: "0.0000005", want: 1},   // 半个最小单位进位
+		{in: "-0.0000005", want: -1}, // 负数远离零
+		{in: "0.00000049", want: 0},
+		{in: "1e-3", want: 1000},
+		{in: "1/3", want: 333_333},
+		{in: "abc", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "1e30", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Parse(%q) = %d, %v, want %d (err %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestFromAny(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      any
+		want    Money
+		wantErr bool
+	}{
+		{name: "nil", in: nil, want: 0},
+		{name: "money", in: Money(7), want: 7},
+		{name: "float", in: 0.1, want: 100_000},
+		{name: "int", in: 3, want: 3 * Unit},
+		{name: "int64", in: int64(-2), want: -2 * Unit},
+		{name: "json number", in: json.Number("0.123456789"), want: 123_457},
+		{name: "string", in: "12.5", want: 12_500_000},
+		{name: "bool", in: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromAny(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("FromAny(%v) = %d, %v, want %d", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want Money
+	}{
+		// 0.1 + 0.2 在整数上精确相加
+		{name: "add", got: FromFloat(0.1) + FromFloat(0.2), want: 300_000},
+		{name: "mul div exact", got: (3 * Unit).MulDiv(1, 4), want: 750_000},
+		{name: "mul div rounds once", got: Money(1).MulDiv(1, 2), want: 1},
+		{name: "mul div round down", got: Money(1).MulDiv(1, 3), want: 0},
+		{name: "mul div negative", got: Money(-1).MulDiv(1, 2), want: -1},
+		{name: "mul div zero denominator", got: Unit.MulDiv(1, 0), want: 0},
+		{name: "per thousand tokens", got: (2 * Unit).MulDiv(1500, 1000), want: 3 * Unit},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+
+	got, err := Unit.MulRat(big.NewRat(2, 3))
+	if err != nil || got != 666_667 {
+		t.Errorf("MulRat(2/3) = %d, %v, want 666667", got, err)
+	}
+	if _, err := Money(1 << 62).MulRat(big.NewRat(4, 1)); err == nil {
+		t.Error("MulRat overflow should fail")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		m        Money
+		wantStr  string
+		wantJSON string
+	}{
+		{m: 0, wantStr: "0.000000", wantJSON: "0"},
+		{m: Unit, wantStr: "1.000000", wantJSON: "1"},
+		{m: 1_500_000, wantStr: "1.500000", wantJSON: "1.5"},
+		{m: 1, wantStr: "0.000001", wantJSON: "0.000001"},
+		{m: -2_250_000, wantStr: "-2.250000", wantJSON: "-2.25"},
+		{m: 10 * Unit, wantStr: "10.000000", wantJSON: "10"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.wantStr {
+			t.Errorf("String(%d) = %q, want %q", tt.m, got, tt.wantStr)
+		}
+		data, _ := json.Marshal(tt.m)
+		if string(data) != tt.wantJSON {
+			t.Errorf("MarshalJSON(%d) = %s, want %s", tt.m, data, tt.wantJSON)
+		}
+		var back Money
+		if err := json.Unmarshal(data, &back); err != nil || back != tt.m {
+			t.Errorf("round trip %s = %d, %v", data, back, err)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: `1.25`, want: 1_250_000},
+		{in: `"1.25"`, want: 1_250_000},
+		{in: `0.1234567`, want: 123_457},
+		{in: `null`, want: 42}, // null 不修改原值
+		{in: `"x"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		m := Money(42)
+		err := json.Unmarshal([]byte(tt.in), &m)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && m != tt.want) {
+			t.Errorf("Unmarshal(%s) = %d, %v, want %d", tt.in, m, err, tt.want)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     any
+		want    Money
+		wantErr bool
+	}{
+		{name: "nil", src: nil, want: 0},
+		{name: "bytes", src: []byte("12.345678"), want: 12_345_678},
+		{name: "string", src: "0.500000", want: 500_000},
+		{name: "int64", src: int64(3), want: 3 * Unit},
+		{name: "float64", src: 1.5, want: 1_500_000},
+		{name: "bad text", src: "x", wantErr: true},
+		{name: "unsupported", src: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			err := m.Scan(tt.src)
+			if (err != nil) != tt.wantErr || m != tt.want {
+				t.Errorf("Scan(%v) = %d, %v, want %d", tt.src, m, err, tt.want)
+			}
+		})
+	}
+
+	v, err := Money(1_500_000).Value()
+	if err != nil || v != "1.500000" {
+		t.Errorf("Value = %v, %v, want 1.500000", v, err)
+	}
+}
@@ -1,12 +1,37 @@
 package queue
 
 import (
+	"sync"
+	"time"
+
 	"github.com/hibiken/asynq"
 	"github.com/majingzhen/prism/pkg/config"
 )
 
 var Client *asynq.Client
 
+var (
+	retryDelayMu    sync.RWMutex
+	retryDelayFuncs = map[string]asynq.RetryDelayFunc{}
+)
+
+// SetRetryDelay 为指定任务类型设置重试间隔函数，未设置的类型使用 asynq 默认策略
+func SetRetryDelay(taskType string, fn asynq.RetryDelayFunc) {
+	retryDelayMu.Lock()
+	defer retryDelayMu.Unlock()
+	retryDelayFuncs[taskType] = fn
+}
+
+func retryDelay(n int, err error, t *asynq.Task) time.Duration {
+	retryDelayMu.RLock()
+	fn, ok := retryDelayFuncs[t.Type()]
+	retryDelayMu.RUnlock()
+	if ok {
+		return fn(n, err, t)
+	}
+	return asynq.DefaultRetryDelayFunc(n, err, t)
+}
+
 func InitClient() error {
 	cfg := config.C.Redis
 	Client = asynq.NewClient(asynq.RedisClientOpt{
@@ -28,7 +53,8 @@ func NewServer() *asynq.Server {
 			DB:       cfg.DB,
 		},
 		asynq.Config{
-			Concurrency: workerCfg.Concurrency,
+			Concurrency:    workerCfg.Concurrency,
+			RetryDelayFunc: retryDelay,
 			Queues: map[string]int{
 				"critical": 6,
 				"default":  3,
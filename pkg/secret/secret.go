@@ -0,0 +1,255 @@
+// Package secret 敏感配置的信封加密
+//
+// 每个值使用随机生成的数据密钥 (DEK) 以 AES-256-GCM 加密，数据密钥再由主密钥 (KEK) 加密后一起保存：
+//
+//	enc:v1:<主密钥标识>:<加密后的数据密钥>:<密文>
+//
+// 轮换主密钥时只需用新主密钥重新加密数据密钥，密文不变。未配置主密钥时值按明文保存，
+// 读取时没有 enc: 前缀的值视为明文，便于从明文平滑迁移。
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/majingzhen/prism/pkg/config"
+)
+
+// EnvMasterKey 主密钥环境变量，优先于配置文件
+const EnvMasterKey = "PRISM_MASTER_KEY"
+
+const (
+	prefix   = "enc:v1:"
+	keySize  = 32
+	maskText = "****"
+)
+
+var (
+	ErrNoMasterKey = errors.New("secret: master key not configured")
+	ErrUnknownKey  = errors.New("secret: unknown master key")
+	ErrMalformed   = errors.New("secret: malformed ciphertext")
+)
+
+type keyring struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+var ring *keyring
+
+// Init 加载主密钥，未配置时不加密
+func Init() error {
+	cfg := config.C.Secrets
+	masterKey := cfg.MasterKey
+	if key := os.Getenv(EnvMasterKey); key != "" {
+		masterKey = key
+	}
+	if masterKey == "" {
+		ring = nil
+		return nil
+	}
+	keyID := cfg.KeyID
+	if keyID == "" {
+		keyID = "default"
+	}
+
+	r := &keyring{activeID: keyID, keys: make(map[string]cipher.AEAD)}
+	for _, old := range cfg.OldKeys {
+		if err := r.add(old.ID, old.Key); err != nil {
+			return err
+		}
+	}
+	if err := r.add(keyID, masterKey); err != nil {
+		return err
+	}
+	ring = r
+	return nil
+}
+
+func (r *keyring) add(id, encoded string) error {
+	if id == "" || strings.Contains(id, ":") {
+		return fmt.Errorf("secret: invalid key id %q", id)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != keySize {
+		return fmt.Errorf("secret: master key %q must be %d bytes base64", id, keySize)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	r.keys[id] = aead
+	return nil
+}
+
+// Enabled 是否配置了主密钥
+func Enabled() bool {
+	return ring != nil
+}
+
+// IsEncrypted 值是否为密文
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID 密文使用的主密钥标识，明文返回空
+func KeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id
+}
+
+// NeedsRewrap 值是否需要用当前主密钥重新加密：明文或使用了旧主密钥
+func NeedsRewrap(value string) bool {
+	return Enabled() && value != "" && KeyID(value) != ring.activeID
+}
+
+// Encrypt 加密，未配置主密钥或值为空时原样返回
+func Encrypt(plaintext string) (string, error) {
+	if !Enabled() || plaintext == "" {
+		return plaintext, nil
+	}
+
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(data, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(ring.keys[ring.activeID], dek, []byte(ring.activeID))
+	if err != nil {
+		return "", err
+	}
+	return format(ring.activeID, wrapped, ciphertext), nil
+}
+
+// Decrypt 解密，明文原样返回
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	id, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	dek, err := unwrap(id, wrapped)
+	if err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(data, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap 用当前主密钥重新加密数据密钥，密文不变；明文值直接加密
+func Rewrap(value string) (string, error) {
+	if !NeedsRewrap(value) {
+		return value, nil
+	}
+	if !IsEncrypted(value) {
+		return Encrypt(value)
+	}
+	id, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	dek, err := unwrap(id, wrapped)
+	if err != nil {
+		return "", err
+	}
+	rewrapped, err := seal(ring.keys[ring.activeID], dek, []byte(ring.activeID))
+	if err != nil {
+		return "", err
+	}
+	return format(ring.activeID, rewrapped, ciphertext), nil
+}
+
+// Mask 脱敏显示，保留首尾各 4 个字符，较短的值全部隐藏
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 12 {
+		return maskText
+	}
+	return value[:4] + maskText + value[len(value)-4:]
+}
+
+func unwrap(id string, wrapped []byte) ([]byte, error) {
+	if !Enabled() {
+		return nil, ErrNoMasterKey
+	}
+	kek, ok := ring.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	return open(kek, wrapped, []byte(id))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 加密，随机 nonce 放在密文前
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, data, additional []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, fmt.Errorf("secret: decrypt failed: %w", err)
+	}
+	return plaintext, nil
+}
+
+func format(id string, wrapped, ciphertext []byte) string {
+	return prefix + id + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext)
+}
+
+func parse(value string) (id string, wrapped, ciphertext []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+	if wrapped, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	if ciphertext, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[0], wrapped, ciphertext, nil
+}
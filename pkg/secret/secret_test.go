@@ -0,0 +1,216 @@
+package secret
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/majingzhen/prism/pkg/config"
+)
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// initRing 按配置加载主密钥，测试结束后恢复为不加密
+func initRing(t *testing.T, cfg config.SecretsConfig) {
+	t.Helper()
+	t.Setenv(EnvMasterKey, "")
+	config.C = &config.Config{Secrets: cfg}
+	if err := Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { ring = nil })
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	initRing(t, config.SecretsConfig{MasterKey: newKey(t), KeyID: "k1"})
+
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{name: "empty", plaintext: ""},
+		{name: "ascii", plaintext: "sk-0123456789abcdef"},
+		{name: "json", plaintext: `{"secret_key":"abc","region":"cn"}`},
+		{name: "unicode", plaintext: "密钥-🔑"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := Encrypt(tt.plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if tt.plaintext != "" && (!IsEncrypted(enc) || KeyID(enc) != "k1" || strings.Contains(enc, tt.plaintext)) {
+				t.Fatalf("Encrypt = %q, want enc:v1:k1 ciphertext", enc)
+			}
+			dec, err := Decrypt(enc)
+			if err != nil || dec != tt.plaintext {
+				t.Fatalf("Decrypt = %q, %v, want %q", dec, err, tt.plaintext)
+			}
+		})
+	}
+
+	// 相同明文每次使用不同的数据密钥
+	a, _ := Encrypt("same")
+	b, _ := Encrypt("same")
+	if a == b {
+		t.Error("ciphertexts of the same plaintext should differ")
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	initRing(t, config.SecretsConfig{MasterKey: newKey(t), KeyID: "k1"})
+	enc, _ := Encrypt("sk-0123456789abcdef")
+	parts := strings.Split(enc, ":")
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr error
+	}{
+		{name: "plaintext passes through", value: "plain"},
+		{name: "unknown key", value: strings.Replace(enc, ":k1:", ":k9:", 1), wantErr: ErrUnknownKey},
+		{name: "missing part", value: strings.Join(parts[:4], ":"), wantErr: ErrMalformed},
+		{name: "bad base64", value: strings.Join(append(parts[:4:4], "!!"), ":"), wantErr: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decrypt(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 篡改密文无法通过认证
+	tampered := []byte(enc)
+	tampered[len(tampered)-2] ^= 1
+	if _, err := Decrypt(string(tampered)); err == nil {
+		t.Error("tampered ciphertext decrypted")
+	}
+}
+
+func TestRotateMasterKey(t *testing.T) {
+	oldKey, newKeyValue := newKey(t), newKey(t)
+	initRing(t, config.SecretsConfig{MasterKey: oldKey, KeyID: "Key2024A"})
+	enc, err := Encrypt("sk-0123456789abcdef")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if NeedsRewrap(enc) {
+		t.Fatal("value under the active key should not need rewrap")
+	}
+
+	// 轮换：旧主密钥移到 old_keys
+	initRing(t, config.SecretsConfig{
+		MasterKey: newKeyValue,
+		KeyID:     "Key2025B",
+		OldKeys:   []config.MasterKey{{ID: "Key2024A", Key: oldKey}},
+	})
+	if !NeedsRewrap(enc) || !NeedsRewrap("plain") {
+		t.Fatal("old ciphertext and plaintext should need rewrap")
+	}
+	if dec, err := Decrypt(enc); err != nil || dec != "sk-0123456789abcdef" {
+		t.Fatalf("Decrypt with old key = %q, %v", dec, err)
+	}
+	rewrapped, err := Rewrap(enc)
+	if err != nil {
+		t.Fatalf("Rewrap: %v", err)
+	}
+	if KeyID(rewrapped) != "Key2025B" || NeedsRewrap(rewrapped) {
+		t.Fatalf("Rewrap key id = %q, want Key2025B", KeyID(rewrapped))
+	}
+	// 密文不变，只重新加密数据密钥
+	if lastPart(rewrapped) != lastPart(enc) {
+		t.Error("Rewrap should keep the data ciphertext")
+	}
+
+	// 删除旧主密钥后，重新加密过的值仍可解密，未重新加密的不行
+	initRing(t, config.SecretsConfig{MasterKey: newKeyValue, KeyID: "Key2025B"})
+	if dec, err := Decrypt(rewrapped); err != nil || dec != "sk-0123456789abcdef" {
+		t.Fatalf("Decrypt after dropping old key = %q, %v", dec, err)
+	}
+	if _, err := Decrypt(enc); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Decrypt old ciphertext err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestInitFromConfigFile(t *testing.T) {
+	oldKey, activeKey := newKey(t), newKey(t)
+	initRing(t, config.SecretsConfig{MasterKey: oldKey, KeyID: "Key2024A"})
+	enc, _ := Encrypt("sk-0123456789abcdef")
+
+	// 标识大小写需要保留，否则旧密文找不到主密钥
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := "secrets:\n" +
+		"  master_key: \"" + activeKey + "\"\n" +
+		"  key_id: \"Key2025B\"\n" +
+		"  old_keys:\n" +
+		"    - id: \"Key2024A\"\n" +
+		"      key: \"" + oldKey + "\"\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config.C = &config.Config{}
+	if err := config.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if dec, err := Decrypt(enc); err != nil || dec != "sk-0123456789abcdef" {
+		t.Fatalf("Decrypt with old key from config = %q, %v", dec, err)
+	}
+}
+
+func TestInitInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.SecretsConfig
+	}{
+		{name: "short master key", cfg: config.SecretsConfig{MasterKey: base64.StdEncoding.EncodeToString([]byte("short"))}},
+		{name: "not base64", cfg: config.SecretsConfig{MasterKey: "not base64!"}},
+		{name: "key id with colon", cfg: config.SecretsConfig{MasterKey: newKey(t), KeyID: "a:b"}},
+		{name: "old key without id", cfg: config.SecretsConfig{MasterKey: newKey(t), OldKeys: []config.MasterKey{{Key: newKey(t)}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvMasterKey, "")
+			config.C = &config.Config{Secrets: tt.cfg}
+			t.Cleanup(func() { ring = nil })
+			if err := Init(); err == nil {
+				t.Error("Init should fail")
+			}
+		})
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"short", "****"},
+		{"sk-0123456789abcdef", "sk-0****cdef"},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.value); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func lastPart(value string) string {
+	return value[strings.LastIndex(value, ":")+1:]
+}
@@ -17,6 +17,18 @@ func Init() error {
 			return fmt.Errorf("init tencent cos: %w", err)
 		}
 		SetDefault(s)
+	case "local":
+		s, err := NewLocalStorage(cfg.Local)
+		if err != nil {
+			return fmt.Errorf("init local storage: %w", err)
+		}
+		SetDefault(s)
+	case "s3":
+		s, err := NewS3Storage(cfg.S3)
+		if err != nil {
+			return fmt.Errorf("init s3 storage: %w", err)
+		}
+		SetDefault(s)
 	default:
 		return fmt.Errorf("unsupported storage type: %s", cfg.Type)
 	}
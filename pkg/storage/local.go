@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/majingzhen/prism/pkg/config"
+)
+
+// LocalFileRoute 本地存储文件访问路由前缀
+const LocalFileRoute = "/files/"
+
+// DefaultLocalURLTTL 默认签名链接有效期
+const DefaultLocalURLTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrURLExpired       = errors.New("url expired")
+	ErrInvalidPath      = errors.New("invalid path")
+)
+
+// LocalStorage 本地文件系统存储
+type LocalStorage struct {
+	dir     string
+	baseURL string
+	secret  []byte
+	urlTTL  time.Duration
+}
+
+// NewLocalStorage 创建本地文件系统存储实例
+func NewLocalStorage(cfg config.LocalStorageConfig) (*LocalStorage, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("local storage dir is required")
+	}
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve dir: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create dir: %w", err)
+	}
+
+	// 未配置签名密钥时使用 JWT 密钥
+	secret := cfg.SignSecret
+	if secret == "" {
+		secret = config.C.Server.JWTSecret
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("local storage sign_secret is required")
+	}
+
+	urlTTL := time.Duration(cfg.URLTTL) * time.Second
+	if urlTTL <= 0 {
+		urlTTL = DefaultLocalURLTTL
+	}
+
+	return &LocalStorage{
+		dir:     dir,
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		secret:  []byte(secret),
+		urlTTL:  urlTTL,
+	}, nil
+}
+
+// Upload 写入文件到本地目录
+func (l *LocalStorage) Upload(ctx context.Context, reader io.Reader, path string, contentType string) (string, error) {
+	fullPath, err := l.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return "", fmt.Errorf("create dir: %w", err)
+	}
+
+	// 先写临时文件再重命名，避免读到不完整的文件
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("close file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return "", fmt.Errorf("rename file: %w", err)
+	}
+
+	return l.GetURL(path), nil
+}
+
+// Delete 删除本地文件
+func (l *LocalStorage) Delete(ctx context.Context, path string) error {
+	fullPath, err := l.resolve(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete file: %w", err)
+	}
+	return nil
+}
+
+// GetURL 获取带签名和过期时间的访问URL
+func (l *LocalStorage) GetURL(path string) string {
+	return l.signedURL(path, l.urlTTL)
+}
+
+// URLExpires 本地存储的访问链接均带签名和过期时间
+func (l *LocalStorage) URLExpires() bool {
+	return true
+}
+
+// GetSignedURL 获取指定有效期的签名访问URL
+func (l *LocalStorage) GetSignedURL(ctx context.Context, path string, ttl time.Duration) (string, error) {
+	return l.signedURL(path, ttl), nil
+}
+
+// signedURL 生成带签名和过期时间的访问URL
+func (l *LocalStorage) signedURL(path string, ttl time.Duration) string {
+	path = strings.TrimLeft(path, "/")
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("sign", l.sign(path, expires))
+
+	return fmt.Sprintf("%s%s%s?%s", l.baseURL, LocalFileRoute, path, query.Encode())
+}
+
+// Open 校验签名后打开文件
+func (l *LocalStorage) Open(path string, expires string, sign string) (*os.File, error) {
+	path = strings.TrimLeft(path, "/")
+
+	expireAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sign), []byte(l.sign(path, expires))) {
+		return nil, ErrInvalidSignature
+	}
+	if time.Now().Unix() > expireAt {
+		return nil, ErrURLExpired
+	}
+
+	fullPath, err := l.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
+
+// sign 计算 path 与过期时间的 HMAC-SHA256 签名
+func (l *LocalStorage) sign(path string, expires string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(path + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// resolve 将存储路径转换为本地绝对路径，禁止越出存储目录
+func (l *LocalStorage) resolve(path string) (string, error) {
+	cleaned := filepath.Clean("/" + filepath.FromSlash(path))
+	if cleaned == string(filepath.Separator) {
+		return "", ErrInvalidPath
+	}
+	return filepath.Join(l.dir, cleaned), nil
+}
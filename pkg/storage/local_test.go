@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/majingzhen/prism/pkg/config"
+)
+
+func newTestLocalStorage(t *testing.T) *LocalStorage {
+	t.Helper()
+	l, err := NewLocalStorage(config.LocalStorageConfig{
+		Dir:        t.TempDir(),
+		BaseURL:    "https://prism.example.com/",
+		SignSecret: "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	return l
+}
+
+// parseSignedURL 拆出签名链接中的路径、过期时间和签名
+func parseSignedURL(t *testing.T, raw string) (path, expires, sign string) {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse url %q: %v", raw, err)
+	}
+	return strings.TrimPrefix(u.Path, LocalFileRoute), u.Query().Get("expires"), u.Query().Get("sign")
+}
+
+func TestLocalStorageUploadAndOpen(t *testing.T) {
+	l := newTestLocalStorage(t)
+	ctx := context.Background()
+
+	raw, err := l.Upload(ctx, strings.NewReader("hello"), "image/2025/a.png", "image/png")
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if !strings.HasPrefix(raw, "https://prism.example.com/files/image/2025/a.png?") {
+		t.Fatalf("unexpected url %q", raw)
+	}
+
+	path, expires, sign := parseSignedURL(t, raw)
+	f, err := l.Open(path, expires, sign)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	if string(data) != "hello" {
+		t.Fatalf("content = %q, want hello", data)
+	}
+}
+
+func TestLocalStorageOpenRejects(t *testing.T) {
+	l := newTestLocalStorage(t)
+	if _, err := l.Upload(context.Background(), strings.NewReader("x"), "a.txt", "text/plain"); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	validURL, _ := l.GetSignedURL(context.Background(), "a.txt", time.Hour)
+	path, expires, sign := parseSignedURL(t, validURL)
+
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	other := newTestLocalStorage(t)
+	other.secret = []byte("other-secret")
+
+	tests := []struct {
+		name    string
+		path    string
+		expires string
+		sign    string
+		wantErr error
+	}{
+		{"tampered sign", path, expires, strings.Repeat("0", len(sign)), ErrInvalidSignature},
+		{"other path", "b.txt", expires, sign, ErrInvalidSignature},
+		{"extended expiry", path, strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10), sign, ErrInvalidSignature},
+		{"bad expires", path, "soon", sign, ErrInvalidSignature},
+		{"expired", path, past, l.sign(path, past), ErrURLExpired},
+		{"other secret", path, expires, other.sign(path, expires), ErrInvalidSignature},
+		{"escape root", "../etc/passwd", expires, l.sign("../etc/passwd", expires), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := l.Open(tt.path, tt.expires, tt.sign)
+			if f != nil {
+				f.Close()
+			}
+			if tt.wantErr == nil {
+				// 越出目录的路径被限制在存储目录内，文件不存在
+				if err == nil {
+					t.Fatal("expected error opening path outside storage dir")
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocalStorageResolve(t *testing.T) {
+	l := newTestLocalStorage(t)
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"a/b.png", l.dir + "/a/b.png", false},
+		{"/a/b.png", l.dir + "/a/b.png", false},
+		{"../../etc/passwd", l.dir + "/etc/passwd", false},
+		{"a/../../b", l.dir + "/b", false},
+		{"/", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := l.resolve(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("resolve(%q) err = %v, wantErr %v", tt.path, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("resolve(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestURLExpires(t *testing.T) {
+	defer SetDefault(DefaultStorage)
+
+	SetDefault(newTestLocalStorage(t))
+	if !URLExpires() {
+		t.Error("local storage urls should expire")
+	}
+	SetDefault(nil)
+	if URLExpires() {
+		t.Error("no storage should not report expiring urls")
+	}
+}
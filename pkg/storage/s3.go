@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// DefaultS3PartSize 默认分片大小 (16MB)，超过该大小的文件使用分片上传
+	DefaultS3PartSize = 16 << 20
+	// DefaultS3PresignTTL 默认预签名链接有效期
+	DefaultS3PresignTTL = time.Hour
+)
+
+// S3Storage S3 兼容对象存储 (AWS S3 / MinIO / Cloudflare R2)
+type S3Storage struct {
+	client     *minio.Client
+	bucket     string
+	baseURL    string
+	cdnURL     string
+	partSize   uint64
+	presignGet bool
+	presignTTL time.Duration
+}
+
+// NewS3Storage 创建 S3 兼容存储实例
+func NewS3Storage(cfg config.S3Config) (*S3Storage, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 endpoint and bucket are required")
+	}
+
+	// endpoint 支持带协议头，如 http://127.0.0.1:9000
+	endpoint := cfg.Endpoint
+	secure := true
+	if strings.HasPrefix(endpoint, "http://") {
+		secure = false
+	}
+	endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://")
+	endpoint = strings.TrimRight(endpoint, "/")
+
+	lookup := minio.BucketLookupDNS
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       secure,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create s3 client: %w", err)
+	}
+
+	scheme := "https"
+	if !secure {
+		scheme = "http"
+	}
+	baseURL := fmt.Sprintf("%s://%s.%s", scheme, cfg.Bucket, endpoint)
+	if cfg.PathStyle {
+		baseURL = fmt.Sprintf("%s://%s/%s", scheme, endpoint, cfg.Bucket)
+	}
+	cdnURL := strings.TrimRight(cfg.CDN, "/")
+	if cdnURL == "" {
+		cdnURL = baseURL
+	}
+
+	partSize := uint64(cfg.PartSize) << 20
+	if partSize == 0 {
+		partSize = DefaultS3PartSize
+	}
+	presignTTL := time.Duration(cfg.PresignTTL) * time.Second
+	if presignTTL <= 0 {
+		presignTTL = DefaultS3PresignTTL
+	}
+
+	return &S3Storage{
+		client:     client,
+		bucket:     cfg.Bucket,
+		baseURL:    baseURL,
+		cdnURL:     cdnURL,
+		partSize:   partSize,
+		presignGet: cfg.PresignGet,
+		presignTTL: presignTTL,
+	}, nil
+}
+
+// Upload 上传文件到 S3，未知大小的流按分片上传
+func (s *S3Storage) Upload(ctx context.Context, reader io.Reader, path string, contentType string) (string, error) {
+	_, err := s.client.PutObject(ctx, s.bucket, path, reader, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s.partSize,
+	})
+	if err != nil {
+		return "", fmt.Errorf("s3 put object: %w", err)
+	}
+
+	return s.GetURL(path), nil
+}
+
+// Delete 从 S3 删除文件
+func (s *S3Storage) Delete(ctx context.Context, path string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, path, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("s3 delete object: %w", err)
+	}
+	return nil
+}
+
+// GetURL 获取文件访问URL，开启 presign_get 时返回预签名链接
+func (s *S3Storage) GetURL(path string) string {
+	if s.presignGet {
+		if u, err := s.GetSignedURL(context.Background(), path, s.presignTTL); err == nil {
+			return u
+		}
+	}
+	return fmt.Sprintf("%s/%s", s.cdnURL, path)
+}
+
+// URLExpires 开启 presign_get 时 GetURL 返回的预签名链接会过期
+func (s *S3Storage) URLExpires() bool {
+	return s.presignGet
+}
+
+// GetSignedURL 获取S3预签名下载URL
+func (s *S3Storage) GetSignedURL(ctx context.Context, path string, ttl time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, path, ttl, nil)
+	if err != nil {
+		return "", fmt.Errorf("s3 presign url: %w", err)
+	}
+	return u.String(), nil
+}
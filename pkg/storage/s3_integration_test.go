@@ -0,0 +1,112 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/majingzhen/prism/pkg/config"
+	"github.com/minio/minio-go/v7"
+)
+
+// 针对真实的 S3 兼容服务运行，例如本地 MinIO：
+//
+//	docker run -d -p 9000:9000 -e MINIO_ROOT_USER=minioadmin -e MINIO_ROOT_PASSWORD=minioadmin minio/minio server /data
+//	PRISM_S3_ENDPOINT=http://127.0.0.1:9000 go test -tags integration ./pkg/storage/
+func newIntegrationS3(t *testing.T) *S3Storage {
+	t.Helper()
+	endpoint := os.Getenv("PRISM_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("PRISM_S3_ENDPOINT not set")
+	}
+	cfg := config.S3Config{
+		Endpoint:   endpoint,
+		Region:     envOr("PRISM_S3_REGION", "us-east-1"),
+		Bucket:     envOr("PRISM_S3_BUCKET", "prism-test"),
+		AccessKey:  envOr("PRISM_S3_ACCESS_KEY", "minioadmin"),
+		SecretKey:  envOr("PRISM_S3_SECRET_KEY", "minioadmin"),
+		PathStyle:  true,
+		PartSize:   5,
+		PresignGet: true,
+		PresignTTL: 60,
+	}
+	s, err := NewS3Storage(cfg)
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+
+	ctx := context.Background()
+	exists, err := s.client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		t.Fatalf("BucketExists: %v", err)
+	}
+	if !exists {
+		if err := s.client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			t.Fatalf("MakeBucket: %v", err)
+		}
+	}
+	return s
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func TestS3IntegrationRoundTrip(t *testing.T) {
+	s := newIntegrationS3(t)
+	ctx := context.Background()
+	key := "integration/" + time.Now().Format("20060102150405.000000") + ".txt"
+
+	// 超过分片大小，走分片上传
+	body := strings.Repeat("prism", 2<<20)
+	raw, err := s.Upload(ctx, strings.NewReader(body), key, "text/plain")
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	t.Cleanup(func() { s.Delete(context.Background(), key) })
+
+	// presign_get 时上传返回的就是预签名链接
+	resp, err := http.Get(raw)
+	if err != nil {
+		t.Fatalf("get upload url: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(data) != len(body) {
+		t.Fatalf("upload url: status %d, %d bytes", resp.StatusCode, len(data))
+	}
+
+	signed, err := s.GetSignedURL(ctx, key, time.Minute)
+	if err != nil {
+		t.Fatalf("GetSignedURL: %v", err)
+	}
+	resp, err = http.Get(signed)
+	if err != nil {
+		t.Fatalf("get signed url: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("signed url status %d", resp.StatusCode)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	resp, err = http.Get(signed)
+	if err != nil {
+		t.Fatalf("get deleted object: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("deleted object status %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/majingzhen/prism/pkg/config"
+)
+
+func TestNewS3StorageEndpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        config.S3Config
+		wantURL    string
+		wantCDN    string
+		wantSecure bool
+	}{
+		{
+			name:       "aws virtual hosted",
+			cfg:        config.S3Config{Endpoint: "s3.amazonaws.com", Region: "us-east-1", Bucket: "prism"},
+			wantURL:    "https://prism.s3.amazonaws.com",
+			wantCDN:    "https://prism.s3.amazonaws.com",
+			wantSecure: true,
+		},
+		{
+			name:       "minio path style over http",
+			cfg:        config.S3Config{Endpoint: "http://127.0.0.1:9000/", Region: "us-east-1", Bucket: "prism", PathStyle: true},
+			wantURL:    "http://127.0.0.1:9000/prism",
+			wantCDN:    "http://127.0.0.1:9000/prism",
+			wantSecure: false,
+		},
+		{
+			name:       "r2 with https scheme and cdn",
+			cfg:        config.S3Config{Endpoint: "https://acc.r2.cloudflarestorage.com", Region: "auto", Bucket: "prism", PathStyle: true, CDN: "https://cdn.example.com/"},
+			wantURL:    "https://acc.r2.cloudflarestorage.com/prism",
+			wantCDN:    "https://cdn.example.com",
+			wantSecure: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewS3Storage(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewS3Storage: %v", err)
+			}
+			if s.baseURL != tt.wantURL {
+				t.Errorf("baseURL = %q, want %q", s.baseURL, tt.wantURL)
+			}
+			if s.cdnURL != tt.wantCDN {
+				t.Errorf("cdnURL = %q, want %q", s.cdnURL, tt.wantCDN)
+			}
+			if got := s.client.EndpointURL().Scheme == "https"; got != tt.wantSecure {
+				t.Errorf("secure = %v, want %v", got, tt.wantSecure)
+			}
+			if s.partSize != DefaultS3PartSize || s.presignTTL != DefaultS3PresignTTL {
+				t.Errorf("defaults not applied: part=%d ttl=%s", s.partSize, s.presignTTL)
+			}
+		})
+	}
+
+	if _, err := NewS3Storage(config.S3Config{Endpoint: "s3.amazonaws.com"}); err == nil {
+		t.Error("expected error without bucket")
+	}
+}
+
+func TestS3StorageGetURL(t *testing.T) {
+	cfg := config.S3Config{
+		Endpoint:  "http://127.0.0.1:9000",
+		Region:    "us-east-1",
+		Bucket:    "prism",
+		AccessKey: "minioadmin",
+		SecretKey: "minioadmin",
+		PathStyle: true,
+	}
+	public, err := NewS3Storage(cfg)
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	if got := public.GetURL("image/a.png"); got != "http://127.0.0.1:9000/prism/image/a.png" {
+		t.Errorf("GetURL = %q", got)
+	}
+	if public.URLExpires() {
+		t.Error("public url should not expire")
+	}
+
+	cfg.PresignGet = true
+	cfg.PresignTTL = 600
+	presigned, err := NewS3Storage(cfg)
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	if !presigned.URLExpires() {
+		t.Error("presigned url should expire")
+	}
+	u, err := url.Parse(presigned.GetURL("image/a.png"))
+	if err != nil {
+		t.Fatalf("parse presigned url: %v", err)
+	}
+	if u.Path != "/prism/image/a.png" {
+		t.Errorf("path = %q", u.Path)
+	}
+	if u.Query().Get("X-Amz-Expires") != "600" || u.Query().Get("X-Amz-Signature") == "" {
+		t.Errorf("unexpected presign query %q", u.RawQuery)
+	}
+
+	signed, err := presigned.GetSignedURL(context.Background(), "image/a.png", 5*time.Minute)
+	if err != nil || !strings.Contains(signed, "X-Amz-Expires=300") {
+		t.Errorf("GetSignedURL = %q, %v", signed, err)
+	}
+}
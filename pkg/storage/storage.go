@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"io"
+	"time"
 )
 
 // Storage 定义存储接口
@@ -13,6 +14,13 @@ type Storage interface {
 	Delete(ctx context.Context, path string) error
 	// GetURL 获取文件访问URL
 	GetURL(path string) string
+	// GetSignedURL 获取有时效的签名访问URL（用于私有存储）
+	GetSignedURL(ctx context.Context, path string, ttl time.Duration) (string, error)
+}
+
+// ExpiringURLs GetURL 返回的访问链接会过期的存储，此类链接不能持久化，只保存对象路径，读取时再生成链接
+type ExpiringURLs interface {
+	URLExpires() bool
 }
 
 var DefaultStorage Storage
@@ -36,3 +44,14 @@ func Delete(ctx context.Context, path string) error {
 func GetURL(path string) string {
 	return DefaultStorage.GetURL(path)
 }
+
+// GetSignedURL 使用默认存储获取签名URL
+func GetSignedURL(ctx context.Context, path string, ttl time.Duration) (string, error) {
+	return DefaultStorage.GetSignedURL(ctx, path, ttl)
+}
+
+// URLExpires 默认存储 GetURL 返回的链接是否会过期
+func URLExpires() bool {
+	e, ok := DefaultStorage.(ExpiringURLs)
+	return ok && e.URLExpires()
+}
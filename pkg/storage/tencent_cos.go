@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/majingzhen/prism/pkg/config"
 	"github.com/tencentyun/cos-go-sdk-v5"
@@ -13,11 +14,13 @@ import (
 
 // TencentCOS 腾讯云对象存储
 type TencentCOS struct {
-	client  *cos.Client
-	bucket  string
-	region  string
-	baseURL string
-	cdnURL  string
+	client    *cos.Client
+	bucket    string
+	region    string
+	baseURL   string
+	cdnURL    string
+	secretID  string
+	secretKey string
 }
 
 // NewTencentCOS 创建腾讯云COS存储实例
@@ -49,11 +52,13 @@ func NewTencentCOS(cfg config.TencentCOSConfig) (*TencentCOS, error) {
 	}
 
 	return &TencentCOS{
-		client:  client,
-		bucket:  cfg.Bucket,
-		region:  cfg.Region,
-		baseURL: baseURL,
-		cdnURL:  cdnURL,
+		client:    client,
+		bucket:    cfg.Bucket,
+		region:    cfg.Region,
+		baseURL:   baseURL,
+		cdnURL:    cdnURL,
+		secretID:  cfg.SecretID,
+		secretKey: cfg.SecretKey,
 	}, nil
 }
 
@@ -86,3 +91,12 @@ func (t *TencentCOS) Delete(ctx context.Context, path string) error {
 func (t *TencentCOS) GetURL(path string) string {
 	return fmt.Sprintf("%s/%s", t.cdnURL, path)
 }
+
+// GetSignedURL 获取COS预签名下载URL
+func (t *TencentCOS) GetSignedURL(ctx context.Context, path string, ttl time.Duration) (string, error) {
+	u, err := t.client.Object.GetPresignedURL(ctx, http.MethodGet, path, t.secretID, t.secretKey, ttl, nil)
+	if err != nil {
+		return "", fmt.Errorf("cos presign url: %w", err)
+	}
+	return u.String(), nil
+}